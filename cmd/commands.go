@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gorm.io/gorm"
+	"internal-transfers-system/internal/service"
+	"os"
+	"time"
+)
+
+// runCommand runs the maintenance command in args and returns the process's exit code.
+func runCommand(ctx context.Context, db *gorm.DB, args []string) int {
+	switch args[0] {
+	case "replay-ledger":
+		return replayLedger(ctx, db, args[1:])
+	case "verify-transfer-chain":
+		return verifyTransferChain(ctx, db)
+	case "backfill-transfer-chain":
+		return backfillTransferChain(ctx, db)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, the commands are: replay-ledger, verify-transfer-chain, backfill-transfer-chain\n", args[0])
+		return 2
+	}
+}
+
+// replayLedger rebuilds the accounts table from the ledger's event log in a new schema and reports how it differs
+// from the live table. It exits with 1 if there are differences.
+func replayLedger(ctx context.Context, db *gorm.DB, args []string) int {
+	flags := flag.NewFlagSet("replay-ledger", flag.ContinueOnError)
+	schema := flags.String("schema", "ledger_replay_"+time.Now().UTC().Format("20060102150405"),
+		"schema to replay into, which must not exist yet")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	replay, err := service.ReplayLedger(ctx, db, *schema)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("replayed %d events into %s.accounts (%d accounts)\n", replay.Events, replay.Schema, replay.Accounts)
+	for _, diff := range replay.Diffs {
+		if diff.Field == "account" {
+			side := "live"
+			if diff.Live == "" {
+				side = "replayed"
+			}
+			fmt.Printf("account %d: only in the %s table\n", diff.AccountID, side)
+			continue
+		}
+		fmt.Printf("account %d: %s is %s live but %s replayed\n", diff.AccountID, diff.Field, diff.Live, diff.Replayed)
+	}
+	if len(replay.Diffs) > 0 {
+		fmt.Printf("%d differences\n", len(replay.Diffs))
+		return 1
+	}
+	fmt.Println("no differences")
+	return 0
+}
+
+// verifyTransferChain walks the hash chain of transfers and reports the first break. It exits with 1 if the chain
+// is broken.
+func verifyTransferChain(ctx context.Context, db *gorm.DB) int {
+	verification, err := service.VerifyTransferChain(ctx, db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verification failed: %v\n", err)
+		return 1
+	}
+
+	if verification.Break != nil {
+		if verification.Break.TransferID != nil {
+			fmt.Printf("chain broken at %d (transfer %d): %s\n", verification.Break.Sequence, *verification.Break.TransferID, verification.Break.Reason)
+		} else {
+			fmt.Printf("chain broken at %d: %s\n", verification.Break.Sequence, verification.Break.Reason)
+		}
+		fmt.Printf("%d transfers verified before the break\n", verification.Length)
+		if verification.Unchained > 0 {
+			fmt.Printf("%d transfers are not chained, run backfill-transfer-chain to chain them\n", verification.Unchained)
+		}
+		return 1
+	}
+	fmt.Printf("%d transfers verified, head %s\n", verification.Length, verification.Head)
+	return 0
+}
+
+// backfillTransferChain chains the transfers that were booked before transfers were chained.
+func backfillTransferChain(ctx context.Context, db *gorm.DB) int {
+	chained, err := service.BackfillTransferChain(ctx, db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backfill failed after chaining %d transfers: %v\n", chained, err)
+		return 1
+	}
+	fmt.Printf("chained %d transfers\n", chained)
+	return 0
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 	"internal-transfers-system/config"
+	"internal-transfers-system/internal/apimodel"
 	"internal-transfers-system/internal/apiserver"
 	"internal-transfers-system/internal/database"
+	"internal-transfers-system/internal/service"
+	"internal-transfers-system/internal/validator"
 	"log"
+	"os"
 )
 
 func main() {
@@ -16,10 +23,85 @@ func main() {
 
 	db := database.NewDefaultDBClientOrFatal(conf)
 
+	// Maintenance commands run instead of the server
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(context.Background(), db, os.Args[1:]))
+	}
+
+	if conf.FXRatesFile != "" {
+		if err := loadFXRates(context.Background(), db, conf.FXRatesFile); err != nil {
+			log.Fatalf("failed to load FX rates: %v", err)
+		}
+	}
+	if conf.FeeSchedulesFile != "" {
+		if err := loadFeeSchedules(context.Background(), db, conf.FeeSchedulesFile); err != nil {
+			log.Fatalf("failed to load fee schedules: %v", err)
+		}
+	}
+
+	go service.RunIdempotencyKeyCleanup(context.Background(), db, conf.IdempotencyKeyTTL, conf.IdempotencyKeyCleanupInterval)
+	go service.RunHoldExpiry(context.Background(), db, conf.HoldExpiryInterval)
+	go service.RunBalanceSnapshots(context.Background(), db, conf.BalanceSnapshotInterval, conf.BalanceSnapshotDelay)
+
 	app := fiber.New()
 
-	svr := apiserver.New(db, app)
+	svr, err := apiserver.New(db, app, conf)
+	if err != nil {
+		log.Fatalf("failed to create server: %v", err)
+	}
+
+	go service.RunScheduledTransfers(context.Background(), db, svr.TransferPolicy, service.ScheduledTransferRetry{
+		MaxAttempts: conf.ScheduledTransferMaxAttempts,
+		Delay:       conf.ScheduledTransferRetryDelay,
+	}, conf.ScheduledTransferInterval)
+	go service.RunStandingOrders(context.Background(), db, svr.TransferPolicy, conf.StandingOrderRetryDelay, conf.StandingOrderInterval)
+	go service.RunWebhookDispatcher(context.Background(), db, service.WebhookPolicy{
+		Timeout:     conf.WebhookTimeout,
+		MaxAttempts: conf.WebhookMaxAttempts,
+		BackoffBase: conf.WebhookBackoffBase,
+		BackoffMax:  conf.WebhookBackoffMax,
+	}, conf.WebhookDispatchInterval)
+	go service.RunEventStream(context.Background(), db, svr.Events, conf.EventStreamPollInterval)
 
 	svr.SetupRoutes()
 	log.Fatal(svr.Start(conf.SvrAddress))
 }
+
+// loadFXRates loads the rates in path into the rate table, replacing existing rates for the same currency pairs.
+func loadFXRates(ctx context.Context, db *gorm.DB, path string) error {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var request apimodel.SetFXRatesRequest
+	if err := json.Unmarshal(file, &request); err != nil {
+		return err
+	}
+
+	rates, err := validator.ValidateSetFXRates(&request)
+	if err != nil {
+		return err
+	}
+	return service.SetFXRates(ctx, db, rates)
+}
+
+// loadFeeSchedules loads the schedules in path, replacing existing schedules for the same transfer types and
+// currencies.
+func loadFeeSchedules(ctx context.Context, db *gorm.DB, path string) error {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var request apimodel.SetFeeSchedulesRequest
+	if err := json.Unmarshal(file, &request); err != nil {
+		return err
+	}
+
+	schedules, err := validator.ValidateSetFeeSchedules(&request)
+	if err != nil {
+		return err
+	}
+	return service.SetFeeSchedules(ctx, db, schedules)
+}
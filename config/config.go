@@ -3,6 +3,7 @@ package config
 import (
 	"github.com/spf13/viper"
 	"log"
+	"time"
 )
 
 type Config struct {
@@ -12,6 +13,71 @@ type Config struct {
 	DBName     string `mapstructure:"DB_NAME"`
 	DBHost     string `mapstructure:"DB_HOST"`
 	DBPort     string `mapstructure:"DB_PORT"`
+
+	// IdempotencyKeyTTL is how long idempotency keys are kept before they are purged. A value of 0 keeps keys forever.
+	IdempotencyKeyTTL             time.Duration `mapstructure:"IDEMPOTENCY_KEY_TTL"`
+	IdempotencyKeyCleanupInterval time.Duration `mapstructure:"IDEMPOTENCY_KEY_CLEANUP_INTERVAL"`
+
+	// HoldExpiryInterval is how often holds past their expiry are marked as expired.
+	HoldExpiryInterval time.Duration `mapstructure:"HOLD_EXPIRY_INTERVAL"`
+
+	// BalanceSnapshotInterval is how often account balances are snapshotted for point-in-time balance queries. Each
+	// snapshot is of the balances BalanceSnapshotDelay ago, so that transfers still being booked are not missed.
+	BalanceSnapshotInterval time.Duration `mapstructure:"BALANCE_SNAPSHOT_INTERVAL"`
+	BalanceSnapshotDelay    time.Duration `mapstructure:"BALANCE_SNAPSHOT_DELAY"`
+
+	// FXRatesFile is an optional JSON file of FX rates loaded into the rate table on startup, in the same format as
+	// the body of PUT /admin/fx/rates.
+	FXRatesFile string `mapstructure:"FX_RATES_FILE"`
+
+	// FeeSchedulesFile is an optional JSON file of fee schedules loaded on startup, in the same format as the body of
+	// PUT /admin/fees/schedules. The revenue accounts must already exist.
+	FeeSchedulesFile string `mapstructure:"FEE_SCHEDULES_FILE"`
+
+	// The default limits on what an account can send, for accounts without limits of their own. Amounts are
+	// comma-separated <currency>:<amount> pairs, e.g. "SGD:10000,USD:7500". Currencies that are not listed, empty
+	// amounts and a zero count are not limited.
+	DefaultMaxTransferAmount   string `mapstructure:"LIMIT_MAX_TRANSFER_AMOUNT"`
+	DefaultDailyAmount         string `mapstructure:"LIMIT_DAILY_AMOUNT"`
+	DefaultRolling30DayAmount  string `mapstructure:"LIMIT_ROLLING_30_DAY_AMOUNT"`
+	DefaultHourlyTransferCount int64  `mapstructure:"LIMIT_HOURLY_TRANSFER_COUNT"`
+
+	// ScheduledTransferInterval is how often the scheduler looks for scheduled transfers that are due. A failed
+	// attempt is retried after ScheduledTransferRetryDelay, up to ScheduledTransferMaxAttempts attempts in total.
+	ScheduledTransferInterval    time.Duration `mapstructure:"SCHEDULED_TRANSFER_INTERVAL"`
+	ScheduledTransferMaxAttempts int           `mapstructure:"SCHEDULED_TRANSFER_MAX_ATTEMPTS"`
+	ScheduledTransferRetryDelay  time.Duration `mapstructure:"SCHEDULED_TRANSFER_RETRY_DELAY"`
+
+	// StandingOrderInterval is how often due standing orders are executed. Standing orders that retry on insufficient
+	// funds wait StandingOrderRetryDelay between attempts.
+	StandingOrderInterval   time.Duration `mapstructure:"STANDING_ORDER_INTERVAL"`
+	StandingOrderRetryDelay time.Duration `mapstructure:"STANDING_ORDER_RETRY_DELAY"`
+
+	// WebhookDispatchInterval is how often the outbox is fanned out to webhook subscriptions and due deliveries are
+	// sent. Each request times out after WebhookTimeout. A failed delivery is retried with exponential backoff
+	// starting at WebhookBackoffBase and capped at WebhookBackoffMax, and is dead-lettered after WebhookMaxAttempts.
+	WebhookDispatchInterval time.Duration `mapstructure:"WEBHOOK_DISPATCH_INTERVAL"`
+	WebhookTimeout          time.Duration `mapstructure:"WEBHOOK_TIMEOUT"`
+	WebhookMaxAttempts      int           `mapstructure:"WEBHOOK_MAX_ATTEMPTS"`
+	WebhookBackoffBase      time.Duration `mapstructure:"WEBHOOK_BACKOFF_BASE"`
+	WebhookBackoffMax       time.Duration `mapstructure:"WEBHOOK_BACKOFF_MAX"`
+
+	// EventStreamPollInterval is how often the outbox is checked for new events to stream, on top of the
+	// notifications sent when events are written. EventStreamHeartbeatInterval is how often idle streams get a
+	// comment, so that proxies keep them open and disconnected clients are noticed.
+	EventStreamPollInterval      time.Duration `mapstructure:"EVENT_STREAM_POLL_INTERVAL"`
+	EventStreamHeartbeatInterval time.Duration `mapstructure:"EVENT_STREAM_HEARTBEAT_INTERVAL"`
+
+	// BatchMaxSize is the most transfers a batch may have. An atomic batch locks all of its accounts until it commits,
+	// so larger batches hold more locks for longer.
+	BatchMaxSize int `mapstructure:"BATCH_MAX_SIZE"`
+
+	// ReceiptSigningKeys are the Ed25519 keys transfer receipts are signed with, as comma-separated
+	// <key id>:<base64 32-byte seed> pairs, and ReceiptSigningKeyID is the one new receipts are signed with. Keys that
+	// are rotated out should stay in the list, so that their public keys are still published and the receipts signed
+	// with them can be verified. Receipts are disabled if no keys are set.
+	ReceiptSigningKeyID string `mapstructure:"RECEIPT_SIGNING_KEY_ID"`
+	ReceiptSigningKeys  string `mapstructure:"RECEIPT_SIGNING_KEYS"`
 }
 
 func LoadConfig(configFileName string) (Config, error) {
@@ -21,6 +87,33 @@ func LoadConfig(configFileName string) (Config, error) {
 	viper.SetConfigName(configFileName)
 	viper.SetConfigType("env")
 
+	viper.SetDefault("IDEMPOTENCY_KEY_TTL", 24*time.Hour)
+	viper.SetDefault("IDEMPOTENCY_KEY_CLEANUP_INTERVAL", time.Hour)
+	viper.SetDefault("HOLD_EXPIRY_INTERVAL", time.Minute)
+	viper.SetDefault("BALANCE_SNAPSHOT_INTERVAL", time.Hour)
+	viper.SetDefault("BALANCE_SNAPSHOT_DELAY", time.Minute)
+	viper.SetDefault("FX_RATES_FILE", "")
+	viper.SetDefault("FEE_SCHEDULES_FILE", "")
+	viper.SetDefault("LIMIT_MAX_TRANSFER_AMOUNT", "")
+	viper.SetDefault("LIMIT_DAILY_AMOUNT", "")
+	viper.SetDefault("LIMIT_ROLLING_30_DAY_AMOUNT", "")
+	viper.SetDefault("LIMIT_HOURLY_TRANSFER_COUNT", 0)
+	viper.SetDefault("SCHEDULED_TRANSFER_INTERVAL", time.Minute)
+	viper.SetDefault("SCHEDULED_TRANSFER_MAX_ATTEMPTS", 3)
+	viper.SetDefault("SCHEDULED_TRANSFER_RETRY_DELAY", time.Hour)
+	viper.SetDefault("STANDING_ORDER_INTERVAL", time.Minute)
+	viper.SetDefault("STANDING_ORDER_RETRY_DELAY", time.Hour)
+	viper.SetDefault("WEBHOOK_DISPATCH_INTERVAL", 5*time.Second)
+	viper.SetDefault("WEBHOOK_TIMEOUT", 10*time.Second)
+	viper.SetDefault("WEBHOOK_MAX_ATTEMPTS", 10)
+	viper.SetDefault("WEBHOOK_BACKOFF_BASE", 30*time.Second)
+	viper.SetDefault("WEBHOOK_BACKOFF_MAX", 6*time.Hour)
+	viper.SetDefault("EVENT_STREAM_POLL_INTERVAL", 5*time.Second)
+	viper.SetDefault("EVENT_STREAM_HEARTBEAT_INTERVAL", 15*time.Second)
+	viper.SetDefault("BATCH_MAX_SIZE", 5000)
+	viper.SetDefault("RECEIPT_SIGNING_KEY_ID", "")
+	viper.SetDefault("RECEIPT_SIGNING_KEYS", "")
+
 	viper.AutomaticEnv()
 
 	if err := viper.ReadInConfig(); err != nil {
@@ -0,0 +1,100 @@
+package apimodel
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// These are the requests and filters the validator builds from the API models, and the service takes as input.
+
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+const (
+	StatementFormatJSON = "json"
+	StatementFormatCSV  = "csv"
+	StatementFormatPDF  = "pdf"
+	// StatementFormatCamt053 is an ISO 20022 camt.053 BankToCustomerStatement message
+	StatementFormatCamt053 = "camt053"
+)
+
+// TransferFilter narrows down the transfers of an account. Zero values mean "no filter".
+type TransferFilter struct {
+	AccountID   uint64
+	Direction   string
+	MinAmount   *decimal.Decimal
+	MaxAmount   *decimal.Decimal
+	CreatedFrom *time.Time // inclusive
+	CreatedTo   *time.Time // exclusive
+	Reference   string
+	ExternalID  string
+	// Description matches transfers whose description contains it, ignoring case
+	Description string
+	// Metadata is a JSON object that matches transfers whose metadata contains it
+	Metadata string
+	// Cursor is the ID of the last transfer of the previous page. Transfers are returned newest first, so the next
+	// page starts at the first ID below the cursor.
+	Cursor uint64
+	Limit  int
+}
+
+// ScheduledTransferFilter narrows down a listing of scheduled transfers. Zero values mean "no filter".
+type ScheduledTransferFilter struct {
+	// AccountID matches scheduled transfers from or to the account
+	AccountID uint64
+	Status    string
+	// Cursor is the ID of the last scheduled transfer of the previous page, see TransferFilter
+	Cursor uint64
+	Limit  int
+}
+
+// StandingOrderFilter narrows down a listing of standing orders. Zero values mean "no filter".
+type StandingOrderFilter struct {
+	// AccountID matches standing orders from or to the account
+	AccountID uint64
+	Status    string
+	// Cursor is the ID of the last standing order of the previous page, see TransferFilter
+	Cursor uint64
+	Limit  int
+}
+
+// WebhookDeliveryFilter narrows down a listing of webhook deliveries. Zero values mean "no filter".
+type WebhookDeliveryFilter struct {
+	Status         string
+	SubscriptionID uint64
+	EventID        uint64
+	// Cursor is the ID of the last delivery of the previous page, see TransferFilter
+	Cursor uint64
+	Limit  int
+}
+
+// EventStreamFilter selects the events of a stream. A zero EventStreamFilter selects every event.
+type EventStreamFilter struct {
+	AccountID uint64
+}
+
+// TransferLeg is the amount a multi-leg transfer debits from or credits to an account. The amount is positive.
+type TransferLeg struct {
+	AccountID uint64
+	Amount    decimal.Decimal
+}
+
+// MultiLegTransfer moves money from the source accounts to the destination accounts, all in the same currency. The
+// source amounts add up to the destination amounts and every account takes part in a single leg.
+type MultiLegTransfer struct {
+	Currency       string
+	Sources        []TransferLeg
+	Destinations   []TransferLeg
+	IdempotencyKey string
+}
+
+// BatchItem is a transfer of a batch. Err is set when the transfer failed validation, in which case it is not
+// attempted.
+type BatchItem struct {
+	Transfer TransferRequest
+	Amount   decimal.Decimal
+	Err      error
+}
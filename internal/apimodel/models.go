@@ -1,14 +1,986 @@
 package apimodel
 
+import (
+	"encoding/json"
+	"github.com/shopspring/decimal"
+	"internal-transfers-system/internal/model"
+	"time"
+)
+
 // These are models used at the api presentation layer. I've put them in the same file but as the project grows, we can refactor and split them out.
 
 type TransferRequest struct {
 	SourceAccountID      uint64 `json:"source_account_id"`
 	DestinationAccountID uint64 `json:"destination_account_id"`
 	Amount               string `json:"amount"`
+	Currency             string `json:"currency"`
+	// QuoteID references the FX quote a cross-currency transfer is converted with
+	QuoteID uint64 `json:"quote_id,omitempty"`
+	// IdempotencyKey is usually supplied through the Idempotency-Key header, which takes precedence over this field.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// Reference, Description and Metadata are kept with the transfer for the client's own records. Metadata must be a
+	// JSON object.
+	Reference   string          `json:"reference,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Metadata    json.RawMessage `json:"metadata,omitempty"`
+	// ExternalID is the client's own ID for the transfer, e.g. an invoice number. It must be unique among the
+	// transfers from the source account.
+	ExternalID string `json:"external_id,omitempty"`
+}
+
+// MultiLegTransferRequest moves money from one or more source accounts to one or more destination accounts. The
+// source and destination amounts must balance exactly.
+type MultiLegTransferRequest struct {
+	Currency       string               `json:"currency"`
+	Sources        []TransferLegRequest `json:"sources"`
+	Destinations   []TransferLegRequest `json:"destinations"`
+	IdempotencyKey string               `json:"idempotency_key,omitempty"`
+}
+
+type TransferLegRequest struct {
+	AccountID uint64 `json:"account_id"`
+	Amount    string `json:"amount"`
 }
 
 type CreateAccountRequest struct {
 	AccountID      uint64 `json:"account_id"`
 	InitialBalance string `json:"initial_balance"`
+	Currency       string `json:"currency"`
+}
+
+type AccountResponse struct {
+	AccountID        uint64 `json:"account_id"`
+	Balance          string `json:"balance"`
+	AvailableBalance string `json:"available_balance"`
+	Currency         string `json:"currency"`
+	Status           string `json:"status"`
+	OverdraftLimit   string `json:"overdraft_limit"`
+	// Only set when the balance is verified against the journal
+	LedgerBalance    *string `json:"ledger_balance,omitempty"`
+	LedgerConsistent *bool   `json:"ledger_consistent,omitempty"`
+}
+
+func NewAccountResponse(account *model.Account, availableBalance decimal.Decimal) AccountResponse {
+	return AccountResponse{
+		AccountID:        account.ID,
+		Balance:          account.Balance.String(),
+		AvailableBalance: availableBalance.String(),
+		Currency:         account.Currency,
+		Status:           account.Status,
+		OverdraftLimit:   account.OverdraftLimit.String(),
+	}
+}
+
+// WithLedgerBalance adds the balance derived from the account's journal entries and whether it matches the stored
+// balance.
+func (r *AccountResponse) WithLedgerBalance(account *model.Account, ledgerBalance decimal.Decimal) {
+	balance := ledgerBalance.String()
+	consistent := ledgerBalance.Equal(account.Balance)
+	r.LedgerBalance = &balance
+	r.LedgerConsistent = &consistent
+}
+
+// AccountBalanceResponse is the balance of an account at a point in time, derived from its postings.
+type AccountBalanceResponse struct {
+	AccountID uint64    `json:"account_id"`
+	Currency  string    `json:"currency"`
+	Balance   string    `json:"balance"`
+	AsOf      time.Time `json:"as_of"`
+}
+
+// StatementQuery holds the query string of an account statement.
+type StatementQuery struct {
+	From   string `query:"from"`
+	To     string `query:"to"`
+	Format string `query:"format"`
+}
+
+// StatementResponse is an account statement. Every format is rendered from it, so they all show the same values.
+type StatementResponse struct {
+	AccountID      uint64                  `json:"account_id"`
+	Currency       string                  `json:"currency"`
+	From           time.Time               `json:"from"`
+	To             time.Time               `json:"to"`
+	OpeningBalance string                  `json:"opening_balance"`
+	ClosingBalance string                  `json:"closing_balance"`
+	Lines          []StatementLineResponse `json:"lines"`
+}
+
+type StatementLineResponse struct {
+	Date                  time.Time `json:"date"`
+	Type                  string    `json:"type"`
+	TransferID            uint64    `json:"transfer_id,omitempty"`
+	CounterpartyAccountID uint64    `json:"counterparty_account_id,omitempty"`
+	Reference             string    `json:"reference,omitempty"`
+	Description           string    `json:"description,omitempty"`
+	Amount                string    `json:"amount"`
+	Balance               string    `json:"balance"`
+}
+
+func NewStatementResponse(statement *model.Statement) StatementResponse {
+	response := StatementResponse{
+		AccountID:      statement.Account.ID,
+		Currency:       statement.Account.Currency,
+		From:           statement.From,
+		To:             statement.To,
+		OpeningBalance: statement.OpeningBalance.String(),
+		ClosingBalance: statement.ClosingBalance.String(),
+		Lines:          make([]StatementLineResponse, 0, len(statement.Lines)),
+	}
+	for _, line := range statement.Lines {
+		lineResponse := StatementLineResponse{
+			Date:        line.Date,
+			Type:        line.Type,
+			Reference:   line.Reference,
+			Description: line.Description,
+			Amount:      line.Amount.String(),
+			Balance:     line.Balance.String(),
+		}
+		if line.TransferID != nil {
+			lineResponse.TransferID = *line.TransferID
+		}
+		if line.CounterpartyAccountID != nil {
+			lineResponse.CounterpartyAccountID = *line.CounterpartyAccountID
+		}
+		response.Lines = append(response.Lines, lineResponse)
+	}
+	return response
+}
+
+// ListTransfersQuery holds the query string filters of an account's transfer listing.
+type ListTransfersQuery struct {
+	Direction   string `query:"direction"`
+	MinAmount   string `query:"min_amount"`
+	MaxAmount   string `query:"max_amount"`
+	CreatedFrom string `query:"created_from"`
+	CreatedTo   string `query:"created_to"`
+	Reference   string `query:"reference"`
+	ExternalID  string `query:"external_id"`
+	// Description matches transfers whose description contains it, ignoring case
+	Description string `query:"description"`
+	// Metadata is a JSON object that matches transfers whose metadata contains it
+	Metadata string `query:"metadata"`
+	Cursor   string `query:"cursor"`
+	Limit    int    `query:"limit"`
+}
+
+type TransferResponse struct {
+	ID uint64 `json:"id"`
+	// The source and destination are not set on multi-leg transfers, which list their accounts in Legs instead
+	SourceAccountID      uint64                `json:"source_account_id,omitempty"`
+	DestinationAccountID uint64                `json:"destination_account_id,omitempty"`
+	Amount               string                `json:"amount"`
+	Currency             string                `json:"currency"`
+	SourceBalance        string                `json:"source_balance,omitempty"`
+	DestinationAmount    string                `json:"destination_amount"`
+	DestinationCurrency  string                `json:"destination_currency"`
+	CreatedAt            time.Time             `json:"created_at"`
+	ReversalOf           *uint64               `json:"reversal_of,omitempty"`
+	BatchID              *uint64               `json:"batch_id,omitempty"`
+	Legs                 []TransferLegResponse `json:"legs,omitempty"`
+	Reference            string                `json:"reference,omitempty"`
+	Description          string                `json:"description,omitempty"`
+	Metadata             json.RawMessage       `json:"metadata,omitempty"`
+	ExternalID           *string               `json:"external_id,omitempty"`
+	// Only set on cross-currency transfers
+	FXRate               string  `json:"fx_rate,omitempty"`
+	FXRoundingAdjustment string  `json:"fx_rounding_adjustment,omitempty"`
+	QuoteID              *uint64 `json:"quote_id,omitempty"`
+	// Only set on transfers that were charged a fee
+	Fee          string  `json:"fee,omitempty"`
+	FeeAccountID *uint64 `json:"fee_account_id,omitempty"`
+	// Only set when the reversals of the transfer have been loaded
+	ReversedAmount string             `json:"reversed_amount,omitempty"`
+	Reversals      []TransferResponse `json:"reversals,omitempty"`
+}
+
+func NewTransferResponse(transfer *model.Transfer) TransferResponse {
+	response := TransferResponse{
+		ID:                  transfer.ID,
+		Amount:              transfer.Amount.String(),
+		Currency:            transfer.Currency,
+		DestinationAmount:   transfer.DestinationAmount.String(),
+		DestinationCurrency: transfer.DestinationCurrency,
+		CreatedAt:           transfer.CreatedAt,
+		ReversalOf:          transfer.ReversalOfID,
+		BatchID:             transfer.BatchID,
+		QuoteID:             transfer.FXQuoteID,
+		Reference:           transfer.Reference,
+		Description:         transfer.Description,
+		Metadata:            json.RawMessage(transfer.Metadata),
+		ExternalID:          transfer.ExternalID,
+	}
+	if transfer.SourceAccountID != nil {
+		response.SourceAccountID = *transfer.SourceAccountID
+		response.DestinationAccountID = *transfer.DestinationAccountID
+	}
+	if transfer.SourceBalanceAfter.Valid {
+		response.SourceBalance = transfer.SourceBalanceAfter.Decimal.String()
+	}
+	for i := range transfer.Legs {
+		response.Legs = append(response.Legs, NewTransferLegResponse(&transfer.Legs[i]))
+	}
+	if transfer.FXRate.Valid {
+		response.FXRate = transfer.FXRate.Decimal.String()
+		response.FXRoundingAdjustment = transfer.FXRoundingAdjustment.Decimal.String()
+	}
+	if transfer.FeeAmount.Valid {
+		response.Fee = transfer.FeeAmount.Decimal.String()
+		response.FeeAccountID = transfer.FeeAccountID
+	}
+
+	if transfer.Reversals != nil {
+		reversed := decimal.Zero
+		response.Reversals = make([]TransferResponse, 0, len(transfer.Reversals))
+		for i := range transfer.Reversals {
+			// The destination amount of a reversal is in the currency of the original transfer
+			reversed = reversed.Add(transfer.Reversals[i].DestinationAmount)
+			response.Reversals = append(response.Reversals, NewTransferResponse(&transfer.Reversals[i]))
+		}
+		response.ReversedAmount = reversed.String()
+	}
+
+	return response
+}
+
+const (
+	TransferLegDebit  = "debit"
+	TransferLegCredit = "credit"
+)
+
+// TransferLegResponse describes a leg of a multi-leg transfer. Amount is always positive and Direction says whether
+// it was debited from or credited to the account.
+type TransferLegResponse struct {
+	AccountID    uint64 `json:"account_id"`
+	Direction    string `json:"direction"`
+	Amount       string `json:"amount"`
+	BalanceAfter string `json:"balance_after"`
+}
+
+func NewTransferLegResponse(leg *model.TransferLeg) TransferLegResponse {
+	direction := TransferLegCredit
+	if leg.Amount.IsNegative() {
+		direction = TransferLegDebit
+	}
+	return TransferLegResponse{
+		AccountID:    leg.AccountID,
+		Direction:    direction,
+		Amount:       leg.Amount.Abs().String(),
+		BalanceAfter: leg.BalanceAfter.String(),
+	}
+}
+
+type ReverseTransferRequest struct {
+	// Amount defaults to whatever has not been reversed yet when not set
+	Amount string `json:"amount"`
+}
+
+type TransferListResponse struct {
+	Transfers  []TransferResponse `json:"transfers"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+type BatchTransferRequest struct {
+	Mode      string            `json:"mode"`
+	Transfers []TransferRequest `json:"transfers"`
+}
+
+// ErrorResponse is the body of an error response, and describes a failed transfer in a batch response.
+type ErrorResponse struct {
+	Error   string            `json:"error"`
+	Code    string            `json:"code,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+const (
+	BatchTransferSucceeded = "succeeded"
+	BatchTransferFailed    = "failed"
+)
+
+// BatchTransferResult is the outcome of a transfer of a batch.
+type BatchTransferResult struct {
+	Index    int               `json:"index"`
+	Status   string            `json:"status"`
+	Transfer *TransferResponse `json:"transfer,omitempty"`
+	Error    *ErrorResponse    `json:"error,omitempty"`
+}
+
+type BatchTransferResponse struct {
+	BatchID uint64                `json:"batch_id"`
+	Mode    string                `json:"mode"`
+	Results []BatchTransferResult `json:"results"`
+}
+
+type CreateHoldRequest struct {
+	AccountID            uint64 `json:"account_id"`
+	DestinationAccountID uint64 `json:"destination_account_id"`
+	Amount               string `json:"amount"`
+	Currency             string `json:"currency"`
+	// ExpiresInSeconds defaults to 7 days when not set
+	ExpiresInSeconds int64 `json:"expires_in_seconds"`
+}
+
+type CaptureHoldRequest struct {
+	// Amount defaults to the full held amount when not set
+	Amount string `json:"amount"`
+}
+
+type HoldResponse struct {
+	ID                   uint64    `json:"id"`
+	AccountID            uint64    `json:"account_id"`
+	DestinationAccountID uint64    `json:"destination_account_id"`
+	Amount               string    `json:"amount"`
+	Currency             string    `json:"currency"`
+	Status               string    `json:"status"`
+	ExpiresAt            time.Time `json:"expires_at"`
+	CapturedAmount       string    `json:"captured_amount,omitempty"`
+	TransferID           *uint64   `json:"transfer_id,omitempty"`
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+func NewHoldResponse(hold *model.Hold) HoldResponse {
+	response := HoldResponse{
+		ID:                   hold.ID,
+		AccountID:            hold.AccountID,
+		DestinationAccountID: hold.DestinationAccountID,
+		Amount:               hold.Amount.String(),
+		Currency:             hold.Currency,
+		Status:               hold.Status,
+		ExpiresAt:            hold.ExpiresAt,
+		TransferID:           hold.TransferID,
+		CreatedAt:            hold.CreatedAt,
+	}
+	if hold.CapturedAmount.Valid {
+		response.CapturedAmount = hold.CapturedAmount.Decimal.String()
+	}
+	return response
+}
+
+type FXRateRequest struct {
+	BaseCurrency  string `json:"base_currency"`
+	QuoteCurrency string `json:"quote_currency"`
+	// Rate is the number of units of the quote currency that one unit of the base currency buys
+	Rate string `json:"rate"`
+}
+
+type SetFXRatesRequest struct {
+	Rates []FXRateRequest `json:"rates"`
+}
+
+type FXRateResponse struct {
+	BaseCurrency  string    `json:"base_currency"`
+	QuoteCurrency string    `json:"quote_currency"`
+	Rate          string    `json:"rate"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type FXRateListResponse struct {
+	Rates []FXRateResponse `json:"rates"`
+}
+
+func NewFXRateListResponse(rates []model.FXRate) FXRateListResponse {
+	response := FXRateListResponse{Rates: make([]FXRateResponse, 0, len(rates))}
+	for _, rate := range rates {
+		response.Rates = append(response.Rates, FXRateResponse{
+			BaseCurrency:  rate.BaseCurrency,
+			QuoteCurrency: rate.QuoteCurrency,
+			Rate:          rate.Rate.String(),
+			UpdatedAt:     rate.UpdatedAt,
+		})
+	}
+	return response
+}
+
+type CreateFXQuoteRequest struct {
+	SourceCurrency      string `json:"source_currency"`
+	DestinationCurrency string `json:"destination_currency"`
+	SourceAmount        string `json:"source_amount"`
+	// ExpiresInSeconds defaults to 30 seconds when not set
+	ExpiresInSeconds int64 `json:"expires_in_seconds"`
+}
+
+type FXQuoteResponse struct {
+	ID                  uint64    `json:"id"`
+	SourceCurrency      string    `json:"source_currency"`
+	DestinationCurrency string    `json:"destination_currency"`
+	SourceAmount        string    `json:"source_amount"`
+	DestinationAmount   string    `json:"destination_amount"`
+	Rate                string    `json:"rate"`
+	RoundingAdjustment  string    `json:"rounding_adjustment"`
+	ExpiresAt           time.Time `json:"expires_at"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+func NewFXQuoteResponse(quote *model.FXQuote) FXQuoteResponse {
+	return FXQuoteResponse{
+		ID:                  quote.ID,
+		SourceCurrency:      quote.SourceCurrency,
+		DestinationCurrency: quote.DestinationCurrency,
+		SourceAmount:        quote.SourceAmount.String(),
+		DestinationAmount:   quote.DestinationAmount.String(),
+		Rate:                quote.Rate.String(),
+		RoundingAdjustment:  quote.RoundingAdjustment.String(),
+		ExpiresAt:           quote.ExpiresAt,
+		CreatedAt:           quote.CreatedAt,
+	}
+}
+
+type FeeTierRequest struct {
+	// UpTo is the largest amount the tier applies to. It is left out on the last tier.
+	UpTo   string `json:"up_to,omitempty"`
+	Amount string `json:"amount"`
+}
+
+// FeeScheduleRequest sets the fee of a transfer type in a currency. Which of the amount fields are used depends on
+// the type: flat_amount for flat fees, percentage with optional min_amount and max_amount for percentage fees, and
+// tiers for tiered fees.
+type FeeScheduleRequest struct {
+	TransferType     string           `json:"transfer_type"`
+	Currency         string           `json:"currency"`
+	Type             string           `json:"type"`
+	RevenueAccountID uint64           `json:"revenue_account_id"`
+	FlatAmount       string           `json:"flat_amount,omitempty"`
+	Percentage       string           `json:"percentage,omitempty"`
+	MinAmount        string           `json:"min_amount,omitempty"`
+	MaxAmount        string           `json:"max_amount,omitempty"`
+	Tiers            []FeeTierRequest `json:"tiers,omitempty"`
+}
+
+type SetFeeSchedulesRequest struct {
+	Schedules []FeeScheduleRequest `json:"schedules"`
+}
+
+type FeeTierResponse struct {
+	UpTo   string `json:"up_to,omitempty"`
+	Amount string `json:"amount"`
+}
+
+type FeeScheduleResponse struct {
+	TransferType     string            `json:"transfer_type"`
+	Currency         string            `json:"currency"`
+	Type             string            `json:"type"`
+	RevenueAccountID uint64            `json:"revenue_account_id"`
+	FlatAmount       string            `json:"flat_amount,omitempty"`
+	Percentage       string            `json:"percentage,omitempty"`
+	MinAmount        string            `json:"min_amount,omitempty"`
+	MaxAmount        string            `json:"max_amount,omitempty"`
+	Tiers            []FeeTierResponse `json:"tiers,omitempty"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+}
+
+func NewFeeScheduleResponse(schedule *model.FeeSchedule) FeeScheduleResponse {
+	response := FeeScheduleResponse{
+		TransferType:     schedule.TransferType,
+		Currency:         schedule.Currency,
+		Type:             schedule.Type,
+		RevenueAccountID: schedule.RevenueAccountID,
+		UpdatedAt:        schedule.UpdatedAt,
+	}
+	if schedule.FlatAmount.Valid {
+		response.FlatAmount = schedule.FlatAmount.Decimal.String()
+	}
+	if schedule.Percentage.Valid {
+		response.Percentage = schedule.Percentage.Decimal.String()
+	}
+	if schedule.MinAmount.Valid {
+		response.MinAmount = schedule.MinAmount.Decimal.String()
+	}
+	if schedule.MaxAmount.Valid {
+		response.MaxAmount = schedule.MaxAmount.Decimal.String()
+	}
+	for _, tier := range schedule.Tiers {
+		tierResponse := FeeTierResponse{Amount: tier.Amount.String()}
+		if tier.UpTo.Valid {
+			tierResponse.UpTo = tier.UpTo.Decimal.String()
+		}
+		response.Tiers = append(response.Tiers, tierResponse)
+	}
+	return response
+}
+
+type FeeScheduleListResponse struct {
+	Schedules []FeeScheduleResponse `json:"schedules"`
+}
+
+func NewFeeScheduleListResponse(schedules []model.FeeSchedule) FeeScheduleListResponse {
+	response := FeeScheduleListResponse{Schedules: make([]FeeScheduleResponse, 0, len(schedules))}
+	for i := range schedules {
+		response.Schedules = append(response.Schedules, NewFeeScheduleResponse(&schedules[i]))
+	}
+	return response
+}
+
+// FeeQuoteQuery holds the query string of a fee quote. TransferType defaults to standard.
+type FeeQuoteQuery struct {
+	TransferType string `query:"transfer_type"`
+	Currency     string `query:"currency"`
+	Amount       string `query:"amount"`
+}
+
+type FeeQuoteResponse struct {
+	TransferType string `json:"transfer_type"`
+	Currency     string `json:"currency"`
+	Amount       string `json:"amount"`
+	Fee          string `json:"fee"`
+	// Total is what the source account is debited, the amount plus the fee
+	Total string `json:"total"`
+	// FeeType is not set when no fee schedule applies
+	FeeType string `json:"fee_type,omitempty"`
+}
+
+// NewFeeQuoteResponse describes the fee charged on a transfer of amount under schedule, which is nil when no schedule
+// applies.
+func NewFeeQuoteResponse(transferType, currency string, amount, fee decimal.Decimal, schedule *model.FeeSchedule) FeeQuoteResponse {
+	response := FeeQuoteResponse{
+		TransferType: transferType,
+		Currency:     currency,
+		Amount:       amount.String(),
+		Fee:          fee.String(),
+		Total:        amount.Add(fee).String(),
+	}
+	if schedule != nil {
+		response.FeeType = schedule.Type
+	}
+	return response
+}
+
+type ChangeAccountStatusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+type AccountStatusChangeResponse struct {
+	ID         uint64    `json:"id"`
+	AccountID  uint64    `json:"account_id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func NewAccountStatusChangeResponse(change *model.AccountStatusChange) AccountStatusChangeResponse {
+	return AccountStatusChangeResponse{
+		ID:         change.ID,
+		AccountID:  change.AccountID,
+		FromStatus: change.FromStatus,
+		ToStatus:   change.ToStatus,
+		Reason:     change.Reason,
+		CreatedAt:  change.CreatedAt,
+	}
+}
+
+type AccountStatusChangeListResponse struct {
+	Changes []AccountStatusChangeResponse `json:"changes"`
+}
+
+type SetOverdraftLimitRequest struct {
+	OverdraftLimit string `json:"overdraft_limit"`
+}
+
+// AccountLimitsRequest sets an account's own limits. Limits that are left out fall back to the defaults.
+type AccountLimitsRequest struct {
+	MaxTransferAmount  string `json:"max_transfer_amount,omitempty"`
+	DailyAmount        string `json:"daily_amount,omitempty"`
+	Rolling30DayAmount string `json:"rolling_30_day_amount,omitempty"`
+	HourlyCount        *int64 `json:"hourly_count,omitempty"`
+}
+
+// LimitsResponse leaves out limits that are not set.
+type LimitsResponse struct {
+	MaxTransferAmount  string `json:"max_transfer_amount,omitempty"`
+	DailyAmount        string `json:"daily_amount,omitempty"`
+	Rolling30DayAmount string `json:"rolling_30_day_amount,omitempty"`
+	HourlyCount        *int64 `json:"hourly_count,omitempty"`
+}
+
+func NewLimitsResponse(maxTransferAmount, dailyAmount, rolling30DayAmount decimal.NullDecimal, hourlyCount *int64) LimitsResponse {
+	response := LimitsResponse{HourlyCount: hourlyCount}
+	if maxTransferAmount.Valid {
+		response.MaxTransferAmount = maxTransferAmount.Decimal.String()
+	}
+	if dailyAmount.Valid {
+		response.DailyAmount = dailyAmount.Decimal.String()
+	}
+	if rolling30DayAmount.Valid {
+		response.Rolling30DayAmount = rolling30DayAmount.Decimal.String()
+	}
+	return response
+}
+
+type AccountLimitsResponse struct {
+	AccountID uint64 `json:"account_id"`
+	// Effective are the limits that apply to the account, i.e. its own limits with the defaults filled in
+	Effective LimitsResponse `json:"effective"`
+	// Overrides are the account's own limits. Not set if the account only has the defaults.
+	Overrides *LimitsResponse `json:"overrides,omitempty"`
+}
+
+type CreateScheduledTransferRequest struct {
+	SourceAccountID      uint64 `json:"source_account_id"`
+	DestinationAccountID uint64 `json:"destination_account_id"`
+	Amount               string `json:"amount"`
+	Currency             string `json:"currency"`
+	// ExecuteAt is an RFC 3339 timestamp in the future
+	ExecuteAt string `json:"execute_at"`
+}
+
+// ListScheduledTransfersQuery holds the query string filters of the scheduled transfer listing.
+type ListScheduledTransfersQuery struct {
+	AccountID uint64 `query:"account_id"`
+	Status    string `query:"status"`
+	Cursor    string `query:"cursor"`
+	Limit     int    `query:"limit"`
+}
+
+type ScheduledTransferAttemptResponse struct {
+	ID         uint64    `json:"id"`
+	Status     string    `json:"status"`
+	TransferID *uint64   `json:"transfer_id,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type ScheduledTransferResponse struct {
+	ID                   uint64    `json:"id"`
+	SourceAccountID      uint64    `json:"source_account_id"`
+	DestinationAccountID uint64    `json:"destination_account_id"`
+	Amount               string    `json:"amount"`
+	Currency             string    `json:"currency"`
+	Status               string    `json:"status"`
+	ExecuteAt            time.Time `json:"execute_at"`
+	// NextAttemptAt is only set while the transfer is pending
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	AttemptCount  int        `json:"attempt_count"`
+	TransferID    *uint64    `json:"transfer_id,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	// Only set when the attempts of the scheduled transfer have been loaded
+	Attempts []ScheduledTransferAttemptResponse `json:"attempts,omitempty"`
+}
+
+func NewScheduledTransferResponse(scheduled *model.ScheduledTransfer) ScheduledTransferResponse {
+	response := ScheduledTransferResponse{
+		ID:                   scheduled.ID,
+		SourceAccountID:      scheduled.SourceAccountID,
+		DestinationAccountID: scheduled.DestinationAccountID,
+		Amount:               scheduled.Amount.String(),
+		Currency:             scheduled.Currency,
+		Status:               scheduled.Status,
+		ExecuteAt:            scheduled.ExecuteAt,
+		AttemptCount:         scheduled.AttemptCount,
+		TransferID:           scheduled.TransferID,
+		CreatedAt:            scheduled.CreatedAt,
+	}
+	if scheduled.Status == model.ScheduledTransferStatusPending {
+		response.NextAttemptAt = &scheduled.NextAttemptAt
+	}
+
+	if scheduled.Attempts != nil {
+		response.Attempts = make([]ScheduledTransferAttemptResponse, 0, len(scheduled.Attempts))
+		for _, attempt := range scheduled.Attempts {
+			response.Attempts = append(response.Attempts, ScheduledTransferAttemptResponse{
+				ID:         attempt.ID,
+				Status:     attempt.Status,
+				TransferID: attempt.TransferID,
+				Error:      attempt.Error,
+				CreatedAt:  attempt.CreatedAt,
+			})
+		}
+	}
+	return response
+}
+
+type ScheduledTransferListResponse struct {
+	ScheduledTransfers []ScheduledTransferResponse `json:"scheduled_transfers"`
+	NextCursor         string                      `json:"next_cursor,omitempty"`
+}
+
+type CreateStandingOrderRequest struct {
+	SourceAccountID      uint64 `json:"source_account_id"`
+	DestinationAccountID uint64 `json:"destination_account_id"`
+	Amount               string `json:"amount"`
+	Currency             string `json:"currency"`
+	// Frequency is weekly, monthly or cron. Weekly and monthly orders recur on start_at's weekday or day of the
+	// month, at its time of day.
+	Frequency      string `json:"frequency"`
+	CronExpression string `json:"cron_expression,omitempty"`
+	// StartAt and EndAt are RFC 3339 timestamps. EndAt is optional.
+	StartAt        string `json:"start_at"`
+	EndAt          string `json:"end_at,omitempty"`
+	MaxOccurrences *int   `json:"max_occurrences,omitempty"`
+	// OnInsufficientFunds is skip (the default), retry or suspend. RetryCount is only used with retry.
+	OnInsufficientFunds string `json:"on_insufficient_funds,omitempty"`
+	RetryCount          int    `json:"retry_count,omitempty"`
+	// MissedOccurrences is skip (the default) or catch_up
+	MissedOccurrences string `json:"missed_occurrences,omitempty"`
+}
+
+// ListStandingOrdersQuery holds the query string filters of the standing order listing.
+type ListStandingOrdersQuery struct {
+	AccountID uint64 `query:"account_id"`
+	Status    string `query:"status"`
+	Cursor    string `query:"cursor"`
+	Limit     int    `query:"limit"`
+}
+
+// PageQuery holds the query string of a listing without filters.
+type PageQuery struct {
+	Cursor string `query:"cursor"`
+	Limit  int    `query:"limit"`
+}
+
+type StandingOrderResponse struct {
+	ID                   uint64     `json:"id"`
+	SourceAccountID      uint64     `json:"source_account_id"`
+	DestinationAccountID uint64     `json:"destination_account_id"`
+	Amount               string     `json:"amount"`
+	Currency             string     `json:"currency"`
+	Frequency            string     `json:"frequency"`
+	CronExpression       string     `json:"cron_expression,omitempty"`
+	StartAt              time.Time  `json:"start_at"`
+	EndAt                *time.Time `json:"end_at,omitempty"`
+	MaxOccurrences       *int       `json:"max_occurrences,omitempty"`
+	OnInsufficientFunds  string     `json:"on_insufficient_funds"`
+	RetryCount           int        `json:"retry_count"`
+	MissedOccurrences    string     `json:"missed_occurrences"`
+	Status               string     `json:"status"`
+	// NextRunAt and NextAttemptAt are only set while the order is active or suspended
+	NextRunAt       *time.Time `json:"next_run_at,omitempty"`
+	NextAttemptAt   *time.Time `json:"next_attempt_at,omitempty"`
+	OccurrenceCount int        `json:"occurrence_count"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+func NewStandingOrderResponse(order *model.StandingOrder) StandingOrderResponse {
+	response := StandingOrderResponse{
+		ID:                   order.ID,
+		SourceAccountID:      order.SourceAccountID,
+		DestinationAccountID: order.DestinationAccountID,
+		Amount:               order.Amount.String(),
+		Currency:             order.Currency,
+		Frequency:            order.Frequency,
+		CronExpression:       order.CronExpression,
+		StartAt:              order.StartAt,
+		EndAt:                order.EndAt,
+		MaxOccurrences:       order.MaxOccurrences,
+		OnInsufficientFunds:  order.OnInsufficientFunds,
+		RetryCount:           order.RetryCount,
+		MissedOccurrences:    order.MissedOccurrences,
+		Status:               order.Status,
+		OccurrenceCount:      order.OccurrenceCount,
+		CreatedAt:            order.CreatedAt,
+	}
+	if order.Status == model.StandingOrderStatusActive || order.Status == model.StandingOrderStatusSuspended {
+		response.NextRunAt = &order.NextRunAt
+		response.NextAttemptAt = &order.NextAttemptAt
+	}
+	return response
+}
+
+type StandingOrderListResponse struct {
+	StandingOrders []StandingOrderResponse `json:"standing_orders"`
+	NextCursor     string                  `json:"next_cursor,omitempty"`
+}
+
+type StandingOrderExecutionResponse struct {
+	ID           uint64    `json:"id"`
+	OccurrenceAt time.Time `json:"occurrence_at"`
+	Status       string    `json:"status"`
+	TransferID   *uint64   `json:"transfer_id,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func NewStandingOrderExecutionResponse(execution *model.StandingOrderExecution) StandingOrderExecutionResponse {
+	return StandingOrderExecutionResponse{
+		ID:           execution.ID,
+		OccurrenceAt: execution.OccurrenceAt,
+		Status:       execution.Status,
+		TransferID:   execution.TransferID,
+		Error:        execution.Error,
+		CreatedAt:    execution.CreatedAt,
+	}
+}
+
+type StandingOrderExecutionListResponse struct {
+	Executions []StandingOrderExecutionResponse `json:"executions"`
+	NextCursor string                           `json:"next_cursor,omitempty"`
+}
+
+// WebhookEvent is the body of a webhook. Data is the API representation of what changed, e.g. a TransferResponse
+// for transfer.created events.
+type WebhookEvent struct {
+	ID        uint64          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func NewWebhookEvent(event *model.OutboxEvent) WebhookEvent {
+	return WebhookEvent{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt,
+		Data:      json.RawMessage(event.Payload),
+	}
+}
+
+// BalanceChangedEvent is the data of balance.changed events. A transfer changes the balance of every account it
+// posts to, including the revenue account of its fee. Amount is the signed change and Balance the balance after it.
+type BalanceChangedEvent struct {
+	AccountID  uint64 `json:"account_id"`
+	TransferID uint64 `json:"transfer_id"`
+	Currency   string `json:"currency"`
+	Amount     string `json:"amount"`
+	Balance    string `json:"balance"`
+}
+
+type CreateWebhookSubscriptionRequest struct {
+	URL string `json:"url"`
+	// EventTypes limits the subscription to some event types. Without them, every event is delivered.
+	EventTypes []string `json:"event_types"`
+	// Secret signs the deliveries. A random secret is generated if it is not given.
+	Secret string `json:"secret"`
+}
+
+type WebhookSubscriptionResponse struct {
+	ID         uint64   `json:"id"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	// Secret is only returned when the subscription is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewWebhookSubscriptionResponse(subscription *model.WebhookSubscription) WebhookSubscriptionResponse {
+	eventTypes := []string(subscription.EventTypes)
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+	return WebhookSubscriptionResponse{
+		ID:         subscription.ID,
+		URL:        subscription.URL,
+		EventTypes: eventTypes,
+		CreatedAt:  subscription.CreatedAt,
+	}
+}
+
+type WebhookSubscriptionListResponse struct {
+	Subscriptions []WebhookSubscriptionResponse `json:"subscriptions"`
+}
+
+// ListWebhookDeliveriesQuery holds the query string filters of a webhook delivery listing.
+type ListWebhookDeliveriesQuery struct {
+	Status         string `query:"status"`
+	SubscriptionID uint64 `query:"subscription_id"`
+	EventID        uint64 `query:"event_id"`
+	Cursor         string `query:"cursor"`
+	Limit          int    `query:"limit"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID             uint64     `json:"id"`
+	EventID        uint64     `json:"event_id"`
+	EventType      string     `json:"event_type,omitempty"`
+	SubscriptionID uint64     `json:"subscription_id"`
+	Status         string     `json:"status"`
+	AttemptCount   int        `json:"attempt_count"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	LastStatusCode *int       `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+func NewWebhookDeliveryResponse(delivery *model.WebhookDelivery) WebhookDeliveryResponse {
+	response := WebhookDeliveryResponse{
+		ID:             delivery.ID,
+		EventID:        delivery.EventID,
+		SubscriptionID: delivery.SubscriptionID,
+		Status:         delivery.Status,
+		AttemptCount:   delivery.AttemptCount,
+		LastAttemptAt:  delivery.LastAttemptAt,
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+		DeliveredAt:    delivery.DeliveredAt,
+		CreatedAt:      delivery.CreatedAt,
+	}
+	if delivery.Event != nil {
+		response.EventType = delivery.Event.Type
+	}
+	// Only pending deliveries are attempted again
+	if delivery.Status == model.WebhookDeliveryStatusPending {
+		response.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	return response
+}
+
+type WebhookDeliveryListResponse struct {
+	Deliveries []WebhookDeliveryResponse `json:"deliveries"`
+	NextCursor string                    `json:"next_cursor,omitempty"`
+}
+
+// ReplayWebhookEventRequest replays an event to a single subscription, or to every subscription to its type if
+// SubscriptionID is not set.
+type ReplayWebhookEventRequest struct {
+	SubscriptionID uint64 `json:"subscription_id"`
+}
+
+// TransferChainResponse is the result of verifying the hash chain of transfers. Length and HeadHash are the position
+// and hash of the last transfer that was verified; Break is only set if the chain does not hold.
+type TransferChainResponse struct {
+	Valid     bool                        `json:"valid"`
+	Length    uint64                      `json:"length"`
+	HeadHash  string                      `json:"head_hash,omitempty"`
+	Unchained int64                       `json:"unchained"`
+	Break     *TransferChainBreakResponse `json:"break,omitempty"`
+}
+
+// TransferChainBreakResponse leaves out TransferID when the transfer at ChainSequence is missing or the chain does not
+// end at its recorded head.
+type TransferChainBreakResponse struct {
+	ChainSequence uint64  `json:"chain_sequence"`
+	TransferID    *uint64 `json:"transfer_id,omitempty"`
+	Reason        string  `json:"reason"`
+}
+
+// CreateTransferResponse is the transfer that was booked and, when receipts are enabled, its signed receipt.
+type CreateTransferResponse struct {
+	TransferResponse
+	Receipt *SignedReceiptResponse `json:"receipt,omitempty"`
+}
+
+// Receipt is the signed content of a transfer receipt: the transfer as it was booked and the balances of its source
+// and destination accounts, or of its legs' accounts, right after it. The signature is over the receipt encoded as canonical JSON (see the
+// receipt package), so the field order here is part of the format.
+type Receipt struct {
+	KeyID    string           `json:"key_id"`
+	IssuedAt time.Time        `json:"issued_at"`
+	Transfer TransferResponse `json:"transfer"`
+	Balances []ReceiptBalance `json:"balances"`
+}
+
+type ReceiptBalance struct {
+	AccountID uint64 `json:"account_id"`
+	Currency  string `json:"currency"`
+	Balance   string `json:"balance"`
+}
+
+// SignedReceiptResponse carries the base64 Ed25519 signature of the receipt by the key Receipt.KeyID.
+type SignedReceiptResponse struct {
+	Receipt   Receipt `json:"receipt"`
+	Signature string  `json:"signature"`
+}
+
+// ReceiptKeyResponse is a base64 Ed25519 public key that receipts are verified with. Current is set on the key new
+// receipts are signed with.
+type ReceiptKeyResponse struct {
+	KeyID     string `json:"key_id"`
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"`
+	Current   bool   `json:"current"`
+}
+
+type ReceiptKeyListResponse struct {
+	Keys []ReceiptKeyResponse `json:"keys"`
 }
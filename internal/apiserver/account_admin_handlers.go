@@ -0,0 +1,125 @@
+package apiserver
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/service"
+	"internal-transfers-system/internal/validator"
+)
+
+func (s *Server) ChangeAccountStatus(c *fiber.Ctx) error {
+	accountID, err := validator.ParseID(c.Params("account_id"), "account")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var request apimodel.ChangeAccountStatusRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := validator.ValidateChangeAccountStatus(&request); err != nil {
+		return errorResponse(c, err)
+	}
+
+	change, err := service.ChangeAccountStatus(c.Context(), s.DB, accountID, request.Status, request.Reason)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.NewAccountStatusChangeResponse(change))
+}
+
+func (s *Server) ListAccountStatusChanges(c *fiber.Ctx) error {
+	accountID, err := validator.ParseID(c.Params("account_id"), "account")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	changes, err := service.ListAccountStatusChanges(c.Context(), s.DB, accountID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	response := apimodel.AccountStatusChangeListResponse{
+		Changes: make([]apimodel.AccountStatusChangeResponse, 0, len(changes)),
+	}
+	for i := range changes {
+		response.Changes = append(response.Changes, apimodel.NewAccountStatusChangeResponse(&changes[i]))
+	}
+	return c.JSON(response)
+}
+
+func (s *Server) SetOverdraftLimit(c *fiber.Ctx) error {
+	accountID, err := validator.ParseID(c.Params("account_id"), "account")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var request apimodel.SetOverdraftLimitRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	limit, err := validator.ValidateSetOverdraftLimit(&request)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	account, err := service.SetOverdraftLimit(c.Context(), s.DB, accountID, limit)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	availableBalance, err := service.AvailableBalance(c.Context(), s.DB, account)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.NewAccountResponse(account, availableBalance))
+}
+
+func (s *Server) GetAccountLimits(c *fiber.Ctx) error {
+	accountID, err := validator.ParseID(c.Params("account_id"), "account")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	limits, overrides, err := service.GetAccountLimits(c.Context(), s.DB, s.TransferPolicy.DefaultLimits, accountID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	response := apimodel.AccountLimitsResponse{
+		AccountID: accountID,
+		Effective: apimodel.NewLimitsResponse(limits.MaxTransferAmount, limits.DailyAmount, limits.Rolling30DayAmount, limits.HourlyCount),
+	}
+	if overrides != nil {
+		own := apimodel.NewLimitsResponse(overrides.MaxTransferAmount, overrides.DailyAmount, overrides.Rolling30DayAmount, overrides.HourlyCount)
+		response.Overrides = &own
+	}
+	return c.JSON(response)
+}
+
+func (s *Server) SetAccountLimits(c *fiber.Ctx) error {
+	accountID, err := validator.ParseID(c.Params("account_id"), "account")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var request apimodel.AccountLimitsRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	limits, err := validator.ValidateSetAccountLimits(accountID, &request)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	if err := service.SetAccountLimits(c.Context(), s.DB, limits); err != nil {
+		return errorResponse(c, err)
+	}
+
+	return s.GetAccountLimits(c)
+}
@@ -0,0 +1,121 @@
+package apiserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/eventstream"
+	"internal-transfers-system/internal/service"
+	"internal-transfers-system/internal/validator"
+	"log/slog"
+	"time"
+)
+
+// eventStreamPage is how many events are read at a time when a stream resumes.
+const eventStreamPage = 500
+
+var errEventStreamBehind = errors.New("the client fell behind the event stream")
+
+// StreamEvents streams new events as Server-Sent Events, optionally only those of one account. A client that sends
+// Last-Event-ID first receives the events it missed from the outbox and then continues with new events.
+func (s *Server) StreamEvents(c *fiber.Ctx) error {
+	filter, err := validator.ValidateEventStreamAccount(c.Query("account_id"))
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	after, resume, err := validator.ValidateLastEventID(c.Get("Last-Event-ID"))
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	if filter.AccountID != 0 {
+		if _, err := service.GetAccount(c.Context(), s.DB, filter.AccountID); err != nil {
+			return errorResponse(c, err)
+		}
+	}
+
+	// Subscribing before reading the missed events means that no event falls in between; events that arrive both
+	// ways are only sent once
+	subscription := s.Events.Subscribe()
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// The request context is not valid once the handler has returned
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		defer s.Events.Unsubscribe(subscription)
+
+		err := s.writeEventStream(ctx, w, subscription, filter, after, resume)
+		slog.Debug("event stream closed", "account", filter.AccountID, "error", err)
+	})
+	return nil
+}
+
+// writeEventStream writes events to w until the client goes away, which is noticed when a write fails, or falls
+// behind.
+func (s *Server) writeEventStream(ctx context.Context, w *bufio.Writer, subscription *eventstream.Subscription,
+	filter apimodel.EventStreamFilter, after uint64, resume bool) error {
+	// Sends the headers right away
+	if err := eventstream.WriteComment(w, "connected"); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for resume {
+		events, err := service.ListStreamEvents(ctx, s.DB, after, eventStreamPage)
+		if err != nil {
+			return err
+		}
+		for i := range events {
+			after = *events[i].Sequence
+			if !eventstream.Matches(filter, &events[i]) {
+				continue
+			}
+			if err := eventstream.WriteEvent(w, &events[i]); err != nil {
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		resume = len(events) == eventStreamPage
+	}
+
+	var heartbeat <-chan time.Time
+	if s.EventStreamHeartbeat > 0 {
+		ticker := time.NewTicker(s.EventStreamHeartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return errEventStreamBehind
+			}
+			if *event.Sequence <= after {
+				continue
+			}
+			after = *event.Sequence
+			if !eventstream.Matches(filter, &event) {
+				continue
+			}
+			if err := eventstream.WriteEvent(w, &event); err != nil {
+				return err
+			}
+		case <-heartbeat:
+			if err := eventstream.WriteComment(w, "heartbeat"); err != nil {
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+}
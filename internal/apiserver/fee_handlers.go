@@ -0,0 +1,66 @@
+package apiserver
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/service"
+	"internal-transfers-system/internal/validator"
+	"strings"
+)
+
+func (s *Server) SetFeeSchedules(c *fiber.Ctx) error {
+	var request apimodel.SetFeeSchedulesRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	schedules, err := validator.ValidateSetFeeSchedules(&request)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	if err := service.SetFeeSchedules(c.Context(), s.DB, schedules); err != nil {
+		return errorResponse(c, err)
+	}
+
+	return s.ListFeeSchedules(c)
+}
+
+func (s *Server) ListFeeSchedules(c *fiber.Ctx) error {
+	schedules, err := service.ListFeeSchedules(c.Context(), s.DB)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.NewFeeScheduleListResponse(schedules))
+}
+
+func (s *Server) DeleteFeeSchedule(c *fiber.Ctx) error {
+	transferType, currency := c.Params("transfer_type"), strings.ToUpper(c.Params("currency"))
+
+	if err := service.DeleteFeeSchedule(c.Context(), s.DB, transferType, currency); err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *Server) QuoteFee(c *fiber.Ctx) error {
+	var query apimodel.FeeQuoteQuery
+	if err := c.QueryParser(&query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	amount, err := validator.ValidateFeeQuote(&query)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	fee, schedule, err := service.QuoteFee(c.Context(), s.DB, query.TransferType, query.Currency, amount)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.NewFeeQuoteResponse(query.TransferType, query.Currency, amount, fee, schedule))
+}
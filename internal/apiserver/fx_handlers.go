@@ -0,0 +1,72 @@
+package apiserver
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/service"
+	"internal-transfers-system/internal/validator"
+)
+
+func (s *Server) SetFXRates(c *fiber.Ctx) error {
+	var request apimodel.SetFXRatesRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rates, err := validator.ValidateSetFXRates(&request)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	if err := service.SetFXRates(c.Context(), s.DB, rates); err != nil {
+		return errorResponse(c, err)
+	}
+
+	return s.ListFXRates(c)
+}
+
+func (s *Server) ListFXRates(c *fiber.Ctx) error {
+	rates, err := service.ListFXRates(c.Context(), s.DB)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.NewFXRateListResponse(rates))
+}
+
+func (s *Server) CreateFXQuote(c *fiber.Ctx) error {
+	var quote apimodel.CreateFXQuoteRequest
+
+	if err := c.BodyParser(&quote); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	amount, ttl, err := validator.ValidateCreateFXQuote(&quote)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	newQuote, err := service.CreateFXQuote(c.Context(), s.DB, quote, amount, ttl)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	c.Location(fmt.Sprintf("/fx/quotes/%d", newQuote.ID))
+	return c.Status(fiber.StatusCreated).JSON(apimodel.NewFXQuoteResponse(newQuote))
+}
+
+func (s *Server) GetFXQuote(c *fiber.Ctx) error {
+	quoteID, err := validator.ParseID(c.Params("quote_id"), "quote")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	quote, err := service.GetFXQuote(c.Context(), s.DB, quoteID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.NewFXQuoteResponse(quote))
+}
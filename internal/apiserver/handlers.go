@@ -1,17 +1,40 @@
 package apiserver
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
-	"gorm.io/gorm"
 	"internal-transfers-system/internal/apimodel"
 	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/receipt"
 	"internal-transfers-system/internal/service"
+	"internal-transfers-system/internal/statement"
 	"internal-transfers-system/internal/svrerror"
 	"internal-transfers-system/internal/validator"
-	"strings"
+	"log/slog"
+	"strconv"
 )
 
+// errorResponse renders validation and service errors with their status code. Any other error is a 500.
+func errorResponse(c *fiber.Ctx, err error) error {
+	status, body := errorBody(err)
+	return c.Status(status).JSON(body)
+}
+
+// errorBody returns the status code and body that errorResponse renders err with.
+func errorBody(err error) (int, apimodel.ErrorResponse) {
+	var customErr *svrerror.Error
+	if errors.As(err, &customErr) {
+		return customErr.StatusCode, apimodel.ErrorResponse{
+			Error:   customErr.Message,
+			Code:    customErr.Code,
+			Details: customErr.Details,
+		}
+	}
+	return fiber.StatusInternalServerError, apimodel.ErrorResponse{Error: err.Error()}
+}
+
 func (s *Server) CreateAccount(c *fiber.Ctx) error {
 	var account apimodel.CreateAccountRequest
 
@@ -21,51 +44,115 @@ func (s *Server) CreateAccount(c *fiber.Ctx) error {
 
 	initialBalance, err := validator.ValidateCreateAccount(&account)
 	if err != nil {
-		var customErr *svrerror.Error
-		if errors.As(err, &customErr) {
-			return c.Status(customErr.StatusCode).JSON(fiber.Map{"error": customErr.Message})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return errorResponse(c, err)
+	}
+
+	newAccount, err := service.CreateAccount(c.Context(), s.DB, account, initialBalance)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	// A new account has no holds, so all of its balance is available
+	return c.Status(fiber.StatusCreated).JSON(apimodel.NewAccountResponse(newAccount, newAccount.Balance))
+}
+
+// GetAccount returns the account balance and the balance available after holds. With ?verify=true the balance is
+// also derived from the journal and cross-checked against the stored balance.
+func (s *Server) GetAccount(c *fiber.Ctx) error {
+	accountID, err := validator.ParseID(c.Params("account_id"), "account")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	account, err := service.GetAccount(c.Context(), s.DB, accountID)
+	if err != nil {
+		return errorResponse(c, err)
 	}
 
-	newAccount := model.Account{
-		ID:      account.AccountID,
-		Balance: initialBalance,
+	availableBalance, err := service.AvailableBalance(c.Context(), s.DB, account)
+	if err != nil {
+		return errorResponse(c, err)
 	}
 
-	// TechDebt: refactor into service layer
-	if err := s.DB.WithContext(c.Context()).Create(&newAccount).Error; err != nil {
+	response := apimodel.NewAccountResponse(account, availableBalance)
 
-		if strings.Contains(err.Error(), "unique") {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "account ID already exists"})
+	if c.QueryBool("verify") {
+		ledgerBalance, err := service.LedgerBalance(c.Context(), s.DB, account.ID)
+		if err != nil {
+			return errorResponse(c, err)
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		response.WithLedgerBalance(account, ledgerBalance)
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{})
+	return c.JSON(response)
 }
 
-func (s *Server) GetAccount(c *fiber.Ctx) error {
-	accountID := c.Params("account_id")
+// GetAccountBalance returns the balance of an account as of the time in ?as_of=, derived from the account's postings
+// and balance snapshots. Without as_of it is the current balance.
+func (s *Server) GetAccountBalance(c *fiber.Ctx) error {
+	accountID, err := validator.ParseID(c.Params("account_id"), "account")
+	if err != nil {
+		return errorResponse(c, err)
+	}
 
-	// TechDebt: refactor into service layer
-	var account model.Account
-	if err := s.DB.WithContext(c.Context()).First(&account, "id = ?", accountID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "account not found"})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	asOf, err := validator.ValidateBalanceAsOf(c.Query("as_of"))
+	if err != nil {
+		return errorResponse(c, err)
 	}
 
-	response := struct {
-		AccountID uint64 `json:"account_id"`
-		Balance   string `json:"balance"`
-	}{
+	account, err := service.GetAccount(c.Context(), s.DB, accountID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	balance, err := service.BalanceAsOf(c.Context(), s.DB, account.ID, asOf)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.AccountBalanceResponse{
 		AccountID: account.ID,
-		Balance:   account.Balance.String(),
+		Currency:  account.Currency,
+		Balance:   balance.String(),
+		AsOf:      asOf,
+	})
+}
+
+// GetAccountStatement returns an account's statement for the period in ?from= and ?to=, as JSON, CSV, PDF or an
+// ISO 20022 camt.053 message depending on ?format=. Formats other than JSON are sent as attachments.
+func (s *Server) GetAccountStatement(c *fiber.Ctx) error {
+	accountID, err := validator.ParseID(c.Params("account_id"), "account")
+	if err != nil {
+		return errorResponse(c, err)
 	}
 
-	return c.JSON(response)
+	var query apimodel.StatementQuery
+	if err := c.QueryParser(&query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	from, to, format, err := validator.ValidateStatement(&query)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	accountStatement, err := service.AccountStatement(c.Context(), s.DB, accountID, from, to)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	response := apimodel.NewStatementResponse(accountStatement)
+	if format == statement.FormatJSON {
+		return c.JSON(response)
+	}
+
+	var body bytes.Buffer
+	if err := statement.Write(&body, &response, format); err != nil {
+		return errorResponse(c, err)
+	}
+	c.Attachment(statement.Filename(&response, format))
+	c.Set(fiber.HeaderContentType, statement.ContentType(format))
+	return c.Send(body.Bytes())
 }
 
 func (s *Server) CreateTransfer(c *fiber.Ctx) error {
@@ -75,23 +162,189 @@ func (s *Server) CreateTransfer(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	if key := c.Get("Idempotency-Key"); key != "" {
+		transfer.IdempotencyKey = key
+	}
+
 	amount, err := validator.ValidateTransfer(&transfer)
 	if err != nil {
-		var customErr *svrerror.Error
-		if errors.As(err, &customErr) {
-			return c.Status(customErr.StatusCode).JSON(fiber.Map{"error": customErr.Message})
+		return errorResponse(c, err)
+	}
+
+	newTransfer, err := service.ProcessTransfer(c.Context(), s.DB, s.TransferPolicy, transfer, amount)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	response := apimodel.CreateTransferResponse{TransferResponse: apimodel.NewTransferResponse(newTransfer)}
+	if s.Receipts != nil {
+		// The transfer is booked either way, and a receipt that could not be issued now can be fetched later
+		if response.Receipt, err = service.IssueReceipt(c.Context(), s.DB, s.Receipts, newTransfer.ID); err != nil {
+			slog.Error("failed to issue transfer receipt", "transfer", newTransfer.ID, "error", err)
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	err = service.ProcessTransfer(c.Context(), s.DB, transfer, amount)
+	c.Location(fmt.Sprintf("/transactions/%d", newTransfer.ID))
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// CreateMultiLegTransfer books a transfer from one or more source accounts to one or more destination accounts.
+func (s *Server) CreateMultiLegTransfer(c *fiber.Ctx) error {
+	var request apimodel.MultiLegTransferRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if key := c.Get("Idempotency-Key"); key != "" {
+		request.IdempotencyKey = key
+	}
+
+	transfer, err := validator.ValidateMultiLegTransfer(&request)
 	if err != nil {
-		var customErr *svrerror.Error
-		if errors.As(err, &customErr) {
-			return c.Status(customErr.StatusCode).JSON(fiber.Map{"error": customErr.Message})
+		return errorResponse(c, err)
+	}
+
+	newTransfer, err := service.ProcessMultiLegTransfer(c.Context(), s.DB, s.TransferPolicy, transfer)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	c.Location(fmt.Sprintf("/transactions/%d", newTransfer.ID))
+	return c.Status(fiber.StatusCreated).JSON(apimodel.NewTransferResponse(newTransfer))
+}
+
+// CreateBatchTransfer books a list of transfers either atomically or one by one. An atomic batch responds like a
+// single transfer: 201 when every transfer was booked and the error of the first failed transfer otherwise. A
+// best-effort batch always responds with 200 and the outcome of every transfer.
+func (s *Server) CreateBatchTransfer(c *fiber.Ctx) error {
+	var request apimodel.BatchTransferRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	items, err := validator.ValidateBatchTransfer(&request, s.BatchMaxSize)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	batch, results, err := service.ProcessBatch(c.Context(), s.DB, s.TransferPolicy, request.Mode, items)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	response := apimodel.BatchTransferResponse{
+		BatchID: batch.ID,
+		Mode:    batch.Mode,
+		Results: make([]apimodel.BatchTransferResult, 0, len(results)),
+	}
+	for i, result := range results {
+		item := apimodel.BatchTransferResult{Index: i}
+		if result.Err != nil {
+			_, body := errorBody(result.Err)
+			item.Status, item.Error = apimodel.BatchTransferFailed, &body
+		} else {
+			transfer := apimodel.NewTransferResponse(result.Transfer)
+			item.Status, item.Transfer = apimodel.BatchTransferSucceeded, &transfer
+		}
+		response.Results = append(response.Results, item)
+	}
+
+	if batch.Mode == model.TransferBatchModeAtomic {
+		return c.Status(fiber.StatusCreated).JSON(response)
+	}
+	return c.JSON(response)
+}
+
+func (s *Server) GetTransfer(c *fiber.Ctx) error {
+	transferID, err := validator.ParseID(c.Params("transfer_id"), "transfer")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	transfer, err := service.GetTransfer(c.Context(), s.DB, transferID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.NewTransferResponse(transfer))
+}
+
+func (s *Server) GetTransferReceipt(c *fiber.Ctx) error {
+	transferID, err := validator.ParseID(c.Params("transfer_id"), "transfer")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	signed, err := service.IssueReceipt(c.Context(), s.DB, s.Receipts, transferID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(signed)
+}
+
+// ListReceiptKeys publishes the public keys that receipts are verified with, including keys that were rotated out.
+func (s *Server) ListReceiptKeys(c *fiber.Ctx) error {
+	return c.JSON(receipt.NewKeyListResponse(s.Receipts))
+}
+
+func (s *Server) ReverseTransfer(c *fiber.Ctx) error {
+	transferID, err := validator.ParseID(c.Params("transfer_id"), "transfer")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var reversal apimodel.ReverseTransferRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&reversal); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{})
+	amount, err := validator.ValidateReverseTransfer(&reversal)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	newTransfer, err := service.ReverseTransfer(c.Context(), s.DB, transferID, amount)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	c.Location(fmt.Sprintf("/transactions/%d", newTransfer.ID))
+	return c.Status(fiber.StatusCreated).JSON(apimodel.NewTransferResponse(newTransfer))
+}
+
+func (s *Server) ListAccountTransfers(c *fiber.Ctx) error {
+	accountID, err := validator.ParseID(c.Params("account_id"), "account")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var query apimodel.ListTransfersQuery
+	if err := c.QueryParser(&query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	filter, err := validator.ValidateListTransfers(accountID, &query)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	transfers, nextCursor, err := service.ListAccountTransfers(c.Context(), s.DB, filter)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	response := apimodel.TransferListResponse{Transfers: make([]apimodel.TransferResponse, 0, len(transfers))}
+	for i := range transfers {
+		response.Transfers = append(response.Transfers, apimodel.NewTransferResponse(&transfers[i]))
+	}
+	if nextCursor != 0 {
+		response.NextCursor = strconv.FormatUint(nextCursor, 10)
+	}
+
+	return c.JSON(response)
 }
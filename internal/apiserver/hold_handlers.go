@@ -0,0 +1,84 @@
+package apiserver
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/service"
+	"internal-transfers-system/internal/validator"
+)
+
+func (s *Server) CreateHold(c *fiber.Ctx) error {
+	var hold apimodel.CreateHoldRequest
+
+	if err := c.BodyParser(&hold); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	amount, ttl, err := validator.ValidateCreateHold(&hold)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	newHold, err := service.CreateHold(c.Context(), s.DB, hold, amount, ttl)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	c.Location(fmt.Sprintf("/holds/%d", newHold.ID))
+	return c.Status(fiber.StatusCreated).JSON(apimodel.NewHoldResponse(newHold))
+}
+
+func (s *Server) GetHold(c *fiber.Ctx) error {
+	holdID, err := validator.ParseID(c.Params("hold_id"), "hold")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	hold, err := service.GetHold(c.Context(), s.DB, holdID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.NewHoldResponse(hold))
+}
+
+func (s *Server) CaptureHold(c *fiber.Ctx) error {
+	holdID, err := validator.ParseID(c.Params("hold_id"), "hold")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var capture apimodel.CaptureHoldRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&capture); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	amount, err := validator.ValidateCaptureHold(&capture)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	hold, err := service.CaptureHold(c.Context(), s.DB, s.TransferPolicy, holdID, amount)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.NewHoldResponse(hold))
+}
+
+func (s *Server) VoidHold(c *fiber.Ctx) error {
+	holdID, err := validator.ParseID(c.Params("hold_id"), "hold")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	hold, err := service.VoidHold(c.Context(), s.DB, holdID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.NewHoldResponse(hold))
+}
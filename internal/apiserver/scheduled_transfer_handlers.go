@@ -0,0 +1,86 @@
+package apiserver
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/service"
+	"internal-transfers-system/internal/validator"
+	"strconv"
+)
+
+func (s *Server) CreateScheduledTransfer(c *fiber.Ctx) error {
+	var request apimodel.CreateScheduledTransferRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	amount, executeAt, err := validator.ValidateCreateScheduledTransfer(&request)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	scheduled, err := service.CreateScheduledTransfer(c.Context(), s.DB, request, amount, executeAt)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	c.Location(fmt.Sprintf("/scheduled-transfers/%d", scheduled.ID))
+	return c.Status(fiber.StatusCreated).JSON(apimodel.NewScheduledTransferResponse(scheduled))
+}
+
+func (s *Server) ListScheduledTransfers(c *fiber.Ctx) error {
+	var query apimodel.ListScheduledTransfersQuery
+	if err := c.QueryParser(&query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	filter, err := validator.ValidateListScheduledTransfers(&query)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	scheduled, nextCursor, err := service.ListScheduledTransfers(c.Context(), s.DB, filter)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	response := apimodel.ScheduledTransferListResponse{ScheduledTransfers: make([]apimodel.ScheduledTransferResponse, 0, len(scheduled))}
+	for i := range scheduled {
+		response.ScheduledTransfers = append(response.ScheduledTransfers, apimodel.NewScheduledTransferResponse(&scheduled[i]))
+	}
+	if nextCursor != 0 {
+		response.NextCursor = strconv.FormatUint(nextCursor, 10)
+	}
+
+	return c.JSON(response)
+}
+
+func (s *Server) GetScheduledTransfer(c *fiber.Ctx) error {
+	scheduledTransferID, err := validator.ParseID(c.Params("scheduled_transfer_id"), "scheduled transfer")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	scheduled, err := service.GetScheduledTransfer(c.Context(), s.DB, scheduledTransferID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.NewScheduledTransferResponse(scheduled))
+}
+
+func (s *Server) CancelScheduledTransfer(c *fiber.Ctx) error {
+	scheduledTransferID, err := validator.ParseID(c.Params("scheduled_transfer_id"), "scheduled transfer")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	scheduled, err := service.CancelScheduledTransfer(c.Context(), s.DB, scheduledTransferID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.NewScheduledTransferResponse(scheduled))
+}
@@ -1,23 +1,110 @@
 package apiserver
 
 import (
+	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
+	"internal-transfers-system/config"
+	"internal-transfers-system/internal/eventstream"
+	"internal-transfers-system/internal/receipt"
+	"internal-transfers-system/internal/service"
+	"time"
 )
 
 type Server struct {
-	FiberApp *fiber.App
-	DB       *gorm.DB
+	FiberApp       *fiber.App
+	DB             *gorm.DB
+	TransferPolicy service.TransferPolicy
+	// Events is fed by service.RunEventStream, which must be running for GET /events/stream to receive new events
+	Events               *eventstream.Hub
+	EventStreamHeartbeat time.Duration
+	// BatchMaxSize is the most transfers POST /transactions/batch accepts
+	BatchMaxSize int
+	// Receipts signs transfer receipts. It is nil when no receipt keys are configured.
+	Receipts *receipt.Signer
 }
 
-func New(db *gorm.DB, fiberApp *fiber.App) *Server {
-	return &Server{FiberApp: fiberApp, DB: db}
+func New(db *gorm.DB, fiberApp *fiber.App, conf config.Config) (*Server, error) {
+	defaultLimits, err := service.NewDefaultLimits(conf.DefaultMaxTransferAmount, conf.DefaultDailyAmount,
+		conf.DefaultRolling30DayAmount, conf.DefaultHourlyTransferCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.BatchMaxSize < 1 {
+		return nil, fmt.Errorf("BATCH_MAX_SIZE must be at least 1, got %d", conf.BatchMaxSize)
+	}
+
+	receiptKeys, err := receipt.ParseKeys(conf.ReceiptSigningKeys)
+	if err != nil {
+		return nil, err
+	}
+	var receipts *receipt.Signer
+	if len(receiptKeys) > 0 {
+		if receipts, err = receipt.NewSigner(conf.ReceiptSigningKeyID, receiptKeys); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Server{
+		FiberApp:             fiberApp,
+		DB:                   db,
+		TransferPolicy:       service.TransferPolicy{DefaultLimits: defaultLimits},
+		Events:               eventstream.NewHub(),
+		EventStreamHeartbeat: conf.EventStreamHeartbeatInterval,
+		BatchMaxSize:         conf.BatchMaxSize,
+		Receipts:             receipts,
+	}, nil
 }
 
 func (s *Server) SetupRoutes() {
 	s.FiberApp.Post("/accounts", s.CreateAccount)
 	s.FiberApp.Get("/accounts/:account_id", s.GetAccount)
+	s.FiberApp.Get("/accounts/:account_id/balance", s.GetAccountBalance)
+	s.FiberApp.Get("/accounts/:account_id/statement", s.GetAccountStatement)
+	s.FiberApp.Get("/accounts/:account_id/transactions", s.ListAccountTransfers)
 	s.FiberApp.Post("/transactions", s.CreateTransfer)
+	s.FiberApp.Post("/transactions/batch", s.CreateBatchTransfer)
+	s.FiberApp.Post("/transactions/multi-leg", s.CreateMultiLegTransfer)
+	s.FiberApp.Get("/transactions/:transfer_id", s.GetTransfer)
+	s.FiberApp.Get("/transactions/:transfer_id/receipt", s.GetTransferReceipt)
+	s.FiberApp.Get("/receipts/keys", s.ListReceiptKeys)
+	s.FiberApp.Post("/transactions/:transfer_id/reverse", s.ReverseTransfer)
+	s.FiberApp.Post("/holds", s.CreateHold)
+	s.FiberApp.Get("/holds/:hold_id", s.GetHold)
+	s.FiberApp.Post("/holds/:hold_id/capture", s.CaptureHold)
+	s.FiberApp.Post("/holds/:hold_id/void", s.VoidHold)
+	s.FiberApp.Post("/scheduled-transfers", s.CreateScheduledTransfer)
+	s.FiberApp.Get("/scheduled-transfers", s.ListScheduledTransfers)
+	s.FiberApp.Get("/scheduled-transfers/:scheduled_transfer_id", s.GetScheduledTransfer)
+	s.FiberApp.Post("/scheduled-transfers/:scheduled_transfer_id/cancel", s.CancelScheduledTransfer)
+	s.FiberApp.Post("/standing-orders", s.CreateStandingOrder)
+	s.FiberApp.Get("/standing-orders", s.ListStandingOrders)
+	s.FiberApp.Get("/standing-orders/:standing_order_id", s.GetStandingOrder)
+	s.FiberApp.Get("/standing-orders/:standing_order_id/executions", s.ListStandingOrderExecutions)
+	s.FiberApp.Post("/standing-orders/:standing_order_id/cancel", s.CancelStandingOrder)
+	s.FiberApp.Post("/standing-orders/:standing_order_id/resume", s.ResumeStandingOrder)
+	s.FiberApp.Get("/fx/rates", s.ListFXRates)
+	s.FiberApp.Post("/fx/quotes", s.CreateFXQuote)
+	s.FiberApp.Get("/fx/quotes/:quote_id", s.GetFXQuote)
+	s.FiberApp.Put("/admin/fx/rates", s.SetFXRates)
+	s.FiberApp.Get("/fees/schedules", s.ListFeeSchedules)
+	s.FiberApp.Get("/fees/quote", s.QuoteFee)
+	s.FiberApp.Put("/admin/fees/schedules", s.SetFeeSchedules)
+	s.FiberApp.Delete("/admin/fees/schedules/:transfer_type/:currency", s.DeleteFeeSchedule)
+	s.FiberApp.Put("/admin/accounts/:account_id/status", s.ChangeAccountStatus)
+	s.FiberApp.Get("/admin/accounts/:account_id/status-changes", s.ListAccountStatusChanges)
+	s.FiberApp.Put("/admin/accounts/:account_id/overdraft-limit", s.SetOverdraftLimit)
+	s.FiberApp.Get("/admin/accounts/:account_id/limits", s.GetAccountLimits)
+	s.FiberApp.Put("/admin/accounts/:account_id/limits", s.SetAccountLimits)
+	s.FiberApp.Get("/events/stream", s.StreamEvents)
+	s.FiberApp.Post("/admin/webhooks/subscriptions", s.CreateWebhookSubscription)
+	s.FiberApp.Get("/admin/webhooks/subscriptions", s.ListWebhookSubscriptions)
+	s.FiberApp.Delete("/admin/webhooks/subscriptions/:subscription_id", s.DeleteWebhookSubscription)
+	s.FiberApp.Get("/admin/webhooks/deliveries", s.ListWebhookDeliveries)
+	s.FiberApp.Post("/admin/webhooks/deliveries/:delivery_id/replay", s.ReplayWebhookDelivery)
+	s.FiberApp.Post("/admin/webhooks/events/:event_id/replay", s.ReplayWebhookEvent)
+	s.FiberApp.Get("/admin/transfers/chain/verify", s.VerifyTransferChain)
 }
 
 func (s *Server) Start(address string) error {
@@ -0,0 +1,132 @@
+package apiserver
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/service"
+	"internal-transfers-system/internal/validator"
+	"strconv"
+)
+
+func (s *Server) CreateStandingOrder(c *fiber.Ctx) error {
+	var request apimodel.CreateStandingOrderRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	order, err := validator.ValidateCreateStandingOrder(&request)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	created, err := service.CreateStandingOrder(c.Context(), s.DB, order)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	c.Location(fmt.Sprintf("/standing-orders/%d", created.ID))
+	return c.Status(fiber.StatusCreated).JSON(apimodel.NewStandingOrderResponse(created))
+}
+
+func (s *Server) ListStandingOrders(c *fiber.Ctx) error {
+	var query apimodel.ListStandingOrdersQuery
+	if err := c.QueryParser(&query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	filter, err := validator.ValidateListStandingOrders(&query)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	orders, nextCursor, err := service.ListStandingOrders(c.Context(), s.DB, filter)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	response := apimodel.StandingOrderListResponse{StandingOrders: make([]apimodel.StandingOrderResponse, 0, len(orders))}
+	for i := range orders {
+		response.StandingOrders = append(response.StandingOrders, apimodel.NewStandingOrderResponse(&orders[i]))
+	}
+	if nextCursor != 0 {
+		response.NextCursor = strconv.FormatUint(nextCursor, 10)
+	}
+
+	return c.JSON(response)
+}
+
+func (s *Server) GetStandingOrder(c *fiber.Ctx) error {
+	standingOrderID, err := validator.ParseID(c.Params("standing_order_id"), "standing order")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	order, err := service.GetStandingOrder(c.Context(), s.DB, standingOrderID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.NewStandingOrderResponse(order))
+}
+
+func (s *Server) ListStandingOrderExecutions(c *fiber.Ctx) error {
+	standingOrderID, err := validator.ParseID(c.Params("standing_order_id"), "standing order")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var query apimodel.PageQuery
+	if err := c.QueryParser(&query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	cursor, limit, err := validator.ValidatePage(&query)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	executions, nextCursor, err := service.ListStandingOrderExecutions(c.Context(), s.DB, standingOrderID, cursor, limit)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	response := apimodel.StandingOrderExecutionListResponse{Executions: make([]apimodel.StandingOrderExecutionResponse, 0, len(executions))}
+	for i := range executions {
+		response.Executions = append(response.Executions, apimodel.NewStandingOrderExecutionResponse(&executions[i]))
+	}
+	if nextCursor != 0 {
+		response.NextCursor = strconv.FormatUint(nextCursor, 10)
+	}
+
+	return c.JSON(response)
+}
+
+func (s *Server) CancelStandingOrder(c *fiber.Ctx) error {
+	standingOrderID, err := validator.ParseID(c.Params("standing_order_id"), "standing order")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	order, err := service.CancelStandingOrder(c.Context(), s.DB, standingOrderID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.NewStandingOrderResponse(order))
+}
+
+func (s *Server) ResumeStandingOrder(c *fiber.Ctx) error {
+	standingOrderID, err := validator.ParseID(c.Params("standing_order_id"), "standing order")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	order, err := service.ResumeStandingOrder(c.Context(), s.DB, standingOrderID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.NewStandingOrderResponse(order))
+}
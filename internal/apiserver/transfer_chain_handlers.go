@@ -0,0 +1,29 @@
+package apiserver
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/service"
+)
+
+func (s *Server) VerifyTransferChain(c *fiber.Ctx) error {
+	verification, err := service.VerifyTransferChain(c.Context(), s.DB)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	response := apimodel.TransferChainResponse{
+		Valid:     verification.Break == nil,
+		Length:    verification.Length,
+		HeadHash:  verification.Head,
+		Unchained: verification.Unchained,
+	}
+	if verification.Break != nil {
+		response.Break = &apimodel.TransferChainBreakResponse{
+			ChainSequence: verification.Break.Sequence,
+			TransferID:    verification.Break.TransferID,
+			Reason:        verification.Break.Reason,
+		}
+	}
+	return c.JSON(response)
+}
@@ -0,0 +1,127 @@
+package apiserver
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/service"
+	"internal-transfers-system/internal/validator"
+	"strconv"
+)
+
+func (s *Server) CreateWebhookSubscription(c *fiber.Ctx) error {
+	var request apimodel.CreateWebhookSubscriptionRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := validator.ValidateCreateWebhookSubscription(&request); err != nil {
+		return errorResponse(c, err)
+	}
+
+	subscription, err := service.CreateWebhookSubscription(c.Context(), s.DB, request.URL, request.EventTypes, request.Secret)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	// The secret is only ever returned here
+	response := apimodel.NewWebhookSubscriptionResponse(subscription)
+	response.Secret = subscription.Secret
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+func (s *Server) ListWebhookSubscriptions(c *fiber.Ctx) error {
+	subscriptions, err := service.ListWebhookSubscriptions(c.Context(), s.DB)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	response := apimodel.WebhookSubscriptionListResponse{Subscriptions: make([]apimodel.WebhookSubscriptionResponse, 0, len(subscriptions))}
+	for i := range subscriptions {
+		response.Subscriptions = append(response.Subscriptions, apimodel.NewWebhookSubscriptionResponse(&subscriptions[i]))
+	}
+
+	return c.JSON(response)
+}
+
+func (s *Server) DeleteWebhookSubscription(c *fiber.Ctx) error {
+	subscriptionID, err := validator.ParseID(c.Params("subscription_id"), "webhook subscription")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	if err := service.DeleteWebhookSubscription(c.Context(), s.DB, subscriptionID); err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *Server) ListWebhookDeliveries(c *fiber.Ctx) error {
+	var query apimodel.ListWebhookDeliveriesQuery
+	if err := c.QueryParser(&query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	filter, err := validator.ValidateListWebhookDeliveries(&query)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	deliveries, nextCursor, err := service.ListWebhookDeliveries(c.Context(), s.DB, filter)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	response := apimodel.WebhookDeliveryListResponse{Deliveries: make([]apimodel.WebhookDeliveryResponse, 0, len(deliveries))}
+	for i := range deliveries {
+		response.Deliveries = append(response.Deliveries, apimodel.NewWebhookDeliveryResponse(&deliveries[i]))
+	}
+	if nextCursor != 0 {
+		response.NextCursor = strconv.FormatUint(nextCursor, 10)
+	}
+
+	return c.JSON(response)
+}
+
+func (s *Server) ReplayWebhookDelivery(c *fiber.Ctx) error {
+	deliveryID, err := validator.ParseID(c.Params("delivery_id"), "webhook delivery")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	delivery, err := service.ReplayWebhookDelivery(c.Context(), s.DB, deliveryID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(apimodel.NewWebhookDeliveryResponse(delivery))
+}
+
+// ReplayWebhookEvent delivers an event again. The body is optional; without it the event is replayed to every
+// subscription to its type.
+func (s *Server) ReplayWebhookEvent(c *fiber.Ctx) error {
+	eventID, err := validator.ParseID(c.Params("event_id"), "event")
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var request apimodel.ReplayWebhookEventRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	deliveries, err := service.ReplayWebhookEvent(c.Context(), s.DB, eventID, request.SubscriptionID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	response := apimodel.WebhookDeliveryListResponse{Deliveries: make([]apimodel.WebhookDeliveryResponse, 0, len(deliveries))}
+	for i := range deliveries {
+		response.Deliveries = append(response.Deliveries, apimodel.NewWebhookDeliveryResponse(&deliveries[i]))
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
@@ -0,0 +1,55 @@
+package currency
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMinorUnits(t *testing.T) {
+	tests := []struct {
+		code          string
+		expectedUnits int32
+		expectedOK    bool
+	}{
+		{code: "SGD", expectedUnits: 2, expectedOK: true},
+		{code: "JPY", expectedUnits: 0, expectedOK: true},
+		{code: "KWD", expectedUnits: 3, expectedOK: true},
+		{code: "CLF", expectedUnits: 4, expectedOK: true},
+		{code: "sgd", expectedUnits: 0, expectedOK: false},
+		{code: "XAU", expectedUnits: 0, expectedOK: false},
+		{code: "", expectedUnits: 0, expectedOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			units, ok := MinorUnits(tt.code)
+			assert.Equal(t, tt.expectedUnits, units)
+			assert.Equal(t, tt.expectedOK, ok)
+			assert.Equal(t, tt.expectedOK, IsValid(tt.code))
+		})
+	}
+}
+
+func TestFitsMinorUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		amount   string
+		expected bool
+	}{
+		{name: "whole amount", code: "USD", amount: "10", expected: true},
+		{name: "cents", code: "USD", amount: "10.05", expected: true},
+		{name: "trailing zeros", code: "USD", amount: "10.500000", expected: true},
+		{name: "sub-cent", code: "USD", amount: "10.005", expected: false},
+		{name: "zero decimal currency", code: "JPY", amount: "100.5", expected: false},
+		{name: "three decimal currency", code: "KWD", amount: "1.234", expected: true},
+		{name: "unsupported currency", code: "ABC", amount: "1", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, FitsMinorUnits(tt.code, decimal.RequireFromString(tt.amount)))
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Package eventstream fans outbox events out to Server-Sent Events clients.
+package eventstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+)
+
+// bufferSize is how many events a subscriber can fall behind before it is dropped.
+const bufferSize = 256
+
+// Hub broadcasts the events of the stream to its subscribers, in sequence order.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+}
+
+// Subscription receives the events published after it was made. Its channel is closed when the subscriber falls
+// more than bufferSize events behind or is unsubscribed; the client is then expected to reconnect with the last
+// sequence it has seen.
+type Subscription struct {
+	Events <-chan model.OutboxEvent
+	events chan model.OutboxEvent
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[*Subscription]struct{})}
+}
+
+func (h *Hub) Subscribe() *Subscription {
+	events := make(chan model.OutboxEvent, bufferSize)
+	subscription := &Subscription{Events: events, events: events}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers[subscription] = struct{}{}
+	return subscription
+}
+
+func (h *Hub) Unsubscribe(subscription *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(subscription)
+}
+
+// Publish sends events to every subscriber without blocking. Subscribers whose buffer is full are dropped.
+func (h *Hub) Publish(events []model.OutboxEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for subscription := range h.subscribers {
+		for _, event := range events {
+			select {
+			case subscription.events <- event:
+				continue
+			default:
+			}
+			h.remove(subscription)
+			break
+		}
+	}
+}
+
+func (h *Hub) remove(subscription *Subscription) {
+	if _, ok := h.subscribers[subscription]; ok {
+		delete(h.subscribers, subscription)
+		close(subscription.events)
+	}
+}
+
+// eventAccounts holds the fields of the event payloads that name accounts.
+type eventAccounts struct {
+	AccountID            uint64  `json:"account_id"`
+	SourceAccountID      uint64  `json:"source_account_id"`
+	DestinationAccountID uint64  `json:"destination_account_id"`
+	FeeAccountID         *uint64 `json:"fee_account_id"`
+	Legs                 []struct {
+		AccountID uint64 `json:"account_id"`
+	} `json:"legs"`
+}
+
+// Matches reports whether event concerns the filter's account: an account.created or balance.changed event of the
+// account, or a transfer.created event of a transfer that posts to it.
+func Matches(f apimodel.EventStreamFilter, event *model.OutboxEvent) bool {
+	if f.AccountID == 0 {
+		return true
+	}
+
+	var accounts eventAccounts
+	if err := json.Unmarshal(event.Payload, &accounts); err != nil {
+		return false
+	}
+	if accounts.AccountID == f.AccountID || accounts.SourceAccountID == f.AccountID || accounts.DestinationAccountID == f.AccountID {
+		return true
+	}
+	if accounts.FeeAccountID != nil && *accounts.FeeAccountID == f.AccountID {
+		return true
+	}
+	for _, leg := range accounts.Legs {
+		if leg.AccountID == f.AccountID {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteEvent writes event in the Server-Sent Events format. The SSE id is the event's sequence, which a client sends
+// back as Last-Event-ID to resume the stream, and the data is the same JSON as the body of a webhook.
+func WriteEvent(w io.Writer, event *model.OutboxEvent) error {
+	data, err := json.Marshal(apimodel.NewWebhookEvent(event))
+	if err != nil {
+		return err
+	}
+	var sequence uint64
+	if event.Sequence != nil {
+		sequence = *event.Sequence
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", sequence, event.Type, data)
+	return err
+}
+
+// WriteComment writes an SSE comment, which clients ignore. Comments keep idle connections open and show whether
+// the client is still there.
+func WriteComment(w io.Writer, comment string) error {
+	_, err := fmt.Fprintf(w, ": %s\n\n", comment)
+	return err
+}
@@ -0,0 +1,102 @@
+package eventstream
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+)
+
+func testEvent(sequence uint64, eventType, payload string) model.OutboxEvent {
+	return model.OutboxEvent{
+		ID:        sequence + 100,
+		CreatedAt: time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+		Type:      eventType,
+		Payload:   model.JSON(payload),
+		Sequence:  &sequence,
+	}
+}
+
+func TestHub(t *testing.T) {
+	hub := NewHub()
+	first := hub.Subscribe()
+	second := hub.Subscribe()
+
+	hub.Publish([]model.OutboxEvent{testEvent(1, model.EventTypeAccountCreated, `{}`), testEvent(2, model.EventTypeAccountCreated, `{}`)})
+	for _, subscription := range []*Subscription{first, second} {
+		assert.Equal(t, uint64(1), *(<-subscription.Events).Sequence)
+		assert.Equal(t, uint64(2), *(<-subscription.Events).Sequence)
+	}
+
+	// Unsubscribing closes the channel and stops the events
+	hub.Unsubscribe(first)
+	hub.Publish([]model.OutboxEvent{testEvent(3, model.EventTypeAccountCreated, `{}`)})
+	_, ok := <-first.Events
+	assert.False(t, ok)
+	assert.Equal(t, uint64(3), *(<-second.Events).Sequence)
+	hub.Unsubscribe(first)
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	hub := NewHub()
+	slow := hub.Subscribe()
+
+	events := make([]model.OutboxEvent, bufferSize+1)
+	for i := range events {
+		events[i] = testEvent(uint64(i+1), model.EventTypeAccountCreated, `{}`)
+	}
+	hub.Publish(events)
+
+	// The subscriber gets what fits in its buffer and is then closed
+	received := 0
+	for range slow.Events {
+		received++
+	}
+	assert.Equal(t, bufferSize, received)
+
+	// Publishing to a hub without subscribers does not block
+	hub.Publish(events)
+}
+
+func TestFilterMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    model.OutboxEvent
+		expected bool
+	}{
+		{name: "account created", event: testEvent(1, model.EventTypeAccountCreated, `{"account_id": 7}`), expected: true},
+		{name: "other account created", event: testEvent(1, model.EventTypeAccountCreated, `{"account_id": 8}`)},
+		{name: "balance changed", event: testEvent(1, model.EventTypeBalanceChanged, `{"account_id": 7, "transfer_id": 3}`), expected: true},
+		{name: "transfer source", event: testEvent(1, model.EventTypeTransferCreated, `{"id": 7, "source_account_id": 7, "destination_account_id": 8}`), expected: true},
+		{name: "transfer destination", event: testEvent(1, model.EventTypeTransferCreated, `{"id": 7, "source_account_id": 8, "destination_account_id": 7}`), expected: true},
+		{name: "transfer fee account", event: testEvent(1, model.EventTypeTransferCreated, `{"source_account_id": 8, "destination_account_id": 9, "fee_account_id": 7}`), expected: true},
+		{name: "multi-leg transfer", event: testEvent(1, model.EventTypeTransferCreated, `{"legs": [{"account_id": 8}, {"account_id": 7}]}`), expected: true},
+		{name: "other transfer", event: testEvent(1, model.EventTypeTransferCreated, `{"id": 7, "source_account_id": 8, "destination_account_id": 9, "legs": [{"account_id": 10}]}`)},
+	}
+
+	filter := apimodel.EventStreamFilter{AccountID: 7}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Matches(filter, &tt.event))
+			assert.True(t, Matches(apimodel.EventStreamFilter{}, &tt.event))
+		})
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	event := testEvent(42, model.EventTypeBalanceChanged, `{"account_id": 7, "balance": "10"}`)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteEvent(&buf, &event))
+	assert.Equal(t, "id: 42\nevent: balance.changed\n"+
+		`data: {"id":142,"type":"balance.changed","created_at":"2024-03-01T09:30:00Z","data":{"account_id":7,"balance":"10"}}`+"\n\n",
+		buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteComment(&buf, "heartbeat"))
+	assert.Equal(t, ": heartbeat\n\n", buf.String())
+}
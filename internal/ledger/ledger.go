@@ -0,0 +1,152 @@
+// Package ledger rebuilds the accounts table from the ledger's event log.
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"internal-transfers-system/internal/model"
+)
+
+// AccountOpened is the event of a new account. The initial balance is part of the event rather than a transfer.
+type AccountOpened struct {
+	AccountID      uint64          `json:"account_id"`
+	Currency       string          `json:"currency"`
+	InitialBalance decimal.Decimal `json:"initial_balance"`
+	OpenedAt       time.Time       `json:"opened_at"`
+}
+
+// FundsTransferred is the event of a booked transfer of any kind. It lists the change to every account the transfer
+// posted to, fees included; FX positions are not accounts and are left out.
+type FundsTransferred struct {
+	TransferID uint64    `json:"transfer_id"`
+	Postings   []Posting `json:"postings"`
+}
+
+type Posting struct {
+	AccountID uint64          `json:"account_id"`
+	Currency  string          `json:"currency"`
+	Amount    decimal.Decimal `json:"amount"`
+}
+
+type AccountStatusChanged struct {
+	AccountID  uint64 `json:"account_id"`
+	FromStatus string `json:"from_status"`
+	ToStatus   string `json:"to_status"`
+	Reason     string `json:"reason"`
+}
+
+type OverdraftLimitChanged struct {
+	AccountID      uint64          `json:"account_id"`
+	OverdraftLimit decimal.Decimal `json:"overdraft_limit"`
+}
+
+// Projection is the state of the accounts table after the events applied to it so far. Events must be applied in
+// sequence order. An account's UpdatedAt is the time of its latest event, which is not necessarily the updated_at of
+// the live row, since some operations touch accounts without changing them.
+type Projection struct {
+	accounts map[uint64]*model.Account
+}
+
+func NewProjection() *Projection {
+	return &Projection{accounts: make(map[uint64]*model.Account)}
+}
+
+// Apply applies a single event. An event that does not fit the state so far, such as a transfer to an account that
+// was never opened, is an error, since the log is then not a faithful record of the accounts table.
+func (p *Projection) Apply(event *model.LedgerEvent) error {
+	if err := p.apply(event); err != nil {
+		return fmt.Errorf("event %d (%s): %w", event.Sequence, event.Type, err)
+	}
+	return nil
+}
+
+func (p *Projection) apply(event *model.LedgerEvent) error {
+	switch event.Type {
+	case model.LedgerEventAccountOpened:
+		var opened AccountOpened
+		if err := json.Unmarshal(event.Payload, &opened); err != nil {
+			return err
+		}
+		if _, ok := p.accounts[opened.AccountID]; ok {
+			return fmt.Errorf("account %d is already open", opened.AccountID)
+		}
+		p.accounts[opened.AccountID] = &model.Account{
+			ID:        opened.AccountID,
+			CreatedAt: opened.OpenedAt,
+			UpdatedAt: event.CreatedAt,
+			Balance:   opened.InitialBalance,
+			Currency:  opened.Currency,
+			Status:    model.AccountStatusActive,
+		}
+
+	case model.LedgerEventFundsTransferred:
+		var transferred FundsTransferred
+		if err := json.Unmarshal(event.Payload, &transferred); err != nil {
+			return err
+		}
+		for _, posting := range transferred.Postings {
+			account, err := p.account(posting.AccountID)
+			if err != nil {
+				return err
+			}
+			if account.Currency != posting.Currency {
+				return fmt.Errorf("posting in %s to account %d in %s", posting.Currency, account.ID, account.Currency)
+			}
+			account.Balance = account.Balance.Add(posting.Amount)
+			account.UpdatedAt = event.CreatedAt
+		}
+
+	case model.LedgerEventAccountStatusChanged:
+		var changed AccountStatusChanged
+		if err := json.Unmarshal(event.Payload, &changed); err != nil {
+			return err
+		}
+		account, err := p.account(changed.AccountID)
+		if err != nil {
+			return err
+		}
+		if account.Status != changed.FromStatus {
+			return fmt.Errorf("account %d is %s, not %s", account.ID, account.Status, changed.FromStatus)
+		}
+		account.Status = changed.ToStatus
+		account.UpdatedAt = event.CreatedAt
+
+	case model.LedgerEventOverdraftLimitChanged:
+		var changed OverdraftLimitChanged
+		if err := json.Unmarshal(event.Payload, &changed); err != nil {
+			return err
+		}
+		account, err := p.account(changed.AccountID)
+		if err != nil {
+			return err
+		}
+		account.OverdraftLimit = changed.OverdraftLimit
+		account.UpdatedAt = event.CreatedAt
+
+	default:
+		return fmt.Errorf("unknown event type")
+	}
+	return nil
+}
+
+func (p *Projection) account(id uint64) (*model.Account, error) {
+	account, ok := p.accounts[id]
+	if !ok {
+		return nil, fmt.Errorf("account %d has not been opened", id)
+	}
+	return account, nil
+}
+
+// Accounts returns the projected accounts in order of their ID.
+func (p *Projection) Accounts() []model.Account {
+	accounts := make([]model.Account, 0, len(p.accounts))
+	for _, account := range p.accounts {
+		accounts = append(accounts, *account)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	return accounts
+}
@@ -0,0 +1,107 @@
+package ledger
+
+import (
+	"encoding/json"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/model"
+	"testing"
+	"time"
+)
+
+var testEventTime = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+func testEvent(sequence uint64, eventType string, payload interface{}) *model.LedgerEvent {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		panic(err)
+	}
+	return &model.LedgerEvent{
+		Sequence:  sequence,
+		CreatedAt: testEventTime.Add(time.Duration(sequence) * time.Minute),
+		Type:      eventType,
+		Payload:   data,
+	}
+}
+
+func testPosting(accountID uint64, amount string) Posting {
+	return Posting{AccountID: accountID, Currency: "SGD", Amount: decimal.RequireFromString(amount)}
+}
+
+func TestProjection(t *testing.T) {
+	projection := NewProjection()
+	for _, event := range []*model.LedgerEvent{
+		testEvent(1, model.LedgerEventAccountOpened, AccountOpened{AccountID: 2, Currency: "SGD", InitialBalance: decimal.NewFromInt(0), OpenedAt: testEventTime}),
+		testEvent(2, model.LedgerEventAccountOpened, AccountOpened{AccountID: 1, Currency: "SGD", InitialBalance: decimal.NewFromInt(100), OpenedAt: testEventTime}),
+		testEvent(3, model.LedgerEventFundsTransferred, FundsTransferred{TransferID: 1, Postings: []Posting{testPosting(1, "-30.50"), testPosting(2, "30.50")}}),
+		testEvent(4, model.LedgerEventOverdraftLimitChanged, OverdraftLimitChanged{AccountID: 2, OverdraftLimit: decimal.NewFromInt(50)}),
+		testEvent(5, model.LedgerEventFundsTransferred, FundsTransferred{TransferID: 2, Postings: []Posting{testPosting(2, "-60"), testPosting(1, "60")}}),
+		testEvent(6, model.LedgerEventAccountStatusChanged, AccountStatusChanged{AccountID: 1, FromStatus: "active", ToStatus: "frozen", Reason: "review"}),
+	} {
+		require.NoError(t, projection.Apply(event))
+	}
+
+	accounts := projection.Accounts()
+	require.Len(t, accounts, 2)
+
+	assert.Equal(t, uint64(1), accounts[0].ID)
+	assert.Equal(t, "129.5", accounts[0].Balance.String())
+	assert.Equal(t, model.AccountStatusFrozen, accounts[0].Status)
+	assert.Equal(t, testEventTime, accounts[0].CreatedAt)
+	assert.Equal(t, testEventTime.Add(6*time.Minute), accounts[0].UpdatedAt)
+
+	assert.Equal(t, uint64(2), accounts[1].ID)
+	assert.Equal(t, "-29.5", accounts[1].Balance.String())
+	assert.Equal(t, "50", accounts[1].OverdraftLimit.String())
+	assert.Equal(t, model.AccountStatusActive, accounts[1].Status)
+	assert.Equal(t, testEventTime.Add(5*time.Minute), accounts[1].UpdatedAt)
+}
+
+func TestProjectionErrors(t *testing.T) {
+	opened := testEvent(1, model.LedgerEventAccountOpened, AccountOpened{AccountID: 1, Currency: "SGD", InitialBalance: decimal.NewFromInt(100), OpenedAt: testEventTime})
+	tests := []struct {
+		name  string
+		event *model.LedgerEvent
+		err   string
+	}{
+		{
+			name:  "Opening an open account",
+			event: testEvent(2, model.LedgerEventAccountOpened, AccountOpened{AccountID: 1, Currency: "SGD"}),
+			err:   "event 2 (AccountOpened): account 1 is already open",
+		},
+		{
+			name:  "Transfer to an unknown account",
+			event: testEvent(2, model.LedgerEventFundsTransferred, FundsTransferred{TransferID: 1, Postings: []Posting{testPosting(1, "-10"), testPosting(2, "10")}}),
+			err:   "event 2 (FundsTransferred): account 2 has not been opened",
+		},
+		{
+			name:  "Posting in another currency",
+			event: testEvent(2, model.LedgerEventFundsTransferred, FundsTransferred{TransferID: 1, Postings: []Posting{{AccountID: 1, Currency: "USD", Amount: decimal.NewFromInt(10)}}}),
+			err:   "event 2 (FundsTransferred): posting in USD to account 1 in SGD",
+		},
+		{
+			name:  "Status change from another status",
+			event: testEvent(2, model.LedgerEventAccountStatusChanged, AccountStatusChanged{AccountID: 1, FromStatus: "frozen", ToStatus: "active"}),
+			err:   "event 2 (AccountStatusChanged): account 1 is active, not frozen",
+		},
+		{
+			name:  "Unknown event type",
+			event: testEvent(2, "AccountMerged", struct{}{}),
+			err:   "event 2 (AccountMerged): unknown event type",
+		},
+		{
+			name:  "Malformed payload",
+			event: &model.LedgerEvent{Sequence: 2, Type: model.LedgerEventOverdraftLimitChanged, Payload: model.JSON(`{"account_id": "one"}`)},
+			err:   "event 2 (OverdraftLimitChanged): json: cannot unmarshal string into Go struct field OverdraftLimitChanged.account_id of type uint64",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projection := NewProjection()
+			require.NoError(t, projection.Apply(opened))
+			assert.EqualError(t, projection.Apply(tt.event), tt.err)
+		})
+	}
+}
@@ -5,9 +5,22 @@ import (
 	"time"
 )
 
+const (
+	AccountStatusActive = "active"
+	// AccountStatusFrozen accounts can receive money but cannot send it
+	AccountStatusFrozen = "frozen"
+	// AccountStatusClosed accounts can neither send nor receive money. Only accounts with a zero balance can be closed.
+	AccountStatusClosed = "closed"
+)
+
 type Account struct {
 	ID        uint64 `gorm:"primaryKey"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Balance   decimal.Decimal `gorm:"type:decimal(78,18);default:0"`
+	// Currency is an ISO 4217 code. It is set when the account is opened and never changes.
+	Currency string `gorm:"type:char(3);not null"`
+	Status   string `gorm:"not null;default:active"`
+	// OverdraftLimit is how far below zero the balance may go. Zero means the account cannot be overdrawn.
+	OverdraftLimit decimal.Decimal `gorm:"type:decimal(78,18);not null;default:0;check:chk_account_overdraft,overdraft_limit >= 0 AND balance >= -overdraft_limit"`
 }
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// AccountLimits overrides the default limits on how much an account can send. Unset fields fall back to the default.
+type AccountLimits struct {
+	AccountID uint64 `gorm:"primaryKey"`
+	UpdatedAt time.Time
+	// MaxTransferAmount caps a single transfer
+	MaxTransferAmount decimal.NullDecimal `gorm:"type:decimal(78,18)"`
+	// DailyAmount caps the total sent per UTC calendar day
+	DailyAmount decimal.NullDecimal `gorm:"type:decimal(78,18)"`
+	// Rolling30DayAmount caps the total sent over the last 30 days
+	Rolling30DayAmount decimal.NullDecimal `gorm:"column:rolling_30_day_amount;type:decimal(78,18)"`
+	// HourlyCount caps the number of transfers sent over the last hour
+	HourlyCount *int64
+	Account     *Account `gorm:"foreignKey:AccountID"`
+}
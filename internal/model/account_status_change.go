@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// AccountStatusChange records a change of an account's status and the reason given for it. The accounts table only
+// holds the current status.
+type AccountStatusChange struct {
+	ID         uint64 `gorm:"primaryKey;autoIncrement"`
+	CreatedAt  time.Time
+	AccountID  uint64   `gorm:"not null;index"`
+	FromStatus string   `gorm:"not null"`
+	ToStatus   string   `gorm:"not null"`
+	Reason     string   `gorm:"not null"`
+	Account    *Account `gorm:"foreignKey:AccountID"`
+}
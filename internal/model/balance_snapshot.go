@@ -0,0 +1,16 @@
+package model
+
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// BalanceSnapshot is the balance of an account as of a point in time, the sum of all of its journal entries created
+// up to and including AsOf. Snapshots are only taken for accounts that had postings since their previous snapshot.
+type BalanceSnapshot struct {
+	AccountID uint64          `gorm:"primaryKey"`
+	AsOf      time.Time       `gorm:"primaryKey"`
+	Balance   decimal.Decimal `gorm:"type:decimal(78,18);not null"`
+	CreatedAt time.Time
+	Account   *Account `gorm:"foreignKey:AccountID"`
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+const (
+	// The transfer types that fees are charged on. Cross-currency transfers are the ones converted with an FX quote.
+	FeeTransferTypeStandard      = "standard"
+	FeeTransferTypeCrossCurrency = "cross_currency"
+
+	FeeTypeFlat       = "flat"
+	FeeTypePercentage = "percentage"
+	FeeTypeTiered     = "tiered"
+)
+
+// FeeSchedule is the fee charged on transfers of TransferType in Currency. The fee is paid by the source account on
+// top of the amount and credited to RevenueAccountID, which is in the same currency.
+//
+// A flat fee charges FlatAmount. A percentage fee charges Percentage percent of the amount, but at least MinAmount and
+// at most MaxAmount when they are set. A tiered fee charges the amount of the first tier the transfer amount fits in.
+type FeeSchedule struct {
+	TransferType     string              `gorm:"primaryKey"`
+	Currency         string              `gorm:"type:char(3);primaryKey"`
+	Type             string              `gorm:"not null"`
+	RevenueAccountID uint64              `gorm:"not null"`
+	FlatAmount       decimal.NullDecimal `gorm:"type:decimal(78,18)"`
+	Percentage       decimal.NullDecimal `gorm:"type:decimal(78,18)"`
+	MinAmount        decimal.NullDecimal `gorm:"type:decimal(78,18)"`
+	MaxAmount        decimal.NullDecimal `gorm:"type:decimal(78,18)"`
+	Tiers            FeeTiers            `gorm:"type:jsonb"`
+	UpdatedAt        time.Time
+	RevenueAccount   *Account `gorm:"foreignKey:RevenueAccountID"`
+}
+
+// FeeTier charges Amount on transfers of up to UpTo, inclusive. The last tier of a schedule has no upper bound.
+type FeeTier struct {
+	UpTo   decimal.NullDecimal `json:"up_to"`
+	Amount decimal.Decimal     `json:"amount"`
+}
+
+// FeeTiers are stored as a JSON array, in ascending order of UpTo.
+type FeeTiers []FeeTier
+
+func (t FeeTiers) Value() (driver.Value, error) {
+	if t == nil {
+		return nil, nil
+	}
+	return json.Marshal(t)
+}
+
+func (t *FeeTiers) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, t)
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	}
+	return errors.New("unsupported type for fee tiers")
+}
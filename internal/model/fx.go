@@ -0,0 +1,29 @@
+package model
+
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// FXRate is the number of units of QuoteCurrency that one unit of BaseCurrency buys.
+type FXRate struct {
+	BaseCurrency  string          `gorm:"type:char(3);primaryKey"`
+	QuoteCurrency string          `gorm:"type:char(3);primaryKey"`
+	Rate          decimal.Decimal `gorm:"type:decimal(78,18);not null"`
+	UpdatedAt     time.Time
+}
+
+// FXQuote locks in a rate for converting SourceAmount into DestinationAmount until ExpiresAt. A quote can be used
+// by a single transfer.
+type FXQuote struct {
+	ID                  uint64 `gorm:"primaryKey;autoIncrement"`
+	CreatedAt           time.Time
+	SourceCurrency      string          `gorm:"type:char(3);not null"`
+	DestinationCurrency string          `gorm:"type:char(3);not null"`
+	SourceAmount        decimal.Decimal `gorm:"type:decimal(78,18);not null"`
+	DestinationAmount   decimal.Decimal `gorm:"type:decimal(78,18);not null"`
+	Rate                decimal.Decimal `gorm:"type:decimal(78,18);not null"`
+	// RoundingAdjustment is the converted amount rounded off to fit the destination currency's minor unit
+	RoundingAdjustment decimal.Decimal `gorm:"type:decimal(78,18);not null"`
+	ExpiresAt          time.Time       `gorm:"not null"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+const (
+	HoldStatusActive   = "active"
+	HoldStatusCaptured = "captured"
+	HoldStatusVoided   = "voided"
+	HoldStatusExpired  = "expired"
+)
+
+// Hold reserves funds on an account for a later transfer to the destination account. While a hold is active and
+// has not expired, its amount is not available for other transfers but is still part of the account balance.
+type Hold struct {
+	ID                   uint64 `gorm:"primaryKey;autoIncrement"`
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	AccountID            uint64              `gorm:"not null"`
+	DestinationAccountID uint64              `gorm:"not null"`
+	Amount               decimal.Decimal     `gorm:"type:decimal(78,18);not null"`
+	Currency             string              `gorm:"type:char(3);not null"`
+	Status               string              `gorm:"not null;default:active"`
+	ExpiresAt            time.Time           `gorm:"not null"`
+	CapturedAmount       decimal.NullDecimal `gorm:"type:decimal(78,18)"`
+	TransferID           *uint64
+	Account              *Account  `gorm:"foreignKey:AccountID"`
+	DestinationAccount   *Account  `gorm:"foreignKey:DestinationAccountID"`
+	Transfer             *Transfer `gorm:"foreignKey:TransferID"`
+}
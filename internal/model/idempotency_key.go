@@ -0,0 +1,15 @@
+package model
+
+import (
+	"time"
+)
+
+// IdempotencyKey records the outcome of a request made with an Idempotency-Key so that retries of the same request
+// are answered from the original result instead of being processed again.
+type IdempotencyKey struct {
+	Key         string `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	RequestHash string    `gorm:"not null"`
+	TransferID  uint64    `gorm:"not null"`
+	Transfer    *Transfer `gorm:"foreignKey:TransferID"`
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// JournalEntry is a single posting against an account. Amounts are signed: debits are negative and credits are
+// positive, so the postings of a transfer in each currency always sum to zero. Opening balances are posted without a
+// transfer. Cross-currency transfers also post to the FX position of each currency, which has no account and no
+// running balance.
+type JournalEntry struct {
+	ID           uint64 `gorm:"primaryKey;autoIncrement"`
+	CreatedAt    time.Time
+	TransferID   *uint64 `gorm:"index"`
+	AccountID    *uint64
+	Currency     string              `gorm:"type:char(3);not null"`
+	Amount       decimal.Decimal     `gorm:"type:decimal(78,18);not null"`
+	BalanceAfter decimal.NullDecimal `gorm:"type:decimal(78,18)"`
+	Transfer     *Transfer           `gorm:"foreignKey:TransferID"`
+	Account      *Account            `gorm:"foreignKey:AccountID"`
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"database/sql/driver"
+	"errors"
+)
+
+// JSON is a raw JSON value stored in a jsonb column. An empty value is stored as NULL.
+type JSON []byte
+
+func (j JSON) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+func (j *JSON) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*j = nil
+		return nil
+	case []byte:
+		*j = append(JSON(nil), v...)
+		return nil
+	case string:
+		*j = JSON(v)
+		return nil
+	}
+	return errors.New("unsupported type for JSON")
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	LedgerEventAccountOpened         = "AccountOpened"
+	LedgerEventFundsTransferred      = "FundsTransferred"
+	LedgerEventAccountStatusChanged  = "AccountStatusChanged"
+	LedgerEventOverdraftLimitChanged = "OverdraftLimitChanged"
+)
+
+// LedgerEvent is an entry in the append-only log of everything that changed the accounts table. Events are written
+// in the same DB transaction as the change, after the account rows have been updated, so the sequence orders the
+// events of each account the same way as the changes were made. The sequence can have gaps where a transaction
+// rolled back. Payload holds one of the event types of the ledger package.
+type LedgerEvent struct {
+	Sequence  uint64 `gorm:"primaryKey;autoIncrement"`
+	CreatedAt time.Time
+	Type      string `gorm:"not null"`
+	Payload   JSON   `gorm:"type:jsonb;not null"`
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	EventTypeAccountCreated  = "account.created"
+	EventTypeTransferCreated = "transfer.created"
+	EventTypeBalanceChanged  = "balance.changed"
+)
+
+// EventTypes are the types of events that can be subscribed to.
+var EventTypes = []string{EventTypeAccountCreated, EventTypeTransferCreated, EventTypeBalanceChanged}
+
+// OutboxEvent is written in the same DB transaction as the change it describes, so an event exists if and only if
+// the change was committed. Payload is the API representation of what changed. DispatchedAt is set once a webhook
+// delivery has been created for every subscription to the event.
+//
+// Sequence is the event's position in the event stream. IDs are taken when events are written, so a transaction can
+// commit an event with a lower ID than one that is already visible; sequence numbers are instead given out after
+// commit, in the order events are seen, so a reader that has seen sequence n never misses an event below it.
+type OutboxEvent struct {
+	ID           uint64 `gorm:"primaryKey;autoIncrement"`
+	CreatedAt    time.Time
+	Type         string `gorm:"not null"`
+	Payload      JSON   `gorm:"type:jsonb;not null"`
+	DispatchedAt *time.Time
+	Sequence     *uint64 `gorm:"uniqueIndex"`
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+const (
+	ScheduledTransferStatusPending   = "pending"
+	ScheduledTransferStatusCompleted = "completed"
+	ScheduledTransferStatusFailed    = "failed"
+	ScheduledTransferStatusCancelled = "cancelled"
+
+	ScheduledTransferAttemptSucceeded = "succeeded"
+	ScheduledTransferAttemptFailed    = "failed"
+)
+
+// ScheduledTransfer is a transfer that is booked by the scheduler once ExecuteAt has passed. A failed attempt is
+// retried at NextAttemptAt until the scheduler gives up and marks the transfer as failed.
+type ScheduledTransfer struct {
+	ID                   uint64 `gorm:"primaryKey;autoIncrement"`
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	SourceAccountID      uint64          `gorm:"not null"`
+	DestinationAccountID uint64          `gorm:"not null"`
+	Amount               decimal.Decimal `gorm:"type:decimal(78,18);not null"`
+	Currency             string          `gorm:"type:char(3);not null"`
+	Status               string          `gorm:"not null;default:pending"`
+	ExecuteAt            time.Time       `gorm:"not null"`
+	NextAttemptAt        time.Time       `gorm:"not null"`
+	AttemptCount         int             `gorm:"not null;default:0"`
+	// TransferID is set once the transfer has been booked
+	TransferID         *uint64
+	SourceAccount      *Account                   `gorm:"foreignKey:SourceAccountID"`
+	DestinationAccount *Account                   `gorm:"foreignKey:DestinationAccountID"`
+	Transfer           *Transfer                  `gorm:"foreignKey:TransferID"`
+	Attempts           []ScheduledTransferAttempt `gorm:"foreignKey:ScheduledTransferID"`
+}
+
+// ScheduledTransferAttempt records the outcome of one attempt to book a scheduled transfer.
+type ScheduledTransferAttempt struct {
+	ID                  uint64 `gorm:"primaryKey;autoIncrement"`
+	CreatedAt           time.Time
+	ScheduledTransferID uint64 `gorm:"not null;index"`
+	Status              string `gorm:"not null"`
+	// TransferID is set on a successful attempt and Error on a failed one
+	TransferID *uint64
+	Error      string    `gorm:"not null;default:''"`
+	Transfer   *Transfer `gorm:"foreignKey:TransferID"`
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+const (
+	StandingOrderFrequencyWeekly  = "weekly"
+	StandingOrderFrequencyMonthly = "monthly"
+	StandingOrderFrequencyCron    = "cron"
+
+	// What to do with an occurrence when the source account does not have the funds for it
+	InsufficientFundsSkip    = "skip"
+	InsufficientFundsRetry   = "retry"
+	InsufficientFundsSuspend = "suspend"
+
+	// What to do with the occurrences that were missed, e.g. while the server was down or the order was suspended
+	MissedOccurrencesSkip    = "skip"
+	MissedOccurrencesCatchUp = "catch_up"
+
+	StandingOrderStatusActive    = "active"
+	StandingOrderStatusSuspended = "suspended"
+	StandingOrderStatusCompleted = "completed"
+	StandingOrderStatusCancelled = "cancelled"
+
+	StandingOrderExecutionSucceeded = "succeeded"
+	StandingOrderExecutionFailed    = "failed"
+	StandingOrderExecutionSkipped   = "skipped"
+)
+
+// StandingOrder books the same transfer on a recurring schedule, starting at StartAt and ending after EndAt or
+// MaxOccurrences occurrences, whichever comes first. Every occurrence counts, whether it was booked or not.
+type StandingOrder struct {
+	ID                   uint64 `gorm:"primaryKey;autoIncrement"`
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	SourceAccountID      uint64          `gorm:"not null"`
+	DestinationAccountID uint64          `gorm:"not null"`
+	Amount               decimal.Decimal `gorm:"type:decimal(78,18);not null"`
+	Currency             string          `gorm:"type:char(3);not null"`
+	Frequency            string          `gorm:"not null"`
+	// CronExpression is only set for the cron frequency
+	CronExpression      string    `gorm:"not null;default:''"`
+	StartAt             time.Time `gorm:"not null"`
+	EndAt               *time.Time
+	MaxOccurrences      *int
+	OnInsufficientFunds string `gorm:"not null"`
+	// RetryCount is how many times an occurrence is retried when OnInsufficientFunds is retry
+	RetryCount int `gorm:"not null;default:0"`
+	// MissedOccurrences is skip to only book the latest due occurrence when the order fell behind, or catch_up to
+	// book every occurrence that was missed
+	MissedOccurrences string `gorm:"not null;default:skip"`
+	Status            string `gorm:"not null;default:active"`
+	// NextRunAt is when the current occurrence is due and NextAttemptAt when it is attempted next, which is later
+	// than NextRunAt while the occurrence is being retried
+	NextRunAt       time.Time `gorm:"not null"`
+	NextAttemptAt   time.Time `gorm:"not null"`
+	OccurrenceCount int       `gorm:"not null;default:0"`
+	// AttemptCount is the number of failed attempts of the current occurrence
+	AttemptCount       int                      `gorm:"not null;default:0"`
+	SourceAccount      *Account                 `gorm:"foreignKey:SourceAccountID"`
+	DestinationAccount *Account                 `gorm:"foreignKey:DestinationAccountID"`
+	Executions         []StandingOrderExecution `gorm:"foreignKey:StandingOrderID"`
+}
+
+// StandingOrderExecution records an attempt to book an occurrence of a standing order, and links the standing order
+// to the transfers it generated.
+type StandingOrderExecution struct {
+	ID              uint64 `gorm:"primaryKey;autoIncrement"`
+	CreatedAt       time.Time
+	StandingOrderID uint64    `gorm:"not null;index"`
+	OccurrenceAt    time.Time `gorm:"not null"`
+	Status          string    `gorm:"not null"`
+	// TransferID is set on a successful execution and Error otherwise
+	TransferID *uint64   `gorm:"uniqueIndex"`
+	Error      string    `gorm:"not null;default:''"`
+	Transfer   *Transfer `gorm:"foreignKey:TransferID"`
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+const (
+	StatementLineAccountOpened = "account_opened"
+	StatementLineTransfer      = "transfer"
+	StatementLineFee           = "fee"
+)
+
+// Statement lists the movements of an account's balance between From (inclusive) and To (exclusive). It is not
+// stored but built from the account's transfers.
+type Statement struct {
+	Account        Account
+	From           time.Time
+	To             time.Time
+	OpeningBalance decimal.Decimal
+	ClosingBalance decimal.Decimal
+	Lines          []StatementLine
+}
+
+// StatementLine is a single movement on a statement. Amount is signed: debits are negative and credits are positive.
+// Balance is the running balance after the line.
+type StatementLine struct {
+	Date       time.Time
+	Type       string
+	TransferID *uint64
+	// CounterpartyAccountID is the other account of a transfer. Multi-leg transfers have no single counterparty.
+	CounterpartyAccountID *uint64
+	Reference             string
+	Description           string
+	Amount                decimal.Decimal
+	Balance               decimal.Decimal
+}
@@ -5,12 +5,51 @@ import (
 	"time"
 )
 
+// Transfer moves money from a source account to a destination account. A multi-leg transfer moves money between
+// several accounts instead; it has no source or destination account and its Legs say how much was debited from or
+// credited to each account. Amount is then the total debited.
 type Transfer struct {
 	ID                   uint64 `gorm:"primaryKey;autoIncrement"`
 	CreatedAt            time.Time
-	SourceAccountID      uint64          `gorm:"not null"`
-	DestinationAccountID uint64          `gorm:"not null"`
-	Amount               decimal.Decimal `gorm:"type:decimal(78,18);not null"`
-	SourceAccount        *Account        `gorm:"foreignKey:SourceAccountID"`
-	DestinationAccount   *Account        `gorm:"foreignKey:DestinationAccountID"`
+	SourceAccountID      *uint64 `gorm:"uniqueIndex:idx_transfers_source_account_id_external_id,priority:1"`
+	DestinationAccountID *uint64
+	Amount               decimal.Decimal     `gorm:"type:decimal(78,18);not null"`
+	Currency             string              `gorm:"type:char(3);not null"`
+	SourceBalanceAfter   decimal.NullDecimal `gorm:"type:decimal(78,18)"`
+	// DestinationAmount is credited to the destination account in DestinationCurrency. It only differs from Amount
+	// and Currency for cross-currency transfers.
+	DestinationAmount   decimal.Decimal `gorm:"type:decimal(78,18);not null"`
+	DestinationCurrency string          `gorm:"type:char(3);not null"`
+	// The FX fields are only set on cross-currency transfers. FXRate is the number of units of DestinationCurrency
+	// per unit of Currency and FXRoundingAdjustment is what was rounded off the converted amount.
+	FXRate               decimal.NullDecimal `gorm:"type:decimal(78,18)"`
+	FXRoundingAdjustment decimal.NullDecimal `gorm:"type:decimal(78,18)"`
+	FXQuoteID            *uint64             `gorm:"uniqueIndex"`
+	// ReversalOfID is set on transfers that reverse, fully or partially, an earlier transfer
+	ReversalOfID *uint64 `gorm:"index"`
+	// FeeAmount is the fee charged to the source account on top of Amount, in Currency, and credited to FeeAccountID.
+	// Both are only set on transfers that were charged a fee.
+	FeeAmount    decimal.NullDecimal `gorm:"type:decimal(78,18)"`
+	FeeAccountID *uint64
+	// Reference, Description and Metadata are supplied by the client for its own records. Metadata is a JSON object.
+	Reference   string `gorm:"not null;default:''"`
+	Description string `gorm:"not null;default:''"`
+	Metadata    JSON   `gorm:"type:jsonb"`
+	// ExternalID is the client's own ID for the transfer, unique among the transfers from the same source account
+	ExternalID *string `gorm:"uniqueIndex:idx_transfers_source_account_id_external_id,priority:2"`
+	// BatchID is set on transfers that were submitted as part of a batch
+	BatchID *uint64 `gorm:"index"`
+	// ChainSequence is the transfer's position in the tamper-evident chain of transfers and Hash chains it to the
+	// transfer before it (see the transferchain package). Both are set in the DB transaction that books the transfer,
+	// in the order the transactions commit, so the chain order is not necessarily the order of the IDs.
+	ChainSequence      *uint64        `gorm:"uniqueIndex"`
+	Hash               *string        `gorm:"type:char(64)"`
+	SourceAccount      *Account       `gorm:"foreignKey:SourceAccountID"`
+	DestinationAccount *Account       `gorm:"foreignKey:DestinationAccountID"`
+	ReversalOf         *Transfer      `gorm:"foreignKey:ReversalOfID"`
+	FXQuote            *FXQuote       `gorm:"foreignKey:FXQuoteID"`
+	Batch              *TransferBatch `gorm:"foreignKey:BatchID"`
+	FeeAccount         *Account       `gorm:"foreignKey:FeeAccountID"`
+	Reversals          []Transfer     `gorm:"foreignKey:ReversalOfID"`
+	Legs               []TransferLeg  `gorm:"foreignKey:TransferID"`
 }
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+const (
+	// In an atomic batch either every transfer is booked or none is
+	TransferBatchModeAtomic = "atomic"
+	// In a best-effort batch every transfer is booked or rejected on its own
+	TransferBatchModeBestEffort = "best_effort"
+)
+
+// TransferBatch groups the transfers that were submitted together through the batch endpoint.
+type TransferBatch struct {
+	ID        uint64 `gorm:"primaryKey;autoIncrement"`
+	CreatedAt time.Time
+	Mode      string     `gorm:"not null"`
+	ItemCount int        `gorm:"not null"`
+	Transfers []Transfer `gorm:"foreignKey:BatchID"`
+}
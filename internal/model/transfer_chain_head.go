@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+// TransferChainHeadID is the ID of the only row of transfer_chain_heads.
+const TransferChainHeadID = 1
+
+// TransferChainHead is the last transfer of the tamper-evident chain of transfers. It is moved on in the same DB
+// transaction as every transfer is chained, and the database only lets it move forward, so transfers removed from the
+// end of the chain leave the head pointing past the end.
+type TransferChainHead struct {
+	ID            int `gorm:"primaryKey"`
+	UpdatedAt     time.Time
+	ChainSequence uint64 `gorm:"not null"`
+	// Hash is empty until the first transfer is chained
+	Hash string `gorm:"not null"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// TransferLeg is the part of a multi-leg transfer that debits or credits a single account. Like journal entries,
+// amounts are signed: debits are negative and credits are positive, and the legs of a transfer sum to zero.
+type TransferLeg struct {
+	ID           uint64 `gorm:"primaryKey;autoIncrement"`
+	CreatedAt    time.Time
+	TransferID   uint64          `gorm:"not null;index"`
+	AccountID    uint64          `gorm:"not null"`
+	Amount       decimal.Decimal `gorm:"type:decimal(78,18);not null"`
+	BalanceAfter decimal.Decimal `gorm:"type:decimal(78,18);not null"`
+	Account      *Account        `gorm:"foreignKey:AccountID"`
+}
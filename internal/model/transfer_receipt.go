@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+)
+
+// TransferReceipt is the signed receipt of a transfer. Payload is the canonical JSON that was signed, kept as text so
+// that it is returned exactly as it was signed, and KeyID is the key that signed it.
+type TransferReceipt struct {
+	TransferID uint64 `gorm:"primaryKey"`
+	CreatedAt  time.Time
+	KeyID      string    `gorm:"not null"`
+	Payload    string    `gorm:"not null"`
+	Signature  string    `gorm:"not null"`
+	Transfer   *Transfer `gorm:"foreignKey:TransferID"`
+}
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	WebhookDeliveryStatusPending   = "pending"
+	WebhookDeliveryStatusDelivered = "delivered"
+	// WebhookDeliveryStatusDead deliveries gave up after too many failed attempts, until they are replayed
+	WebhookDeliveryStatusDead = "dead"
+)
+
+// WebhookSubscription registers an endpoint for outbox events. Deliveries are signed with Secret. A subscription
+// without event types receives every event.
+type WebhookSubscription struct {
+	ID         uint64 `gorm:"primaryKey;autoIncrement"`
+	CreatedAt  time.Time
+	URL        string     `gorm:"not null"`
+	Secret     string     `gorm:"not null"`
+	EventTypes StringList `gorm:"type:jsonb;not null"`
+}
+
+// Matches reports whether the subscription receives events of the given type.
+func (s *WebhookSubscription) Matches(eventType string) bool {
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is the delivery of an event to a subscription. A failed attempt is retried at NextAttemptAt, with
+// an exponential backoff, until the delivery is given up as dead.
+type WebhookDelivery struct {
+	ID             uint64 `gorm:"primaryKey;autoIncrement"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	EventID        uint64    `gorm:"not null;index"`
+	SubscriptionID uint64    `gorm:"not null;index"`
+	Status         string    `gorm:"not null;default:pending"`
+	AttemptCount   int       `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time `gorm:"not null"`
+	// The outcome of the last attempt. LastStatusCode is not set if no response was received.
+	LastAttemptAt  *time.Time
+	LastStatusCode *int
+	LastError      string `gorm:"not null;default:''"`
+	DeliveredAt    *time.Time
+	Event          *OutboxEvent         `gorm:"foreignKey:EventID"`
+	Subscription   *WebhookSubscription `gorm:"foreignKey:SubscriptionID;constraint:OnDelete:CASCADE"`
+}
+
+// StringList is stored as a JSON array.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	return json.Marshal(l)
+}
+
+func (l *StringList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	}
+	return errors.New("unsupported type for string list")
+}
@@ -0,0 +1,184 @@
+// Package receipt signs transfer receipts and verifies them. A receipt is signed with Ed25519 over its canonical
+// JSON, which is the receipt encoded by encoding/json without HTML escaping: fields in the order of apimodel.Receipt
+// and no insignificant whitespace. Verification re-encodes the receipt it is given, so a receipt still verifies after
+// it has been decoded and passed around, as long as none of its values changed.
+package receipt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"internal-transfers-system/internal/apimodel"
+)
+
+// Algorithm is the signature algorithm of every receipt key.
+const Algorithm = "Ed25519"
+
+var (
+	ErrUnknownKey       = errors.New("receipt is signed with an unknown key")
+	ErrInvalidSignature = errors.New("receipt signature is invalid")
+)
+
+// Key is a signing key and the ID receipts refer to it by.
+type Key struct {
+	ID         string
+	PrivateKey ed25519.PrivateKey
+}
+
+// PublicKey is a key receipts are verified with.
+type PublicKey struct {
+	ID  string
+	Key ed25519.PublicKey
+}
+
+// ParseKeys parses signing keys written as comma-separated <key id>:<base64 seed> pairs, where the seed is the
+// 32-byte Ed25519 private key seed.
+func ParseKeys(value string) ([]Key, error) {
+	var keys []Key
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(pair, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("receipt key %q is not <key id>:<base64 seed>", pair)
+		}
+		seed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("receipt key %s is not a base64 %d-byte seed", id, ed25519.SeedSize)
+		}
+		keys = append(keys, Key{ID: id, PrivateKey: ed25519.NewKeyFromSeed(seed)})
+	}
+	return keys, nil
+}
+
+// Signer signs receipts with its current key. It also keeps the keys that were rotated out, so that their public
+// keys can still be published and the receipts signed with them verified.
+type Signer struct {
+	current Key
+	keys    []Key
+}
+
+// NewSigner returns a Signer that signs with the key currentID, which must be one of keys.
+func NewSigner(currentID string, keys []Key) (*Signer, error) {
+	seen := make(map[string]bool, len(keys))
+	signer := &Signer{keys: keys}
+	for _, key := range keys {
+		if seen[key.ID] {
+			return nil, fmt.Errorf("receipt key %s is given more than once", key.ID)
+		}
+		seen[key.ID] = true
+		if key.ID == currentID {
+			signer.current = key
+		}
+	}
+	if !seen[currentID] {
+		return nil, fmt.Errorf("current receipt key %q is not one of the receipt keys", currentID)
+	}
+	return signer, nil
+}
+
+// CurrentKeyID returns the ID of the key new receipts are signed with.
+func (s *Signer) CurrentKeyID() string {
+	return s.current.ID
+}
+
+// PublicKeys returns the public keys of all of the signer's keys, in the order they were given.
+func (s *Signer) PublicKeys() []PublicKey {
+	keys := make([]PublicKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, PublicKey{ID: key.ID, Key: key.PrivateKey.Public().(ed25519.PublicKey)})
+	}
+	return keys
+}
+
+// Sign sets the receipt's key to the current key and signs it. It returns the canonical JSON that was signed and the
+// base64 signature.
+func (s *Signer) Sign(receipt *apimodel.Receipt) ([]byte, string, error) {
+	receipt.KeyID = s.current.ID
+	canonical, err := Canonical(receipt)
+	if err != nil {
+		return nil, "", err
+	}
+	signature := ed25519.Sign(s.current.PrivateKey, canonical)
+	return canonical, base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// Canonical returns the bytes of the receipt that are signed.
+func Canonical(receipt *apimodel.Receipt) ([]byte, error) {
+	var canonical bytes.Buffer
+	encoder := json.NewEncoder(&canonical)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(receipt); err != nil {
+		return nil, err
+	}
+	// The encoder ends every value with a newline
+	return bytes.TrimSuffix(canonical.Bytes(), []byte("\n")), nil
+}
+
+// Verify checks the signature of a receipt against the key it names among keys. It returns ErrUnknownKey if the key
+// is not one of keys and ErrInvalidSignature if the signature does not match.
+func Verify(keys []PublicKey, signed *apimodel.SignedReceiptResponse) error {
+	var key ed25519.PublicKey
+	for _, candidate := range keys {
+		if candidate.ID == signed.Receipt.KeyID {
+			key = candidate.Key
+			break
+		}
+	}
+	if key == nil {
+		return ErrUnknownKey
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	canonical, err := Canonical(&signed.Receipt)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, canonical, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// PublicKeysFromResponse reads the keys published by GET /receipts/keys.
+func PublicKeysFromResponse(response *apimodel.ReceiptKeyListResponse) ([]PublicKey, error) {
+	keys := make([]PublicKey, 0, len(response.Keys))
+	for _, key := range response.Keys {
+		if key.Algorithm != Algorithm {
+			return nil, fmt.Errorf("receipt key %s uses unsupported algorithm %s", key.KeyID, key.Algorithm)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(key.PublicKey)
+		if err != nil || len(decoded) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("receipt key %s is not a base64 Ed25519 public key", key.KeyID)
+		}
+		keys = append(keys, PublicKey{ID: key.KeyID, Key: decoded})
+	}
+	return keys, nil
+}
+
+// NewKeyListResponse is the response of GET /receipts/keys for the signer's keys.
+func NewKeyListResponse(signer *Signer) apimodel.ReceiptKeyListResponse {
+	response := apimodel.ReceiptKeyListResponse{Keys: []apimodel.ReceiptKeyResponse{}}
+	if signer == nil {
+		return response
+	}
+	for _, key := range signer.PublicKeys() {
+		response.Keys = append(response.Keys, apimodel.ReceiptKeyResponse{
+			KeyID:     key.ID,
+			Algorithm: Algorithm,
+			PublicKey: base64.StdEncoding.EncodeToString(key.Key),
+			Current:   key.ID == signer.CurrentKeyID(),
+		})
+	}
+	return response
+}
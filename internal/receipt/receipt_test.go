@@ -0,0 +1,182 @@
+package receipt
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"testing"
+	"time"
+)
+
+const (
+	testKey2023 = "2023:JV0p/EFcyf6q2enBChWg+IvplFSsnr8KXIjVj7JpiEw="
+	testKey2024 = "2024:A9C++zb68EG5Q/d0ieCTDL+xMThvKrU9xlY0jui07iA="
+)
+
+func testSigner(t *testing.T, currentID string) *Signer {
+	keys, err := ParseKeys(testKey2023 + ", " + testKey2024)
+	require.NoError(t, err)
+	signer, err := NewSigner(currentID, keys)
+	require.NoError(t, err)
+	return signer
+}
+
+func testReceipt() apimodel.Receipt {
+	return apimodel.Receipt{
+		IssuedAt: time.Date(2024, 3, 1, 9, 30, 0, 123456000, time.UTC),
+		Transfer: apimodel.TransferResponse{
+			ID:                   7,
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               "30.5",
+			Currency:             "SGD",
+			SourceBalance:        "69.5",
+			DestinationAmount:    "30.5",
+			DestinationCurrency:  "SGD",
+			CreatedAt:            time.Date(2024, 3, 1, 9, 29, 59, 0, time.UTC),
+			Reference:            "<INV-1> & co",
+			Metadata:             json.RawMessage(`{"order": 42}`),
+		},
+		Balances: []apimodel.ReceiptBalance{
+			{AccountID: 1, Currency: "SGD", Balance: "69.5"},
+			{AccountID: 2, Currency: "SGD", Balance: "130.5"},
+		},
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys(testKey2023 + "," + testKey2024 + ",")
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "2023", keys[0].ID)
+	assert.Equal(t, "2024", keys[1].ID)
+
+	keys, err = ParseKeys("")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	for _, value := range []string{
+		"2024",
+		":A9C++zb68EG5Q/d0ieCTDL+xMThvKrU9xlY0jui07iA=",
+		"2024:not base64",
+		"2024:c2hvcnQ=",
+	} {
+		_, err := ParseKeys(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestNewSigner(t *testing.T) {
+	keys, err := ParseKeys(testKey2023 + "," + testKey2024)
+	require.NoError(t, err)
+
+	_, err = NewSigner("2025", keys)
+	assert.EqualError(t, err, `current receipt key "2025" is not one of the receipt keys`)
+
+	_, err = NewSigner("2024", append(keys, keys[1]))
+	assert.EqualError(t, err, "receipt key 2024 is given more than once")
+}
+
+func TestSignAndVerify(t *testing.T) {
+	signer := testSigner(t, "2024")
+	receipt := testReceipt()
+	canonical, signature, err := signer.Sign(&receipt)
+	require.NoError(t, err)
+	assert.Equal(t, "2024", receipt.KeyID)
+	assert.Equal(t, `{"key_id":"2024","issued_at":"2024-03-01T09:30:00.123456Z","transfer":{"id":7,"source_account_id":1,`+
+		`"destination_account_id":2,"amount":"30.5","currency":"SGD","source_balance":"69.5","destination_amount":"30.5",`+
+		`"destination_currency":"SGD","created_at":"2024-03-01T09:29:59Z","reference":"<INV-1> & co",`+
+		`"metadata":{"order":42}},"balances":[{"account_id":1,"currency":"SGD","balance":"69.5"},`+
+		`{"account_id":2,"currency":"SGD","balance":"130.5"}]}`, string(canonical))
+
+	signed := apimodel.SignedReceiptResponse{Receipt: receipt, Signature: signature}
+	assert.NoError(t, Verify(signer.PublicKeys(), &signed))
+
+	// The receipt still verifies after it has been sent and decoded
+	encoded, err := json.MarshalIndent(signed, "", "  ")
+	require.NoError(t, err)
+	var decoded apimodel.SignedReceiptResponse
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.NoError(t, Verify(signer.PublicKeys(), &decoded))
+
+	tests := []struct {
+		name   string
+		change func(signed *apimodel.SignedReceiptResponse)
+		err    error
+	}{
+		{
+			name:   "Changed amount",
+			change: func(signed *apimodel.SignedReceiptResponse) { signed.Receipt.Transfer.Amount = "30.6" },
+			err:    ErrInvalidSignature,
+		},
+		{
+			name:   "Changed balance",
+			change: func(signed *apimodel.SignedReceiptResponse) { signed.Receipt.Balances[1].Balance = "131" },
+			err:    ErrInvalidSignature,
+		},
+		{
+			name:   "Claimed to be signed by another key",
+			change: func(signed *apimodel.SignedReceiptResponse) { signed.Receipt.KeyID = "2023" },
+			err:    ErrInvalidSignature,
+		},
+		{
+			name:   "Unknown key",
+			change: func(signed *apimodel.SignedReceiptResponse) { signed.Receipt.KeyID = "2025" },
+			err:    ErrUnknownKey,
+		},
+		{
+			name:   "Malformed signature",
+			change: func(signed *apimodel.SignedReceiptResponse) { signed.Signature = "not base64" },
+			err:    ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changed apimodel.SignedReceiptResponse
+			require.NoError(t, json.Unmarshal(encoded, &changed))
+			tt.change(&changed)
+			assert.ErrorIs(t, Verify(signer.PublicKeys(), &changed), tt.err)
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := testSigner(t, "2023")
+	receipt := testReceipt()
+	_, signature, err := old.Sign(&receipt)
+	require.NoError(t, err)
+	signed := apimodel.SignedReceiptResponse{Receipt: receipt, Signature: signature}
+
+	// Receipts signed before the rotation verify against the published keys of the new signer
+	rotated := testSigner(t, "2024")
+	response := NewKeyListResponse(rotated)
+	require.Len(t, response.Keys, 2)
+	assert.Equal(t, "2023", response.Keys[0].KeyID)
+	assert.False(t, response.Keys[0].Current)
+	assert.Equal(t, "2024", response.Keys[1].KeyID)
+	assert.True(t, response.Keys[1].Current)
+	assert.Equal(t, Algorithm, response.Keys[1].Algorithm)
+
+	keys, err := PublicKeysFromResponse(&response)
+	require.NoError(t, err)
+	assert.NoError(t, Verify(keys, &signed))
+
+	// Until the old key is no longer published
+	assert.ErrorIs(t, Verify(keys[1:], &signed), ErrUnknownKey)
+}
+
+func TestPublicKeysFromResponse(t *testing.T) {
+	_, err := PublicKeysFromResponse(&apimodel.ReceiptKeyListResponse{Keys: []apimodel.ReceiptKeyResponse{
+		{KeyID: "2024", Algorithm: "RSA", PublicKey: "c2hvcnQ="},
+	}})
+	assert.EqualError(t, err, "receipt key 2024 uses unsupported algorithm RSA")
+
+	_, err = PublicKeysFromResponse(&apimodel.ReceiptKeyListResponse{Keys: []apimodel.ReceiptKeyResponse{
+		{KeyID: "2024", Algorithm: Algorithm, PublicKey: "c2hvcnQ="},
+	}})
+	assert.EqualError(t, err, "receipt key 2024 is not a base64 Ed25519 public key")
+
+	assert.Empty(t, NewKeyListResponse(nil).Keys)
+}
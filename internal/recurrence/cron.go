@@ -0,0 +1,133 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearchLimit bounds the search for the next occurrence of expressions that never match, such as February 30th.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// cronField is a set of allowed values, one bit per value.
+type cronField uint64
+
+func (f cronField) has(value int) bool {
+	return f&(1<<uint(value)) != 0
+}
+
+type cron struct {
+	minute, hour, dayOfMonth, month, dayOfWeek cronField
+	// Like in cron(8), if both day fields are restricted, a day matches if either of them does
+	dayOfMonthAny, dayOfWeekAny bool
+}
+
+// ParseCron parses a standard five-field cron expression (minute, hour, day of month, month, day of week). Fields
+// take numbers, "*", ranges ("1-5"), steps ("*/15", "0-30/10") and comma separated lists of these. Day of week 0 and
+// 7 are both Sunday. Occurrences are in UTC.
+func ParseCron(expression string) (Schedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields, got %d", len(fields))
+	}
+
+	var s cron
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, "minute"); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, "hour"); err != nil {
+		return nil, err
+	}
+	if s.dayOfMonth, err = parseCronField(fields[2], 1, 31, "day of month"); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, "month"); err != nil {
+		return nil, err
+	}
+	if s.dayOfWeek, err = parseCronField(fields[4], 0, 7, "day of week"); err != nil {
+		return nil, err
+	}
+	if s.dayOfWeek.has(7) {
+		s.dayOfWeek |= 1
+	}
+	s.dayOfMonthAny = fields[2] == "*"
+	s.dayOfWeekAny = fields[4] == "*"
+	return s, nil
+}
+
+func parseCronField(field string, min, max int, name string) (cronField, error) {
+	var result cronField
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field %q", name, field)
+			}
+		}
+
+		low, high := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err1, err2 error
+			low, err1 = strconv.Atoi(bounds[0])
+			high, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range in %s field %q", name, field)
+			}
+		default:
+			value, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in %s field %q", name, field)
+			}
+			// "5/10" means from 5 to the maximum in steps of 10
+			low = value
+			if step == 1 {
+				high = value
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%s field %q must be between %d and %d", name, field, min, max)
+		}
+
+		for value := low; value <= high; value += step {
+			result |= 1 << uint(value)
+		}
+	}
+	return result, nil
+}
+
+func (s cron) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+		switch {
+		case !s.month.has(int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !s.hour.has(t.Hour()):
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case !s.minute.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s cron) dayMatches(t time.Time) bool {
+	dayOfMonth := s.dayOfMonth.has(t.Day())
+	dayOfWeek := s.dayOfWeek.has(int(t.Weekday()))
+	if s.dayOfMonthAny || s.dayOfWeekAny {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
@@ -0,0 +1,75 @@
+package recurrence
+
+import (
+	"time"
+)
+
+// Schedule yields the occurrences of a recurring event.
+type Schedule interface {
+	// Next returns the first occurrence strictly after t, or the zero time if there is none.
+	Next(t time.Time) time.Time
+}
+
+// First returns the first occurrence at or after t.
+func First(schedule Schedule, t time.Time) time.Time {
+	return schedule.Next(t.Add(-time.Nanosecond))
+}
+
+type weekly struct {
+	start time.Time
+}
+
+// Weekly occurs every seven days from start, at the same time of day in start's location.
+func Weekly(start time.Time) Schedule {
+	return weekly{start: start}
+}
+
+func (s weekly) Next(t time.Time) time.Time {
+	// Start from an estimate a week early, since a DST change can make the calendar weeks an hour shorter
+	weeks := int(t.Sub(s.start)/(7*24*time.Hour)) - 1
+	if weeks < 0 {
+		weeks = 0
+	}
+	for {
+		next := s.start.AddDate(0, 0, 7*weeks)
+		if next.After(t) {
+			return next
+		}
+		weeks++
+	}
+}
+
+type monthly struct {
+	start time.Time
+}
+
+// Monthly occurs on start's day of the month, at the same time of day in start's location. In months that are too
+// short, e.g. for the 31st, it occurs on the last day of the month instead.
+func Monthly(start time.Time) Schedule {
+	return monthly{start: start}
+}
+
+func (s monthly) Next(t time.Time) time.Time {
+	months := (t.Year()-s.start.Year())*12 + int(t.Month()) - int(s.start.Month()) - 1
+	if months < 0 {
+		months = 0
+	}
+	for {
+		next := s.occurrence(months)
+		if next.After(t) {
+			return next
+		}
+		months++
+	}
+}
+
+// occurrence returns the nth occurrence after start, start being the 0th.
+func (s monthly) occurrence(n int) time.Time {
+	firstOfMonth := time.Date(s.start.Year(), s.start.Month()+time.Month(n), 1, 0, 0, 0, 0, s.start.Location())
+	day := s.start.Day()
+	if lastDay := firstOfMonth.AddDate(0, 1, -1).Day(); day > lastDay {
+		day = lastDay
+	}
+	return time.Date(firstOfMonth.Year(), firstOfMonth.Month(), day,
+		s.start.Hour(), s.start.Minute(), s.start.Second(), s.start.Nanosecond(), s.start.Location())
+}
@@ -0,0 +1,89 @@
+package recurrence
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestWeekly(t *testing.T) {
+	schedule := Weekly(date(2024, 3, 4, 9, 0))
+
+	assert.Equal(t, date(2024, 3, 4, 9, 0), First(schedule, date(2024, 1, 1, 0, 0)))
+	assert.Equal(t, date(2024, 3, 4, 9, 0), First(schedule, date(2024, 3, 4, 9, 0)))
+	assert.Equal(t, date(2024, 3, 11, 9, 0), schedule.Next(date(2024, 3, 4, 9, 0)))
+	assert.Equal(t, date(2024, 5, 6, 9, 0), schedule.Next(date(2024, 5, 1, 0, 0)))
+}
+
+func TestWeeklyKeepsTheTimeOfDayAcrossDST(t *testing.T) {
+	location, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+	schedule := Weekly(time.Date(2024, 3, 25, 9, 0, 0, 0, location))
+
+	next := schedule.Next(time.Date(2024, 10, 25, 0, 0, 0, 0, location))
+	assert.Equal(t, time.Date(2024, 10, 28, 9, 0, 0, 0, location), next)
+}
+
+func TestMonthly(t *testing.T) {
+	tests := []struct {
+		name     string
+		start    time.Time
+		after    time.Time
+		expected time.Time
+	}{
+		{name: "before the start", start: date(2024, 1, 15, 9, 0), after: date(2023, 12, 1, 0, 0), expected: date(2024, 1, 15, 9, 0)},
+		{name: "next month", start: date(2024, 1, 15, 9, 0), after: date(2024, 1, 15, 9, 0), expected: date(2024, 2, 15, 9, 0)},
+		{name: "later in the same month", start: date(2024, 1, 15, 9, 0), after: date(2024, 6, 10, 0, 0), expected: date(2024, 6, 15, 9, 0)},
+		{name: "across the year", start: date(2024, 1, 15, 9, 0), after: date(2024, 12, 20, 0, 0), expected: date(2025, 1, 15, 9, 0)},
+		{name: "short month", start: date(2024, 1, 31, 9, 0), after: date(2024, 1, 31, 9, 0), expected: date(2024, 2, 29, 9, 0)},
+		{name: "back to the 31st", start: date(2024, 1, 31, 9, 0), after: date(2024, 2, 29, 9, 0), expected: date(2024, 3, 31, 9, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Monthly(tt.start).Next(tt.after))
+		})
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expression string
+		after      time.Time
+		expected   time.Time
+	}{
+		{expression: "*/15 * * * *", after: date(2024, 3, 1, 10, 7), expected: date(2024, 3, 1, 10, 15)},
+		{expression: "0 9 * * *", after: date(2024, 3, 1, 9, 0), expected: date(2024, 3, 2, 9, 0)},
+		{expression: "30 8 1 * *", after: date(2024, 3, 1, 9, 0), expected: date(2024, 4, 1, 8, 30)},
+		{expression: "0 9 * * 1-5", after: date(2024, 3, 1, 10, 0), expected: date(2024, 3, 4, 9, 0)},
+		{expression: "0 0 * * 7", after: date(2024, 3, 1, 0, 0), expected: date(2024, 3, 3, 0, 0)},
+		{expression: "0 12 1,15 6 *", after: date(2024, 3, 1, 0, 0), expected: date(2024, 6, 1, 12, 0)},
+		// Both day fields restricted: either one matches
+		{expression: "0 0 13 * 5", after: date(2024, 3, 1, 0, 0), expected: date(2024, 3, 8, 0, 0)},
+		{expression: "0 0 29 2 *", after: date(2024, 3, 1, 0, 0), expected: date(2028, 2, 29, 0, 0)},
+		{expression: "0 0 30 2 *", after: date(2024, 3, 1, 0, 0), expected: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, schedule.Next(tt.after))
+		})
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		t.Run(expression, func(t *testing.T) {
+			_, err := ParseCron(expression)
+			assert.Error(t, err)
+		})
+	}
+}
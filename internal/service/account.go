@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/currency"
+	"internal-transfers-system/internal/ledger"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/svrerror"
+)
+
+// CreateAccount opens an account in the requested currency and posts its initial balance to the journal. An
+// account.created event is written to the outbox and an AccountOpened event to the ledger in the same DB transaction.
+func CreateAccount(ctx context.Context, db *gorm.DB, request apimodel.CreateAccountRequest, initialBalance decimal.Decimal) (*model.Account, error) {
+	account := model.Account{
+		ID:       request.AccountID,
+		Balance:  initialBalance,
+		Currency: request.Currency,
+	}
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&account).Error; err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				return svrerror.New("account ID already exists", http.StatusBadRequest)
+			}
+			return err
+		}
+
+		if !initialBalance.IsZero() {
+			opening := posting(nil, account.ID, account.Currency, initialBalance, initialBalance)
+			if err := tx.Create(&opening).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := appendLedgerEvent(tx, model.LedgerEventAccountOpened, ledger.AccountOpened{
+			AccountID:      account.ID,
+			Currency:       account.Currency,
+			InitialBalance: initialBalance,
+			OpenedAt:       account.CreatedAt,
+		}); err != nil {
+			return err
+		}
+
+		return recordEvent(tx, model.EventTypeAccountCreated, apimodel.NewAccountResponse(&account, account.Balance))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// GetAccount returns a single account by ID.
+func GetAccount(ctx context.Context, db *gorm.DB, accountID uint64) (*model.Account, error) {
+	var account model.Account
+	if err := db.WithContext(ctx).Take(&account, "id = ?", accountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, svrerror.New("account not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+// accountStatusTransitions lists the statuses an account can move to from each status. Closed is final.
+var accountStatusTransitions = map[string][]string{
+	model.AccountStatusActive: {model.AccountStatusFrozen, model.AccountStatusClosed},
+	model.AccountStatusFrozen: {model.AccountStatusActive},
+}
+
+// ChangeAccountStatus moves an account to a new status and records the change with its reason. Like transfers, it
+// relies on the updatedAt timestamp of the account, so a transfer that read the account before the change is retried
+// and sees the new status, and an account cannot receive money while it is being closed.
+//
+// An account can only be closed once its balance is zero and nothing is left that would move money in or out of it
+// later. The account is locked FOR UPDATE, so that holds, scheduled transfers and standing orders set up at the same
+// time either see it closed or are counted.
+func ChangeAccountStatus(ctx context.Context, db *gorm.DB, accountID uint64, status, reason string) (*model.AccountStatusChange, error) {
+	var change *model.AccountStatusChange
+	err := withRetry(func() error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var account model.Account
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&account, "id = ?", accountID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return svrerror.New("account not found", http.StatusNotFound)
+				}
+				return err
+			}
+
+			if !canChangeAccountStatus(account.Status, status) {
+				return svrerror.New(fmt.Sprintf("account status cannot change from %s to %s", account.Status, status), http.StatusUnprocessableEntity)
+			}
+			if status == model.AccountStatusClosed {
+				if !account.Balance.IsZero() {
+					return svrerror.New("only accounts with a zero balance can be closed", http.StatusUnprocessableEntity)
+				}
+				if err := checkNoOpenItems(tx, account.ID); err != nil {
+					return err
+				}
+			}
+
+			result := tx.Exec(`UPDATE accounts SET status = ?, updated_at = NOW() WHERE id = ? AND updated_at = ?`,
+				status, account.ID, account.UpdatedAt)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != 1 {
+				return svrerror.New("account updatedAt mismatch, retrying", http.StatusConflict)
+			}
+
+			newChange := model.AccountStatusChange{
+				AccountID:  account.ID,
+				FromStatus: account.Status,
+				ToStatus:   status,
+				Reason:     reason,
+			}
+			if err := tx.Create(&newChange).Error; err != nil {
+				return err
+			}
+			if err := appendLedgerEvent(tx, model.LedgerEventAccountStatusChanged, ledger.AccountStatusChanged{
+				AccountID:  account.ID,
+				FromStatus: account.Status,
+				ToStatus:   status,
+				Reason:     reason,
+			}); err != nil {
+				return err
+			}
+
+			change = &newChange
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// checkNoOpenItems rejects closing an account that still has work that would move money in or out of it later:
+// active holds on or towards it, pending scheduled transfers and standing orders that are not over yet. These have to
+// be voided or cancelled first. The error details count each kind of item.
+func checkNoOpenItems(tx *gorm.DB, accountID uint64) error {
+	var holds, scheduledTransfers, standingOrders int64
+	if err := tx.Model(&model.Hold{}).
+		Where("status = ? AND (account_id = ? OR destination_account_id = ?)", model.HoldStatusActive, accountID, accountID).
+		Count(&holds).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&model.ScheduledTransfer{}).
+		Where("status = ? AND (source_account_id = ? OR destination_account_id = ?)", model.ScheduledTransferStatusPending, accountID, accountID).
+		Count(&scheduledTransfers).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&model.StandingOrder{}).
+		Where("status IN ? AND (source_account_id = ? OR destination_account_id = ?)",
+			[]string{model.StandingOrderStatusActive, model.StandingOrderStatusSuspended}, accountID, accountID).
+		Count(&standingOrders).Error; err != nil {
+		return err
+	}
+	if holds+scheduledTransfers+standingOrders == 0 {
+		return nil
+	}
+
+	return &svrerror.Error{
+		Message:    fmt.Sprintf("account %d has active holds, pending scheduled transfers or standing orders, which must be ended before it can be closed", accountID),
+		StatusCode: http.StatusUnprocessableEntity,
+		Code:       svrerror.CodeAccountHasOpenItems,
+		Details: map[string]string{
+			"active_holds":                strconv.FormatInt(holds, 10),
+			"pending_scheduled_transfers": strconv.FormatInt(scheduledTransfers, 10),
+			"standing_orders":             strconv.FormatInt(standingOrders, 10),
+		},
+	}
+}
+
+// ListAccountStatusChanges returns the status changes of an account, oldest first.
+func ListAccountStatusChanges(ctx context.Context, db *gorm.DB, accountID uint64) ([]model.AccountStatusChange, error) {
+	if _, err := GetAccount(ctx, db, accountID); err != nil {
+		return nil, err
+	}
+
+	var changes []model.AccountStatusChange
+	err := db.WithContext(ctx).Where("account_id = ?", accountID).Order("id").Find(&changes).Error
+	return changes, err
+}
+
+func canChangeAccountStatus(from, to string) bool {
+	for _, allowed := range accountStatusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDebitAllowed rejects taking money out of frozen and closed accounts. These are not conflicts to be retried,
+// and each has its own error code so that clients can tell them apart.
+func checkDebitAllowed(account *model.Account) error {
+	switch account.Status {
+	case model.AccountStatusFrozen:
+		return svrerror.NewWithCode(fmt.Sprintf("account %d is frozen", account.ID), http.StatusForbidden, svrerror.CodeAccountFrozen)
+	case model.AccountStatusClosed:
+		return svrerror.NewWithCode(fmt.Sprintf("account %d is closed", account.ID), http.StatusUnprocessableEntity, svrerror.CodeAccountClosed)
+	}
+	return nil
+}
+
+// checkCreditAllowed rejects paying money into closed accounts. Frozen accounts can still receive money.
+func checkCreditAllowed(account *model.Account) error {
+	if account.Status == model.AccountStatusClosed {
+		return svrerror.NewWithCode(fmt.Sprintf("account %d is closed", account.ID), http.StatusUnprocessableEntity, svrerror.CodeAccountClosed)
+	}
+	return nil
+}
+
+// SetOverdraftLimit changes how far below zero an account's balance may go. The limit cannot be lowered below what
+// the account is already overdrawn by. The change touches the account's updatedAt, so a transfer that read the old
+// limit is retried.
+func SetOverdraftLimit(ctx context.Context, db *gorm.DB, accountID uint64, limit decimal.Decimal) (*model.Account, error) {
+	var updated *model.Account
+	err := withRetry(func() error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var account model.Account
+			if err := tx.Take(&account, "id = ?", accountID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return svrerror.New("account not found", http.StatusNotFound)
+				}
+				return err
+			}
+
+			if err := checkCreditAllowed(&account); err != nil {
+				return err
+			}
+			if !currency.FitsMinorUnits(account.Currency, limit) {
+				return svrerror.New("overdraft limit has more decimal places than "+account.Currency+" allows", http.StatusBadRequest)
+			}
+			if account.Balance.Add(limit).IsNegative() {
+				return svrerror.New("overdraft limit cannot be lower than the amount the account is overdrawn by", http.StatusUnprocessableEntity)
+			}
+
+			result := tx.Exec(`UPDATE accounts SET overdraft_limit = ?, updated_at = NOW() WHERE id = ? AND updated_at = ?`,
+				limit, account.ID, account.UpdatedAt)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != 1 {
+				return svrerror.New("account updatedAt mismatch, retrying", http.StatusConflict)
+			}
+
+			if err := appendLedgerEvent(tx, model.LedgerEventOverdraftLimitChanged, ledger.OverdraftLimitChanged{
+				AccountID:      account.ID,
+				OverdraftLimit: limit,
+			}); err != nil {
+				return err
+			}
+
+			account.OverdraftLimit = limit
+			updated = &account
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// isCheckViolation reports whether err is a violation of the named check constraint.
+func isCheckViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23514" && pgErr.ConstraintName == constraint
+}
+
+// isUniqueViolation reports whether err is a violation of the named unique index or constraint.
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == constraint
+}
+
+// touchAccount bumps the account's updatedAt if it has not changed since it was read, so that transfers that read the
+// account before the change fail the optimistic concurrency check and are retried.
+func touchAccount(tx *gorm.DB, account *model.Account) error {
+	result := tx.Exec(`UPDATE accounts SET updated_at = NOW() WHERE id = ? AND updated_at = ?`, account.ID, account.UpdatedAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return svrerror.New("account updatedAt mismatch, retrying", http.StatusConflict)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// runEvery calls job every interval until ctx is cancelled. Failures are logged and the job runs again on the next
+// tick.
+func runEvery(ctx context.Context, name string, interval time.Duration, job func(ctx context.Context) error) {
+	if interval <= 0 {
+		slog.Info("background job disabled", "job", name)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := job(ctx); err != nil {
+				slog.Error("background job failed", "job", name, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"internal-transfers-system/internal/model"
+)
+
+// BalanceAsOf derives the balance of an account at a point in time from its journal: the latest snapshot taken at or
+// before asOf, plus the postings made after the snapshot and up to asOf. Without a snapshot every posting up to asOf
+// is summed.
+func BalanceAsOf(ctx context.Context, db *gorm.DB, accountID uint64, asOf time.Time) (decimal.Decimal, error) {
+	db = db.WithContext(ctx)
+
+	var snapshot model.BalanceSnapshot
+	err := db.Where("account_id = ? AND as_of <= ?", accountID, asOf).Order("as_of DESC").Take(&snapshot).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return decimal.Zero, err
+	}
+
+	query := db.Model(&model.JournalEntry{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("account_id = ? AND created_at <= ?", accountID, asOf)
+	if !snapshot.AsOf.IsZero() {
+		query = query.Where("created_at > ?", snapshot.AsOf)
+	}
+
+	var sum decimal.Decimal
+	if err := query.Row().Scan(&sum); err != nil {
+		return decimal.Zero, err
+	}
+	return snapshot.Balance.Add(sum), nil
+}
+
+// TakeBalanceSnapshots snapshots the balance as of cutoff of every account that had postings since its previous
+// snapshot, and returns the number of snapshots taken. Postings must not be created at or before cutoff afterwards,
+// so cutoff should be far enough in the past for every transaction that was running at the time to have committed.
+//
+// Cutoffs only move forward: a cutoff at or before the latest snapshot is ignored. That way an account that had
+// postings since its own latest snapshot has postings since the latest snapshot of all, which keeps the scan of the
+// journal short.
+func TakeBalanceSnapshots(ctx context.Context, db *gorm.DB, cutoff time.Time) (int64, error) {
+	var taken int64
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Concurrent runs queue up behind each other, while balance queries can still read the snapshots
+		if err := tx.Exec("LOCK TABLE balance_snapshots IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+
+		var latest *time.Time
+		if err := tx.Model(&model.BalanceSnapshot{}).Select("MAX(as_of)").Row().Scan(&latest); err != nil {
+			return err
+		}
+		if latest != nil && !cutoff.After(*latest) {
+			return nil
+		}
+
+		result := tx.Exec(`
+            WITH latest AS (
+                SELECT DISTINCT ON (account_id) account_id, as_of, balance
+                FROM balance_snapshots
+                ORDER BY account_id, as_of DESC
+            )
+            INSERT INTO balance_snapshots (account_id, as_of, balance, created_at)
+            SELECT j.account_id, ?, COALESCE(l.balance, 0) + SUM(j.amount), NOW()
+            FROM journal_entries j
+                LEFT JOIN latest l ON l.account_id = j.account_id
+            WHERE j.account_id IS NOT NULL
+              AND j.created_at > COALESCE(?, '-infinity'::timestamptz)
+              AND j.created_at <= ?
+              AND (l.as_of IS NULL OR j.created_at > l.as_of)
+            GROUP BY j.account_id, l.balance`,
+			cutoff, latest, cutoff)
+		taken = result.RowsAffected
+		return result.Error
+	})
+	return taken, err
+}
+
+// RunBalanceSnapshots takes balance snapshots every interval until ctx is cancelled. Each run snapshots the balances
+// as of delay ago, which leaves transactions that were running at the time room to commit.
+func RunBalanceSnapshots(ctx context.Context, db *gorm.DB, interval, delay time.Duration) {
+	runEvery(ctx, "balance snapshots", interval, func(ctx context.Context) error {
+		taken, err := TakeBalanceSnapshots(ctx, db, time.Now().Add(-delay))
+		if err != nil {
+			return err
+		}
+		slog.Debug("took balance snapshots", "count", taken)
+		return nil
+	})
+}
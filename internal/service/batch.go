@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/svrerror"
+)
+
+// BatchItemResult is the outcome of a transfer of a batch. Exactly one of Transfer and Err is set.
+type BatchItemResult struct {
+	Transfer *model.Transfer
+	Err      error
+}
+
+// ProcessBatch books a batch of transfers and returns the batch along with a result for every item, in the order of
+// the items.
+//
+// In atomic mode the transfers are booked in a single DB transaction and the first failure rolls back the whole
+// batch; the error names the index of the failed item. Every account the batch touches is locked up front in the
+// order of its ID, fee revenue accounts included, so that concurrent batches over the same accounts queue up instead
+// of deadlocking. The items are
+// then booked straight into that transaction, and a conflict retries the whole batch.
+//
+// In best-effort mode every transfer is booked in its own DB transaction, exactly as by ProcessTransfer, and failures
+// are reported in the item's result. Items that failed validation are reported without being attempted.
+func ProcessBatch(ctx context.Context, db *gorm.DB, policy TransferPolicy, mode string, items []apimodel.BatchItem) (*model.TransferBatch, []BatchItemResult, error) {
+	if mode == model.TransferBatchModeAtomic {
+		return processAtomicBatch(ctx, db, policy, items)
+	}
+	return processBestEffortBatch(ctx, db, policy, items)
+}
+
+func processAtomicBatch(ctx context.Context, db *gorm.DB, policy TransferPolicy, items []apimodel.BatchItem) (*model.TransferBatch, []BatchItemResult, error) {
+	fingerprints := make([]string, len(items))
+	for i, item := range items {
+		if item.Err != nil {
+			return nil, nil, batchItemError(i, item.Err)
+		}
+		fingerprint, err := transferFingerprint(item.Transfer, item.Amount)
+		if err != nil {
+			return nil, nil, batchItemError(i, err)
+		}
+		fingerprints[i] = fingerprint
+	}
+
+	var batch *model.TransferBatch
+	var results []BatchItemResult
+	err := withRetry(func() error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			newBatch := model.TransferBatch{Mode: model.TransferBatchModeAtomic, ItemCount: len(items)}
+			if err := tx.Create(&newBatch).Error; err != nil {
+				return err
+			}
+
+			if err := lockBatchAccounts(tx, items); err != nil {
+				return err
+			}
+
+			booked := make([]BatchItemResult, len(items))
+			for i, item := range items {
+				// The accounts are locked, so the transfer does not run into conflicts with other transactions
+				transfer, err := bookWithIdempotencyKey(tx, item.Transfer.IdempotencyKey, fingerprints[i], func(tx *gorm.DB) (*model.Transfer, error) {
+					return bookTransferRequest(tx, policy, item.Transfer, item.Amount, &newBatch.ID)
+				})
+				if err != nil {
+					return batchItemError(i, err)
+				}
+				booked[i].Transfer = transfer
+			}
+
+			// The batch is chained once every item holds its locks, including the fee revenue accounts
+			transfers := make([]*model.Transfer, len(booked))
+			for i := range booked {
+				transfers[i] = booked[i].Transfer
+			}
+			if err := chainTransfers(tx, transfers...); err != nil {
+				return err
+			}
+
+			batch, results = &newBatch, booked
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	slog.Info("booked atomic batch", "id", batch.ID, "transfers", len(items))
+	return batch, results, nil
+}
+
+func processBestEffortBatch(ctx context.Context, db *gorm.DB, policy TransferPolicy, items []apimodel.BatchItem) (*model.TransferBatch, []BatchItemResult, error) {
+	batch := model.TransferBatch{Mode: model.TransferBatchModeBestEffort, ItemCount: len(items)}
+	if err := db.WithContext(ctx).Create(&batch).Error; err != nil {
+		return nil, nil, err
+	}
+
+	results := make([]BatchItemResult, len(items))
+	booked := 0
+	for i, item := range items {
+		if item.Err != nil {
+			results[i].Err = item.Err
+			continue
+		}
+		transfer, err := processTransfer(ctx, db, policy, item.Transfer, item.Amount, &batch.ID)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].Transfer = transfer
+		booked++
+	}
+	slog.Info("booked best-effort batch", "id", batch.ID, "transfers", len(items), "booked", booked)
+	return &batch, results, nil
+}
+
+// lockBatchAccounts locks every account that the items of a batch move money between, including the revenue accounts
+// their fees are credited to, in ascending order of ID.
+func lockBatchAccounts(tx *gorm.DB, items []apimodel.BatchItem) error {
+	seen := make(map[uint64]bool)
+	var accountIDs []uint64
+	for _, item := range items {
+		ids := []uint64{item.Transfer.SourceAccountID, item.Transfer.DestinationAccountID}
+		// creditFee locks the revenue account again when the item is booked, which then does not have to wait
+		fee, err := transferFee(tx, feeTransferType(item.Transfer), item.Transfer.Currency, item.Amount)
+		if err != nil {
+			return err
+		}
+		if fee != nil && fee.AccountID != item.Transfer.SourceAccountID {
+			ids = append(ids, fee.AccountID)
+		}
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				accountIDs = append(accountIDs, id)
+			}
+		}
+	}
+	sort.Slice(accountIDs, func(i, j int) bool { return accountIDs[i] < accountIDs[j] })
+
+	// Missing accounts are reported when the transfer that references them is booked
+	var accounts []model.Account
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", accountIDs).
+		Order("id").
+		Find(&accounts).Error
+}
+
+// batchItemError prefixes err with the index of the batch item it belongs to and adds the index to its details.
+// Errors other than svrerror.Error are wrapped, so that they still fail the request with a 500.
+func batchItemError(index int, err error) error {
+	var customErr *svrerror.Error
+	if !errors.As(err, &customErr) {
+		return fmt.Errorf("transfers[%d]: %w", index, err)
+	}
+
+	details := map[string]string{"index": strconv.Itoa(index)}
+	for key, value := range customErr.Details {
+		details[key] = value
+	}
+	return &svrerror.Error{
+		Message:    fmt.Sprintf("transfers[%d]: %s", index, customErr.Message),
+		StatusCode: customErr.StatusCode,
+		Code:       customErr.Code,
+		Details:    details,
+	}
+}
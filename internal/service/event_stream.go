@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+	"internal-transfers-system/internal/eventstream"
+	"internal-transfers-system/internal/model"
+)
+
+const (
+	// eventSequenceLock is the advisory lock that serialises the numbering of events across server processes.
+	eventSequenceLock = 7_301_947_224
+	// maxEventBatch is how many events are numbered or read at a time.
+	maxEventBatch = 500
+	// listenRetryDelay is how long to wait before listening again after the connection was lost.
+	listenRetryDelay = 5 * time.Second
+)
+
+// SequenceEvents gives the next sequence numbers to committed events that do not have one yet, in order of their ID,
+// and returns how many were numbered. Numbering happens under an advisory lock and commits before the lock is
+// released, so sequence numbers become visible in order and without gaps.
+func SequenceEvents(ctx context.Context, db *gorm.DB) (int64, error) {
+	var numbered int64
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", eventSequenceLock).Error; err != nil {
+			return err
+		}
+		result := tx.Exec(`
+            UPDATE outbox_events
+            SET sequence = numbered.sequence
+            FROM (
+                SELECT id, (SELECT COALESCE(MAX(sequence), 0) FROM outbox_events) + ROW_NUMBER() OVER (ORDER BY id) AS sequence
+                FROM outbox_events
+                WHERE sequence IS NULL
+                ORDER BY id
+                LIMIT ?
+            ) AS numbered
+            WHERE outbox_events.id = numbered.id`, maxEventBatch)
+		numbered = result.RowsAffected
+		return result.Error
+	})
+	return numbered, err
+}
+
+// ListStreamEvents returns up to limit events with a sequence number after the given one, in sequence order.
+func ListStreamEvents(ctx context.Context, db *gorm.DB, after uint64, limit int) ([]model.OutboxEvent, error) {
+	var events []model.OutboxEvent
+	err := db.WithContext(ctx).
+		Where("sequence > ?", after).
+		Order("sequence").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+// LastEventSequence returns the sequence number of the latest event in the stream, or 0 if there are none.
+func LastEventSequence(ctx context.Context, db *gorm.DB) (uint64, error) {
+	var sequence uint64
+	err := db.WithContext(ctx).Model(&model.OutboxEvent{}).Select("COALESCE(MAX(sequence), 0)").Scan(&sequence).Error
+	return sequence, err
+}
+
+// RunEventStream feeds hub until ctx is cancelled. It listens on EventsChannel and, whenever a transaction that wrote
+// events commits, numbers the new events and publishes them. The outbox is also checked every pollInterval, in case
+// a notification was missed while the listening connection was down.
+func RunEventStream(ctx context.Context, db *gorm.DB, hub *eventstream.Hub, pollInterval time.Duration) {
+	wake := make(chan struct{}, 1)
+	go listenForEvents(ctx, db, wake)
+
+	var poll <-chan time.Time
+	if pollInterval > 0 {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	var after *uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-poll:
+		}
+
+		if after == nil {
+			// Only events after the start are published; clients catch up on older ones from the outbox
+			last, err := LastEventSequence(ctx, db)
+			if err != nil {
+				slog.Error("failed to read the event sequence", "error", err)
+				continue
+			}
+			after = &last
+		}
+		if err := publishEvents(ctx, db, hub, after); err != nil && ctx.Err() == nil {
+			slog.Error("failed to publish events", "error", err)
+		}
+	}
+}
+
+// publishEvents numbers new events and publishes every event after the sequence number in after, which is moved to
+// the last event published.
+func publishEvents(ctx context.Context, db *gorm.DB, hub *eventstream.Hub, after *uint64) error {
+	for {
+		numbered, err := SequenceEvents(ctx, db)
+		if err != nil {
+			return err
+		}
+		if numbered < maxEventBatch {
+			break
+		}
+	}
+
+	for {
+		events, err := ListStreamEvents(ctx, db, *after, maxEventBatch)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		hub.Publish(events)
+		*after = *events[len(events)-1].Sequence
+	}
+}
+
+// listenForEvents signals wake whenever EventsChannel is notified, and once every time it starts listening so that
+// events committed while it was not are picked up.
+func listenForEvents(ctx context.Context, db *gorm.DB, wake chan<- struct{}) {
+	for {
+		err := listen(ctx, db, wake)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Error("lost the event notification connection", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+// listen holds a connection of the pool for as long as it listens. The connection is discarded afterwards rather
+// than returned to the pool, since it would still be subscribed to the channel.
+func listen(ctx context.Context, db *gorm.DB, wake chan<- struct{}) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		pgxConn := driverConn.(*stdlib.Conn).Conn()
+		if _, err := pgxConn.Exec(ctx, "LISTEN "+pgx.Identifier{EventsChannel}.Sanitize()); err != nil {
+			return errors.Join(err, driver.ErrBadConn)
+		}
+
+		for {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+			if _, err := pgxConn.WaitForNotification(ctx); err != nil {
+				return errors.Join(err, driver.ErrBadConn)
+			}
+		}
+	})
+}
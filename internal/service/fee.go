@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"internal-transfers-system/internal/currency"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/svrerror"
+)
+
+// feeCharge is the fee charged on a transfer, in the currency of the source account.
+type feeCharge struct {
+	Amount   decimal.Decimal
+	Currency string
+	// AccountID is the revenue account the fee is credited to
+	AccountID uint64
+}
+
+// SetFeeSchedules creates or replaces the given schedules. Every revenue account must exist, be active and be in the
+// currency of its schedule. The revenue accounts are locked, so they cannot be closed at the same time.
+func SetFeeSchedules(ctx context.Context, db *gorm.DB, schedules []model.FeeSchedule) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, schedule := range schedules {
+			var account model.Account
+			if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Take(&account, "id = ?", schedule.RevenueAccountID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return svrerror.New(fmt.Sprintf("revenue account %d not found", schedule.RevenueAccountID), http.StatusNotFound)
+				}
+				return err
+			}
+			if account.Status != model.AccountStatusActive {
+				return svrerror.NewWithCode(fmt.Sprintf("revenue account %d is %s", account.ID, account.Status),
+					http.StatusUnprocessableEntity, svrerror.CodeFeeAccountUnavailable)
+			}
+			if err := checkAccountCurrency(&account, schedule.Currency, "revenue"); err != nil {
+				return err
+			}
+		}
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&schedules).Error
+	})
+}
+
+// ListFeeSchedules returns all schedules ordered by transfer type and currency.
+func ListFeeSchedules(ctx context.Context, db *gorm.DB) ([]model.FeeSchedule, error) {
+	var schedules []model.FeeSchedule
+	err := db.WithContext(ctx).Order("transfer_type, currency").Find(&schedules).Error
+	return schedules, err
+}
+
+// DeleteFeeSchedule stops charging fees on transfers of transferType in code.
+func DeleteFeeSchedule(ctx context.Context, db *gorm.DB, transferType, code string) error {
+	result := db.WithContext(ctx).Delete(&model.FeeSchedule{}, "transfer_type = ? AND currency = ?", transferType, code)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return svrerror.New("fee schedule not found", http.StatusNotFound)
+	}
+	return nil
+}
+
+// QuoteFee returns the fee that a transfer of amount would be charged, along with the schedule it is charged under.
+// The schedule is nil and the fee zero when no schedule applies.
+func QuoteFee(ctx context.Context, db *gorm.DB, transferType, code string, amount decimal.Decimal) (decimal.Decimal, *model.FeeSchedule, error) {
+	schedule, err := feeSchedule(db.WithContext(ctx), transferType, code)
+	if err != nil || schedule == nil {
+		return decimal.Zero, nil, err
+	}
+	return computeFee(schedule, amount), schedule, nil
+}
+
+// transferFee returns the fee charged on a transfer of amount, or nil if no fee is charged.
+func transferFee(tx *gorm.DB, transferType, code string, amount decimal.Decimal) (*feeCharge, error) {
+	schedule, err := feeSchedule(tx, transferType, code)
+	if err != nil || schedule == nil {
+		return nil, err
+	}
+
+	fee := computeFee(schedule, amount)
+	if !fee.IsPositive() {
+		return nil, nil
+	}
+	return &feeCharge{Amount: fee, Currency: code, AccountID: schedule.RevenueAccountID}, nil
+}
+
+// feeSchedule returns the schedule for transfers of transferType in code, or nil if there is none.
+func feeSchedule(tx *gorm.DB, transferType, code string) (*model.FeeSchedule, error) {
+	var schedule model.FeeSchedule
+	err := tx.Take(&schedule, "transfer_type = ? AND currency = ?", transferType, code).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// computeFee applies a schedule to the amount of a transfer. Percentage fees are rounded half up to the minor unit
+// of the currency before the minimum and maximum are applied.
+func computeFee(schedule *model.FeeSchedule, amount decimal.Decimal) decimal.Decimal {
+	switch schedule.Type {
+	case model.FeeTypeFlat:
+		return schedule.FlatAmount.Decimal
+	case model.FeeTypePercentage:
+		units, _ := currency.MinorUnits(schedule.Currency)
+		fee := amount.Mul(schedule.Percentage.Decimal).Div(decimal.NewFromInt(100)).Round(units)
+		if schedule.MinAmount.Valid && fee.LessThan(schedule.MinAmount.Decimal) {
+			fee = schedule.MinAmount.Decimal
+		}
+		if schedule.MaxAmount.Valid && fee.GreaterThan(schedule.MaxAmount.Decimal) {
+			fee = schedule.MaxAmount.Decimal
+		}
+		return fee
+	case model.FeeTypeTiered:
+		for _, tier := range schedule.Tiers {
+			if !tier.UpTo.Valid || amount.LessThanOrEqual(tier.UpTo.Decimal) {
+				return tier.Amount
+			}
+		}
+	}
+	return decimal.Zero
+}
+
+// creditFee credits a fee to its revenue account and returns the account's balance after the credit. The account row
+// is locked and updated in place rather than checked against its updatedAt, so that transfers from different accounts
+// do not conflict on the revenue account they share. A revenue account that cannot take the fee, because it was
+// closed or its currency does not match, fails the transfer with a 422 and CodeFeeAccountUnavailable.
+func creditFee(tx *gorm.DB, fee *feeCharge) (decimal.Decimal, error) {
+	var account model.Account
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&account, "id = ?", fee.AccountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return decimal.Zero, svrerror.NewWithCode(fmt.Sprintf("fee revenue account %d not found", fee.AccountID),
+				http.StatusUnprocessableEntity, svrerror.CodeFeeAccountUnavailable)
+		}
+		return decimal.Zero, err
+	}
+	if err := checkCreditAllowed(&account); err != nil {
+		return decimal.Zero, feeAccountUnavailable(err)
+	}
+	if err := checkAccountCurrency(&account, fee.Currency, "fee revenue"); err != nil {
+		return decimal.Zero, feeAccountUnavailable(err)
+	}
+
+	var balance decimal.Decimal
+	result := tx.Raw(`UPDATE accounts SET balance = balance + ?, updated_at = NOW() WHERE id = ? RETURNING balance`,
+		fee.Amount, fee.AccountID).Scan(&balance)
+	if result.Error != nil {
+		return decimal.Zero, result.Error
+	}
+	return balance, nil
+}
+
+// feeAccountUnavailable turns the error of a failed check of a fee revenue account into a 422, since the transfer
+// cannot be booked until the fee schedule is fixed.
+func feeAccountUnavailable(err error) error {
+	var customErr *svrerror.Error
+	if !errors.As(err, &customErr) {
+		return err
+	}
+	return svrerror.NewWithCode("fee cannot be charged: "+customErr.Message, http.StatusUnprocessableEntity,
+		svrerror.CodeFeeAccountUnavailable)
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/currency"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/svrerror"
+)
+
+// fxRatePrecision is the number of decimal places kept for rates and unrounded converted amounts, matching the
+// precision of the database columns.
+const fxRatePrecision = 18
+
+// fxConversion describes how the amount of a cross-currency transfer is converted for the destination account.
+type fxConversion struct {
+	DestinationCurrency string
+	DestinationAmount   decimal.Decimal
+	Rate                decimal.Decimal
+	RoundingAdjustment  decimal.Decimal
+	// QuoteID is the quote the conversion was priced with. Reversals are booked at the rate of the original
+	// transfer and do not have a quote.
+	QuoteID *uint64
+}
+
+// SetFXRates creates or replaces the given rates.
+func SetFXRates(ctx context.Context, db *gorm.DB, rates []model.FXRate) error {
+	return db.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&rates).Error
+}
+
+// ListFXRates returns all rates ordered by currency pair.
+func ListFXRates(ctx context.Context, db *gorm.DB) ([]model.FXRate, error) {
+	var rates []model.FXRate
+	err := db.WithContext(ctx).Order("base_currency, quote_currency").Find(&rates).Error
+	return rates, err
+}
+
+// fxRate returns the rate for converting from one currency into another. If only the opposite pair is in the rate
+// table, its inverse is used.
+func fxRate(tx *gorm.DB, from, to string) (decimal.Decimal, error) {
+	var rate model.FXRate
+	err := tx.Take(&rate, "base_currency = ? AND quote_currency = ?", from, to).Error
+	if err == nil {
+		return rate.Rate, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return decimal.Zero, err
+	}
+
+	err = tx.Take(&rate, "base_currency = ? AND quote_currency = ?", to, from).Error
+	if err == nil {
+		return decimal.NewFromInt(1).DivRound(rate.Rate, fxRatePrecision), nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return decimal.Zero, svrerror.New(fmt.Sprintf("no FX rate from %s to %s", from, to), http.StatusUnprocessableEntity)
+	}
+	return decimal.Zero, err
+}
+
+// convert applies rate to amount and rounds the result down to the minor unit of the destination currency, so that
+// the destination is never credited more than the rate allows. The amount rounded off is returned as well.
+func convert(amount, rate decimal.Decimal, destinationCurrency string) (decimal.Decimal, decimal.Decimal) {
+	exact := amount.Mul(rate).Truncate(fxRatePrecision)
+	units, _ := currency.MinorUnits(destinationCurrency)
+	converted := exact.RoundDown(units)
+	return converted, exact.Sub(converted)
+}
+
+// CreateFXQuote prices the conversion of sourceAmount at the current rate and locks the rate in for ttl.
+func CreateFXQuote(ctx context.Context, db *gorm.DB, quote apimodel.CreateFXQuoteRequest, sourceAmount decimal.Decimal, ttl time.Duration) (*model.FXQuote, error) {
+	tx := db.WithContext(ctx)
+
+	rate, err := fxRate(tx, quote.SourceCurrency, quote.DestinationCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	destinationAmount, adjustment := convert(sourceAmount, rate, quote.DestinationCurrency)
+	if !destinationAmount.IsPositive() {
+		return nil, svrerror.New("amount is too small to convert", http.StatusBadRequest)
+	}
+
+	newQuote := model.FXQuote{
+		SourceCurrency:      quote.SourceCurrency,
+		DestinationCurrency: quote.DestinationCurrency,
+		SourceAmount:        sourceAmount,
+		DestinationAmount:   destinationAmount,
+		Rate:                rate,
+		RoundingAdjustment:  adjustment,
+		ExpiresAt:           time.Now().Add(ttl),
+	}
+	if err := tx.Create(&newQuote).Error; err != nil {
+		return nil, err
+	}
+	return &newQuote, nil
+}
+
+// GetFXQuote returns a single quote by ID.
+func GetFXQuote(ctx context.Context, db *gorm.DB, quoteID uint64) (*model.FXQuote, error) {
+	var quote model.FXQuote
+	if err := db.WithContext(ctx).Take(&quote, "id = ?", quoteID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, svrerror.New("quote not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// useFXQuote checks that the quote can be used for the transfer and returns the conversion it locked in. The quote
+// row is locked so that concurrent transfers cannot use the same quote; the unique index on transfers.fx_quote_id
+// backs this up.
+func useFXQuote(tx *gorm.DB, transfer apimodel.TransferRequest, amount decimal.Decimal) (*fxConversion, error) {
+	var quote model.FXQuote
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&quote, "id = ?", transfer.QuoteID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, svrerror.New("quote not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+
+	if quote.SourceCurrency != transfer.Currency || !quote.SourceAmount.Equal(amount) {
+		return nil, svrerror.New("amount and currency must match the quote", http.StatusBadRequest)
+	}
+	if !quote.ExpiresAt.After(time.Now()) {
+		return nil, svrerror.New("quote has expired", http.StatusUnprocessableEntity)
+	}
+
+	var uses int64
+	if err := tx.Model(&model.Transfer{}).Where("fx_quote_id = ?", quote.ID).Count(&uses).Error; err != nil {
+		return nil, err
+	}
+	if uses > 0 {
+		return nil, svrerror.New("quote has already been used", http.StatusUnprocessableEntity)
+	}
+
+	return &fxConversion{
+		DestinationCurrency: quote.DestinationCurrency,
+		DestinationAmount:   quote.DestinationAmount,
+		Rate:                quote.Rate,
+		RoundingAdjustment:  quote.RoundingAdjustment,
+		QuoteID:             &quote.ID,
+	}, nil
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/svrerror"
+)
+
+// heldAmount returns the total of the active holds on an account that have not expired yet, by the DB's clock.
+func heldAmount(tx *gorm.DB, accountID uint64) (decimal.Decimal, error) {
+	var held decimal.Decimal
+	err := tx.Model(&model.Hold{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("account_id = ? AND status = ? AND expires_at > NOW()", accountID, model.HoldStatusActive).
+		Row().
+		Scan(&held)
+	return held, err
+}
+
+// dbNow returns the DB's NOW(), which is the start of the transaction tx. Holds expire by the DB's clock, so that
+// every check of a hold in a transaction, and the expiry job, see the same time.
+func dbNow(tx *gorm.DB) (time.Time, error) {
+	var now time.Time
+	err := tx.Raw("SELECT NOW()").Scan(&now).Error
+	return now, err
+}
+
+// AvailableBalance is the account balance less the funds reserved by active holds.
+func AvailableBalance(ctx context.Context, db *gorm.DB, account *model.Account) (decimal.Decimal, error) {
+	held, err := heldAmount(db.WithContext(ctx), account.ID)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return account.Balance.Sub(held), nil
+}
+
+// CreateHold reserves amount on the source account for ttl. Like ProcessTransfer, it relies on the updatedAt
+// timestamp of the source account to make sure a concurrent transfer or hold cannot spend the same funds.
+func CreateHold(ctx context.Context, db *gorm.DB, hold apimodel.CreateHoldRequest, amount decimal.Decimal, ttl time.Duration) (*model.Hold, error) {
+	var created *model.Hold
+	err := withRetry(func() error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var sourceAccount model.Account
+			if err := tx.Take(&sourceAccount, "id = ?", hold.AccountID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return svrerror.New("source account not found", http.StatusNotFound)
+				}
+				return err
+			}
+
+			// The destination is locked FOR SHARE so that it cannot be closed while a hold towards it is created
+			var destinationAccount model.Account
+			if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).
+				Take(&destinationAccount, "id = ?", hold.DestinationAccountID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return svrerror.New("destination account not found", http.StatusNotFound)
+				}
+				return err
+			}
+
+			if err := checkDebitAllowed(&sourceAccount); err != nil {
+				return err
+			}
+			if err := checkCreditAllowed(&destinationAccount); err != nil {
+				return err
+			}
+
+			if err := checkAccountCurrency(&sourceAccount, hold.Currency, "source"); err != nil {
+				return err
+			}
+			if err := checkAccountCurrency(&destinationAccount, hold.Currency, "destination"); err != nil {
+				return err
+			}
+
+			held, err := heldAmount(tx, sourceAccount.ID)
+			if err != nil {
+				return err
+			}
+			if sourceAccount.Balance.Sub(held).Add(sourceAccount.OverdraftLimit).LessThan(amount) {
+				return svrerror.NewWithCode("insufficient funds", http.StatusBadRequest, svrerror.CodeInsufficientFunds)
+			}
+
+			// The balance does not change, but touching updatedAt makes concurrent transfers from this account retry
+			// and see the new hold.
+			result := tx.Exec(`UPDATE accounts SET updated_at = NOW() WHERE id = ? AND updated_at = ?`,
+				sourceAccount.ID, sourceAccount.UpdatedAt)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != 1 {
+				return svrerror.New("account updatedAt mismatch, retrying", http.StatusConflict)
+			}
+
+			now, err := dbNow(tx)
+			if err != nil {
+				return err
+			}
+			newHold := model.Hold{
+				AccountID:            hold.AccountID,
+				DestinationAccountID: hold.DestinationAccountID,
+				Amount:               amount,
+				Currency:             hold.Currency,
+				Status:               model.HoldStatusActive,
+				ExpiresAt:            now.Add(ttl),
+			}
+			if err := tx.Create(&newHold).Error; err != nil {
+				return err
+			}
+
+			created = &newHold
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// GetHold returns a single hold by ID.
+func GetHold(ctx context.Context, db *gorm.DB, holdID uint64) (*model.Hold, error) {
+	var hold model.Hold
+	if err := db.WithContext(ctx).Take(&hold, "id = ?", holdID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, svrerror.New("hold not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// CaptureHold turns an active hold into a transfer to the hold's destination account. amount may be less than the
+// held amount, in which case the remainder is released. If amount is not set, the full hold is captured. The source
+// account's limits are checked against the captured amount when the transfer is booked, like any other transfer.
+func CaptureHold(ctx context.Context, db *gorm.DB, policy TransferPolicy, holdID uint64, amount decimal.NullDecimal) (*model.Hold, error) {
+	var captured *model.Hold
+	err := withRetry(func() error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var hold model.Hold
+			if err := tx.Take(&hold, "id = ?", holdID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return svrerror.New("hold not found", http.StatusNotFound)
+				}
+				return err
+			}
+			now, err := dbNow(tx)
+			if err != nil {
+				return err
+			}
+			if err := checkHoldActive(&hold, now); err != nil {
+				return err
+			}
+
+			captureAmount := hold.Amount
+			if amount.Valid {
+				captureAmount = amount.Decimal
+			}
+			if captureAmount.GreaterThan(hold.Amount) {
+				return svrerror.New("capture amount exceeds the held amount", http.StatusBadRequest)
+			}
+
+			transfer, err := bookTransfer(tx, transferBooking{
+				SourceAccountID:      hold.AccountID,
+				DestinationAccountID: hold.DestinationAccountID,
+				Amount:               captureAmount,
+				Currency:             hold.Currency,
+				HeldAmount:           hold.Amount,
+				Limits:               &policy.DefaultLimits,
+			})
+			if err != nil {
+				return err
+			}
+
+			hold.Status = model.HoldStatusCaptured
+			hold.CapturedAmount = decimal.NewNullDecimal(captureAmount)
+			hold.TransferID = &transfer.ID
+			if err := updateActiveHold(tx, &hold); err != nil {
+				return err
+			}
+			if err := chainTransfers(tx, transfer); err != nil {
+				return err
+			}
+
+			captured = &hold
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return captured, nil
+}
+
+// VoidHold releases an active hold without moving any money.
+func VoidHold(ctx context.Context, db *gorm.DB, holdID uint64) (*model.Hold, error) {
+	var voided *model.Hold
+	err := withRetry(func() error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var hold model.Hold
+			if err := tx.Take(&hold, "id = ?", holdID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return svrerror.New("hold not found", http.StatusNotFound)
+				}
+				return err
+			}
+			now, err := dbNow(tx)
+			if err != nil {
+				return err
+			}
+			if err := checkHoldActive(&hold, now); err != nil {
+				return err
+			}
+
+			hold.Status = model.HoldStatusVoided
+			if err := updateActiveHold(tx, &hold); err != nil {
+				return err
+			}
+
+			voided = &hold
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return voided, nil
+}
+
+// ExpireHolds marks active holds past their expiry as expired. Expired holds stop counting against the available
+// balance as soon as they expire, so this only tidies up their status.
+func ExpireHolds(ctx context.Context, db *gorm.DB) (int64, error) {
+	result := db.WithContext(ctx).
+		Model(&model.Hold{}).
+		Where("status = ? AND expires_at <= NOW()", model.HoldStatusActive).
+		Update("status", model.HoldStatusExpired)
+	return result.RowsAffected, result.Error
+}
+
+// RunHoldExpiry expires holds every interval until ctx is cancelled.
+func RunHoldExpiry(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	runEvery(ctx, "hold expiry", interval, func(ctx context.Context) error {
+		expired, err := ExpireHolds(ctx, db)
+		if err != nil {
+			return err
+		}
+		slog.Debug("expired holds", "count", expired)
+		return nil
+	})
+}
+
+// checkHoldActive rejects holds that have already been captured, voided or expired. This is not a conflict to be
+// retried, so it is reported as unprocessable rather than with the 409 used for optimistic concurrency failures. now
+// is the DB's time, as returned by dbNow.
+func checkHoldActive(hold *model.Hold, now time.Time) error {
+	if hold.Status != model.HoldStatusActive {
+		return svrerror.New("hold is "+hold.Status, http.StatusUnprocessableEntity)
+	}
+	if !hold.ExpiresAt.After(now) {
+		return svrerror.New("hold has expired", http.StatusUnprocessableEntity)
+	}
+	return nil
+}
+
+// updateActiveHold saves the hold only if it is still active, so that a hold cannot be captured or voided twice.
+func updateActiveHold(tx *gorm.DB, hold *model.Hold) error {
+	result := tx.Model(hold).
+		Where("status = ?", model.HoldStatusActive).
+		Updates(map[string]interface{}{
+			"status":          hold.Status,
+			"captured_amount": hold.CapturedAmount,
+			"transfer_id":     hold.TransferID,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return svrerror.New("hold changed concurrently, retrying", http.StatusConflict)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/svrerror"
+)
+
+// requestFingerprint hashes everything in the transfer request except the idempotency key itself. The amount is
+// normalised so that "10" and "10.00" are treated as the same request.
+func requestFingerprint(transfer apimodel.TransferRequest, amount decimal.Decimal) (string, error) {
+	transfer.IdempotencyKey = ""
+	transfer.Amount = amount.String()
+	return hashRequest(transfer)
+}
+
+// multiLegFingerprint is requestFingerprint for multi-leg transfers. The amounts have been parsed already, so they
+// are normalised when they are encoded.
+func multiLegFingerprint(transfer apimodel.MultiLegTransfer) (string, error) {
+	transfer.IdempotencyKey = ""
+	return hashRequest(transfer)
+}
+
+func hashRequest(request interface{}) (string, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// findIdempotentTransfer looks up a previous use of the idempotency key. It returns the ID of the transfer booked
+// for the key, or 0 if the key has not been used yet. Reusing a key for a different request is rejected.
+func findIdempotentTransfer(tx *gorm.DB, key, fingerprint string) (uint64, error) {
+	var record model.IdempotencyKey
+	if err := tx.Take(&record, "key = ?", key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if record.RequestHash != fingerprint {
+		return 0, svrerror.New("idempotency key has already been used for a different request", http.StatusUnprocessableEntity)
+	}
+	return record.TransferID, nil
+}
+
+// saveIdempotencyKey stores the key against the booked transfer. If a concurrent request with the same key committed
+// first, a conflict is returned so that the retry loop picks up and replays the committed result.
+func saveIdempotencyKey(tx *gorm.DB, key, fingerprint string, transferID uint64) error {
+	record := model.IdempotencyKey{
+		Key:         key,
+		RequestHash: fingerprint,
+		TransferID:  transferID,
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return svrerror.New("idempotency key used concurrently, retrying", http.StatusConflict)
+		}
+		return err
+	}
+	return nil
+}
+
+// PurgeExpiredIdempotencyKeys deletes idempotency keys older than ttl and returns the number of keys removed.
+func PurgeExpiredIdempotencyKeys(ctx context.Context, db *gorm.DB, ttl time.Duration) (int64, error) {
+	result := db.WithContext(ctx).
+		Where("created_at < ?", time.Now().Add(-ttl)).
+		Delete(&model.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
+
+// RunIdempotencyKeyCleanup purges expired idempotency keys every interval until ctx is cancelled. Keys remain
+// replayable until they are purged, so ttl is the minimum time a key is honoured for.
+func RunIdempotencyKeyCleanup(ctx context.Context, db *gorm.DB, ttl, interval time.Duration) {
+	if ttl <= 0 {
+		slog.Info("idempotency key cleanup disabled")
+		return
+	}
+
+	runEvery(ctx, "idempotency key cleanup", interval, func(ctx context.Context) error {
+		purged, err := PurgeExpiredIdempotencyKeys(ctx, db, ttl)
+		if err != nil {
+			return err
+		}
+		slog.Debug("purged idempotency keys", "count", purged)
+		return nil
+	})
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"internal-transfers-system/internal/model"
+)
+
+// posting returns the journal entry that moves amount into (positive) or out of (negative) an account.
+func posting(transferID *uint64, accountID uint64, currency string, amount, balanceAfter decimal.Decimal) model.JournalEntry {
+	return model.JournalEntry{
+		TransferID:   transferID,
+		AccountID:    &accountID,
+		Currency:     currency,
+		Amount:       amount,
+		BalanceAfter: decimal.NewNullDecimal(balanceAfter),
+	}
+}
+
+// fxPosition returns the journal entry that balances one side of a cross-currency transfer. The FX position of a
+// currency is not an account, so the entry has neither an account nor a running balance.
+func fxPosition(transferID *uint64, currency string, amount decimal.Decimal) model.JournalEntry {
+	return model.JournalEntry{
+		TransferID: transferID,
+		Currency:   currency,
+		Amount:     amount,
+	}
+}
+
+// postJournalEntries writes the postings of a transfer. The postings in each currency must sum to zero, which is also
+// enforced by a deferred constraint trigger in the database.
+func postJournalEntries(tx *gorm.DB, entries []model.JournalEntry) error {
+	sums := make(map[string]decimal.Decimal)
+	for _, entry := range entries {
+		sums[entry.Currency] = sums[entry.Currency].Add(entry.Amount)
+	}
+	for currency, sum := range sums {
+		if !sum.IsZero() {
+			return fmt.Errorf("journal entries do not balance: %s postings sum to %s", currency, sum)
+		}
+	}
+	return tx.Create(&entries).Error
+}
+
+// LedgerBalance derives the balance of an account by summing all of its postings.
+func LedgerBalance(ctx context.Context, db *gorm.DB, accountID uint64) (decimal.Decimal, error) {
+	var balance decimal.Decimal
+	err := db.WithContext(ctx).
+		Model(&model.JournalEntry{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("account_id = ?", accountID).
+		Row().
+		Scan(&balance)
+	return balance, err
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"internal-transfers-system/internal/ledger"
+	"internal-transfers-system/internal/model"
+)
+
+// replaySchemaName restricts replay schemas to plain lower case identifiers, since the name ends up in DDL.
+var replaySchemaName = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// appendLedgerEvent appends an event to the ledger's event log within tx. It must be called after the account rows
+// the event describes have been updated, so that the event's sequence follows the row locks.
+func appendLedgerEvent(tx *gorm.DB, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&model.LedgerEvent{Type: eventType, Payload: data}).Error
+}
+
+// appendFundsTransferred appends the FundsTransferred event of a transfer, with a posting per account from its
+// journal entries.
+func appendFundsTransferred(tx *gorm.DB, transferID uint64, entries []model.JournalEntry) error {
+	event := ledger.FundsTransferred{TransferID: transferID}
+	for _, entry := range entries {
+		if entry.AccountID == nil {
+			continue
+		}
+		event.Postings = append(event.Postings, ledger.Posting{
+			AccountID: *entry.AccountID,
+			Currency:  entry.Currency,
+			Amount:    entry.Amount,
+		})
+	}
+	return appendLedgerEvent(tx, model.LedgerEventFundsTransferred, event)
+}
+
+// AccountDiff is a difference between the live accounts table and a replay of the event log. Field is "account"
+// when the account only exists on one side; the missing side is then empty.
+type AccountDiff struct {
+	AccountID uint64
+	Field     string
+	Live      string
+	Replayed  string
+}
+
+type LedgerReplay struct {
+	Schema   string
+	Events   int
+	Accounts int
+	Diffs    []AccountDiff
+}
+
+// ReplayLedger projects the whole event log into the accounts table of a new schema and compares the result with the
+// live accounts table. Everything happens in a single repeatable read transaction, so the events and the live table
+// come from the same snapshot and the comparison is exact even while transfers are being booked. The schema is kept
+// so that the replayed table can be inspected, and must not exist yet.
+func ReplayLedger(ctx context.Context, db *gorm.DB, schema string) (*LedgerReplay, error) {
+	if !replaySchemaName.MatchString(schema) {
+		return nil, fmt.Errorf("invalid schema name %q", schema)
+	}
+
+	replay := LedgerReplay{Schema: schema}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		projection := ledger.NewProjection()
+		var events []model.LedgerEvent
+		// Batches are read in order of the primary key, which is the sequence
+		result := tx.FindInBatches(&events, 1000, func(tx *gorm.DB, batch int) error {
+			for i := range events {
+				if err := projection.Apply(&events[i]); err != nil {
+					return err
+				}
+			}
+			replay.Events += len(events)
+			return nil
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		table := fmt.Sprintf(`"%s".accounts`, schema)
+		if err := tx.Exec(fmt.Sprintf(`CREATE SCHEMA "%s"`, schema)).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(fmt.Sprintf(`CREATE TABLE %s (LIKE accounts INCLUDING DEFAULTS INCLUDING CONSTRAINTS)`, table)).Error; err != nil {
+			return err
+		}
+		accounts := projection.Accounts()
+		replay.Accounts = len(accounts)
+		if len(accounts) > 0 {
+			if err := tx.Table(schema+".accounts").CreateInBatches(&accounts, 1000).Error; err != nil {
+				return err
+			}
+		}
+
+		var err error
+		replay.Diffs, err = diffAccounts(tx, table)
+		return err
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return nil, err
+	}
+	return &replay, nil
+}
+
+// accountPair is a live account next to its replayed version. The columns of a side are NULL if the account only
+// exists on the other side.
+type accountPair struct {
+	LiveID                 *uint64
+	ReplayedID             *uint64
+	LiveBalance            decimal.NullDecimal
+	ReplayedBalance        decimal.NullDecimal
+	LiveCurrency           *string
+	ReplayedCurrency       *string
+	LiveStatus             *string
+	ReplayedStatus         *string
+	LiveOverdraftLimit     decimal.NullDecimal
+	ReplayedOverdraftLimit decimal.NullDecimal
+	LiveCreatedAt          *time.Time
+	ReplayedCreatedAt      *time.Time
+}
+
+// diffAccounts compares the live accounts table with the replayed one. updated_at is not compared, since holds and
+// limit changes touch accounts without an event.
+func diffAccounts(tx *gorm.DB, table string) ([]AccountDiff, error) {
+	var pairs []accountPair
+	err := tx.Raw(fmt.Sprintf(`
+            SELECT live.id AS live_id, replayed.id AS replayed_id,
+                   live.balance AS live_balance, replayed.balance AS replayed_balance,
+                   live.currency AS live_currency, replayed.currency AS replayed_currency,
+                   live.status AS live_status, replayed.status AS replayed_status,
+                   live.overdraft_limit AS live_overdraft_limit, replayed.overdraft_limit AS replayed_overdraft_limit,
+                   live.created_at AS live_created_at, replayed.created_at AS replayed_created_at
+            FROM accounts live
+                FULL OUTER JOIN %s replayed ON replayed.id = live.id
+            WHERE live.id IS NULL OR replayed.id IS NULL
+               OR live.balance <> replayed.balance
+               OR live.currency <> replayed.currency
+               OR live.status <> replayed.status
+               OR live.overdraft_limit <> replayed.overdraft_limit
+               OR live.created_at <> replayed.created_at
+            ORDER BY COALESCE(live.id, replayed.id)`, table)).Scan(&pairs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []AccountDiff
+	for _, pair := range pairs {
+		switch {
+		case pair.ReplayedID == nil:
+			diffs = append(diffs, AccountDiff{AccountID: *pair.LiveID, Field: "account", Live: "present"})
+			continue
+		case pair.LiveID == nil:
+			diffs = append(diffs, AccountDiff{AccountID: *pair.ReplayedID, Field: "account", Replayed: "present"})
+			continue
+		}
+
+		id := *pair.LiveID
+		if !pair.LiveBalance.Decimal.Equal(pair.ReplayedBalance.Decimal) {
+			diffs = append(diffs, AccountDiff{id, "balance", pair.LiveBalance.Decimal.String(), pair.ReplayedBalance.Decimal.String()})
+		}
+		if *pair.LiveCurrency != *pair.ReplayedCurrency {
+			diffs = append(diffs, AccountDiff{id, "currency", *pair.LiveCurrency, *pair.ReplayedCurrency})
+		}
+		if *pair.LiveStatus != *pair.ReplayedStatus {
+			diffs = append(diffs, AccountDiff{id, "status", *pair.LiveStatus, *pair.ReplayedStatus})
+		}
+		if !pair.LiveOverdraftLimit.Decimal.Equal(pair.ReplayedOverdraftLimit.Decimal) {
+			diffs = append(diffs, AccountDiff{id, "overdraft_limit", pair.LiveOverdraftLimit.Decimal.String(), pair.ReplayedOverdraftLimit.Decimal.String()})
+		}
+		if !pair.LiveCreatedAt.Equal(*pair.ReplayedCreatedAt) {
+			diffs = append(diffs, AccountDiff{id, "created_at", pair.LiveCreatedAt.Format(time.RFC3339Nano), pair.ReplayedCreatedAt.Format(time.RFC3339Nano)})
+		}
+	}
+	return diffs, nil
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"internal-transfers-system/internal/currency"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/svrerror"
+)
+
+// Names of the limits, as reported in limit exceeded errors.
+const (
+	LimitMaxTransferAmount  = "max_transfer_amount"
+	LimitDailyAmount        = "daily_amount"
+	LimitRolling30DayAmount = "rolling_30_day_amount"
+	LimitHourlyCount        = "hourly_count"
+)
+
+const rollingLimitWindow = 30 * 24 * time.Hour
+
+// Limits caps how much an account can send. Limits that are not set do not apply. Amounts are in the currency of
+// the account.
+type Limits struct {
+	MaxTransferAmount  decimal.NullDecimal
+	DailyAmount        decimal.NullDecimal
+	Rolling30DayAmount decimal.NullDecimal
+	HourlyCount        *int64
+}
+
+// DefaultLimits are the limits of accounts that do not have limits of their own. An amount only means something in a
+// currency, so the amount limits are kept per currency, and accounts in a currency without one are not limited by it.
+type DefaultLimits struct {
+	MaxTransferAmount  map[string]decimal.Decimal
+	DailyAmount        map[string]decimal.Decimal
+	Rolling30DayAmount map[string]decimal.Decimal
+	HourlyCount        *int64
+}
+
+// NewDefaultLimits parses the default limits from configuration. Amounts are written as comma-separated
+// <currency>:<amount> pairs, e.g. "SGD:10000,USD:7500". Empty amounts and a zero count are not limited.
+func NewDefaultLimits(maxTransferAmount, dailyAmount, rolling30DayAmount string, hourlyCount int64) (DefaultLimits, error) {
+	var limits DefaultLimits
+	for _, field := range []struct {
+		name   string
+		value  string
+		limits *map[string]decimal.Decimal
+	}{
+		{LimitMaxTransferAmount, maxTransferAmount, &limits.MaxTransferAmount},
+		{LimitDailyAmount, dailyAmount, &limits.DailyAmount},
+		{LimitRolling30DayAmount, rolling30DayAmount, &limits.Rolling30DayAmount},
+	} {
+		amounts, err := parseCurrencyAmounts(field.name, field.value)
+		if err != nil {
+			return limits, err
+		}
+		*field.limits = amounts
+	}
+
+	if hourlyCount < 0 {
+		return limits, fmt.Errorf("%s must not be negative: %d", LimitHourlyCount, hourlyCount)
+	}
+	if hourlyCount > 0 {
+		limits.HourlyCount = &hourlyCount
+	}
+	return limits, nil
+}
+
+func parseCurrencyAmounts(name, value string) (map[string]decimal.Decimal, error) {
+	amounts := make(map[string]decimal.Decimal)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		code, encoded, ok := strings.Cut(pair, ":")
+		if !ok || !currency.IsValid(code) {
+			return nil, fmt.Errorf("%s must be <currency>:<amount> pairs: %q", name, pair)
+		}
+		if _, ok := amounts[code]; ok {
+			return nil, fmt.Errorf("%s is given more than once for %s", name, code)
+		}
+		amount, err := decimal.NewFromString(encoded)
+		if err != nil || !amount.IsPositive() {
+			return nil, fmt.Errorf("%s must be a positive amount: %q", name, pair)
+		}
+		amounts[code] = amount
+	}
+	return amounts, nil
+}
+
+// forCurrency returns the default limits of accounts in the given currency.
+func (d DefaultLimits) forCurrency(code string) Limits {
+	limits := Limits{HourlyCount: d.HourlyCount}
+	if amount, ok := d.MaxTransferAmount[code]; ok {
+		limits.MaxTransferAmount = decimal.NewNullDecimal(amount)
+	}
+	if amount, ok := d.DailyAmount[code]; ok {
+		limits.DailyAmount = decimal.NewNullDecimal(amount)
+	}
+	if amount, ok := d.Rolling30DayAmount[code]; ok {
+		limits.Rolling30DayAmount = decimal.NewNullDecimal(amount)
+	}
+	return limits
+}
+
+// withOverrides returns the limits with the account's own limits taking precedence.
+func (l Limits) withOverrides(overrides *model.AccountLimits) Limits {
+	if overrides == nil {
+		return l
+	}
+	if overrides.MaxTransferAmount.Valid {
+		l.MaxTransferAmount = overrides.MaxTransferAmount
+	}
+	if overrides.DailyAmount.Valid {
+		l.DailyAmount = overrides.DailyAmount
+	}
+	if overrides.Rolling30DayAmount.Valid {
+		l.Rolling30DayAmount = overrides.Rolling30DayAmount
+	}
+	if overrides.HourlyCount != nil {
+		l.HourlyCount = overrides.HourlyCount
+	}
+	return l
+}
+
+// findAccountLimits returns the account's own limits, or nil if it only has the defaults.
+func findAccountLimits(tx *gorm.DB, accountID uint64) (*model.AccountLimits, error) {
+	var overrides model.AccountLimits
+	if err := tx.Take(&overrides, "account_id = ?", accountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &overrides, nil
+}
+
+// GetAccountLimits returns the limits that apply to an account along with the account's own limits, which are nil if
+// the account only has the defaults.
+func GetAccountLimits(ctx context.Context, db *gorm.DB, defaults DefaultLimits, accountID uint64) (Limits, *model.AccountLimits, error) {
+	account, err := GetAccount(ctx, db, accountID)
+	if err != nil {
+		return Limits{}, nil, err
+	}
+
+	overrides, err := findAccountLimits(db.WithContext(ctx), accountID)
+	if err != nil {
+		return Limits{}, nil, err
+	}
+	return defaults.forCurrency(account.Currency).withOverrides(overrides), overrides, nil
+}
+
+// SetAccountLimits replaces the account's own limits. Like other changes to an account, it touches the account's
+// updatedAt so that a transfer that read the old limits is retried.
+func SetAccountLimits(ctx context.Context, db *gorm.DB, limits model.AccountLimits) error {
+	return withRetry(func() error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var account model.Account
+			if err := tx.Take(&account, "id = ?", limits.AccountID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return svrerror.New("account not found", http.StatusNotFound)
+				}
+				return err
+			}
+
+			if err := touchAccount(tx, &account); err != nil {
+				return err
+			}
+			return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&limits).Error
+		})
+	})
+}
+
+// checkLimits rejects a transfer that would take the source account over any of its limits. The usage is read from
+// the transfers table within tx, after the source account has been read. Two concurrent transfers from the same
+// account cannot both pass on stale usage, because only one of them can update the source account's balance; the
+// other fails the updatedAt check, is retried and sees the first transfer.
+func checkLimits(tx *gorm.DB, defaults DefaultLimits, account *model.Account, amount decimal.Decimal) error {
+	accountID := account.ID
+	overrides, err := findAccountLimits(tx, accountID)
+	if err != nil {
+		return err
+	}
+	limits := defaults.forCurrency(account.Currency).withOverrides(overrides)
+
+	if limits.MaxTransferAmount.Valid && amount.GreaterThan(limits.MaxTransferAmount.Decimal) {
+		return limitExceeded(LimitMaxTransferAmount, limits.MaxTransferAmount.Decimal.String(), "", amount.String())
+	}
+	if !limits.DailyAmount.Valid && !limits.Rolling30DayAmount.Valid && limits.HourlyCount == nil {
+		return nil
+	}
+
+	// Outgoing transfers are single transfers from the account and the debit legs of multi-leg transfers. Reversals
+	// from the account give money back to where it came from and do not count towards its limits.
+	now := time.Now()
+	since := now.Add(-rollingLimitWindow)
+	var daily, rolling decimal.Decimal
+	var hourly int64
+	err = tx.Raw(`
+		SELECT COALESCE(SUM(amount) FILTER (WHERE created_at >= ?), 0),
+			COALESCE(SUM(amount), 0),
+			COUNT(*) FILTER (WHERE created_at >= ?)
+		FROM (SELECT created_at, amount FROM transfers
+			WHERE source_account_id = ? AND reversal_of_id IS NULL AND created_at >= ?
+			UNION ALL
+			SELECT created_at, -amount FROM transfer_legs WHERE account_id = ? AND amount < 0 AND created_at >= ?) AS outgoing`,
+		now.UTC().Truncate(24*time.Hour), now.Add(-time.Hour), accountID, since, accountID, since).
+		Row().
+		Scan(&daily, &rolling, &hourly)
+	if err != nil {
+		return err
+	}
+
+	if limits.DailyAmount.Valid && daily.Add(amount).GreaterThan(limits.DailyAmount.Decimal) {
+		return limitExceeded(LimitDailyAmount, limits.DailyAmount.Decimal.String(), daily.String(), amount.String())
+	}
+	if limits.Rolling30DayAmount.Valid && rolling.Add(amount).GreaterThan(limits.Rolling30DayAmount.Decimal) {
+		return limitExceeded(LimitRolling30DayAmount, limits.Rolling30DayAmount.Decimal.String(), rolling.String(), amount.String())
+	}
+	if limits.HourlyCount != nil && hourly+1 > *limits.HourlyCount {
+		return limitExceeded(LimitHourlyCount, fmt.Sprint(*limits.HourlyCount), fmt.Sprint(hourly), "1")
+	}
+	return nil
+}
+
+// limitExceeded names the limit, its value, how much of it has been used already and what the transfer asked for.
+// used is left out for the per transfer limit.
+func limitExceeded(limit, value, used, requested string) error {
+	details := map[string]string{
+		"limit":     limit,
+		"value":     value,
+		"requested": requested,
+	}
+	if used != "" {
+		details["used"] = used
+	}
+	return &svrerror.Error{
+		Message:    limit + " limit exceeded",
+		StatusCode: http.StatusUnprocessableEntity,
+		Code:       svrerror.CodeLimitExceeded,
+		Details:    details,
+	}
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/svrerror"
+)
+
+// ProcessMultiLegTransfer books a multi-leg transfer as a single transfer with a leg per account, in the same kind of
+// transaction as ProcessTransfer: either every leg is booked or none is, idempotency keys are honoured, and each
+// source account gets the same checks as the source of a single transfer, limits included.
+func ProcessMultiLegTransfer(ctx context.Context, db *gorm.DB, policy TransferPolicy, transfer apimodel.MultiLegTransfer) (*model.Transfer, error) {
+	var fingerprint string
+	if transfer.IdempotencyKey != "" {
+		var err error
+		if fingerprint, err = multiLegFingerprint(transfer); err != nil {
+			return nil, err
+		}
+	}
+
+	return bookIdempotently(ctx, db, transfer.IdempotencyKey, fingerprint, func(tx *gorm.DB) (*model.Transfer, error) {
+		slog.Debug("processing multi-leg transfer", "sources", len(transfer.Sources), "destinations", len(transfer.Destinations))
+		return bookMultiLegTransfer(tx, policy, transfer)
+	})
+}
+
+// bookMultiLegTransfer moves money between the accounts of a multi-leg transfer within tx. Like bookTransfer, it only
+// updates accounts that have not changed since they were read. The accounts are updated in order of their ID, so that
+// concurrent multi-leg transfers over the same accounts cannot deadlock.
+func bookMultiLegTransfer(tx *gorm.DB, policy TransferPolicy, transfer apimodel.MultiLegTransfer) (*model.Transfer, error) {
+	accountIDs := make([]uint64, 0, len(transfer.Sources)+len(transfer.Destinations))
+	for _, leg := range transfer.Sources {
+		accountIDs = append(accountIDs, leg.AccountID)
+	}
+	for _, leg := range transfer.Destinations {
+		accountIDs = append(accountIDs, leg.AccountID)
+	}
+
+	var found []model.Account
+	if err := tx.Where("id IN ?", accountIDs).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	accounts := make(map[uint64]*model.Account, len(found))
+	for i := range found {
+		accounts[found[i].ID] = &found[i]
+	}
+	for _, id := range accountIDs {
+		if accounts[id] == nil {
+			return nil, svrerror.New(fmt.Sprintf("account %d not found", id), http.StatusNotFound)
+		}
+	}
+
+	total := decimal.Zero
+	balances := make(map[uint64]decimal.Decimal, len(accountIDs))
+	for _, leg := range transfer.Sources {
+		account := accounts[leg.AccountID]
+		if err := checkDebitAllowed(account); err != nil {
+			return nil, err
+		}
+		if err := checkAccountCurrency(account, transfer.Currency, "source"); err != nil {
+			return nil, err
+		}
+		// The usage is read after the account, see bookTransfer
+		if err := checkLimits(tx, policy.DefaultLimits, account, leg.Amount); err != nil {
+			return nil, err
+		}
+
+		held, err := heldAmount(tx, account.ID)
+		if err != nil {
+			return nil, err
+		}
+		if account.Balance.Sub(held).Add(account.OverdraftLimit).LessThan(leg.Amount) {
+			return nil, insufficientFundsInAccount(account.ID)
+		}
+
+		balances[account.ID] = account.Balance.Sub(leg.Amount)
+		total = total.Add(leg.Amount)
+	}
+	for _, leg := range transfer.Destinations {
+		account := accounts[leg.AccountID]
+		if err := checkCreditAllowed(account); err != nil {
+			return nil, err
+		}
+		if err := checkAccountCurrency(account, transfer.Currency, "destination"); err != nil {
+			return nil, err
+		}
+		balances[account.ID] = account.Balance.Add(leg.Amount)
+	}
+
+	sort.Slice(accountIDs, func(i, j int) bool { return accountIDs[i] < accountIDs[j] })
+	for _, id := range accountIDs {
+		result := tx.Exec(`UPDATE accounts SET balance = ?, updated_at = NOW() WHERE id = ? AND updated_at = ?`,
+			balances[id], id, accounts[id].UpdatedAt)
+		if result.Error != nil {
+			// The overdraft check constraint backs up the funds check above
+			if isCheckViolation(result.Error, "chk_account_overdraft") {
+				return nil, insufficientFundsInAccount(id)
+			}
+			return nil, result.Error
+		}
+		if result.RowsAffected != 1 {
+			return nil, svrerror.New("account updatedAt mismatch, retrying", http.StatusConflict)
+		}
+	}
+
+	newTransfer := model.Transfer{
+		Amount:              total,
+		Currency:            transfer.Currency,
+		DestinationAmount:   total,
+		DestinationCurrency: transfer.Currency,
+	}
+	if err := tx.Create(&newTransfer).Error; err != nil {
+		return nil, err
+	}
+
+	legs := make([]model.TransferLeg, 0, len(accountIDs))
+	entries := make([]model.JournalEntry, 0, len(accountIDs))
+	addLeg := func(accountID uint64, amount decimal.Decimal) {
+		legs = append(legs, model.TransferLeg{
+			TransferID:   newTransfer.ID,
+			AccountID:    accountID,
+			Amount:       amount,
+			BalanceAfter: balances[accountID],
+		})
+		entries = append(entries, posting(&newTransfer.ID, accountID, transfer.Currency, amount, balances[accountID]))
+	}
+	for _, leg := range transfer.Sources {
+		addLeg(leg.AccountID, leg.Amount.Neg())
+	}
+	for _, leg := range transfer.Destinations {
+		addLeg(leg.AccountID, leg.Amount)
+	}
+
+	if err := tx.Create(&legs).Error; err != nil {
+		return nil, err
+	}
+	if err := postJournalEntries(tx, entries); err != nil {
+		return nil, err
+	}
+
+	newTransfer.Legs = legs
+	if err := recordEvent(tx, model.EventTypeTransferCreated, apimodel.NewTransferResponse(&newTransfer)); err != nil {
+		return nil, err
+	}
+	if err := recordBalanceChanges(tx, newTransfer.ID, entries); err != nil {
+		return nil, err
+	}
+	if err := appendFundsTransferred(tx, newTransfer.ID, entries); err != nil {
+		return nil, err
+	}
+	return &newTransfer, nil
+}
+
+// insufficientFundsInAccount is the insufficient funds error for a transfer with several source accounts, which
+// names the account that is short of funds.
+func insufficientFundsInAccount(accountID uint64) error {
+	return &svrerror.Error{
+		Message:    fmt.Sprintf("insufficient funds in account %d", accountID),
+		StatusCode: http.StatusBadRequest,
+		Code:       svrerror.CodeInsufficientFunds,
+		Details:    map[string]string{"account_id": strconv.FormatUint(accountID, 10)},
+	}
+}
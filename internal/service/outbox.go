@@ -0,0 +1,58 @@
+package service
+
+import (
+	"encoding/json"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+)
+
+// EventsChannel is the channel notified when events are written to the outbox. Postgres delivers the notification
+// when the transaction commits, and only once per transaction since the payload is always the same.
+const EventsChannel = "outbox_events"
+
+// recordEvent writes an event to the outbox within tx, so that it is only published if tx commits. payload is
+// marshalled to JSON and becomes the data of the event's webhooks.
+func recordEvent(tx *gorm.DB, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if err := tx.Create(&model.OutboxEvent{Type: eventType, Payload: data}).Error; err != nil {
+		return err
+	}
+	return tx.Exec("SELECT pg_notify(?, '')", EventsChannel).Error
+}
+
+// recordBalanceChanges writes a balance.changed event for every account that entries post to, with the balance after
+// its last posting. FX position postings have no account and are skipped.
+func recordBalanceChanges(tx *gorm.DB, transferID uint64, entries []model.JournalEntry) error {
+	var accountIDs []uint64
+	last := make(map[uint64]model.JournalEntry)
+	changes := make(map[uint64]decimal.Decimal)
+	for _, entry := range entries {
+		if entry.AccountID == nil {
+			continue
+		}
+		if _, ok := last[*entry.AccountID]; !ok {
+			accountIDs = append(accountIDs, *entry.AccountID)
+		}
+		last[*entry.AccountID] = entry
+		changes[*entry.AccountID] = changes[*entry.AccountID].Add(entry.Amount)
+	}
+
+	for _, accountID := range accountIDs {
+		if err := recordEvent(tx, model.EventTypeBalanceChanged, apimodel.BalanceChangedEvent{
+			AccountID:  accountID,
+			TransferID: transferID,
+			Currency:   last[accountID].Currency,
+			Amount:     changes[accountID].String(),
+			Balance:    last[accountID].BalanceAfter.Decimal.String(),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
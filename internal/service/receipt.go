@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/receipt"
+	"internal-transfers-system/internal/svrerror"
+)
+
+// IssueReceipt returns the signed receipt of a transfer. The first time a transfer's receipt is asked for, it is
+// signed with the signer's current key and stored, so a transfer's receipt stays the same after keys are rotated and
+// the accounts have moved on. signer can be nil when receipts are not enabled, in which case only receipts that were
+// issued before can be returned.
+func IssueReceipt(ctx context.Context, db *gorm.DB, signer *receipt.Signer, transferID uint64) (*apimodel.SignedReceiptResponse, error) {
+	db = db.WithContext(ctx)
+
+	var stored model.TransferReceipt
+	result := db.Limit(1).Find(&stored, "transfer_id = ?", transferID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if signer == nil {
+			return nil, svrerror.New("receipts are not enabled", http.StatusNotFound)
+		}
+
+		issued, err := signReceipt(db, signer, transferID)
+		if err != nil {
+			return nil, err
+		}
+		// A concurrent request may have issued the receipt first, in which case that one is returned
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(issued).Error; err != nil {
+			return nil, err
+		}
+		if err := db.Take(&stored, "transfer_id = ?", transferID).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	response := apimodel.SignedReceiptResponse{Signature: stored.Signature}
+	if err := json.Unmarshal([]byte(stored.Payload), &response.Receipt); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// signReceipt signs a receipt of the transfer as it was booked, with the balance of each of its own accounts right
+// after the transfer, taken from the journal. Those are its source and destination accounts, or the accounts of its
+// legs. Other accounts the transfer posted to, like a fee revenue account, are left out.
+func signReceipt(db *gorm.DB, signer *receipt.Signer, transferID uint64) (*model.TransferReceipt, error) {
+	var transfer model.Transfer
+	if err := db.Preload("Legs", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Take(&transfer, "id = ?", transferID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, svrerror.New("transfer not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+
+	var accounts []uint64
+	for _, id := range []*uint64{transfer.SourceAccountID, transfer.DestinationAccountID} {
+		if id != nil {
+			accounts = append(accounts, *id)
+		}
+	}
+	for _, leg := range transfer.Legs {
+		accounts = append(accounts, leg.AccountID)
+	}
+
+	var entries []model.JournalEntry
+	if err := db.Where("transfer_id = ? AND account_id IN ?", transferID, accounts).Order("id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	// The last posting to an account has its balance after the transfer
+	balances := make([]apimodel.ReceiptBalance, 0, len(entries))
+	positions := make(map[uint64]int)
+	for _, entry := range entries {
+		balance := apimodel.ReceiptBalance{
+			AccountID: *entry.AccountID,
+			Currency:  entry.Currency,
+			Balance:   entry.BalanceAfter.Decimal.String(),
+		}
+		if i, ok := positions[*entry.AccountID]; ok {
+			balances[i] = balance
+			continue
+		}
+		positions[*entry.AccountID] = len(balances)
+		balances = append(balances, balance)
+	}
+
+	content := apimodel.Receipt{
+		IssuedAt: time.Now().UTC(),
+		Transfer: apimodel.NewTransferResponse(&transfer),
+		Balances: balances,
+	}
+	payload, signature, err := signer.Sign(&content)
+	if err != nil {
+		return nil, err
+	}
+	return &model.TransferReceipt{
+		TransferID: transferID,
+		KeyID:      content.KeyID,
+		Payload:    string(payload),
+		Signature:  signature,
+	}, nil
+}
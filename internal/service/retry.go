@@ -0,0 +1,54 @@
+package service
+
+import (
+	"errors"
+	"github.com/avast/retry-go/v4"
+	"github.com/jackc/pgx/v5/pgconn"
+	"log"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"internal-transfers-system/internal/svrerror"
+)
+
+// withRetry runs fn, typically a whole DB transaction, and retries it with backoff when it failed because of an
+// optimistic concurrency conflict or lock contention.
+func withRetry(fn func() error) error {
+	return retry.Do(
+		fn,
+		retry.Attempts(5),
+		retry.Delay(100*time.Millisecond),
+		retry.MaxDelay(2*time.Second),
+		retry.MaxJitter(100*time.Millisecond),
+		retry.DelayType(retry.CombineDelay(
+			retry.BackOffDelay,
+			retry.RandomDelay,
+		)),
+		retry.OnRetry(func(n uint, err error) {
+			log.Printf("retry: #%d: %s\n", n, err)
+		}),
+		retry.RetryIf(func(err error) bool {
+			if !isRetryable(err) {
+				return false
+			}
+			slog.Warn("transfer: retrying", "reason", err)
+			return true
+		}),
+	)
+}
+
+// isRetryable reports whether err is an optimistic concurrency conflict or lock contention, which goes away when the
+// transaction is run again.
+func isRetryable(err error) bool {
+	var svrError *svrerror.Error
+	if errors.As(err, &svrError) && svrError.StatusCode == http.StatusConflict {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "55P03" {
+		return true
+	}
+	// Fees are credited to a shared revenue account, which can deadlock with a transfer into it
+	return errors.As(err, &pgErr) && pgErr.Code == "40P01"
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/svrerror"
+)
+
+// ReverseTransfer books a transfer in the opposite direction of an earlier transfer and links it to the original.
+// amount may be less than the original amount for a partial reversal; if it is not set, whatever has not been
+// reversed yet is reversed. The reversals of a transfer can never add up to more than the original amount.
+// Cross-currency transfers are reversed in full at the original rate, so that both accounts end up where they were.
+func ReverseTransfer(ctx context.Context, db *gorm.DB, transferID uint64, amount decimal.NullDecimal) (*model.Transfer, error) {
+	var reversal *model.Transfer
+	err := withRetry(func() error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			// Lock the original so that concurrent reversals of it are serialised and cannot jointly exceed it
+			var original model.Transfer
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&original, "id = ?", transferID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return svrerror.New("transfer not found", http.StatusNotFound)
+				}
+				return err
+			}
+			if original.ReversalOfID != nil {
+				return svrerror.New("a reversal cannot be reversed", http.StatusUnprocessableEntity)
+			}
+			if original.SourceAccountID == nil {
+				return svrerror.New("multi-leg transfers cannot be reversed", http.StatusUnprocessableEntity)
+			}
+
+			// A reversal's destination amount is what it returns to the original source account
+			var reversed decimal.Decimal
+			if err := tx.Model(&model.Transfer{}).
+				Select("COALESCE(SUM(destination_amount), 0)").
+				Where("reversal_of_id = ?", original.ID).
+				Row().
+				Scan(&reversed); err != nil {
+				return err
+			}
+
+			remaining := original.Amount.Sub(reversed)
+			reversalAmount := remaining
+			if amount.Valid {
+				reversalAmount = amount.Decimal
+			}
+			if !remaining.IsPositive() {
+				return svrerror.New("transfer has already been fully reversed", http.StatusUnprocessableEntity)
+			}
+			if reversalAmount.GreaterThan(remaining) {
+				return svrerror.New("reversal amount exceeds the amount not yet reversed", http.StatusBadRequest)
+			}
+
+			booking := transferBooking{
+				SourceAccountID:      *original.DestinationAccountID,
+				DestinationAccountID: *original.SourceAccountID,
+				Amount:               reversalAmount,
+				Currency:             original.Currency,
+				ReversalOfID:         &original.ID,
+			}
+			if original.FXRate.Valid {
+				if !reversalAmount.Equal(original.Amount) {
+					return svrerror.New("cross-currency transfers can only be reversed in full", http.StatusUnprocessableEntity)
+				}
+				booking.Amount = original.DestinationAmount
+				booking.Currency = original.DestinationCurrency
+				booking.Conversion = &fxConversion{
+					DestinationCurrency: original.Currency,
+					DestinationAmount:   original.Amount,
+					Rate:                original.Amount.DivRound(original.DestinationAmount, fxRatePrecision),
+					RoundingAdjustment:  decimal.Zero,
+				}
+			}
+
+			slog.Debug("reversing transfer", "transfer", original.ID, "amount", booking.Amount)
+			newTransfer, err := bookTransfer(tx, booking)
+			if err != nil {
+				return err
+			}
+			if err := chainTransfers(tx, newTransfer); err != nil {
+				return err
+			}
+
+			reversal = newTransfer
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/svrerror"
+)
+
+// ScheduledTransferRetry controls how often a scheduled transfer is attempted before it is marked as failed.
+type ScheduledTransferRetry struct {
+	MaxAttempts int
+	Delay       time.Duration
+}
+
+// CreateScheduledTransfer stores a transfer to be booked at executeAt. Everything other than the accounts and the
+// currency, including the funds, is checked when the transfer is booked.
+func CreateScheduledTransfer(ctx context.Context, db *gorm.DB, request apimodel.CreateScheduledTransferRequest, amount decimal.Decimal, executeAt time.Time) (*model.ScheduledTransfer, error) {
+	var created *model.ScheduledTransfer
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkTransferAccounts(tx, request.SourceAccountID, request.DestinationAccountID, request.Currency); err != nil {
+			return err
+		}
+
+		scheduled := model.ScheduledTransfer{
+			SourceAccountID:      request.SourceAccountID,
+			DestinationAccountID: request.DestinationAccountID,
+			Amount:               amount,
+			Currency:             request.Currency,
+			Status:               model.ScheduledTransferStatusPending,
+			ExecuteAt:            executeAt,
+			NextAttemptAt:        executeAt,
+		}
+		if err := tx.Create(&scheduled).Error; err != nil {
+			return err
+		}
+		scheduled.Attempts = []model.ScheduledTransferAttempt{}
+
+		created = &scheduled
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// GetScheduledTransfer returns a single scheduled transfer by ID, along with its attempts.
+func GetScheduledTransfer(ctx context.Context, db *gorm.DB, scheduledTransferID uint64) (*model.ScheduledTransfer, error) {
+	var scheduled model.ScheduledTransfer
+	if err := db.WithContext(ctx).
+		Preload("Attempts", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Take(&scheduled, "id = ?", scheduledTransferID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, svrerror.New("scheduled transfer not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &scheduled, nil
+}
+
+// ListScheduledTransfers returns a page of scheduled transfers, newest first, using keyset pagination over the ID.
+// The returned cursor is 0 when there are no more pages.
+func ListScheduledTransfers(ctx context.Context, db *gorm.DB, filter apimodel.ScheduledTransferFilter) ([]model.ScheduledTransfer, uint64, error) {
+	query := db.WithContext(ctx).Model(&model.ScheduledTransfer{})
+	if filter.AccountID != 0 {
+		query = query.Where("(source_account_id = ? OR destination_account_id = ?)", filter.AccountID, filter.AccountID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Cursor != 0 {
+		query = query.Where("id < ?", filter.Cursor)
+	}
+
+	// Fetch one extra row to find out whether there is another page
+	var scheduled []model.ScheduledTransfer
+	if err := query.Order("id DESC").Limit(filter.Limit + 1).Find(&scheduled).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var nextCursor uint64
+	if len(scheduled) > filter.Limit {
+		scheduled = scheduled[:filter.Limit]
+		nextCursor = scheduled[len(scheduled)-1].ID
+	}
+
+	return scheduled, nextCursor, nil
+}
+
+// CancelScheduledTransfer cancels a pending scheduled transfer. The row is locked, so a cancellation that races with
+// the scheduler waits for the attempt to finish and then fails if the transfer was booked.
+func CancelScheduledTransfer(ctx context.Context, db *gorm.DB, scheduledTransferID uint64) (*model.ScheduledTransfer, error) {
+	var cancelled *model.ScheduledTransfer
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var scheduled model.ScheduledTransfer
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Take(&scheduled, "id = ?", scheduledTransferID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return svrerror.New("scheduled transfer not found", http.StatusNotFound)
+			}
+			return err
+		}
+		if scheduled.Status != model.ScheduledTransferStatusPending {
+			return svrerror.New("scheduled transfer is "+scheduled.Status, http.StatusUnprocessableEntity)
+		}
+
+		scheduled.Status = model.ScheduledTransferStatusCancelled
+		if err := tx.Model(&scheduled).Update("status", scheduled.Status).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("scheduled_transfer_id = ?", scheduled.ID).Order("id").Find(&scheduled.Attempts).Error; err != nil {
+			return err
+		}
+
+		cancelled = &scheduled
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cancelled, nil
+}
+
+// checkTransferAccounts checks that the accounts of a future transfer exist, are not closed and are in its currency,
+// so that obvious mistakes are reported when the transfer is set up rather than when it is booked. Frozen accounts
+// are allowed since they may be unfrozen by then. The accounts are locked FOR SHARE until the transaction ends, so an
+// account cannot be closed while a transfer to or from it is being set up.
+func checkTransferAccounts(tx *gorm.DB, sourceAccountID, destinationAccountID uint64, code string) error {
+	tx = tx.Clauses(clause.Locking{Strength: "SHARE"})
+	var sourceAccount, destinationAccount model.Account
+	if err := tx.Take(&sourceAccount, "id = ?", sourceAccountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return svrerror.New("source account not found", http.StatusNotFound)
+		}
+		return err
+	}
+	if err := tx.Take(&destinationAccount, "id = ?", destinationAccountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return svrerror.New("destination account not found", http.StatusNotFound)
+		}
+		return err
+	}
+
+	if err := checkCreditAllowed(&sourceAccount); err != nil {
+		return err
+	}
+	if err := checkCreditAllowed(&destinationAccount); err != nil {
+		return err
+	}
+	if err := checkAccountCurrency(&sourceAccount, code, "source"); err != nil {
+		return err
+	}
+	return checkAccountCurrency(&destinationAccount, code, "destination")
+}
+
+// ExecuteDueScheduledTransfers books every pending scheduled transfer whose next attempt is due and returns how many
+// were attempted. Each one is claimed with FOR UPDATE SKIP LOCKED in its own transaction, so several server processes
+// can run the scheduler side by side without booking a transfer twice.
+func ExecuteDueScheduledTransfers(ctx context.Context, db *gorm.DB, policy TransferPolicy, retry ScheduledTransferRetry) (int, error) {
+	attempted := 0
+	for ctx.Err() == nil {
+		found, err := executeNextScheduledTransfer(ctx, db, policy, retry)
+		if err != nil {
+			return attempted, err
+		}
+		if !found {
+			break
+		}
+		attempted++
+	}
+	return attempted, nil
+}
+
+// executeNextScheduledTransfer attempts the oldest due scheduled transfer, if there is one. The transfer is booked
+// in a savepoint of the same transaction as the attempt is recorded, so a scheduled transfer is marked as completed
+// if and only if its transfer was booked. A conflict with another transaction is not an attempt: the transaction is
+// rolled back and the scheduled transfer is picked up again on the next run.
+func executeNextScheduledTransfer(ctx context.Context, db *gorm.DB, policy TransferPolicy, retry ScheduledTransferRetry) (bool, error) {
+	found := false
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var scheduled model.ScheduledTransfer
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", model.ScheduledTransferStatusPending, time.Now()).
+			Order("next_attempt_at").
+			Limit(1).
+			Find(&scheduled)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		found = true
+
+		request := apimodel.TransferRequest{
+			SourceAccountID:      scheduled.SourceAccountID,
+			DestinationAccountID: scheduled.DestinationAccountID,
+			Amount:               scheduled.Amount.String(),
+			Currency:             scheduled.Currency,
+		}
+		transfer, transferErr := bookInSavepoint(tx, policy, request, scheduled.Amount)
+		if transferErr != nil && isRetryable(transferErr) {
+			return transferErr
+		}
+
+		attempt := model.ScheduledTransferAttempt{ScheduledTransferID: scheduled.ID}
+		scheduled.AttemptCount++
+		switch {
+		case transferErr == nil:
+			attempt.Status = model.ScheduledTransferAttemptSucceeded
+			attempt.TransferID = &transfer.ID
+			scheduled.Status = model.ScheduledTransferStatusCompleted
+			scheduled.TransferID = &transfer.ID
+		case scheduled.AttemptCount >= retry.MaxAttempts:
+			attempt.Status = model.ScheduledTransferAttemptFailed
+			attempt.Error = transferErr.Error()
+			scheduled.Status = model.ScheduledTransferStatusFailed
+		default:
+			attempt.Status = model.ScheduledTransferAttemptFailed
+			attempt.Error = transferErr.Error()
+			scheduled.NextAttemptAt = time.Now().Add(retry.Delay)
+		}
+		slog.Info("attempted scheduled transfer", "id", scheduled.ID, "attempt", scheduled.AttemptCount,
+			"status", attempt.Status, "error", attempt.Error)
+
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&scheduled).Updates(map[string]interface{}{
+			"status":          scheduled.Status,
+			"attempt_count":   scheduled.AttemptCount,
+			"next_attempt_at": scheduled.NextAttemptAt,
+			"transfer_id":     scheduled.TransferID,
+		}).Error; err != nil {
+			return err
+		}
+		if transfer == nil {
+			return nil
+		}
+		return chainTransfers(tx, transfer)
+	})
+	return found, err
+}
+
+// RunScheduledTransfers books due scheduled transfers every interval until ctx is cancelled.
+func RunScheduledTransfers(ctx context.Context, db *gorm.DB, policy TransferPolicy, retry ScheduledTransferRetry, interval time.Duration) {
+	runEvery(ctx, "scheduled transfers", interval, func(ctx context.Context) error {
+		attempted, err := ExecuteDueScheduledTransfers(ctx, db, policy, retry)
+		if err != nil {
+			return err
+		}
+		slog.Debug("attempted scheduled transfers", "count", attempted)
+		return nil
+	})
+}
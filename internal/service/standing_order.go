@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/recurrence"
+	"internal-transfers-system/internal/svrerror"
+)
+
+// StandingOrderSchedule returns the recurrence of a standing order.
+func StandingOrderSchedule(order *model.StandingOrder) (recurrence.Schedule, error) {
+	switch order.Frequency {
+	case model.StandingOrderFrequencyWeekly:
+		return recurrence.Weekly(order.StartAt), nil
+	case model.StandingOrderFrequencyMonthly:
+		return recurrence.Monthly(order.StartAt), nil
+	case model.StandingOrderFrequencyCron:
+		return recurrence.ParseCron(order.CronExpression)
+	}
+	return nil, errors.New("unknown standing order frequency " + order.Frequency)
+}
+
+// CreateStandingOrder stores a standing order and schedules its first occurrence. Like for scheduled transfers,
+// only the accounts and currency are checked up front.
+func CreateStandingOrder(ctx context.Context, db *gorm.DB, order model.StandingOrder) (*model.StandingOrder, error) {
+	schedule, err := StandingOrderSchedule(&order)
+	if err != nil {
+		if order.Frequency == model.StandingOrderFrequencyCron {
+			return nil, svrerror.New("invalid cron_expression: "+err.Error(), http.StatusBadRequest)
+		}
+		return nil, err
+	}
+	first := recurrence.First(schedule, order.StartAt)
+	if first.IsZero() || order.EndAt != nil && first.After(*order.EndAt) {
+		return nil, svrerror.New("standing order has no occurrences between start_at and end_at", http.StatusBadRequest)
+	}
+
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkTransferAccounts(tx, order.SourceAccountID, order.DestinationAccountID, order.Currency); err != nil {
+			return err
+		}
+
+		order.Status = model.StandingOrderStatusActive
+		order.NextRunAt = first
+		order.NextAttemptAt = first
+		return tx.Create(&order).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// GetStandingOrder returns a single standing order by ID.
+func GetStandingOrder(ctx context.Context, db *gorm.DB, standingOrderID uint64) (*model.StandingOrder, error) {
+	var order model.StandingOrder
+	if err := db.WithContext(ctx).Take(&order, "id = ?", standingOrderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, svrerror.New("standing order not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &order, nil
+}
+
+// ListStandingOrders returns a page of standing orders, newest first, using keyset pagination over the ID. The
+// returned cursor is 0 when there are no more pages.
+func ListStandingOrders(ctx context.Context, db *gorm.DB, filter apimodel.StandingOrderFilter) ([]model.StandingOrder, uint64, error) {
+	query := db.WithContext(ctx).Model(&model.StandingOrder{})
+	if filter.AccountID != 0 {
+		query = query.Where("(source_account_id = ? OR destination_account_id = ?)", filter.AccountID, filter.AccountID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Cursor != 0 {
+		query = query.Where("id < ?", filter.Cursor)
+	}
+
+	// Fetch one extra row to find out whether there is another page
+	var orders []model.StandingOrder
+	if err := query.Order("id DESC").Limit(filter.Limit + 1).Find(&orders).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var nextCursor uint64
+	if len(orders) > filter.Limit {
+		orders = orders[:filter.Limit]
+		nextCursor = orders[len(orders)-1].ID
+	}
+
+	return orders, nextCursor, nil
+}
+
+// ListStandingOrderExecutions returns a page of the executions of a standing order, newest first. The returned
+// cursor is 0 when there are no more pages.
+func ListStandingOrderExecutions(ctx context.Context, db *gorm.DB, standingOrderID uint64, cursor uint64, limit int) ([]model.StandingOrderExecution, uint64, error) {
+	if _, err := GetStandingOrder(ctx, db, standingOrderID); err != nil {
+		return nil, 0, err
+	}
+
+	query := db.WithContext(ctx).Where("standing_order_id = ?", standingOrderID)
+	if cursor != 0 {
+		query = query.Where("id < ?", cursor)
+	}
+
+	var executions []model.StandingOrderExecution
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&executions).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var nextCursor uint64
+	if len(executions) > limit {
+		executions = executions[:limit]
+		nextCursor = executions[len(executions)-1].ID
+	}
+
+	return executions, nextCursor, nil
+}
+
+// CancelStandingOrder stops an active or suspended standing order for good.
+func CancelStandingOrder(ctx context.Context, db *gorm.DB, standingOrderID uint64) (*model.StandingOrder, error) {
+	return changeStandingOrder(ctx, db, standingOrderID, func(order *model.StandingOrder) error {
+		if order.Status != model.StandingOrderStatusActive && order.Status != model.StandingOrderStatusSuspended {
+			return svrerror.New("standing order is "+order.Status, http.StatusUnprocessableEntity)
+		}
+		order.Status = model.StandingOrderStatusCancelled
+		return nil
+	})
+}
+
+// ResumeStandingOrder reactivates a suspended standing order. The occurrence it was suspended on is attempted again
+// straight away, unless the order skips missed occurrences and a later one is due by then.
+func ResumeStandingOrder(ctx context.Context, db *gorm.DB, standingOrderID uint64) (*model.StandingOrder, error) {
+	return changeStandingOrder(ctx, db, standingOrderID, func(order *model.StandingOrder) error {
+		if order.Status != model.StandingOrderStatusSuspended {
+			return svrerror.New("standing order is "+order.Status, http.StatusUnprocessableEntity)
+		}
+		order.Status = model.StandingOrderStatusActive
+		order.AttemptCount = 0
+		order.NextAttemptAt = time.Now()
+		return nil
+	})
+}
+
+// changeStandingOrder locks a standing order and saves the changes made by change. The lock makes a change that
+// races with the worker wait for the execution to finish.
+func changeStandingOrder(ctx context.Context, db *gorm.DB, standingOrderID uint64, change func(order *model.StandingOrder) error) (*model.StandingOrder, error) {
+	var changed *model.StandingOrder
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var order model.StandingOrder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&order, "id = ?", standingOrderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return svrerror.New("standing order not found", http.StatusNotFound)
+			}
+			return err
+		}
+		if err := change(&order); err != nil {
+			return err
+		}
+		if err := saveStandingOrderProgress(tx, &order); err != nil {
+			return err
+		}
+
+		changed = &order
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// ExecuteDueStandingOrders attempts the due occurrence of every active standing order and returns how many
+// occurrences were attempted. Standing orders that fell behind, e.g. while the server was down, either skip to their
+// latest due occurrence or catch up one occurrence at a time, depending on MissedOccurrences. Each one is claimed with
+// FOR UPDATE SKIP LOCKED, as for scheduled transfers.
+func ExecuteDueStandingOrders(ctx context.Context, db *gorm.DB, policy TransferPolicy, retryDelay time.Duration) (int, error) {
+	attempted := 0
+	for ctx.Err() == nil {
+		found, err := executeNextStandingOrder(ctx, db, policy, retryDelay)
+		if err != nil {
+			return attempted, err
+		}
+		if !found {
+			break
+		}
+		attempted++
+	}
+	return attempted, nil
+}
+
+// executeNextStandingOrder attempts the occurrence of the standing order that has been due the longest, if there is
+// one. The transfer is booked in the same transaction as the execution is recorded.
+//
+// When the source account does not have the funds, the occurrence is skipped, retried after retryDelay up to the
+// order's RetryCount times and then skipped, or the order is suspended, depending on OnInsufficientFunds. Any other
+// failure, such as a frozen account or an exceeded limit, suspends the order until it is resumed. A conflict with
+// another transaction is not a failure of the occurrence: the transaction is rolled back and the order is picked up
+// again on the next run.
+func executeNextStandingOrder(ctx context.Context, db *gorm.DB, policy TransferPolicy, retryDelay time.Duration) (bool, error) {
+	found := false
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var order model.StandingOrder
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", model.StandingOrderStatusActive, now).
+			Order("next_attempt_at").
+			Limit(1).
+			Find(&order)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		found = true
+
+		if order.MissedOccurrences == model.MissedOccurrencesSkip {
+			if err := skipMissedOccurrences(tx, &order, now); err != nil {
+				return err
+			}
+		}
+
+		request := apimodel.TransferRequest{
+			SourceAccountID:      order.SourceAccountID,
+			DestinationAccountID: order.DestinationAccountID,
+			Amount:               order.Amount.String(),
+			Currency:             order.Currency,
+		}
+		transfer, transferErr := bookInSavepoint(tx, policy, request, order.Amount)
+		if transferErr != nil && isRetryable(transferErr) {
+			return transferErr
+		}
+
+		execution := model.StandingOrderExecution{StandingOrderID: order.ID, OccurrenceAt: order.NextRunAt}
+		advance := false
+		switch {
+		case transferErr == nil:
+			execution.Status = model.StandingOrderExecutionSucceeded
+			execution.TransferID = &transfer.ID
+			advance = true
+		case svrerror.HasCode(transferErr, svrerror.CodeInsufficientFunds) && order.OnInsufficientFunds == model.InsufficientFundsSkip:
+			execution.Status = model.StandingOrderExecutionSkipped
+			advance = true
+		case svrerror.HasCode(transferErr, svrerror.CodeInsufficientFunds) && order.OnInsufficientFunds == model.InsufficientFundsRetry:
+			execution.Status = model.StandingOrderExecutionFailed
+			order.AttemptCount++
+			if order.AttemptCount > order.RetryCount {
+				advance = true
+			} else {
+				order.NextAttemptAt = time.Now().Add(retryDelay)
+			}
+		default:
+			execution.Status = model.StandingOrderExecutionFailed
+			order.Status = model.StandingOrderStatusSuspended
+		}
+		if transferErr != nil {
+			execution.Error = transferErr.Error()
+		}
+		slog.Info("executed standing order", "id", order.ID, "occurrence", execution.OccurrenceAt,
+			"status", execution.Status, "error", execution.Error)
+
+		if advance {
+			if err := advanceStandingOrder(&order); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(&execution).Error; err != nil {
+			return err
+		}
+		if err := saveStandingOrderProgress(tx, &order); err != nil {
+			return err
+		}
+		if transfer == nil {
+			return nil
+		}
+		return chainTransfers(tx, transfer)
+	})
+	return found, err
+}
+
+// skipMissedOccurrences records the occurrences of a standing order that are followed by another due occurrence as
+// skipped, so that only the latest due occurrence is attempted. The last occurrence of an order is never skipped.
+func skipMissedOccurrences(tx *gorm.DB, order *model.StandingOrder, now time.Time) error {
+	schedule, err := StandingOrderSchedule(order)
+	if err != nil {
+		return err
+	}
+
+	var skipped []model.StandingOrderExecution
+	for order.MaxOccurrences == nil || order.OccurrenceCount+1 < *order.MaxOccurrences {
+		next := schedule.Next(order.NextRunAt)
+		if next.IsZero() || next.After(now) || order.EndAt != nil && next.After(*order.EndAt) {
+			break
+		}
+		skipped = append(skipped, model.StandingOrderExecution{
+			StandingOrderID: order.ID,
+			OccurrenceAt:    order.NextRunAt,
+			Status:          model.StandingOrderExecutionSkipped,
+			Error:           "occurrence was missed",
+		})
+		if err := advanceStandingOrder(order); err != nil {
+			return err
+		}
+	}
+	if len(skipped) == 0 {
+		return nil
+	}
+
+	slog.Info("skipped missed standing order occurrences", "id", order.ID, "count", len(skipped))
+	return tx.Create(&skipped).Error
+}
+
+// advanceStandingOrder moves a standing order on to its next occurrence, or completes it if there is none.
+func advanceStandingOrder(order *model.StandingOrder) error {
+	schedule, err := StandingOrderSchedule(order)
+	if err != nil {
+		return err
+	}
+
+	order.OccurrenceCount++
+	order.AttemptCount = 0
+	next := schedule.Next(order.NextRunAt)
+	switch {
+	case order.MaxOccurrences != nil && order.OccurrenceCount >= *order.MaxOccurrences,
+		next.IsZero(),
+		order.EndAt != nil && next.After(*order.EndAt):
+		order.Status = model.StandingOrderStatusCompleted
+	default:
+		order.NextRunAt = next
+		order.NextAttemptAt = next
+	}
+	return nil
+}
+
+func saveStandingOrderProgress(tx *gorm.DB, order *model.StandingOrder) error {
+	return tx.Model(order).Updates(map[string]interface{}{
+		"status":           order.Status,
+		"next_run_at":      order.NextRunAt,
+		"next_attempt_at":  order.NextAttemptAt,
+		"occurrence_count": order.OccurrenceCount,
+		"attempt_count":    order.AttemptCount,
+	}).Error
+}
+
+// RunStandingOrders executes due standing orders every interval until ctx is cancelled.
+func RunStandingOrders(ctx context.Context, db *gorm.DB, policy TransferPolicy, retryDelay time.Duration, interval time.Duration) {
+	runEvery(ctx, "standing orders", interval, func(ctx context.Context) error {
+		attempted, err := ExecuteDueStandingOrders(ctx, db, policy, retryDelay)
+		if err != nil {
+			return err
+		}
+		slog.Debug("executed standing orders", "count", attempted)
+		return nil
+	})
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/svrerror"
+)
+
+// AccountStatement builds the statement of an account between from (inclusive) and to (exclusive) from its
+// transfers. The opening balance is worked back from the current balance by undoing every transfer since from, in a
+// repeatable read transaction so that the balance and the transfers are read from the same snapshot. If the account
+// was opened during the period, the statement starts from zero and its initial balance is the first line.
+func AccountStatement(ctx context.Context, db *gorm.DB, accountID uint64, from, to time.Time) (*model.Statement, error) {
+	statement := model.Statement{From: from, To: to}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Take(&statement.Account, "id = ?", accountID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return svrerror.New("account not found", http.StatusNotFound)
+			}
+			return err
+		}
+
+		var transfers []model.Transfer
+		if err := tx.Preload("Legs", "account_id = ?", accountID).
+			Where("(source_account_id = ? OR destination_account_id = ? OR fee_account_id = ? OR id IN (SELECT transfer_id FROM transfer_legs WHERE account_id = ?))",
+				accountID, accountID, accountID, accountID).
+			Where("created_at >= ?", from).
+			Order("created_at, id").
+			Find(&transfers).Error; err != nil {
+			return err
+		}
+
+		var lines []model.StatementLine
+		balance := statement.Account.Balance
+		for i := range transfers {
+			for _, line := range statementLines(&transfers[i], accountID) {
+				balance = balance.Sub(line.Amount)
+				if transfers[i].CreatedAt.Before(to) {
+					lines = append(lines, line)
+				}
+			}
+		}
+
+		opening := balance
+		if !statement.Account.CreatedAt.Before(from) {
+			// What is left after undoing every transfer is the initial balance the account was opened with
+			opening = decimal.Zero
+			if statement.Account.CreatedAt.Before(to) {
+				lines = append([]model.StatementLine{{
+					Date:   statement.Account.CreatedAt,
+					Type:   model.StatementLineAccountOpened,
+					Amount: balance,
+				}}, lines...)
+			}
+		}
+
+		statement.OpeningBalance = opening
+		for i := range lines {
+			opening = opening.Add(lines[i].Amount)
+			lines[i].Balance = opening
+		}
+		statement.ClosingBalance = opening
+		statement.Lines = lines
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	return &statement, nil
+}
+
+// statementLines returns how a transfer moved the balance of an account. A fee is a line of its own, both for the
+// account that paid it and for the revenue account that received it, which can also be the destination.
+func statementLines(transfer *model.Transfer, accountID uint64) []model.StatementLine {
+	line := model.StatementLine{
+		Date:        transfer.CreatedAt,
+		Type:        model.StatementLineTransfer,
+		TransferID:  &transfer.ID,
+		Reference:   transfer.Reference,
+		Description: transfer.Description,
+	}
+	is := func(id *uint64) bool { return id != nil && *id == accountID }
+
+	var lines []model.StatementLine
+	for _, leg := range transfer.Legs {
+		line.Amount = leg.Amount
+		lines = append(lines, line)
+	}
+	if is(transfer.SourceAccountID) {
+		debit := line
+		debit.CounterpartyAccountID = transfer.DestinationAccountID
+		debit.Amount = transfer.Amount.Neg()
+		lines = append(lines, debit)
+	}
+	if is(transfer.DestinationAccountID) {
+		credit := line
+		credit.CounterpartyAccountID = transfer.SourceAccountID
+		credit.Amount = transfer.DestinationAmount
+		lines = append(lines, credit)
+	}
+	if transfer.FeeAmount.Valid {
+		fee := line
+		fee.Type = model.StatementLineFee
+		if is(transfer.SourceAccountID) {
+			paid := fee
+			paid.CounterpartyAccountID = transfer.FeeAccountID
+			paid.Amount = transfer.FeeAmount.Decimal.Neg()
+			lines = append(lines, paid)
+		}
+		if is(transfer.FeeAccountID) {
+			fee.CounterpartyAccountID = transfer.SourceAccountID
+			fee.Amount = transfer.FeeAmount.Decimal
+			lines = append(lines, fee)
+		}
+	}
+	return lines
+}
@@ -3,116 +3,415 @@ package service
 import (
 	"context"
 	"errors"
-	"github.com/avast/retry-go/v4"
-	"github.com/jackc/pgx/v5/pgconn"
-	"log"
+	"fmt"
 	"log/slog"
 	"net/http"
-	"time"
+	"strconv"
 
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/currency"
 	"internal-transfers-system/internal/model"
 	"internal-transfers-system/internal/svrerror"
 )
 
+// TransferPolicy is the configuration that ProcessTransfer applies to every transfer.
+type TransferPolicy struct {
+	// DefaultLimits apply to accounts that do not have their own limits
+	DefaultLimits DefaultLimits
+}
+
+// transferBooking describes a transfer to be booked by bookTransfer inside an existing DB transaction.
+type transferBooking struct {
+	SourceAccountID      uint64
+	DestinationAccountID uint64
+	Amount               decimal.Decimal
+	// Currency must match the currency of the source account, and of the destination account unless the transfer
+	// is converted
+	Currency string
+	// Conversion is set on cross-currency transfers
+	Conversion *fxConversion
+	// HeldAmount is reserved on the source account by a hold that is being captured by this transfer. It is
+	// released as part of the booking, so it counts towards the funds available for the transfer.
+	HeldAmount decimal.Decimal
+	// ReversalOfID links a reversal to the transfer it reverses
+	ReversalOfID *uint64
+	// Limits are checked against the source account's outgoing transfers. Not set for reversals.
+	Limits *DefaultLimits
+	// BatchID links the transfer to the batch it was submitted in
+	BatchID *uint64
+	// Fee is charged to the source account on top of the amount. Not set for captures and reversals.
+	Fee *feeCharge
+	// Reference, Description, Metadata and ExternalID are the client's own details of the transfer
+	Reference   string
+	Description string
+	Metadata    model.JSON
+	ExternalID  *string
+}
+
 // ProcessTransfer uses optimistic concurrency control by looking at the updatedAt timestamp on the account
-// before updating the account values
-func ProcessTransfer(ctx context.Context, db *gorm.DB, transfer apimodel.TransferRequest, amount decimal.Decimal) error {
-	return retry.Do(
-		func() error {
-			return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-				slog.Debug("processing transfer", "from", transfer.SourceAccountID, "to", transfer.DestinationAccountID)
-				var sourceAccount, destinationAccount model.Account
-
-				if err := tx.Take(&sourceAccount, "id = ?", transfer.SourceAccountID).Error; err != nil {
-					if errors.Is(err, gorm.ErrRecordNotFound) {
-						return svrerror.New("source account not found", http.StatusNotFound)
-					}
-					return err
-				}
-
-				if err := tx.Take(&destinationAccount, "id = ?", transfer.DestinationAccountID).Error; err != nil {
-					if errors.Is(err, gorm.ErrRecordNotFound) {
-						return svrerror.New("destination account not found", http.StatusNotFound)
-					}
-					return err
-				}
-
-				if sourceAccount.Balance.LessThan(amount) {
-					return svrerror.New("insufficient funds", http.StatusBadRequest)
-				}
-
-				updatedSourceBalance := sourceAccount.Balance.Sub(amount)
-				updatedDestinationBalance := destinationAccount.Balance.Add(amount)
-
-				// Combine the update of both records into a single query as an optimisation
-				result := tx.Exec(`
-                        UPDATE accounts
-                        SET balance = CASE 
-                            WHEN id = ? AND updated_at = ? THEN ?
-                            WHEN id = ? AND updated_at = ? THEN ?
-                            ELSE balance
-                        END,
-                        updated_at = CASE
-                            WHEN id = ? AND updated_at = ? THEN NOW()
-                            WHEN id = ? AND updated_at = ? THEN NOW()
-                            ELSE updated_at
-                        END
-                        WHERE (id = ? AND updated_at = ?) 
-                           OR (id = ? AND updated_at = ?)`,
-					sourceAccount.ID, sourceAccount.UpdatedAt, updatedSourceBalance,
-					destinationAccount.ID, destinationAccount.UpdatedAt, updatedDestinationBalance,
-					sourceAccount.ID, sourceAccount.UpdatedAt,
-					destinationAccount.ID, destinationAccount.UpdatedAt,
-					sourceAccount.ID, sourceAccount.UpdatedAt,
-					destinationAccount.ID, destinationAccount.UpdatedAt,
-				)
-
-				if result.Error != nil {
-					return result.Error
-				}
-				if result.RowsAffected != 2 {
-					return svrerror.New("account updatedAt mismatch, retrying", http.StatusConflict)
-				}
-
-				newTransfer := model.Transfer{
-					SourceAccountID:      transfer.SourceAccountID,
-					DestinationAccountID: transfer.DestinationAccountID,
-					Amount:               amount,
-				}
-
-				if err := tx.Create(&newTransfer).Error; err != nil {
-					return err
-				}
-
-				return nil
-			})
-		},
-		retry.Attempts(5),
-		retry.Delay(100*time.Millisecond),
-		retry.MaxDelay(2*time.Second),
-		retry.MaxJitter(100*time.Millisecond),
-		retry.DelayType(retry.CombineDelay(
-			retry.BackOffDelay,
-			retry.RandomDelay,
-		)),
-		retry.OnRetry(func(n uint, err error) {
-			log.Printf("retry: #%d: %s\n", n, err)
-		}),
-		retry.RetryIf(func(err error) bool {
-			var svrError *svrerror.Error
-			if errors.As(err, &svrError) && svrError.StatusCode == http.StatusConflict {
-				slog.Warn("transfer: updatedAt mismatch, retrying")
-				return true
+// before updating the account values.
+// Every transfer is booked as a debit posting on the source account and a credit posting on the destination account.
+// If the request carries an idempotency key that has already been used for the same request, the transfer is not
+// booked again and the original transfer is returned instead.
+// Cross-currency transfers must reference an FX quote, which is used up by the transfer.
+// The source account's limits are checked in the same DB transaction, before the transfer is booked.
+// The fee of the matching fee schedule is charged to the source account and credited to the schedule's revenue
+// account in the same DB transaction. Transfers out of the revenue account itself are not charged.
+// A transfer.created event, and a balance.changed event for every account it posts to, are written to the outbox in
+// the same DB transaction, for every transfer that is booked, along with a FundsTransferred event in the ledger.
+func ProcessTransfer(ctx context.Context, db *gorm.DB, policy TransferPolicy, transfer apimodel.TransferRequest, amount decimal.Decimal) (*model.Transfer, error) {
+	return processTransfer(ctx, db, policy, transfer, amount, nil)
+}
+
+// processTransfer is ProcessTransfer for a transfer that may be part of a batch.
+func processTransfer(ctx context.Context, db *gorm.DB, policy TransferPolicy, transfer apimodel.TransferRequest, amount decimal.Decimal, batchID *uint64) (*model.Transfer, error) {
+	fingerprint, err := transferFingerprint(transfer, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	return bookIdempotently(ctx, db, transfer.IdempotencyKey, fingerprint, func(tx *gorm.DB) (*model.Transfer, error) {
+		return bookTransferRequest(tx, policy, transfer, amount, batchID)
+	})
+}
+
+// transferFingerprint returns the fingerprint the transfer's idempotency key is saved with, which is empty when the
+// transfer does not have a key.
+func transferFingerprint(transfer apimodel.TransferRequest, amount decimal.Decimal) (string, error) {
+	if transfer.IdempotencyKey == "" {
+		return "", nil
+	}
+	return requestFingerprint(transfer, amount)
+}
+
+// bookTransferRequest books a transfer request within tx: it uses up the FX quote of a cross-currency transfer and
+// charges the fee of the matching fee schedule.
+func bookTransferRequest(tx *gorm.DB, policy TransferPolicy, transfer apimodel.TransferRequest, amount decimal.Decimal, batchID *uint64) (*model.Transfer, error) {
+	slog.Debug("processing transfer", "from", transfer.SourceAccountID, "to", transfer.DestinationAccountID)
+
+	booking := transferBooking{
+		SourceAccountID:      transfer.SourceAccountID,
+		DestinationAccountID: transfer.DestinationAccountID,
+		Amount:               amount,
+		Currency:             transfer.Currency,
+		Limits:               &policy.DefaultLimits,
+		BatchID:              batchID,
+		Reference:            transfer.Reference,
+		Description:          transfer.Description,
+		Metadata:             model.JSON(transfer.Metadata),
+	}
+	if transfer.ExternalID != "" {
+		booking.ExternalID = &transfer.ExternalID
+	}
+	if transfer.QuoteID != 0 {
+		conversion, err := useFXQuote(tx, transfer, amount)
+		if err != nil {
+			return nil, err
+		}
+		booking.Conversion = conversion
+	}
+
+	fee, err := transferFee(tx, feeTransferType(transfer), transfer.Currency, amount)
+	if err != nil {
+		return nil, err
+	}
+	if fee != nil && fee.AccountID != transfer.SourceAccountID {
+		booking.Fee = fee
+	}
+
+	return bookTransfer(tx, booking)
+}
+
+// feeTransferType returns the type of fee schedule that applies to a transfer request.
+func feeTransferType(transfer apimodel.TransferRequest) string {
+	if transfer.QuoteID != 0 {
+		return model.FeeTransferTypeCrossCurrency
+	}
+	return model.FeeTransferTypeStandard
+}
+
+// bookInSavepoint books a transfer request in a savepoint of tx, so that a failed booking is rolled back without
+// aborting tx. Unlike ProcessTransfer it does not retry conflicts, since tx holds locks of its own that must not be
+// kept while waiting; the caller decides what to do about a conflict. The caller also chains the transfer.
+func bookInSavepoint(tx *gorm.DB, policy TransferPolicy, transfer apimodel.TransferRequest, amount decimal.Decimal) (*model.Transfer, error) {
+	var booked *model.Transfer
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		var err error
+		booked, err = bookTransferRequest(tx, policy, transfer, amount, nil)
+		return err
+	})
+	return booked, err
+}
+
+// bookIdempotently runs book in a DB transaction, which is retried on conflicts, with the idempotency check of
+// bookWithIdempotencyKey, and chains the transfer at the end of the transaction.
+func bookIdempotently(ctx context.Context, db *gorm.DB, key, fingerprint string, book func(tx *gorm.DB) (*model.Transfer, error)) (*model.Transfer, error) {
+	var booked *model.Transfer
+	err := withRetry(func() error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var err error
+			booked, err = bookWithIdempotencyKey(tx, key, fingerprint, book)
+			if err != nil {
+				return err
 			}
-			var pgErr *pgconn.PgError
-			if errors.As(err, &pgErr) && pgErr.Code == "55P03" {
-				slog.Warn("transfer: failed to get a lock")
-				return true
+			return chainTransfers(tx, booked)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return booked, nil
+}
+
+// bookWithIdempotencyKey runs book within tx. If the idempotency key has already been used for the same request, the
+// transfer booked for it is returned instead of booking it again; otherwise the key is saved against the new transfer
+// in the same transaction. An empty key skips the idempotency check.
+func bookWithIdempotencyKey(tx *gorm.DB, key, fingerprint string, book func(tx *gorm.DB) (*model.Transfer, error)) (*model.Transfer, error) {
+	if key != "" {
+		transferID, err := findIdempotentTransfer(tx, key, fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		if transferID != 0 {
+			slog.Debug("replaying idempotent transfer", "key", key, "transfer", transferID)
+			var existing model.Transfer
+			if err := tx.Preload("Legs", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+				Take(&existing, "id = ?", transferID).Error; err != nil {
+				return nil, err
 			}
-			return false
-		}),
+			return &existing, nil
+		}
+	}
+
+	newTransfer, err := book(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != "" {
+		if err := saveIdempotencyKey(tx, key, fingerprint, newTransfer.ID); err != nil {
+			return nil, err
+		}
+	}
+	return newTransfer, nil
+}
+
+// bookTransfer moves money between two accounts within tx. The account rows are only updated if they have not
+// changed since they were read; otherwise a conflict is returned and the caller is expected to retry the transaction.
+// The caller chains the transfer with chainTransfers as the last step of tx.
+func bookTransfer(tx *gorm.DB, booking transferBooking) (*model.Transfer, error) {
+	var sourceAccount, destinationAccount model.Account
+
+	if err := tx.Take(&sourceAccount, "id = ?", booking.SourceAccountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, svrerror.New("source account not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+
+	if err := tx.Take(&destinationAccount, "id = ?", booking.DestinationAccountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, svrerror.New("destination account not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+
+	if err := checkDebitAllowed(&sourceAccount); err != nil {
+		return nil, err
+	}
+	if err := checkCreditAllowed(&destinationAccount); err != nil {
+		return nil, err
+	}
+
+	if booking.ExternalID != nil {
+		if err := checkExternalIDUnused(tx, sourceAccount.ID, *booking.ExternalID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkAccountCurrency(&sourceAccount, booking.Currency, "source"); err != nil {
+		return nil, err
+	}
+	destinationCurrency, destinationAmount := booking.Currency, booking.Amount
+	if booking.Conversion != nil {
+		destinationCurrency, destinationAmount = booking.Conversion.DestinationCurrency, booking.Conversion.DestinationAmount
+	}
+	if err := checkAccountCurrency(&destinationAccount, destinationCurrency, "destination"); err != nil {
+		return nil, err
+	}
+	if !currency.FitsMinorUnits(booking.Currency, booking.Amount) {
+		return nil, svrerror.New("amount has more decimal places than "+booking.Currency+" allows", http.StatusBadRequest)
+	}
+
+	// The usage is read after the source account, so that a transfer booked from it in the meantime fails the
+	// updatedAt check below
+	if booking.Limits != nil {
+		if err := checkLimits(tx, *booking.Limits, &sourceAccount, booking.Amount); err != nil {
+			return nil, err
+		}
+	}
+
+	// The fee is paid out of the same funds as the amount
+	debit := booking.Amount
+	if booking.Fee != nil {
+		debit = debit.Add(booking.Fee.Amount)
+	}
+
+	held, err := heldAmount(tx, sourceAccount.ID)
+	if err != nil {
+		return nil, err
+	}
+	availableBalance := sourceAccount.Balance.Sub(held).Add(booking.HeldAmount)
+	if availableBalance.Add(sourceAccount.OverdraftLimit).LessThan(debit) {
+		return nil, svrerror.NewWithCode("insufficient funds", http.StatusBadRequest, svrerror.CodeInsufficientFunds)
+	}
+
+	updatedSourceBalance := sourceAccount.Balance.Sub(debit)
+	updatedDestinationBalance := destinationAccount.Balance.Add(destinationAmount)
+
+	// Combine the update of both records into a single query as an optimisation
+	result := tx.Exec(`
+            UPDATE accounts
+            SET balance = CASE 
+                WHEN id = ? AND updated_at = ? THEN ?
+                WHEN id = ? AND updated_at = ? THEN ?
+                ELSE balance
+            END,
+            updated_at = CASE
+                WHEN id = ? AND updated_at = ? THEN NOW()
+                WHEN id = ? AND updated_at = ? THEN NOW()
+                ELSE updated_at
+            END
+            WHERE (id = ? AND updated_at = ?) 
+               OR (id = ? AND updated_at = ?)`,
+		sourceAccount.ID, sourceAccount.UpdatedAt, updatedSourceBalance,
+		destinationAccount.ID, destinationAccount.UpdatedAt, updatedDestinationBalance,
+		sourceAccount.ID, sourceAccount.UpdatedAt,
+		destinationAccount.ID, destinationAccount.UpdatedAt,
+		sourceAccount.ID, sourceAccount.UpdatedAt,
+		destinationAccount.ID, destinationAccount.UpdatedAt,
 	)
+
+	if result.Error != nil {
+		// The overdraft check constraint backs up the funds check above
+		if isCheckViolation(result.Error, "chk_account_overdraft") {
+			return nil, svrerror.NewWithCode("insufficient funds", http.StatusBadRequest, svrerror.CodeInsufficientFunds)
+		}
+		return nil, result.Error
+	}
+	if result.RowsAffected != 2 {
+		return nil, svrerror.New("account updatedAt mismatch, retrying", http.StatusConflict)
+	}
+
+	var feeAccountBalance decimal.Decimal
+	if booking.Fee != nil {
+		if feeAccountBalance, err = creditFee(tx, booking.Fee); err != nil {
+			return nil, err
+		}
+	}
+
+	newTransfer := model.Transfer{
+		SourceAccountID:      &sourceAccount.ID,
+		DestinationAccountID: &destinationAccount.ID,
+		Amount:               booking.Amount,
+		Currency:             booking.Currency,
+		SourceBalanceAfter:   decimal.NewNullDecimal(updatedSourceBalance),
+		DestinationAmount:    destinationAmount,
+		DestinationCurrency:  destinationCurrency,
+		ReversalOfID:         booking.ReversalOfID,
+		BatchID:              booking.BatchID,
+		Reference:            booking.Reference,
+		Description:          booking.Description,
+		Metadata:             booking.Metadata,
+		ExternalID:           booking.ExternalID,
+	}
+	if booking.Conversion != nil {
+		newTransfer.FXRate = decimal.NewNullDecimal(booking.Conversion.Rate)
+		newTransfer.FXRoundingAdjustment = decimal.NewNullDecimal(booking.Conversion.RoundingAdjustment)
+		newTransfer.FXQuoteID = booking.Conversion.QuoteID
+	}
+	if booking.Fee != nil {
+		newTransfer.FeeAmount = decimal.NewNullDecimal(booking.Fee.Amount)
+		newTransfer.FeeAccountID = &booking.Fee.AccountID
+	}
+
+	if err := tx.Create(&newTransfer).Error; err != nil {
+		// The unique index backs up the external ID check above against concurrent transfers
+		if isUniqueViolation(err, "idx_transfers_source_account_id_external_id") {
+			return nil, duplicateExternalID(*booking.ExternalID, 0)
+		}
+		return nil, err
+	}
+
+	entries := []model.JournalEntry{
+		posting(&newTransfer.ID, sourceAccount.ID, booking.Currency, booking.Amount.Neg(), sourceAccount.Balance.Sub(booking.Amount)),
+		posting(&newTransfer.ID, destinationAccount.ID, destinationCurrency, destinationAmount, updatedDestinationBalance),
+	}
+	if booking.Fee != nil {
+		// The fee is a separate pair of postings from the source account to the revenue account
+		entries = append(entries,
+			posting(&newTransfer.ID, sourceAccount.ID, booking.Currency, booking.Fee.Amount.Neg(), updatedSourceBalance),
+			posting(&newTransfer.ID, booking.Fee.AccountID, booking.Currency, booking.Fee.Amount, feeAccountBalance),
+		)
+	}
+	if booking.Conversion != nil {
+		// The FX position buys the source currency and sells the destination currency
+		entries = append(entries,
+			fxPosition(&newTransfer.ID, booking.Currency, booking.Amount),
+			fxPosition(&newTransfer.ID, destinationCurrency, destinationAmount.Neg()),
+		)
+	}
+	if err := postJournalEntries(tx, entries); err != nil {
+		return nil, err
+	}
+	if err := recordEvent(tx, model.EventTypeTransferCreated, apimodel.NewTransferResponse(&newTransfer)); err != nil {
+		return nil, err
+	}
+	if err := recordBalanceChanges(tx, newTransfer.ID, entries); err != nil {
+		return nil, err
+	}
+	if err := appendFundsTransferred(tx, newTransfer.ID, entries); err != nil {
+		return nil, err
+	}
+
+	return &newTransfer, nil
+}
+
+// checkExternalIDUnused rejects an external ID that has already been used for a transfer from the same source account.
+func checkExternalIDUnused(tx *gorm.DB, sourceAccountID uint64, externalID string) error {
+	var existing model.Transfer
+	err := tx.Select("id").Take(&existing, "source_account_id = ? AND external_id = ?", sourceAccountID, externalID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return duplicateExternalID(externalID, existing.ID)
+}
+
+// duplicateExternalID is the error for an external ID that is already in use. The ID of the transfer that uses it is
+// added to the details when it is known.
+func duplicateExternalID(externalID string, transferID uint64) error {
+	details := map[string]string{"external_id": externalID}
+	if transferID != 0 {
+		details["transfer_id"] = strconv.FormatUint(transferID, 10)
+	}
+	return &svrerror.Error{
+		Message:    fmt.Sprintf("external id %q has already been used for a transfer from this account", externalID),
+		StatusCode: http.StatusUnprocessableEntity,
+		Code:       svrerror.CodeDuplicateExternalID,
+		Details:    details,
+	}
+}
+
+// checkAccountCurrency rejects money movements in a different currency from the account. role is used in the error
+// message, e.g. "source".
+func checkAccountCurrency(account *model.Account, code string, role string) error {
+	if account.Currency != code {
+		return svrerror.New(fmt.Sprintf("currency %s does not match %s account currency %s", code, role, account.Currency), http.StatusBadRequest)
+	}
+	return nil
 }
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"gorm.io/gorm"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/transferchain"
+)
+
+const (
+	// transferChainLock is the advisory lock that serialises extending the transfer chain across server processes.
+	transferChainLock = 7_301_947_225
+	// maxTransferChainBatch is how many transfers are chained or verified at a time.
+	maxTransferChainBatch = 500
+)
+
+// chainTransfers appends transfers that were booked in tx to the end of the hash chain, in the order given.
+// Transfers that are already chained, like one returned for a replayed idempotency key, are skipped.
+//
+// The end of the chain is taken under an advisory lock that is held until tx commits, so chain sequences are given
+// out in commit order and without gaps, and a transfer is tamper-evident as soon as it is visible. This must be the
+// last thing tx does: once it holds the lock, tx must not wait for any row lock, or it could deadlock with a
+// transaction that holds that row and is queued for the lock. The trade-off is throughput. Every booking in the
+// system queues for the lock from this step until its commit, so transfers commit one at a time and the rate of
+// bookings is capped at roughly one per commit round trip, however many accounts they touch.
+func chainTransfers(tx *gorm.DB, transfers ...*model.Transfer) error {
+	var unchained []*model.Transfer
+	for _, transfer := range transfers {
+		if transfer.ChainSequence == nil {
+			unchained = append(unchained, transfer)
+		}
+	}
+	if len(unchained) == 0 {
+		return nil
+	}
+
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", transferChainLock).Error; err != nil {
+		return err
+	}
+	var head model.TransferChainHead
+	if err := tx.Take(&head, "id = ?", model.TransferChainHeadID).Error; err != nil {
+		return err
+	}
+
+	for _, transfer := range unchained {
+		// The transfer is hashed as it is stored, with the precision of its timestamps and the normalised metadata
+		// the verification reads back
+		var stored model.Transfer
+		if err := tx.Preload("Legs", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+			Take(&stored, "id = ?", transfer.ID).Error; err != nil {
+			return err
+		}
+		if err := appendToTransferChain(tx, &head, &stored); err != nil {
+			return err
+		}
+		transfer.ChainSequence, transfer.Hash = stored.ChainSequence, stored.Hash
+	}
+	return nil
+}
+
+// appendToTransferChain hashes transfer after head, stores its chain sequence and hash and moves head on to it. The
+// caller holds the transfer chain lock.
+func appendToTransferChain(tx *gorm.DB, head *model.TransferChainHead, transfer *model.Transfer) error {
+	sequence := head.ChainSequence + 1
+	hash, err := transferchain.Hash(sequence, head.Hash, transfer)
+	if err != nil {
+		return fmt.Errorf("transfer %d: %w", transfer.ID, err)
+	}
+	if err := tx.Model(transfer).
+		UpdateColumns(map[string]interface{}{"chain_sequence": sequence, "hash": hash}).Error; err != nil {
+		return err
+	}
+	head.ChainSequence, head.Hash = sequence, hash
+	if err := tx.Model(head).
+		Updates(map[string]interface{}{"chain_sequence": sequence, "hash": hash}).Error; err != nil {
+		return err
+	}
+	transfer.ChainSequence, transfer.Hash = &sequence, &hash
+	return nil
+}
+
+// BackfillTransferChain appends the transfers that were booked before transfers were chained to the end of the hash
+// chain, in order of their ID, and returns how many were chained. It works in batches, each in its own transaction,
+// so it can run while transfers are being booked.
+func BackfillTransferChain(ctx context.Context, db *gorm.DB) (int, error) {
+	var chained int
+	for {
+		var batch int
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", transferChainLock).Error; err != nil {
+				return err
+			}
+			var head model.TransferChainHead
+			if err := tx.Take(&head, "id = ?", model.TransferChainHeadID).Error; err != nil {
+				return err
+			}
+
+			var transfers []model.Transfer
+			if err := tx.Preload("Legs", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+				Where("chain_sequence IS NULL").
+				Order("id").
+				Limit(maxTransferChainBatch).
+				Find(&transfers).Error; err != nil {
+				return err
+			}
+			for i := range transfers {
+				if err := appendToTransferChain(tx, &head, &transfers[i]); err != nil {
+					return err
+				}
+			}
+			batch = len(transfers)
+			return nil
+		})
+		if err != nil {
+			return chained, err
+		}
+		chained += batch
+		if batch < maxTransferChainBatch {
+			return chained, nil
+		}
+	}
+}
+
+// TransferChainBreak is the first place where the transfer chain does not hold. TransferID is nil when the transfer
+// at Sequence is missing or the chain does not end at its recorded head.
+type TransferChainBreak struct {
+	Sequence   uint64
+	TransferID *uint64
+	Reason     string
+}
+
+// TransferChainVerification is the result of walking the transfer chain. Length and Head are the sequence and hash
+// of the last transfer that was verified. Unchained is the number of transfers that are not in the chain, which only
+// happens to transfers booked before transfers were chained until they are backfilled.
+type TransferChainVerification struct {
+	Length    uint64
+	Head      string
+	Unchained int64
+	Break     *TransferChainBreak
+}
+
+// VerifyTransferChain walks the transfer chain from the start, recomputing every hash, and stops at the first
+// transfer that is missing or whose hash does not match its fields and the hash before it. The chain must then end
+// at the recorded chain head, which catches transfers removed from the end of the chain, and every transfer must be
+// in the chain. The whole walk reads from one snapshot.
+func VerifyTransferChain(ctx context.Context, db *gorm.DB) (*TransferChainVerification, error) {
+	verification := &TransferChainVerification{}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Transfer{}).Where("chain_sequence IS NULL").Count(&verification.Unchained).Error; err != nil {
+			return err
+		}
+		var head model.TransferChainHead
+		if err := tx.Take(&head, "id = ?", model.TransferChainHeadID).Error; err != nil {
+			return err
+		}
+
+		for {
+			var transfers []model.Transfer
+			if err := tx.Preload("Legs", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+				Where("chain_sequence > ?", verification.Length).
+				Order("chain_sequence").
+				Limit(maxTransferChainBatch).
+				Find(&transfers).Error; err != nil {
+				return err
+			}
+
+			for i := range transfers {
+				transfer := &transfers[i]
+				sequence := verification.Length + 1
+				if *transfer.ChainSequence != sequence {
+					verification.Break = &TransferChainBreak{Sequence: sequence, Reason: "transfer is missing"}
+					return nil
+				}
+				hash, err := transferchain.Hash(sequence, verification.Head, transfer)
+				if err != nil {
+					return fmt.Errorf("transfer %d: %w", transfer.ID, err)
+				}
+				if hash != *transfer.Hash {
+					verification.Break = &TransferChainBreak{Sequence: sequence, TransferID: &transfer.ID, Reason: "hash does not match"}
+					return nil
+				}
+				verification.Length, verification.Head = sequence, hash
+			}
+			if len(transfers) < maxTransferChainBatch {
+				break
+			}
+		}
+
+		switch {
+		case verification.Length < head.ChainSequence:
+			verification.Break = &TransferChainBreak{Sequence: verification.Length + 1, Reason: "transfer is missing"}
+			return nil
+		case verification.Length > head.ChainSequence || verification.Head != head.Hash:
+			verification.Break = &TransferChainBreak{Sequence: verification.Length, Reason: "chain does not end at its recorded head"}
+			return nil
+		}
+
+		if verification.Unchained > 0 {
+			var unchained model.Transfer
+			if err := tx.Select("id").Where("chain_sequence IS NULL").Order("id").Take(&unchained).Error; err != nil {
+				return err
+			}
+			verification.Break = &TransferChainBreak{
+				Sequence:   verification.Length + 1,
+				TransferID: &unchained.ID,
+				Reason:     "transfer is not chained",
+			}
+		}
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	return verification, err
+}
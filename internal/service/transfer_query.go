@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/svrerror"
+)
+
+// likeEscaper escapes the wildcards of a LIKE pattern, so that user input only matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// GetTransfer returns a single transfer by ID, along with its legs and the reversals made against it.
+func GetTransfer(ctx context.Context, db *gorm.DB, transferID uint64) (*model.Transfer, error) {
+	var transfer model.Transfer
+	if err := db.WithContext(ctx).
+		Preload("Legs", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Reversals", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Take(&transfer, "id = ?", transferID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, svrerror.New("transfer not found", http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+// ListAccountTransfers returns a page of transfers in and out of an account, newest first, using keyset pagination
+// over the transfer ID. The returned cursor is 0 when there are no more pages.
+func ListAccountTransfers(ctx context.Context, db *gorm.DB, filter apimodel.TransferFilter) ([]model.Transfer, uint64, error) {
+	db = db.WithContext(ctx)
+
+	var accountCount int64
+	if err := db.Model(&model.Account{}).Where("id = ?", filter.AccountID).Count(&accountCount).Error; err != nil {
+		return nil, 0, err
+	}
+	if accountCount == 0 {
+		return nil, 0, svrerror.New("account not found", http.StatusNotFound)
+	}
+
+	// Multi-leg transfers are found through their legs, where credits are positive and debits negative
+	query := db.Model(&model.Transfer{})
+	switch filter.Direction {
+	case apimodel.DirectionIn:
+		query = query.Where("(destination_account_id = ? OR id IN (SELECT transfer_id FROM transfer_legs WHERE account_id = ? AND amount > 0))",
+			filter.AccountID, filter.AccountID)
+	case apimodel.DirectionOut:
+		query = query.Where("(source_account_id = ? OR id IN (SELECT transfer_id FROM transfer_legs WHERE account_id = ? AND amount < 0))",
+			filter.AccountID, filter.AccountID)
+	default:
+		query = query.Where("(source_account_id = ? OR destination_account_id = ? OR id IN (SELECT transfer_id FROM transfer_legs WHERE account_id = ?))",
+			filter.AccountID, filter.AccountID, filter.AccountID)
+	}
+
+	if filter.MinAmount != nil {
+		query = query.Where("amount >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		query = query.Where("amount <= ?", *filter.MaxAmount)
+	}
+	if filter.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		query = query.Where("created_at < ?", *filter.CreatedTo)
+	}
+	if filter.Reference != "" {
+		query = query.Where("reference = ?", filter.Reference)
+	}
+	if filter.ExternalID != "" {
+		query = query.Where("external_id = ?", filter.ExternalID)
+	}
+	if filter.Description != "" {
+		query = query.Where("description ILIKE ?", "%"+likeEscaper.Replace(filter.Description)+"%")
+	}
+	if filter.Metadata != "" {
+		query = query.Where("metadata @> ?::jsonb", filter.Metadata)
+	}
+	if filter.Cursor != 0 {
+		query = query.Where("id < ?", filter.Cursor)
+	}
+
+	// Fetch one extra row to find out whether there is another page
+	var transfers []model.Transfer
+	if err := query.Preload("Legs", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Order("id DESC").Limit(filter.Limit + 1).Find(&transfers).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var nextCursor uint64
+	if len(transfers) > filter.Limit {
+		transfers = transfers[:filter.Limit]
+		nextCursor = transfers[len(transfers)-1].ID
+	}
+
+	return transfers, nextCursor, nil
+}
@@ -0,0 +1,447 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/svrerror"
+	"internal-transfers-system/internal/webhook"
+)
+
+// WebhookPolicy controls how webhooks are delivered. A failed attempt is retried after BackoffBase, doubling with
+// every attempt up to BackoffMax, until MaxAttempts attempts have failed and the delivery is dead.
+type WebhookPolicy struct {
+	Timeout     time.Duration
+	MaxAttempts int
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+}
+
+// backoff returns how long to wait after the given number of failed attempts.
+func (p WebhookPolicy) backoff(attempts int) time.Duration {
+	delay := p.BackoffBase
+	for i := 1; i < attempts && delay < p.BackoffMax; i++ {
+		delay *= 2
+	}
+	return min(delay, p.BackoffMax)
+}
+
+const (
+	// maxWebhookErrorLength caps how much of a failed response is kept on the delivery.
+	maxWebhookErrorLength = 500
+	// maxConcurrentWebhooks is how many deliveries are sent at the same time, each to a different subscription.
+	maxConcurrentWebhooks = 16
+	// webhookLeaseMargin is how much longer than the request timeout a claimed delivery is leased for.
+	webhookLeaseMargin = time.Minute
+)
+
+// CreateWebhookSubscription registers an endpoint for events of the given types, or every event if there are none.
+// A random secret is generated if secret is empty.
+func CreateWebhookSubscription(ctx context.Context, db *gorm.DB, url string, eventTypes []string, secret string) (*model.WebhookSubscription, error) {
+	if secret == "" {
+		var err error
+		if secret, err = webhook.NewSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	subscription := model.WebhookSubscription{URL: url, Secret: secret, EventTypes: eventTypes}
+	if err := db.WithContext(ctx).Create(&subscription).Error; err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// ListWebhookSubscriptions returns every subscription in the order they were created.
+func ListWebhookSubscriptions(ctx context.Context, db *gorm.DB) ([]model.WebhookSubscription, error) {
+	var subscriptions []model.WebhookSubscription
+	err := db.WithContext(ctx).Order("id").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// DeleteWebhookSubscription removes a subscription along with its deliveries, pending ones included.
+func DeleteWebhookSubscription(ctx context.Context, db *gorm.DB, subscriptionID uint64) error {
+	result := db.WithContext(ctx).Delete(&model.WebhookSubscription{}, "id = ?", subscriptionID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return svrerror.New("webhook subscription not found", http.StatusNotFound)
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns a page of deliveries, newest first, using keyset pagination over the delivery ID.
+func ListWebhookDeliveries(ctx context.Context, db *gorm.DB, filter apimodel.WebhookDeliveryFilter) ([]model.WebhookDelivery, uint64, error) {
+	query := db.WithContext(ctx).Model(&model.WebhookDelivery{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.SubscriptionID != 0 {
+		query = query.Where("subscription_id = ?", filter.SubscriptionID)
+	}
+	if filter.EventID != 0 {
+		query = query.Where("event_id = ?", filter.EventID)
+	}
+	if filter.Cursor != 0 {
+		query = query.Where("id < ?", filter.Cursor)
+	}
+
+	// Fetch one extra row to find out whether there is another page
+	var deliveries []model.WebhookDelivery
+	if err := query.Preload("Event").Order("id DESC").Limit(filter.Limit + 1).Find(&deliveries).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var nextCursor uint64
+	if len(deliveries) > filter.Limit {
+		deliveries = deliveries[:filter.Limit]
+		nextCursor = deliveries[len(deliveries)-1].ID
+	}
+
+	return deliveries, nextCursor, nil
+}
+
+// ReplayWebhookDelivery sends a delivery again from scratch: it becomes pending, is due right away and gets the full
+// number of attempts. This is how dead deliveries are retried once the endpoint has been fixed.
+func ReplayWebhookDelivery(ctx context.Context, db *gorm.DB, deliveryID uint64) (*model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Moving next_attempt_at ends the lease of an attempt that is in progress, so its outcome is not recorded
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&delivery, "id = ?", deliveryID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return svrerror.New("webhook delivery not found", http.StatusNotFound)
+			}
+			return err
+		}
+
+		delivery.Status = model.WebhookDeliveryStatusPending
+		delivery.AttemptCount = 0
+		delivery.NextAttemptAt = time.Now()
+		delivery.DeliveredAt = nil
+		return tx.Save(&delivery).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// ReplayWebhookEvent creates a new delivery of an event, to a single subscription or, if subscriptionID is 0, to
+// every subscription to the event's type. An event can only be replayed once the dispatcher has picked it up, so that
+// it is not delivered twice by mistake.
+func ReplayWebhookEvent(ctx context.Context, db *gorm.DB, eventID, subscriptionID uint64) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var event model.OutboxEvent
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&event, "id = ?", eventID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return svrerror.New("event not found", http.StatusNotFound)
+			}
+			return err
+		}
+		if event.DispatchedAt == nil {
+			return svrerror.New("event has not been dispatched yet", http.StatusUnprocessableEntity)
+		}
+
+		var subscriptions []model.WebhookSubscription
+		if subscriptionID != 0 {
+			var subscription model.WebhookSubscription
+			if err := tx.Take(&subscription, "id = ?", subscriptionID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return svrerror.New("webhook subscription not found", http.StatusNotFound)
+				}
+				return err
+			}
+			subscriptions = append(subscriptions, subscription)
+		} else if err := tx.Order("id").Find(&subscriptions).Error; err != nil {
+			return err
+		}
+
+		var err error
+		deliveries, err = createDeliveries(tx, &event, subscriptions, subscriptionID != 0)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// createDeliveries creates a pending delivery of event for every subscription to its type, or for every one of
+// subscriptions if all is set.
+func createDeliveries(tx *gorm.DB, event *model.OutboxEvent, subscriptions []model.WebhookSubscription, all bool) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	for i := range subscriptions {
+		if !all && !subscriptions[i].Matches(event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, model.WebhookDelivery{
+			EventID:        event.ID,
+			SubscriptionID: subscriptions[i].ID,
+			Status:         model.WebhookDeliveryStatusPending,
+			NextAttemptAt:  time.Now(),
+		})
+	}
+	if len(deliveries) == 0 {
+		return deliveries, nil
+	}
+	return deliveries, tx.Create(&deliveries).Error
+}
+
+// DispatchWebhooks creates the deliveries of new outbox events and then attempts every delivery that is due, and
+// returns how many deliveries were attempted. Like the scheduler, events and deliveries are claimed with FOR UPDATE
+// SKIP LOCKED, so several server processes can dispatch side by side. Deliveries to different subscriptions are sent
+// concurrently, and the deliveries of a subscription one at a time, in the order they were created: see
+// claimDueWebhooks.
+func DispatchWebhooks(ctx context.Context, db *gorm.DB, client *http.Client, policy WebhookPolicy) (int, error) {
+	for ctx.Err() == nil {
+		found, err := fanOutNextEvents(ctx, db)
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			break
+		}
+	}
+
+	attempted := 0
+	for ctx.Err() == nil {
+		claimed, err := claimDueWebhooks(ctx, db, policy)
+		if err != nil {
+			return attempted, err
+		}
+		if len(claimed) == 0 {
+			break
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, len(claimed))
+		for i := range claimed {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = deliverWebhook(ctx, db, client, policy, &claimed[i])
+			}()
+		}
+		wg.Wait()
+		attempted += len(claimed)
+		if err := errors.Join(errs...); err != nil {
+			return attempted, err
+		}
+	}
+	return attempted, nil
+}
+
+// fanOutNextEvents creates the deliveries of the oldest undispatched events and marks them as dispatched.
+func fanOutNextEvents(ctx context.Context, db *gorm.DB) (bool, error) {
+	found := false
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var events []model.OutboxEvent
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("dispatched_at IS NULL").
+			Order("id").
+			Limit(100).
+			Find(&events).Error; err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		found = true
+
+		var subscriptions []model.WebhookSubscription
+		if err := tx.Order("id").Find(&subscriptions).Error; err != nil {
+			return err
+		}
+
+		ids := make([]uint64, 0, len(events))
+		for i := range events {
+			if _, err := createDeliveries(tx, &events[i], subscriptions, false); err != nil {
+				return err
+			}
+			ids = append(ids, events[i].ID)
+		}
+		return tx.Model(&model.OutboxEvent{}).Where("id IN ?", ids).Update("dispatched_at", time.Now()).Error
+	})
+	return found, err
+}
+
+// claimedWebhook is a delivery that has been claimed for an attempt, along with what it sends and where.
+type claimedWebhook struct {
+	Delivery     model.WebhookDelivery
+	Event        model.OutboxEvent
+	Subscription model.WebhookSubscription
+}
+
+// claimDueWebhooks claims the oldest pending delivery of up to maxConcurrentWebhooks subscriptions, if it is due.
+// A claim leases the delivery by moving its next_attempt_at past the time it takes to send it, so that the claim
+// commits straight away and the webhook is sent without holding a transaction or a lock. Other dispatchers skip a
+// leased delivery until the lease runs out, which is also when a delivery whose dispatcher died is attempted again.
+//
+// Only the oldest pending delivery of a subscription can be claimed, so a subscription's deliveries go out one at a
+// time and in order, across dispatchers: while it is leased, or backing off after a failed attempt, the deliveries
+// after it wait. It stops holding them up once it is delivered or dead-lettered.
+func claimDueWebhooks(ctx context.Context, db *gorm.DB, policy WebhookPolicy) ([]claimedWebhook, error) {
+	var claimed []claimedWebhook
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var deliveries []model.WebhookDelivery
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where(`id IN (SELECT DISTINCT ON (subscription_id) id FROM webhook_deliveries
+				WHERE status = ? ORDER BY subscription_id, id)`,
+				model.WebhookDeliveryStatusPending).
+			// Checked on the locked row, so a delivery that another dispatcher claimed since the subquery ran is skipped
+			Where("status = ? AND next_attempt_at <= ?", model.WebhookDeliveryStatusPending, now).
+			Order("next_attempt_at, id").
+			Limit(maxConcurrentWebhooks).
+			Find(&deliveries).Error; err != nil {
+			return err
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		// The database keeps microseconds, and the lease is compared when the outcome is recorded
+		lease := now.Add(policy.Timeout + webhookLeaseMargin).Truncate(time.Microsecond)
+		ids := make([]uint64, 0, len(deliveries))
+		claimed = make([]claimedWebhook, len(deliveries))
+		for i, delivery := range deliveries {
+			claimed[i].Delivery = delivery
+			claimed[i].Delivery.NextAttemptAt = lease
+			if err := tx.Take(&claimed[i].Event, "id = ?", delivery.EventID).Error; err != nil {
+				return err
+			}
+			if err := tx.Take(&claimed[i].Subscription, "id = ?", delivery.SubscriptionID).Error; err != nil {
+				return err
+			}
+			ids = append(ids, delivery.ID)
+		}
+		return tx.Model(&model.WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", lease).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// deliverWebhook sends a claimed delivery and records the outcome. The outcome is only recorded while the delivery is
+// still leased to this attempt; if it was replayed in the meantime, the replay stands. An attempt that is cut short
+// because ctx was cancelled is not recorded, and the delivery is attempted again once its lease runs out.
+func deliverWebhook(ctx context.Context, db *gorm.DB, client *http.Client, policy WebhookPolicy, claimed *claimedWebhook) error {
+	delivery := &claimed.Delivery
+	lease := delivery.NextAttemptAt
+
+	statusCode, sendErr := sendWebhook(ctx, client, &claimed.Subscription, &claimed.Event)
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	now := time.Now()
+	delivery.AttemptCount++
+	delivery.LastAttemptAt = &now
+	delivery.LastStatusCode = nil
+	if statusCode != 0 {
+		delivery.LastStatusCode = &statusCode
+	}
+	switch {
+	case sendErr == nil:
+		delivery.Status = model.WebhookDeliveryStatusDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+	case delivery.AttemptCount >= policy.MaxAttempts:
+		delivery.Status = model.WebhookDeliveryStatusDead
+		delivery.LastError = sendErr.Error()
+	default:
+		delivery.NextAttemptAt = now.Add(policy.backoff(delivery.AttemptCount))
+		delivery.LastError = sendErr.Error()
+	}
+	slog.Info("attempted webhook delivery", "id", delivery.ID, "event", claimed.Event.ID, "subscription", claimed.Subscription.ID,
+		"attempt", delivery.AttemptCount, "status", delivery.Status, "error", delivery.LastError)
+
+	result := db.WithContext(ctx).Model(delivery).
+		Where("status = ? AND next_attempt_at = ?", model.WebhookDeliveryStatusPending, lease).
+		Updates(map[string]interface{}{
+			"status":           delivery.Status,
+			"attempt_count":    delivery.AttemptCount,
+			"next_attempt_at":  delivery.NextAttemptAt,
+			"last_attempt_at":  delivery.LastAttemptAt,
+			"last_status_code": delivery.LastStatusCode,
+			"last_error":       delivery.LastError,
+			"delivered_at":     delivery.DeliveredAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		slog.Info("webhook delivery changed while it was attempted, outcome not recorded", "id", delivery.ID)
+	}
+	return nil
+}
+
+// sendWebhook posts an event to a subscription's endpoint, signed with its secret. Any response other than a 2xx is
+// an error. The status code is 0 if no response was received.
+func sendWebhook(ctx context.Context, client *http.Client, subscription *model.WebhookSubscription, event *model.OutboxEvent) (int, error) {
+	body, err := json.Marshal(apimodel.NewWebhookEvent(event))
+	if err != nil {
+		return 0, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(webhook.EventIDHeader, fmt.Sprint(event.ID))
+	request.Header.Set(webhook.EventTypeHeader, event.Type)
+	request.Header.Set(webhook.SignatureHeader, webhook.Sign(subscription.Secret, time.Now(), body))
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, truncateWebhookError(err.Error())
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		excerpt, _ := io.ReadAll(io.LimitReader(response.Body, maxWebhookErrorLength))
+		message := response.Status
+		if text := strings.TrimSpace(string(excerpt)); text != "" {
+			message += ": " + text
+		}
+		return response.StatusCode, truncateWebhookError(message)
+	}
+	return response.StatusCode, nil
+}
+
+func truncateWebhookError(message string) error {
+	if len(message) > maxWebhookErrorLength {
+		message = message[:maxWebhookErrorLength]
+	}
+	return errors.New(strings.ToValidUTF8(message, ""))
+}
+
+// RunWebhookDispatcher dispatches webhooks every interval until ctx is cancelled.
+func RunWebhookDispatcher(ctx context.Context, db *gorm.DB, policy WebhookPolicy, interval time.Duration) {
+	client := &http.Client{Timeout: policy.Timeout}
+	runEvery(ctx, "webhook dispatcher", interval, func(ctx context.Context) error {
+		attempted, err := DispatchWebhooks(ctx, db, client, policy)
+		if err != nil {
+			return err
+		}
+		slog.Debug("attempted webhook deliveries", "count", attempted)
+		return nil
+	})
+}
@@ -0,0 +1,281 @@
+package statement
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+)
+
+// camt053Namespace is the namespace of version 8 of the ISO 20022 BankToCustomerStatement message.
+const camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.08"
+
+// now is the creation time of camt.053 messages, replaced in tests.
+var now = time.Now
+
+// The camt.053 types only have the elements that are filled in. Their fields are in the order of the XSD sequences.
+type camtDocument struct {
+	XMLName   xml.Name                    `xml:"Document"`
+	Namespace string                      `xml:"xmlns,attr"`
+	Statement camtBankToCustomerStatement `xml:"BkToCstmrStmt"`
+}
+
+type camtBankToCustomerStatement struct {
+	GroupHeader camtGroupHeader      `xml:"GrpHdr"`
+	Statement   camtAccountStatement `xml:"Stmt"`
+}
+
+type camtGroupHeader struct {
+	MessageID string `xml:"MsgId"`
+	CreatedAt string `xml:"CreDtTm"`
+}
+
+type camtAccountStatement struct {
+	ID        string        `xml:"Id"`
+	CreatedAt string        `xml:"CreDtTm"`
+	Period    camtPeriod    `xml:"FrToDt"`
+	Account   camtAccount   `xml:"Acct"`
+	Balances  []camtBalance `xml:"Bal"`
+	Summary   camtSummary   `xml:"TxsSummry"`
+	Entries   []camtEntry   `xml:"Ntry"`
+}
+
+type camtPeriod struct {
+	From string `xml:"FrDtTm"`
+	To   string `xml:"ToDtTm"`
+}
+
+type camtAccount struct {
+	ID       camtAccountID `xml:"Id"`
+	Currency string        `xml:"Ccy,omitempty"`
+}
+
+type camtAccountID struct {
+	Other struct {
+		ID string `xml:"Id"`
+	} `xml:"Othr"`
+}
+
+type camtAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type camtDateTime struct {
+	DateTime string `xml:"DtTm"`
+}
+
+type camtBalance struct {
+	Type struct {
+		Code string `xml:"CdOrPrtry>Cd"`
+	} `xml:"Tp"`
+	Amount      camtAmount   `xml:"Amt"`
+	CreditDebit string       `xml:"CdtDbtInd"`
+	Date        camtDateTime `xml:"Dt"`
+}
+
+type camtSummary struct {
+	Total struct {
+		Count string `xml:"NbOfNtries"`
+		Sum   string `xml:"Sum"`
+		Net   struct {
+			Amount      string `xml:"Amt"`
+			CreditDebit string `xml:"CdtDbtInd"`
+		} `xml:"TtlNetNtry"`
+	} `xml:"TtlNtries"`
+	Credits camtCountAndSum `xml:"TtlCdtNtries"`
+	Debits  camtCountAndSum `xml:"TtlDbtNtries"`
+}
+
+type camtCountAndSum struct {
+	Count string `xml:"NbOfNtries"`
+	Sum   string `xml:"Sum"`
+}
+
+type camtEntry struct {
+	Reference       string           `xml:"NtryRef,omitempty"`
+	Amount          camtAmount       `xml:"Amt"`
+	CreditDebit     string           `xml:"CdtDbtInd"`
+	Status          string           `xml:"Sts>Cd"`
+	BookingDate     camtDateTime     `xml:"BookgDt"`
+	ValueDate       camtDateTime     `xml:"ValDt"`
+	ServicerRef     string           `xml:"AcctSvcrRef,omitempty"`
+	TransactionCode camtBankTxCode   `xml:"BkTxCd"`
+	Details         *camtTransaction `xml:"NtryDtls>TxDtls"`
+	AdditionalInfo  string           `xml:"AddtlNtryInf,omitempty"`
+}
+
+type camtBankTxCode struct {
+	Domain    string `xml:"Domn>Cd"`
+	Family    string `xml:"Domn>Fmly>Cd"`
+	SubFamily string `xml:"Domn>Fmly>SubFmlyCd"`
+}
+
+type camtTransaction struct {
+	ServicerRef string       `xml:"Refs>AcctSvcrRef"`
+	Parties     *camtParties `xml:"RltdPties"`
+	Remittance  []string     `xml:"RmtInf>Ustrd"`
+}
+
+type camtParties struct {
+	DebtorAccount   *camtAccount `xml:"DbtrAcct"`
+	CreditorAccount *camtAccount `xml:"CdtrAcct"`
+}
+
+// camtTransactionCodes maps statement line types to ISO 20022 bank transaction codes, for debits and credits.
+// Transfers are book transfers between accounts of the same institution, and fees are charges.
+var camtTransactionCodes = map[string][2]camtBankTxCode{
+	model.StatementLineTransfer:      {{"PMNT", "ICDT", "BOOK"}, {"PMNT", "RCDT", "BOOK"}},
+	model.StatementLineFee:           {{"ACMT", "MDOP", "CHRG"}, {"ACMT", "MCOP", "CHRG"}},
+	model.StatementLineAccountOpened: {{"ACMT", "MDOP", "OTHR"}, {"ACMT", "MCOP", "OTHR"}},
+}
+
+// WriteCamt053 writes a statement as an ISO 20022 camt.053.001.08 BankToCustomerStatement message. Every line is an
+// entry, with the amount unsigned and a credit or debit indicator instead, and the opening and closing balances are
+// booked balances as of the start and end of the period.
+func WriteCamt053(w io.Writer, statement *apimodel.StatementResponse) error {
+	createdAt := now()
+	accountID := strconv.FormatUint(statement.AccountID, 10)
+	document := camtDocument{
+		Namespace: camt053Namespace,
+		Statement: camtBankToCustomerStatement{
+			GroupHeader: camtGroupHeader{
+				MessageID: fmt.Sprintf("%s-%s", accountID, createdAt.UTC().Format("20060102150405")),
+				CreatedAt: camtTime(createdAt),
+			},
+			Statement: camtAccountStatement{
+				ID:        fmt.Sprintf("%s-%s-%s", statement.From.UTC().Format("060102"), statement.To.UTC().Format("060102"), accountID),
+				CreatedAt: camtTime(createdAt),
+				Period:    camtPeriod{From: camtTime(statement.From), To: camtTime(statement.To)},
+				Account:   camtAccountOf(statement.AccountID, statement.Currency),
+			},
+		},
+	}
+	stmt := &document.Statement.Statement
+
+	for _, balance := range []struct {
+		code   string
+		amount string
+		date   time.Time
+	}{
+		{"OPBD", statement.OpeningBalance, statement.From},
+		{"CLBD", statement.ClosingBalance, statement.To},
+	} {
+		amount, indicator, err := camtSignedAmount(balance.amount)
+		if err != nil {
+			return err
+		}
+		camtBal := camtBalance{
+			Amount:      camtAmount{Currency: statement.Currency, Value: amount.String()},
+			CreditDebit: indicator,
+			Date:        camtDateTime{DateTime: camtTime(balance.date)},
+		}
+		camtBal.Type.Code = balance.code
+		stmt.Balances = append(stmt.Balances, camtBal)
+	}
+
+	var credits, debits decimal.Decimal
+	var creditCount, debitCount int
+	for _, line := range statement.Lines {
+		entry, amount, err := camtEntryOf(statement, line)
+		if err != nil {
+			return err
+		}
+		if entry.CreditDebit == "CRDT" {
+			credits, creditCount = credits.Add(amount), creditCount+1
+		} else {
+			debits, debitCount = debits.Add(amount), debitCount+1
+		}
+		stmt.Entries = append(stmt.Entries, entry)
+	}
+
+	summary := &stmt.Summary
+	summary.Total.Count = strconv.Itoa(creditCount + debitCount)
+	summary.Total.Sum = credits.Add(debits).String()
+	net, indicator := credits.Sub(debits), "CRDT"
+	if net.IsNegative() {
+		net, indicator = net.Neg(), "DBIT"
+	}
+	summary.Total.Net.Amount, summary.Total.Net.CreditDebit = net.String(), indicator
+	summary.Credits = camtCountAndSum{Count: strconv.Itoa(creditCount), Sum: credits.String()}
+	summary.Debits = camtCountAndSum{Count: strconv.Itoa(debitCount), Sum: debits.String()}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// camtEntryOf maps a statement line to an entry, and also returns its unsigned amount.
+func camtEntryOf(statement *apimodel.StatementResponse, line apimodel.StatementLineResponse) (camtEntry, decimal.Decimal, error) {
+	amount, indicator, err := camtSignedAmount(line.Amount)
+	if err != nil {
+		return camtEntry{}, decimal.Zero, err
+	}
+
+	codes := camtTransactionCodes[line.Type]
+	entry := camtEntry{
+		Amount:          camtAmount{Currency: statement.Currency, Value: amount.String()},
+		CreditDebit:     indicator,
+		Status:          "BOOK",
+		BookingDate:     camtDateTime{DateTime: camtTime(line.Date)},
+		ValueDate:       camtDateTime{DateTime: camtTime(line.Date)},
+		TransactionCode: codes[0],
+		AdditionalInfo:  line.Description,
+	}
+	if indicator == "CRDT" {
+		entry.TransactionCode = codes[1]
+	}
+	if line.TransferID == 0 {
+		return entry, amount, nil
+	}
+
+	transferID := strconv.FormatUint(line.TransferID, 10)
+	entry.Reference, entry.ServicerRef = transferID, transferID
+	entry.Details = &camtTransaction{ServicerRef: transferID}
+	if line.Reference != "" {
+		entry.Details.Remittance = []string{line.Reference}
+	}
+	if line.CounterpartyAccountID != 0 {
+		// The counterparty is the creditor of a debit and the debtor of a credit
+		counterparty := camtAccountOf(line.CounterpartyAccountID, "")
+		entry.Details.Parties = &camtParties{CreditorAccount: &counterparty}
+		if indicator == "CRDT" {
+			entry.Details.Parties = &camtParties{DebtorAccount: &counterparty}
+		}
+	}
+	return entry, amount, nil
+}
+
+func camtAccountOf(accountID uint64, currency string) camtAccount {
+	account := camtAccount{Currency: currency}
+	account.ID.Other.ID = strconv.FormatUint(accountID, 10)
+	return account
+}
+
+// camtSignedAmount splits an amount into its absolute value and a credit or debit indicator. Zero is a credit.
+func camtSignedAmount(value string) (decimal.Decimal, string, error) {
+	amount, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.Zero, "", err
+	}
+	if amount.IsNegative() {
+		return amount.Neg(), "DBIT", nil
+	}
+	return amount, "CRDT", nil
+}
+
+func camtTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,131 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testCamt053Statement() *apimodel.StatementResponse {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	return &apimodel.StatementResponse{
+		AccountID:      1,
+		Currency:       "SGD",
+		From:           from,
+		To:             from.AddDate(0, 1, 0),
+		OpeningBalance: "-5",
+		ClosingBalance: "83.5",
+		Lines: []apimodel.StatementLineResponse{
+			{Date: from.Add(time.Hour), Type: model.StatementLineTransfer, TransferID: 7, CounterpartyAccountID: 2,
+				Reference: "INV-1", Description: "March invoice", Amount: "100", Balance: "95"},
+			{Date: from.Add(2 * time.Hour), Type: model.StatementLineTransfer, TransferID: 8, CounterpartyAccountID: 3,
+				Amount: "-10", Balance: "85"},
+			{Date: from.Add(2 * time.Hour), Type: model.StatementLineFee, TransferID: 8, CounterpartyAccountID: 9,
+				Amount: "-1.5", Balance: "83.5"},
+		},
+	}
+}
+
+func writeTestCamt053(t *testing.T, statement *apimodel.StatementResponse) []byte {
+	now = func() time.Time { return time.Date(2024, 4, 1, 2, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	var body bytes.Buffer
+	require.NoError(t, WriteCamt053(&body, statement))
+	return body.Bytes()
+}
+
+// validateCamt053 validates a message against the camt.053.001.08 XSD with xmllint, since the standard library
+// cannot validate XML schemas.
+func validateCamt053(t *testing.T, document []byte) {
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint is not installed")
+	}
+
+	path := filepath.Join(t.TempDir(), "camt053.xml")
+	require.NoError(t, os.WriteFile(path, document, 0o600))
+	output, err := exec.Command(xmllint, "--noout", "--schema", "testdata/camt.053.001.08.xsd", path).CombinedOutput()
+	assert.NoError(t, err, string(output))
+}
+
+func TestWriteCamt053IsValid(t *testing.T) {
+	t.Run("With entries", func(t *testing.T) {
+		validateCamt053(t, writeTestCamt053(t, testCamt053Statement()))
+	})
+
+	t.Run("Without entries", func(t *testing.T) {
+		statement := testCamt053Statement()
+		statement.Lines = nil
+		validateCamt053(t, writeTestCamt053(t, statement))
+	})
+
+	t.Run("Account opened during the period", func(t *testing.T) {
+		statement := testCamt053Statement()
+		statement.OpeningBalance = "0"
+		statement.Lines[0] = apimodel.StatementLineResponse{Date: statement.From, Type: model.StatementLineAccountOpened, Amount: "100", Balance: "100"}
+		validateCamt053(t, writeTestCamt053(t, statement))
+	})
+}
+
+func TestWriteCamt053(t *testing.T) {
+	var document struct {
+		MessageID string `xml:"BkToCstmrStmt>GrpHdr>MsgId"`
+		Statement struct {
+			ID       string `xml:"Id"`
+			Account  string `xml:"Acct>Id>Othr>Id"`
+			Balances []struct {
+				Code        string `xml:"Tp>CdOrPrtry>Cd"`
+				Amount      string `xml:"Amt"`
+				Currency    string `xml:"Amt,attr"`
+				CreditDebit string `xml:"CdtDbtInd"`
+			} `xml:"Bal"`
+			Net struct {
+				Amount      string `xml:"Amt"`
+				CreditDebit string `xml:"CdtDbtInd"`
+			} `xml:"TxsSummry>TtlNtries>TtlNetNtry"`
+			Entries []struct {
+				Reference      string `xml:"NtryRef"`
+				Amount         string `xml:"Amt"`
+				CreditDebit    string `xml:"CdtDbtInd"`
+				Family         string `xml:"BkTxCd>Domn>Fmly>Cd"`
+				SubFamily      string `xml:"BkTxCd>Domn>Fmly>SubFmlyCd"`
+				Debtor         string `xml:"NtryDtls>TxDtls>RltdPties>DbtrAcct>Id>Othr>Id"`
+				Creditor       string `xml:"NtryDtls>TxDtls>RltdPties>CdtrAcct>Id>Othr>Id"`
+				Remittance     string `xml:"NtryDtls>TxDtls>RmtInf>Ustrd"`
+				AdditionalInfo string `xml:"AddtlNtryInf"`
+			} `xml:"Ntry"`
+		} `xml:"BkToCstmrStmt>Stmt"`
+	}
+	body := writeTestCamt053(t, testCamt053Statement())
+	require.NoError(t, xml.Unmarshal(body, &document))
+	assert.Contains(t, string(body), `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.08">`)
+
+	assert.Equal(t, "1-20240401020000", document.MessageID)
+	assert.Equal(t, "240301-240401-1", document.Statement.ID)
+	assert.Equal(t, "1", document.Statement.Account)
+
+	require.Len(t, document.Statement.Balances, 2)
+	opening, closing := document.Statement.Balances[0], document.Statement.Balances[1]
+	assert.Equal(t, []string{"OPBD", "5", "DBIT"}, []string{opening.Code, opening.Amount, opening.CreditDebit})
+	assert.Equal(t, []string{"CLBD", "83.5", "CRDT"}, []string{closing.Code, closing.Amount, closing.CreditDebit})
+	assert.Equal(t, []string{"88.5", "CRDT"}, []string{document.Statement.Net.Amount, document.Statement.Net.CreditDebit})
+
+	entries := document.Statement.Entries
+	require.Len(t, entries, 3)
+	assert.Equal(t, []string{"7", "100", "CRDT", "RCDT", "BOOK", "2", "", "INV-1", "March invoice"}, []string{entries[0].Reference,
+		entries[0].Amount, entries[0].CreditDebit, entries[0].Family, entries[0].SubFamily, entries[0].Debtor, entries[0].Creditor,
+		entries[0].Remittance, entries[0].AdditionalInfo})
+	assert.Equal(t, []string{"10", "DBIT", "ICDT", "", "3"}, []string{entries[1].Amount, entries[1].CreditDebit, entries[1].Family,
+		entries[1].Debtor, entries[1].Creditor})
+	assert.Equal(t, []string{"1.5", "DBIT", "MDOP", "CHRG", "9"}, []string{entries[2].Amount, entries[2].CreditDebit, entries[2].Family,
+		entries[2].SubFamily, entries[2].Creditor})
+}
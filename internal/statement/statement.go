@@ -0,0 +1,182 @@
+package statement
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"internal-transfers-system/internal/apimodel"
+)
+
+const (
+	FormatJSON    = apimodel.StatementFormatJSON
+	FormatCSV     = apimodel.StatementFormatCSV
+	FormatPDF     = apimodel.StatementFormatPDF
+	FormatCamt053 = apimodel.StatementFormatCamt053
+)
+
+// ContentType returns the MIME type of a statement format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatPDF:
+		return "application/pdf"
+	case FormatCamt053:
+		return "application/xml"
+	}
+	return "application/json"
+}
+
+// Write renders a statement in one of the formats other than JSON.
+func Write(w io.Writer, statement *apimodel.StatementResponse, format string) error {
+	switch format {
+	case FormatCSV:
+		return WriteCSV(w, statement)
+	case FormatPDF:
+		return WritePDF(w, statement)
+	case FormatCamt053:
+		return WriteCamt053(w, statement)
+	}
+	return fmt.Errorf("unsupported statement format %q", format)
+}
+
+// Filename returns the name a statement is downloaded as.
+func Filename(statement *apimodel.StatementResponse, format string) string {
+	extension := format
+	if format == FormatCamt053 {
+		extension = "xml"
+	}
+	return fmt.Sprintf("statement-%d-%s-%s.%s", statement.AccountID,
+		statement.From.UTC().Format("20060102"), statement.To.UTC().Format("20060102"), extension)
+}
+
+var csvHeader = []string{"date", "type", "transfer_id", "counterparty_account_id", "reference", "description", "amount", "balance"}
+
+// WriteCSV writes a statement as CSV, with a row per line between an opening and a closing balance row.
+func WriteCSV(w io.Writer, statement *apimodel.StatementResponse) error {
+	writer := csv.NewWriter(w)
+	rows := [][]string{
+		csvHeader,
+		{formatTime(statement.From), "opening_balance", "", "", "", "", "", statement.OpeningBalance},
+	}
+	for _, line := range statement.Lines {
+		rows = append(rows, []string{
+			formatTime(line.Date),
+			line.Type,
+			formatID(line.TransferID),
+			formatID(line.CounterpartyAccountID),
+			escapeFormula(line.Reference),
+			escapeFormula(line.Description),
+			line.Amount,
+			line.Balance,
+		})
+	}
+	rows = append(rows, []string{formatTime(statement.To), "closing_balance", "", "", "", "", "", statement.ClosingBalance})
+	return writer.WriteAll(rows)
+}
+
+// escapeFormula stops spreadsheets from evaluating client supplied text as a formula.
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+type pdfColumn struct {
+	title string
+	width float64
+	align string
+}
+
+var pdfColumns = []pdfColumn{
+	{"Date", 32, "L"},
+	{"Type", 22, "L"},
+	{"Transfer", 18, "R"},
+	{"Counterparty", 22, "R"},
+	{"Details", 40, "L"},
+	{"Amount", 28, "R"},
+	{"Balance", 28, "R"},
+}
+
+const pdfLineHeight = 6
+
+// WritePDF writes a statement as an A4 PDF document. The column headings are repeated on every page.
+func WritePDF(w io.Writer, statement *apimodel.StatementResponse) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	// The core fonts only cover Windows-1252, so other characters in client supplied text are replaced
+	translate := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetTitle(fmt.Sprintf("Statement for account %d", statement.AccountID), true)
+
+	pdf.SetHeaderFunc(func() {
+		pdf.SetFont("Helvetica", "B", 14)
+		pdf.CellFormat(0, 8, fmt.Sprintf("Statement for account %d (%s)", statement.AccountID, statement.Currency), "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(0, 6, fmt.Sprintf("%s to %s", formatTime(statement.From), formatTime(statement.To)), "", 1, "L", false, 0, "")
+		pdf.Ln(2)
+		pdf.SetFont("Helvetica", "B", 9)
+		for _, column := range pdfColumns {
+			pdf.CellFormat(column.width, pdfLineHeight, column.title, "B", 0, column.align, false, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Helvetica", "", 9)
+	})
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(0, 10, fmt.Sprintf("Page %d", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	row := func(cells ...string) {
+		for i, column := range pdfColumns {
+			pdf.CellFormat(column.width, pdfLineHeight, fitText(pdf, translate(cells[i]), column.width), "", 0, column.align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	row(pdfTime(statement.From), "Opening balance", "", "", "", "", statement.OpeningBalance)
+	for _, line := range statement.Lines {
+		details := line.Reference
+		if line.Description != "" {
+			details = strings.TrimSpace(details + " " + line.Description)
+		}
+		row(pdfTime(line.Date), line.Type, formatID(line.TransferID), formatID(line.CounterpartyAccountID), details, line.Amount, line.Balance)
+	}
+	pdf.SetFont("Helvetica", "B", 9)
+	row(pdfTime(statement.To), "Closing balance", "", "", "", "", statement.ClosingBalance)
+
+	return pdf.Output(w)
+}
+
+// fitText shortens text with an ellipsis until it fits in a cell of the given width.
+func fitText(pdf *gofpdf.Fpdf, text string, width float64) string {
+	const padding = 2
+	if pdf.GetStringWidth(text) <= width-padding {
+		return text
+	}
+	for len(text) > 0 && pdf.GetStringWidth(text+"...") > width-padding {
+		text = text[:len(text)-1]
+	}
+	return text + "..."
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func pdfTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04")
+}
+
+func formatID(id uint64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatUint(id, 10)
+}
@@ -0,0 +1,69 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testStatement(lines int) *apimodel.StatementResponse {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	statement := &apimodel.StatementResponse{
+		AccountID:      1,
+		Currency:       "SGD",
+		From:           from,
+		To:             from.AddDate(0, 1, 0),
+		OpeningBalance: "100",
+		ClosingBalance: "90",
+	}
+	for i := 0; i < lines; i++ {
+		statement.Lines = append(statement.Lines, apimodel.StatementLineResponse{
+			Date:                  from.Add(time.Duration(i) * time.Hour),
+			Type:                  "transfer",
+			TransferID:            uint64(i + 1),
+			CounterpartyAccountID: 2,
+			Reference:             fmt.Sprintf("INV-%d", i+1),
+			Description:           "Café " + strings.Repeat("very long description ", 5),
+			Amount:                "-10",
+			Balance:               "90",
+		})
+	}
+	return statement
+}
+
+func TestWriteCSV(t *testing.T) {
+	statement := testStatement(1)
+	statement.Lines[0].Description = "=HYPERLINK(\"http://example.com\")"
+
+	var body bytes.Buffer
+	require.NoError(t, WriteCSV(&body, statement))
+
+	rows, err := csv.NewReader(&body).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		csvHeader,
+		{"2024-03-01T00:00:00Z", "opening_balance", "", "", "", "", "", "100"},
+		{"2024-03-01T00:00:00Z", "transfer", "1", "2", "INV-1", "'=HYPERLINK(\"http://example.com\")", "-10", "90"},
+		{"2024-04-01T00:00:00Z", "closing_balance", "", "", "", "", "", "90"},
+	}, rows)
+}
+
+func TestWritePDF(t *testing.T) {
+	var short, long bytes.Buffer
+	require.NoError(t, WritePDF(&short, testStatement(1)))
+	require.NoError(t, WritePDF(&long, testStatement(200)))
+
+	assert.True(t, bytes.HasPrefix(short.Bytes(), []byte("%PDF-")))
+	assert.Equal(t, 1, bytes.Count(short.Bytes(), []byte("/Type /Page\n")))
+	assert.Greater(t, bytes.Count(long.Bytes(), []byte("/Type /Page\n")), 1)
+}
+
+func TestFilename(t *testing.T) {
+	assert.Equal(t, "statement-1-20240301-20240401.pdf", Filename(testStatement(0), FormatPDF))
+}
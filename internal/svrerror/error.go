@@ -1,9 +1,28 @@
 package svrerror
 
+import "errors"
+
+// Codes identify errors that clients are expected to handle programmatically. They are returned next to the
+// message, which is free to change.
+const (
+	CodeAccountFrozen       = "account_frozen"
+	CodeAccountClosed       = "account_closed"
+	CodeLimitExceeded       = "limit_exceeded"
+	CodeInsufficientFunds   = "insufficient_funds"
+	CodeDuplicateExternalID = "duplicate_external_id"
+	CodeAccountHasOpenItems = "account_has_open_items"
+	// CodeFeeAccountUnavailable is returned when a fee cannot be credited to the revenue account of its schedule
+	CodeFeeAccountUnavailable = "fee_account_unavailable"
+)
+
 // Error is a custom error type used to wrap errors with a status code.
 type Error struct {
 	Message    string
 	StatusCode int
+	// Code is optional and only set for errors that clients need to tell apart
+	Code string
+	// Details is optional structured information about the error, e.g. the limit that was exceeded
+	Details map[string]string
 }
 
 func (e *Error) Error() string {
@@ -16,3 +35,17 @@ func New(message string, statusCode int) error {
 		StatusCode: statusCode,
 	}
 }
+
+func NewWithCode(message string, statusCode int, code string) error {
+	return &Error{
+		Message:    message,
+		StatusCode: statusCode,
+		Code:       code,
+	}
+}
+
+// HasCode reports whether err is, or wraps, an Error with the given code.
+func HasCode(err error, code string) bool {
+	var svrError *Error
+	return errors.As(err, &svrError) && svrError.Code == code
+}
@@ -0,0 +1,112 @@
+// Package transferchain computes the hashes that chain transfers into a tamper-evident log. Each transfer's hash is
+// the SHA-256 of its canonical form, which includes the hash of the transfer before it, so editing or removing any
+// transfer changes every hash after it.
+package transferchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"internal-transfers-system/internal/model"
+)
+
+// canonicalTransfer fixes the fields that are hashed and their order. Decimals are written without trailing zeros and
+// times in UTC, so that a transfer hashes the same however it was read from the database.
+type canonicalTransfer struct {
+	ChainSequence        uint64          `json:"chain_sequence"`
+	PreviousHash         string          `json:"previous_hash"`
+	ID                   uint64          `json:"id"`
+	CreatedAt            string          `json:"created_at"`
+	SourceAccountID      *uint64         `json:"source_account_id"`
+	DestinationAccountID *uint64         `json:"destination_account_id"`
+	Amount               string          `json:"amount"`
+	Currency             string          `json:"currency"`
+	SourceBalanceAfter   *string         `json:"source_balance_after"`
+	DestinationAmount    string          `json:"destination_amount"`
+	DestinationCurrency  string          `json:"destination_currency"`
+	FXRate               *string         `json:"fx_rate"`
+	FXRoundingAdjustment *string         `json:"fx_rounding_adjustment"`
+	FXQuoteID            *uint64         `json:"fx_quote_id"`
+	ReversalOfID         *uint64         `json:"reversal_of_id"`
+	FeeAmount            *string         `json:"fee_amount"`
+	FeeAccountID         *uint64         `json:"fee_account_id"`
+	Reference            string          `json:"reference"`
+	Description          string          `json:"description"`
+	Metadata             json.RawMessage `json:"metadata"`
+	ExternalID           *string         `json:"external_id"`
+	BatchID              *uint64         `json:"batch_id"`
+	Legs                 []canonicalLeg  `json:"legs"`
+}
+
+type canonicalLeg struct {
+	AccountID    uint64 `json:"account_id"`
+	Amount       string `json:"amount"`
+	BalanceAfter string `json:"balance_after"`
+}
+
+// Canonical returns the bytes that are hashed for transfer at position sequence in the chain, after the transfer
+// with hash previous, which is empty for the first transfer. The legs of a multi-leg transfer must be loaded, in
+// order of their ID.
+func Canonical(sequence uint64, previous string, transfer *model.Transfer) ([]byte, error) {
+	canonical := canonicalTransfer{
+		ChainSequence:        sequence,
+		PreviousHash:         previous,
+		ID:                   transfer.ID,
+		CreatedAt:            transfer.CreatedAt.UTC().Format(time.RFC3339Nano),
+		SourceAccountID:      transfer.SourceAccountID,
+		DestinationAccountID: transfer.DestinationAccountID,
+		Amount:               transfer.Amount.String(),
+		Currency:             transfer.Currency,
+		SourceBalanceAfter:   nullDecimal(transfer.SourceBalanceAfter),
+		DestinationAmount:    transfer.DestinationAmount.String(),
+		DestinationCurrency:  transfer.DestinationCurrency,
+		FXRate:               nullDecimal(transfer.FXRate),
+		FXRoundingAdjustment: nullDecimal(transfer.FXRoundingAdjustment),
+		FXQuoteID:            transfer.FXQuoteID,
+		ReversalOfID:         transfer.ReversalOfID,
+		FeeAmount:            nullDecimal(transfer.FeeAmount),
+		FeeAccountID:         transfer.FeeAccountID,
+		Reference:            transfer.Reference,
+		Description:          transfer.Description,
+		ExternalID:           transfer.ExternalID,
+		BatchID:              transfer.BatchID,
+		Legs:                 make([]canonicalLeg, 0, len(transfer.Legs)),
+	}
+	if len(transfer.Metadata) > 0 {
+		var metadata bytes.Buffer
+		if err := json.Compact(&metadata, transfer.Metadata); err != nil {
+			return nil, err
+		}
+		canonical.Metadata = metadata.Bytes()
+	}
+	for _, leg := range transfer.Legs {
+		canonical.Legs = append(canonical.Legs, canonicalLeg{
+			AccountID:    leg.AccountID,
+			Amount:       leg.Amount.String(),
+			BalanceAfter: leg.BalanceAfter.String(),
+		})
+	}
+	return json.Marshal(canonical)
+}
+
+// Hash returns the hex SHA-256 of the canonical form of transfer at position sequence, chained to previous.
+func Hash(sequence uint64, previous string, transfer *model.Transfer) (string, error) {
+	canonical, err := Canonical(sequence, previous, transfer)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func nullDecimal(value decimal.NullDecimal) *string {
+	if !value.Valid {
+		return nil
+	}
+	s := value.Decimal.String()
+	return &s
+}
@@ -0,0 +1,112 @@
+package transferchain
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/model"
+	"testing"
+	"time"
+)
+
+func testTransfer() *model.Transfer {
+	source, destination := uint64(1), uint64(2)
+	return &model.Transfer{
+		ID:                   7,
+		CreatedAt:            time.Date(2024, 3, 1, 9, 30, 0, 123456000, time.UTC),
+		SourceAccountID:      &source,
+		DestinationAccountID: &destination,
+		Amount:               decimal.RequireFromString("30.50"),
+		Currency:             "SGD",
+		SourceBalanceAfter:   decimal.NewNullDecimal(decimal.RequireFromString("69.5")),
+		DestinationAmount:    decimal.RequireFromString("30.50"),
+		DestinationCurrency:  "SGD",
+		Reference:            "INV-1",
+		Metadata:             model.JSON(`{"order": 42, "tags": ["a", "b"]}`),
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	canonical, err := Canonical(3, "abc", testTransfer())
+	require.NoError(t, err)
+	assert.Equal(t, `{"chain_sequence":3,"previous_hash":"abc","id":7,"created_at":"2024-03-01T09:30:00.123456Z",`+
+		`"source_account_id":1,"destination_account_id":2,"amount":"30.5","currency":"SGD","source_balance_after":"69.5",`+
+		`"destination_amount":"30.5","destination_currency":"SGD","fx_rate":null,"fx_rounding_adjustment":null,`+
+		`"fx_quote_id":null,"reversal_of_id":null,"fee_amount":null,"fee_account_id":null,"reference":"INV-1",`+
+		`"description":"","metadata":{"order":42,"tags":["a","b"]},"external_id":null,"batch_id":null,"legs":[]}`,
+		string(canonical))
+}
+
+func TestHash(t *testing.T) {
+	hash, err := Hash(3, "abc", testTransfer())
+	require.NoError(t, err)
+	assert.Len(t, hash, 64)
+
+	// The same transfer as read back from the database hashes the same
+	same := testTransfer()
+	same.CreatedAt = same.CreatedAt.In(time.FixedZone("SGT", 8*60*60))
+	same.Amount = decimal.RequireFromString("30.500000000000000000")
+	same.DestinationAmount = decimal.RequireFromString("30.500000000000000000")
+	same.Metadata = model.JSON(`{"order":42,"tags":["a","b"]}`)
+	sameHash, err := Hash(3, "abc", same)
+	require.NoError(t, err)
+	assert.Equal(t, hash, sameHash)
+
+	tests := []struct {
+		name     string
+		sequence uint64
+		previous string
+		change   func(transfer *model.Transfer)
+	}{
+		{name: "Another position", sequence: 4, previous: "abc"},
+		{name: "Another previous hash", sequence: 3, previous: "abd"},
+		{
+			name:     "Another amount",
+			sequence: 3,
+			previous: "abc",
+			change:   func(transfer *model.Transfer) { transfer.Amount = decimal.RequireFromString("30.51") },
+		},
+		{
+			name:     "Another destination",
+			sequence: 3,
+			previous: "abc",
+			change: func(transfer *model.Transfer) {
+				destination := uint64(3)
+				transfer.DestinationAccountID = &destination
+			},
+		},
+		{
+			name:     "Another metadata",
+			sequence: 3,
+			previous: "abc",
+			change:   func(transfer *model.Transfer) { transfer.Metadata = model.JSON(`{"order": 43, "tags": ["a", "b"]}`) },
+		},
+		{
+			name:     "A leg",
+			sequence: 3,
+			previous: "abc",
+			change: func(transfer *model.Transfer) {
+				transfer.Legs = []model.TransferLeg{{AccountID: 1, Amount: decimal.NewFromInt(-1), BalanceAfter: decimal.Zero}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transfer := testTransfer()
+			if tt.change != nil {
+				tt.change(transfer)
+			}
+			changedHash, err := Hash(tt.sequence, tt.previous, transfer)
+			require.NoError(t, err)
+			assert.NotEqual(t, hash, changedHash)
+		})
+	}
+}
+
+func TestHashInvalidMetadata(t *testing.T) {
+	transfer := testTransfer()
+	transfer.Metadata = model.JSON(`{"order":`)
+	_, err := Hash(1, "", transfer)
+	assert.Error(t, err)
+}
@@ -1,10 +1,52 @@
 package validator
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/shopspring/decimal"
 	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/currency"
+	"internal-transfers-system/internal/model"
 	"internal-transfers-system/internal/svrerror"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+
+	maxReferenceLength   = 140
+	maxDescriptionLength = 500
+	maxExternalIDLength  = 255
+	maxMetadataSize      = 4096
+
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+
+	defaultHoldTTL = 7 * 24 * time.Hour
+	maxHoldTTL     = 30 * 24 * time.Hour
+
+	defaultFXQuoteTTL = 30 * time.Second
+	maxFXQuoteTTL     = 10 * time.Minute
+
+	maxStatusReasonLength = 500
+
+	maxStandingOrderRetryCount = 10
+
+	maxTransferLegs = 50
+
+	maxFeeTiers = 20
+
+	maxStatementPeriod = 366 * 24 * time.Hour
+
+	maxWebhookURLLength    = 2048
+	minWebhookSecretLength = 16
 )
 
 func ValidateCreateAccount(account *apimodel.CreateAccountRequest) (decimal.Decimal, error) {
@@ -23,6 +65,10 @@ func ValidateCreateAccount(account *apimodel.CreateAccountRequest) (decimal.Deci
 		return decimal.Zero, svrerror.New("initial balance must be non-negative", fiber.StatusBadRequest)
 	}
 
+	if err := validateCurrencyAmount(account.Currency, initialBalance, "initial balance"); err != nil {
+		return decimal.Zero, err
+	}
+
 	return initialBalance, nil
 }
 
@@ -41,5 +87,885 @@ func ValidateTransfer(transfer *apimodel.TransferRequest) (decimal.Decimal, erro
 		return decimal.Zero, svrerror.New("source and destination accounts must be different", fiber.StatusBadRequest)
 	}
 
+	if err := validateCurrencyAmount(transfer.Currency, amount, "amount"); err != nil {
+		return decimal.Zero, err
+	}
+
+	if len(transfer.IdempotencyKey) > maxIdempotencyKeyLength {
+		return decimal.Zero, svrerror.New("idempotency key must be at most 255 characters", fiber.StatusBadRequest)
+	}
+
+	if err := validateTransferDetails(transfer); err != nil {
+		return decimal.Zero, err
+	}
+
 	return amount, nil
 }
+
+// validateTransferDetails checks the details a client keeps with a transfer. The metadata is compacted, so that it is
+// stored and fingerprinted the same way whatever its formatting.
+func validateTransferDetails(transfer *apimodel.TransferRequest) error {
+	if utf8.RuneCountInString(transfer.Reference) > maxReferenceLength {
+		return svrerror.New(fmt.Sprintf("reference must be at most %d characters", maxReferenceLength), fiber.StatusBadRequest)
+	}
+	if utf8.RuneCountInString(transfer.Description) > maxDescriptionLength {
+		return svrerror.New(fmt.Sprintf("description must be at most %d characters", maxDescriptionLength), fiber.StatusBadRequest)
+	}
+	if len(transfer.ExternalID) > maxExternalIDLength {
+		return svrerror.New(fmt.Sprintf("external id must be at most %d characters", maxExternalIDLength), fiber.StatusBadRequest)
+	}
+
+	if len(transfer.Metadata) == 0 {
+		return nil
+	}
+	var metadata bytes.Buffer
+	if err := json.Compact(&metadata, transfer.Metadata); err != nil {
+		return svrerror.New("metadata must be valid JSON", fiber.StatusBadRequest)
+	}
+	switch {
+	case metadata.String() == "null":
+		transfer.Metadata = nil
+		return nil
+	case metadata.Bytes()[0] != '{':
+		return svrerror.New("metadata must be a JSON object", fiber.StatusBadRequest)
+	case metadata.Len() > maxMetadataSize:
+		return svrerror.New(fmt.Sprintf("metadata must be at most %d bytes", maxMetadataSize), fiber.StatusBadRequest)
+	case bytes.Contains(metadata.Bytes(), []byte(`\u0000`)):
+		// Postgres cannot store null characters in jsonb
+		return svrerror.New("metadata must not contain null characters", fiber.StatusBadRequest)
+	}
+	transfer.Metadata = metadata.Bytes()
+	return nil
+}
+
+// ValidateMultiLegTransfer checks every leg of a multi-leg transfer and that the legs balance exactly.
+func ValidateMultiLegTransfer(request *apimodel.MultiLegTransferRequest) (apimodel.MultiLegTransfer, error) {
+	transfer := apimodel.MultiLegTransfer{Currency: request.Currency, IdempotencyKey: request.IdempotencyKey}
+
+	if !currency.IsValid(request.Currency) {
+		return transfer, svrerror.New("currency must be a supported ISO 4217 code", fiber.StatusBadRequest)
+	}
+	if len(request.Sources) == 0 || len(request.Destinations) == 0 {
+		return transfer, svrerror.New("a multi-leg transfer needs at least one source and one destination", fiber.StatusBadRequest)
+	}
+	if len(request.Sources)+len(request.Destinations) > maxTransferLegs {
+		return transfer, svrerror.New(fmt.Sprintf("a multi-leg transfer can have at most %d legs", maxTransferLegs), fiber.StatusBadRequest)
+	}
+	if len(request.IdempotencyKey) > maxIdempotencyKeyLength {
+		return transfer, svrerror.New("idempotency key must be at most 255 characters", fiber.StatusBadRequest)
+	}
+
+	seen := make(map[uint64]bool)
+	parseLegs := func(legs []apimodel.TransferLegRequest, name string) ([]apimodel.TransferLeg, decimal.Decimal, error) {
+		parsed := make([]apimodel.TransferLeg, 0, len(legs))
+		total := decimal.Zero
+		for i, leg := range legs {
+			if leg.AccountID < 1 {
+				return nil, total, svrerror.New(fmt.Sprintf("%s[%d]: account id must be greater than 0", name, i), fiber.StatusBadRequest)
+			}
+			if seen[leg.AccountID] {
+				return nil, total, svrerror.New(fmt.Sprintf("%s[%d]: account %d is in more than one leg", name, i, leg.AccountID), fiber.StatusBadRequest)
+			}
+			seen[leg.AccountID] = true
+
+			amount, err := decimal.NewFromString(leg.Amount)
+			if err != nil {
+				return nil, total, svrerror.New(fmt.Sprintf("%s[%d]: invalid amount format", name, i), fiber.StatusBadRequest)
+			}
+			if amount.LessThanOrEqual(decimal.Zero) {
+				return nil, total, svrerror.New(fmt.Sprintf("%s[%d]: amount must be greater than zero", name, i), fiber.StatusBadRequest)
+			}
+			if err := validateCurrencyAmount(request.Currency, amount, fmt.Sprintf("%s[%d] amount", name, i)); err != nil {
+				return nil, total, err
+			}
+
+			parsed = append(parsed, apimodel.TransferLeg{AccountID: leg.AccountID, Amount: amount})
+			total = total.Add(amount)
+		}
+		return parsed, total, nil
+	}
+
+	sources, debited, err := parseLegs(request.Sources, "sources")
+	if err != nil {
+		return transfer, err
+	}
+	destinations, credited, err := parseLegs(request.Destinations, "destinations")
+	if err != nil {
+		return transfer, err
+	}
+	if !debited.Equal(credited) {
+		return transfer, svrerror.New(fmt.Sprintf("legs do not balance: sources add up to %s and destinations to %s", debited, credited), fiber.StatusBadRequest)
+	}
+
+	transfer.Sources, transfer.Destinations = sources, destinations
+	return transfer, nil
+}
+
+// ValidateBatchTransfer validates the mode of a batch and each of its transfers. An invalid transfer does not fail
+// the validation, but is returned with its error: it rejects an atomic batch as a whole, while the rest of a
+// best-effort batch goes ahead without it. A batch may have at most maxSize transfers.
+func ValidateBatchTransfer(request *apimodel.BatchTransferRequest, maxSize int) ([]apimodel.BatchItem, error) {
+	if request.Mode != model.TransferBatchModeAtomic && request.Mode != model.TransferBatchModeBestEffort {
+		return nil, svrerror.New("mode must be either atomic or best_effort", fiber.StatusBadRequest)
+	}
+	if len(request.Transfers) == 0 || len(request.Transfers) > maxSize {
+		return nil, svrerror.New(fmt.Sprintf("a batch must have between 1 and %d transfers", maxSize), fiber.StatusBadRequest)
+	}
+
+	items := make([]apimodel.BatchItem, len(request.Transfers))
+	for i := range request.Transfers {
+		amount, err := ValidateTransfer(&request.Transfers[i])
+		items[i] = apimodel.BatchItem{Transfer: request.Transfers[i], Amount: amount, Err: err}
+	}
+	return items, nil
+}
+
+// validateCurrencyAmount checks that the currency is a supported ISO 4217 code and that the amount does not have
+// more decimal places than the currency's minor unit. name is used in the error message, e.g. "amount".
+func validateCurrencyAmount(code string, amount decimal.Decimal, name string) error {
+	if !currency.IsValid(code) {
+		return svrerror.New("currency must be a supported ISO 4217 code", fiber.StatusBadRequest)
+	}
+	if !currency.FitsMinorUnits(code, amount) {
+		units, _ := currency.MinorUnits(code)
+		return svrerror.New(fmt.Sprintf("%s must have at most %d decimal places for %s", name, units, code), fiber.StatusBadRequest)
+	}
+	return nil
+}
+
+// ParseID parses a numeric ID from a path parameter. name is used in the error message, e.g. "transfer".
+func ParseID(value string, name string) (uint64, error) {
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || id == 0 {
+		return 0, svrerror.New(fmt.Sprintf("invalid %s id", name), fiber.StatusBadRequest)
+	}
+	return id, nil
+}
+
+// ValidateEventStreamAccount parses the account filter of an event stream. An empty value streams every event.
+func ValidateEventStreamAccount(value string) (apimodel.EventStreamFilter, error) {
+	if value == "" {
+		return apimodel.EventStreamFilter{}, nil
+	}
+	accountID, err := ParseID(value, "account")
+	if err != nil {
+		return apimodel.EventStreamFilter{}, err
+	}
+	return apimodel.EventStreamFilter{AccountID: accountID}, nil
+}
+
+// ValidateLastEventID parses the Last-Event-ID header of an event stream, the sequence number of the last event the
+// client received. Without it, resume is false and the stream only carries events from now on.
+func ValidateLastEventID(value string) (after uint64, resume bool, err error) {
+	if value == "" {
+		return 0, false, nil
+	}
+	after, err = strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false, svrerror.New("Last-Event-ID must be the id of an event", fiber.StatusBadRequest)
+	}
+	return after, true, nil
+}
+
+// ValidateBalanceAsOf parses the point in time of a balance query. An empty value is the current time, and the
+// future is rejected since its balance is not known yet.
+func ValidateBalanceAsOf(value string) (time.Time, error) {
+	now := time.Now()
+	if value == "" {
+		return now, nil
+	}
+
+	asOf, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, svrerror.New("as_of must be an RFC 3339 timestamp", fiber.StatusBadRequest)
+	}
+	if asOf.After(now) {
+		return time.Time{}, svrerror.New("as_of must not be in the future", fiber.StatusBadRequest)
+	}
+	return asOf, nil
+}
+
+// ValidateStatement parses the period and format of an account statement. The period runs from from up to, but not
+// including, to. Both are RFC 3339 timestamps or dates, which stand for midnight UTC, and the format defaults to JSON.
+func ValidateStatement(query *apimodel.StatementQuery) (time.Time, time.Time, string, error) {
+	from, err := parseStatementTime(query.From, "from")
+	if err != nil {
+		return time.Time{}, time.Time{}, "", err
+	}
+	to, err := parseStatementTime(query.To, "to")
+	if err != nil {
+		return time.Time{}, time.Time{}, "", err
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, "", svrerror.New("from must be before to", fiber.StatusBadRequest)
+	}
+	if to.Sub(from) > maxStatementPeriod {
+		return time.Time{}, time.Time{}, "", svrerror.New("a statement can cover at most 366 days", fiber.StatusBadRequest)
+	}
+
+	switch query.Format {
+	case "":
+		return from, to, apimodel.StatementFormatJSON, nil
+	case apimodel.StatementFormatJSON, apimodel.StatementFormatCSV, apimodel.StatementFormatPDF, apimodel.StatementFormatCamt053:
+		return from, to, query.Format, nil
+	}
+	return time.Time{}, time.Time{}, "", svrerror.New("format must be one of json, csv, pdf or camt053", fiber.StatusBadRequest)
+}
+
+func parseStatementTime(value, name string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, svrerror.New(name+" is required", fiber.StatusBadRequest)
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, svrerror.New(name+" must be a date or an RFC 3339 timestamp", fiber.StatusBadRequest)
+	}
+	return t, nil
+}
+
+func ValidateListTransfers(accountID uint64, query *apimodel.ListTransfersQuery) (apimodel.TransferFilter, error) {
+	filter := apimodel.TransferFilter{AccountID: accountID}
+
+	switch query.Direction {
+	case "", apimodel.DirectionIn, apimodel.DirectionOut:
+		filter.Direction = query.Direction
+	default:
+		return filter, svrerror.New("direction must be either in or out", fiber.StatusBadRequest)
+	}
+
+	if query.MinAmount != "" {
+		minAmount, err := decimal.NewFromString(query.MinAmount)
+		if err != nil {
+			return filter, svrerror.New("invalid min_amount format", fiber.StatusBadRequest)
+		}
+		filter.MinAmount = &minAmount
+	}
+	if query.MaxAmount != "" {
+		maxAmount, err := decimal.NewFromString(query.MaxAmount)
+		if err != nil {
+			return filter, svrerror.New("invalid max_amount format", fiber.StatusBadRequest)
+		}
+		filter.MaxAmount = &maxAmount
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && filter.MinAmount.GreaterThan(*filter.MaxAmount) {
+		return filter, svrerror.New("min_amount must not be greater than max_amount", fiber.StatusBadRequest)
+	}
+
+	if query.CreatedFrom != "" {
+		createdFrom, err := time.Parse(time.RFC3339, query.CreatedFrom)
+		if err != nil {
+			return filter, svrerror.New("created_from must be an RFC 3339 timestamp", fiber.StatusBadRequest)
+		}
+		filter.CreatedFrom = &createdFrom
+	}
+	if query.CreatedTo != "" {
+		createdTo, err := time.Parse(time.RFC3339, query.CreatedTo)
+		if err != nil {
+			return filter, svrerror.New("created_to must be an RFC 3339 timestamp", fiber.StatusBadRequest)
+		}
+		filter.CreatedTo = &createdTo
+	}
+
+	filter.Reference, filter.ExternalID, filter.Description = query.Reference, query.ExternalID, query.Description
+	if query.Metadata != "" {
+		var metadata map[string]interface{}
+		if err := json.Unmarshal([]byte(query.Metadata), &metadata); err != nil || metadata == nil {
+			return filter, svrerror.New("metadata must be a JSON object", fiber.StatusBadRequest)
+		}
+		filter.Metadata = query.Metadata
+	}
+
+	cursor, limit, err := validatePage(query.Cursor, query.Limit)
+	if err != nil {
+		return filter, err
+	}
+	filter.Cursor, filter.Limit = cursor, limit
+
+	return filter, nil
+}
+
+// validatePage parses the cursor and page size of a listing with keyset pagination.
+func validatePage(cursorValue string, limit int) (uint64, int, error) {
+	var cursor uint64
+	if cursorValue != "" {
+		var err error
+		if cursor, err = strconv.ParseUint(cursorValue, 10, 64); err != nil {
+			return 0, 0, svrerror.New("invalid cursor", fiber.StatusBadRequest)
+		}
+	}
+
+	switch {
+	case limit == 0:
+		return cursor, defaultPageLimit, nil
+	case limit < 0 || limit > maxPageLimit:
+		return 0, 0, svrerror.New(fmt.Sprintf("limit must be between 1 and %d", maxPageLimit), fiber.StatusBadRequest)
+	}
+	return cursor, limit, nil
+}
+
+func ValidateCreateHold(hold *apimodel.CreateHoldRequest) (decimal.Decimal, time.Duration, error) {
+	amount, err := decimal.NewFromString(hold.Amount)
+	if err != nil {
+		return decimal.Zero, 0, svrerror.New("invalid amount format", fiber.StatusBadRequest)
+	}
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return decimal.Zero, 0, svrerror.New("amount must be greater than zero", fiber.StatusBadRequest)
+	}
+
+	if hold.AccountID == hold.DestinationAccountID {
+		return decimal.Zero, 0, svrerror.New("source and destination accounts must be different", fiber.StatusBadRequest)
+	}
+
+	if err := validateCurrencyAmount(hold.Currency, amount, "amount"); err != nil {
+		return decimal.Zero, 0, err
+	}
+
+	switch {
+	case hold.ExpiresInSeconds == 0:
+		return amount, defaultHoldTTL, nil
+	case hold.ExpiresInSeconds < 0 || hold.ExpiresInSeconds > int64(maxHoldTTL/time.Second):
+		return decimal.Zero, 0, svrerror.New(fmt.Sprintf("expires_in_seconds must be between 1 and %d", int64(maxHoldTTL/time.Second)), fiber.StatusBadRequest)
+	}
+
+	return amount, time.Duration(hold.ExpiresInSeconds) * time.Second, nil
+}
+
+func ValidateCaptureHold(capture *apimodel.CaptureHoldRequest) (decimal.NullDecimal, error) {
+	return validateOptionalAmount(capture.Amount)
+}
+
+func ValidateReverseTransfer(reversal *apimodel.ReverseTransferRequest) (decimal.NullDecimal, error) {
+	return validateOptionalAmount(reversal.Amount)
+}
+
+// validateOptionalAmount parses an amount that defaults to a server side value when left empty.
+func validateOptionalAmount(value string) (decimal.NullDecimal, error) {
+	if value == "" {
+		return decimal.NullDecimal{}, nil
+	}
+
+	amount, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.NullDecimal{}, svrerror.New("invalid amount format", fiber.StatusBadRequest)
+	}
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return decimal.NullDecimal{}, svrerror.New("amount must be greater than zero", fiber.StatusBadRequest)
+	}
+
+	return decimal.NewNullDecimal(amount), nil
+}
+
+func ValidateSetFXRates(request *apimodel.SetFXRatesRequest) ([]model.FXRate, error) {
+	if len(request.Rates) == 0 {
+		return nil, svrerror.New("at least one rate is required", fiber.StatusBadRequest)
+	}
+
+	rates := make([]model.FXRate, 0, len(request.Rates))
+	for _, rate := range request.Rates {
+		if !currency.IsValid(rate.BaseCurrency) || !currency.IsValid(rate.QuoteCurrency) {
+			return nil, svrerror.New("currency must be a supported ISO 4217 code", fiber.StatusBadRequest)
+		}
+		if rate.BaseCurrency == rate.QuoteCurrency {
+			return nil, svrerror.New("base and quote currencies must be different", fiber.StatusBadRequest)
+		}
+
+		value, err := decimal.NewFromString(rate.Rate)
+		if err != nil {
+			return nil, svrerror.New("invalid rate format", fiber.StatusBadRequest)
+		}
+		if value.LessThanOrEqual(decimal.Zero) {
+			return nil, svrerror.New("rate must be greater than zero", fiber.StatusBadRequest)
+		}
+
+		rates = append(rates, model.FXRate{
+			BaseCurrency:  rate.BaseCurrency,
+			QuoteCurrency: rate.QuoteCurrency,
+			Rate:          value,
+		})
+	}
+	return rates, nil
+}
+
+func ValidateCreateFXQuote(quote *apimodel.CreateFXQuoteRequest) (decimal.Decimal, time.Duration, error) {
+	amount, err := decimal.NewFromString(quote.SourceAmount)
+	if err != nil {
+		return decimal.Zero, 0, svrerror.New("invalid source amount format", fiber.StatusBadRequest)
+	}
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return decimal.Zero, 0, svrerror.New("source amount must be greater than zero", fiber.StatusBadRequest)
+	}
+
+	if err := validateCurrencyAmount(quote.SourceCurrency, amount, "source amount"); err != nil {
+		return decimal.Zero, 0, err
+	}
+	if !currency.IsValid(quote.DestinationCurrency) {
+		return decimal.Zero, 0, svrerror.New("currency must be a supported ISO 4217 code", fiber.StatusBadRequest)
+	}
+	if quote.SourceCurrency == quote.DestinationCurrency {
+		return decimal.Zero, 0, svrerror.New("source and destination currencies must be different", fiber.StatusBadRequest)
+	}
+
+	switch {
+	case quote.ExpiresInSeconds == 0:
+		return amount, defaultFXQuoteTTL, nil
+	case quote.ExpiresInSeconds < 0 || quote.ExpiresInSeconds > int64(maxFXQuoteTTL/time.Second):
+		return decimal.Zero, 0, svrerror.New(fmt.Sprintf("expires_in_seconds must be between 1 and %d", int64(maxFXQuoteTTL/time.Second)), fiber.StatusBadRequest)
+	}
+
+	return amount, time.Duration(quote.ExpiresInSeconds) * time.Second, nil
+}
+
+// ValidateSetFeeSchedules checks that every schedule is complete for its type and does not set the fields of other
+// types. Fee amounts must fit the minor unit of the schedule's currency.
+func ValidateSetFeeSchedules(request *apimodel.SetFeeSchedulesRequest) ([]model.FeeSchedule, error) {
+	if len(request.Schedules) == 0 {
+		return nil, svrerror.New("at least one schedule is required", fiber.StatusBadRequest)
+	}
+
+	seen := make(map[string]bool)
+	schedules := make([]model.FeeSchedule, 0, len(request.Schedules))
+	for i := range request.Schedules {
+		schedule, err := validateFeeSchedule(&request.Schedules[i])
+		if err != nil {
+			// Only svrerror.Error is returned, see validateFeeSchedule
+			if customErr, ok := err.(*svrerror.Error); ok {
+				customErr.Message = fmt.Sprintf("schedules[%d]: %s", i, customErr.Message)
+			}
+			return nil, err
+		}
+
+		key := schedule.TransferType + "/" + schedule.Currency
+		if seen[key] {
+			return nil, svrerror.New(fmt.Sprintf("schedules[%d]: %s %s fees are set more than once", i, schedule.Currency, schedule.TransferType), fiber.StatusBadRequest)
+		}
+		seen[key] = true
+
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
+
+func validateFeeSchedule(request *apimodel.FeeScheduleRequest) (model.FeeSchedule, error) {
+	schedule := model.FeeSchedule{
+		TransferType:     request.TransferType,
+		Currency:         request.Currency,
+		Type:             request.Type,
+		RevenueAccountID: request.RevenueAccountID,
+	}
+
+	if err := validateFeeTransferType(request.TransferType); err != nil {
+		return schedule, err
+	}
+	if !currency.IsValid(request.Currency) {
+		return schedule, svrerror.New("currency must be a supported ISO 4217 code", fiber.StatusBadRequest)
+	}
+	if request.RevenueAccountID < 1 {
+		return schedule, svrerror.New("revenue account id must be greater than 0", fiber.StatusBadRequest)
+	}
+
+	var err error
+	switch request.Type {
+	case model.FeeTypeFlat:
+		if request.Percentage != "" || request.MinAmount != "" || request.MaxAmount != "" || len(request.Tiers) > 0 {
+			return schedule, svrerror.New("flat fees only take a flat_amount", fiber.StatusBadRequest)
+		}
+		if schedule.FlatAmount, err = parseFeeAmount(request.FlatAmount, request.Currency, "flat_amount"); err != nil {
+			return schedule, err
+		}
+		if !schedule.FlatAmount.Valid || schedule.FlatAmount.Decimal.IsZero() {
+			return schedule, svrerror.New("flat_amount must be greater than zero", fiber.StatusBadRequest)
+		}
+
+	case model.FeeTypePercentage:
+		if request.FlatAmount != "" || len(request.Tiers) > 0 {
+			return schedule, svrerror.New("percentage fees only take a percentage, min_amount and max_amount", fiber.StatusBadRequest)
+		}
+		percentage, err := decimal.NewFromString(request.Percentage)
+		if err != nil {
+			return schedule, svrerror.New("invalid percentage format", fiber.StatusBadRequest)
+		}
+		if percentage.LessThanOrEqual(decimal.Zero) || percentage.GreaterThan(decimal.NewFromInt(100)) {
+			return schedule, svrerror.New("percentage must be greater than 0 and at most 100", fiber.StatusBadRequest)
+		}
+		schedule.Percentage = decimal.NewNullDecimal(percentage)
+
+		if schedule.MinAmount, err = parseFeeAmount(request.MinAmount, request.Currency, "min_amount"); err != nil {
+			return schedule, err
+		}
+		if schedule.MaxAmount, err = parseFeeAmount(request.MaxAmount, request.Currency, "max_amount"); err != nil {
+			return schedule, err
+		}
+		if schedule.MinAmount.Valid && schedule.MaxAmount.Valid && schedule.MinAmount.Decimal.GreaterThan(schedule.MaxAmount.Decimal) {
+			return schedule, svrerror.New("min_amount must not be greater than max_amount", fiber.StatusBadRequest)
+		}
+
+	case model.FeeTypeTiered:
+		if request.FlatAmount != "" || request.Percentage != "" || request.MinAmount != "" || request.MaxAmount != "" {
+			return schedule, svrerror.New("tiered fees only take tiers", fiber.StatusBadRequest)
+		}
+		if schedule.Tiers, err = validateFeeTiers(request.Tiers, request.Currency); err != nil {
+			return schedule, err
+		}
+
+	default:
+		return schedule, svrerror.New("type must be one of flat, percentage or tiered", fiber.StatusBadRequest)
+	}
+
+	return schedule, nil
+}
+
+// validateFeeTiers checks that the tiers are in ascending order of their upper bound and that only the last tier is
+// unbounded, so that every amount falls into exactly one tier.
+func validateFeeTiers(requests []apimodel.FeeTierRequest, code string) (model.FeeTiers, error) {
+	if len(requests) == 0 || len(requests) > maxFeeTiers {
+		return nil, svrerror.New(fmt.Sprintf("tiered fees must have between 1 and %d tiers", maxFeeTiers), fiber.StatusBadRequest)
+	}
+
+	tiers := make(model.FeeTiers, 0, len(requests))
+	for i, request := range requests {
+		amount, err := parseFeeAmount(request.Amount, code, fmt.Sprintf("tiers[%d] amount", i))
+		if err != nil {
+			return nil, err
+		}
+		if !amount.Valid {
+			return nil, svrerror.New(fmt.Sprintf("tiers[%d]: amount is required", i), fiber.StatusBadRequest)
+		}
+		tier := model.FeeTier{Amount: amount.Decimal}
+
+		last := i == len(requests)-1
+		switch {
+		case last && request.UpTo != "":
+			return nil, svrerror.New("the last tier must not have an up_to amount", fiber.StatusBadRequest)
+		case !last && request.UpTo == "":
+			return nil, svrerror.New(fmt.Sprintf("tiers[%d]: up_to is required on every tier but the last", i), fiber.StatusBadRequest)
+		case !last:
+			upTo, err := decimal.NewFromString(request.UpTo)
+			if err != nil {
+				return nil, svrerror.New(fmt.Sprintf("tiers[%d]: invalid up_to format", i), fiber.StatusBadRequest)
+			}
+			if upTo.LessThanOrEqual(decimal.Zero) {
+				return nil, svrerror.New(fmt.Sprintf("tiers[%d]: up_to must be greater than zero", i), fiber.StatusBadRequest)
+			}
+			if i > 0 && upTo.LessThanOrEqual(tiers[i-1].UpTo.Decimal) {
+				return nil, svrerror.New(fmt.Sprintf("tiers[%d]: up_to must be greater than the up_to of the tier before", i), fiber.StatusBadRequest)
+			}
+			tier.UpTo = decimal.NewNullDecimal(upTo)
+		}
+
+		tiers = append(tiers, tier)
+	}
+	return tiers, nil
+}
+
+// parseFeeAmount parses an optional, non-negative fee amount in the given currency. name is used in the error
+// message, e.g. "min_amount".
+func parseFeeAmount(value, code, name string) (decimal.NullDecimal, error) {
+	if value == "" {
+		return decimal.NullDecimal{}, nil
+	}
+
+	amount, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.NullDecimal{}, svrerror.New(fmt.Sprintf("invalid %s format", name), fiber.StatusBadRequest)
+	}
+	if amount.IsNegative() {
+		return decimal.NullDecimal{}, svrerror.New(fmt.Sprintf("%s must not be negative", name), fiber.StatusBadRequest)
+	}
+	if err := validateCurrencyAmount(code, amount, name); err != nil {
+		return decimal.NullDecimal{}, err
+	}
+	return decimal.NewNullDecimal(amount), nil
+}
+
+func validateFeeTransferType(transferType string) error {
+	if transferType != model.FeeTransferTypeStandard && transferType != model.FeeTransferTypeCrossCurrency {
+		return svrerror.New("transfer type must be either standard or cross_currency", fiber.StatusBadRequest)
+	}
+	return nil
+}
+
+// ValidateFeeQuote checks the query of a fee quote and returns the amount. The transfer type defaults to standard.
+func ValidateFeeQuote(query *apimodel.FeeQuoteQuery) (decimal.Decimal, error) {
+	if query.TransferType == "" {
+		query.TransferType = model.FeeTransferTypeStandard
+	}
+	if err := validateFeeTransferType(query.TransferType); err != nil {
+		return decimal.Zero, err
+	}
+
+	amount, err := decimal.NewFromString(query.Amount)
+	if err != nil {
+		return decimal.Zero, svrerror.New("invalid amount format", fiber.StatusBadRequest)
+	}
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return decimal.Zero, svrerror.New("amount must be greater than zero", fiber.StatusBadRequest)
+	}
+	if err := validateCurrencyAmount(query.Currency, amount, "amount"); err != nil {
+		return decimal.Zero, err
+	}
+	return amount, nil
+}
+
+func ValidateChangeAccountStatus(request *apimodel.ChangeAccountStatusRequest) error {
+	switch request.Status {
+	case model.AccountStatusActive, model.AccountStatusFrozen, model.AccountStatusClosed:
+	default:
+		return svrerror.New("status must be one of active, frozen or closed", fiber.StatusBadRequest)
+	}
+
+	if strings.TrimSpace(request.Reason) == "" {
+		return svrerror.New("reason is required", fiber.StatusBadRequest)
+	}
+	if len(request.Reason) > maxStatusReasonLength {
+		return svrerror.New(fmt.Sprintf("reason must be at most %d characters", maxStatusReasonLength), fiber.StatusBadRequest)
+	}
+	return nil
+}
+
+func ValidateSetOverdraftLimit(request *apimodel.SetOverdraftLimitRequest) (decimal.Decimal, error) {
+	limit, err := decimal.NewFromString(request.OverdraftLimit)
+	if err != nil {
+		return decimal.Zero, svrerror.New("invalid overdraft limit format", fiber.StatusBadRequest)
+	}
+	if limit.IsNegative() {
+		return decimal.Zero, svrerror.New("overdraft limit must be non-negative", fiber.StatusBadRequest)
+	}
+	return limit, nil
+}
+
+func ValidateSetAccountLimits(accountID uint64, request *apimodel.AccountLimitsRequest) (model.AccountLimits, error) {
+	limits := model.AccountLimits{AccountID: accountID, HourlyCount: request.HourlyCount}
+
+	for _, field := range []struct {
+		name  string
+		value string
+		limit *decimal.NullDecimal
+	}{
+		{"max_transfer_amount", request.MaxTransferAmount, &limits.MaxTransferAmount},
+		{"daily_amount", request.DailyAmount, &limits.DailyAmount},
+		{"rolling_30_day_amount", request.Rolling30DayAmount, &limits.Rolling30DayAmount},
+	} {
+		if field.value == "" {
+			continue
+		}
+		amount, err := decimal.NewFromString(field.value)
+		if err != nil {
+			return limits, svrerror.New(fmt.Sprintf("invalid %s format", field.name), fiber.StatusBadRequest)
+		}
+		if !amount.IsPositive() {
+			return limits, svrerror.New(fmt.Sprintf("%s must be greater than zero", field.name), fiber.StatusBadRequest)
+		}
+		*field.limit = decimal.NewNullDecimal(amount)
+	}
+
+	if request.HourlyCount != nil && *request.HourlyCount < 1 {
+		return limits, svrerror.New("hourly_count must be greater than zero", fiber.StatusBadRequest)
+	}
+	return limits, nil
+}
+
+func ValidateCreateScheduledTransfer(request *apimodel.CreateScheduledTransferRequest) (decimal.Decimal, time.Time, error) {
+	amount, err := ValidateTransfer(&apimodel.TransferRequest{
+		SourceAccountID:      request.SourceAccountID,
+		DestinationAccountID: request.DestinationAccountID,
+		Amount:               request.Amount,
+		Currency:             request.Currency,
+	})
+	if err != nil {
+		return decimal.Zero, time.Time{}, err
+	}
+
+	executeAt, err := time.Parse(time.RFC3339, request.ExecuteAt)
+	if err != nil {
+		return decimal.Zero, time.Time{}, svrerror.New("execute_at must be an RFC 3339 timestamp", fiber.StatusBadRequest)
+	}
+	if !executeAt.After(time.Now()) {
+		return decimal.Zero, time.Time{}, svrerror.New("execute_at must be in the future", fiber.StatusBadRequest)
+	}
+
+	return amount, executeAt, nil
+}
+
+func ValidateListScheduledTransfers(query *apimodel.ListScheduledTransfersQuery) (apimodel.ScheduledTransferFilter, error) {
+	filter := apimodel.ScheduledTransferFilter{AccountID: query.AccountID}
+
+	switch query.Status {
+	case "", model.ScheduledTransferStatusPending, model.ScheduledTransferStatusCompleted,
+		model.ScheduledTransferStatusFailed, model.ScheduledTransferStatusCancelled:
+		filter.Status = query.Status
+	default:
+		return filter, svrerror.New("status must be one of pending, completed, failed or cancelled", fiber.StatusBadRequest)
+	}
+
+	cursor, limit, err := validatePage(query.Cursor, query.Limit)
+	if err != nil {
+		return filter, err
+	}
+	filter.Cursor, filter.Limit = cursor, limit
+
+	return filter, nil
+}
+
+func ValidateCreateStandingOrder(request *apimodel.CreateStandingOrderRequest) (model.StandingOrder, error) {
+	amount, err := ValidateTransfer(&apimodel.TransferRequest{
+		SourceAccountID:      request.SourceAccountID,
+		DestinationAccountID: request.DestinationAccountID,
+		Amount:               request.Amount,
+		Currency:             request.Currency,
+	})
+	if err != nil {
+		return model.StandingOrder{}, err
+	}
+
+	order := model.StandingOrder{
+		SourceAccountID:      request.SourceAccountID,
+		DestinationAccountID: request.DestinationAccountID,
+		Amount:               amount,
+		Currency:             request.Currency,
+		Frequency:            request.Frequency,
+		MaxOccurrences:       request.MaxOccurrences,
+		OnInsufficientFunds:  request.OnInsufficientFunds,
+		RetryCount:           request.RetryCount,
+		MissedOccurrences:    request.MissedOccurrences,
+	}
+
+	switch request.Frequency {
+	case model.StandingOrderFrequencyWeekly, model.StandingOrderFrequencyMonthly:
+		if request.CronExpression != "" {
+			return order, svrerror.New("cron_expression is only allowed with the cron frequency", fiber.StatusBadRequest)
+		}
+	case model.StandingOrderFrequencyCron:
+		// The expression itself is parsed by the service when the order is created
+		if request.CronExpression == "" {
+			return order, svrerror.New("cron_expression is required with the cron frequency", fiber.StatusBadRequest)
+		}
+		order.CronExpression = request.CronExpression
+	default:
+		return order, svrerror.New("frequency must be one of weekly, monthly or cron", fiber.StatusBadRequest)
+	}
+
+	startAt, err := time.Parse(time.RFC3339, request.StartAt)
+	if err != nil {
+		return order, svrerror.New("start_at must be an RFC 3339 timestamp", fiber.StatusBadRequest)
+	}
+	if !startAt.After(time.Now()) {
+		return order, svrerror.New("start_at must be in the future", fiber.StatusBadRequest)
+	}
+	order.StartAt = startAt.UTC()
+
+	if request.EndAt != "" {
+		endAt, err := time.Parse(time.RFC3339, request.EndAt)
+		if err != nil {
+			return order, svrerror.New("end_at must be an RFC 3339 timestamp", fiber.StatusBadRequest)
+		}
+		if !endAt.After(startAt) {
+			return order, svrerror.New("end_at must be after start_at", fiber.StatusBadRequest)
+		}
+		endAt = endAt.UTC()
+		order.EndAt = &endAt
+	}
+
+	if request.MaxOccurrences != nil && *request.MaxOccurrences <= 0 {
+		return order, svrerror.New("max_occurrences must be greater than zero", fiber.StatusBadRequest)
+	}
+
+	switch request.OnInsufficientFunds {
+	case "":
+		order.OnInsufficientFunds = model.InsufficientFundsSkip
+	case model.InsufficientFundsSkip, model.InsufficientFundsRetry, model.InsufficientFundsSuspend:
+	default:
+		return order, svrerror.New("on_insufficient_funds must be one of skip, retry or suspend", fiber.StatusBadRequest)
+	}
+	if order.OnInsufficientFunds == model.InsufficientFundsRetry {
+		if request.RetryCount < 1 || request.RetryCount > maxStandingOrderRetryCount {
+			return order, svrerror.New(fmt.Sprintf("retry_count must be between 1 and %d", maxStandingOrderRetryCount), fiber.StatusBadRequest)
+		}
+	} else if request.RetryCount != 0 {
+		return order, svrerror.New("retry_count is only allowed when on_insufficient_funds is retry", fiber.StatusBadRequest)
+	}
+
+	switch request.MissedOccurrences {
+	case "":
+		order.MissedOccurrences = model.MissedOccurrencesSkip
+	case model.MissedOccurrencesSkip, model.MissedOccurrencesCatchUp:
+	default:
+		return order, svrerror.New("missed_occurrences must be one of skip or catch_up", fiber.StatusBadRequest)
+	}
+
+	return order, nil
+}
+
+func ValidateListStandingOrders(query *apimodel.ListStandingOrdersQuery) (apimodel.StandingOrderFilter, error) {
+	filter := apimodel.StandingOrderFilter{AccountID: query.AccountID}
+
+	switch query.Status {
+	case "", model.StandingOrderStatusActive, model.StandingOrderStatusSuspended,
+		model.StandingOrderStatusCompleted, model.StandingOrderStatusCancelled:
+		filter.Status = query.Status
+	default:
+		return filter, svrerror.New("status must be one of active, suspended, completed or cancelled", fiber.StatusBadRequest)
+	}
+
+	cursor, limit, err := validatePage(query.Cursor, query.Limit)
+	if err != nil {
+		return filter, err
+	}
+	filter.Cursor, filter.Limit = cursor, limit
+
+	return filter, nil
+}
+
+func ValidatePage(query *apimodel.PageQuery) (uint64, int, error) {
+	return validatePage(query.Cursor, query.Limit)
+}
+
+// ValidateCreateWebhookSubscription checks that the endpoint is an absolute http(s) URL, that the event types exist
+// and that a secret chosen by the client is long enough to be hard to guess.
+func ValidateCreateWebhookSubscription(request *apimodel.CreateWebhookSubscriptionRequest) error {
+	endpoint, err := url.Parse(request.URL)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return svrerror.New("url must be an absolute http or https URL", fiber.StatusBadRequest)
+	}
+	if len(request.URL) > maxWebhookURLLength {
+		return svrerror.New(fmt.Sprintf("url must be at most %d characters", maxWebhookURLLength), fiber.StatusBadRequest)
+	}
+
+	seen := make(map[string]bool, len(request.EventTypes))
+	for _, eventType := range request.EventTypes {
+		if !slices.Contains(model.EventTypes, eventType) {
+			return svrerror.New(fmt.Sprintf("unknown event type %q, must be one of %s", eventType,
+				strings.Join(model.EventTypes, ", ")), fiber.StatusBadRequest)
+		}
+		if seen[eventType] {
+			return svrerror.New(fmt.Sprintf("event type %q is listed more than once", eventType), fiber.StatusBadRequest)
+		}
+		seen[eventType] = true
+	}
+
+	if request.Secret != "" && len(request.Secret) < minWebhookSecretLength {
+		return svrerror.New(fmt.Sprintf("secret must be at least %d characters", minWebhookSecretLength), fiber.StatusBadRequest)
+	}
+	return nil
+}
+
+func ValidateListWebhookDeliveries(query *apimodel.ListWebhookDeliveriesQuery) (apimodel.WebhookDeliveryFilter, error) {
+	filter := apimodel.WebhookDeliveryFilter{SubscriptionID: query.SubscriptionID, EventID: query.EventID}
+
+	switch query.Status {
+	case "", model.WebhookDeliveryStatusPending, model.WebhookDeliveryStatusDelivered, model.WebhookDeliveryStatusDead:
+		filter.Status = query.Status
+	default:
+		return filter, svrerror.New("status must be one of pending, delivered or dead", fiber.StatusBadRequest)
+	}
+
+	cursor, limit, err := validatePage(query.Cursor, query.Limit)
+	if err != nil {
+		return filter, err
+	}
+	filter.Cursor, filter.Limit = cursor, limit
+
+	return filter, nil
+}
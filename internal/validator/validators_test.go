@@ -7,7 +7,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"internal-transfers-system/internal/apimodel"
 	"internal-transfers-system/internal/svrerror"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestValidateTransfer(t *testing.T) {
@@ -23,6 +25,7 @@ func TestValidateTransfer(t *testing.T) {
 				SourceAccountID:      1,
 				DestinationAccountID: 2,
 				Amount:               "100.50",
+				Currency:             "SGD",
 			},
 			expectedError:  nil,
 			expectedAmount: decimal.NewFromFloat(100.50),
@@ -33,6 +36,7 @@ func TestValidateTransfer(t *testing.T) {
 				SourceAccountID:      1,
 				DestinationAccountID: 2,
 				Amount:               "invalid",
+				Currency:             "SGD",
 			},
 			expectedError:  svrerror.New("invalid amount format", fiber.StatusBadRequest),
 			expectedAmount: decimal.Zero,
@@ -43,6 +47,7 @@ func TestValidateTransfer(t *testing.T) {
 				SourceAccountID:      1,
 				DestinationAccountID: 2,
 				Amount:               "0",
+				Currency:             "SGD",
 			},
 			expectedError:  svrerror.New("amount must be greater than zero", fiber.StatusBadRequest),
 			expectedAmount: decimal.Zero,
@@ -53,10 +58,128 @@ func TestValidateTransfer(t *testing.T) {
 				SourceAccountID:      1,
 				DestinationAccountID: 1,
 				Amount:               "100.50",
+				Currency:             "SGD",
 			},
 			expectedError:  svrerror.New("source and destination accounts must be different", fiber.StatusBadRequest),
 			expectedAmount: decimal.Zero,
 		},
+		{
+			name: "unsupported currency",
+			transfer: apimodel.TransferRequest{
+				SourceAccountID:      1,
+				DestinationAccountID: 2,
+				Amount:               "100.50",
+				Currency:             "sgd",
+			},
+			expectedError:  svrerror.New("currency must be a supported ISO 4217 code", fiber.StatusBadRequest),
+			expectedAmount: decimal.Zero,
+		},
+		{
+			name: "more decimal places than the currency",
+			transfer: apimodel.TransferRequest{
+				SourceAccountID:      1,
+				DestinationAccountID: 2,
+				Amount:               "100.505",
+				Currency:             "SGD",
+			},
+			expectedError:  svrerror.New("amount must have at most 2 decimal places for SGD", fiber.StatusBadRequest),
+			expectedAmount: decimal.Zero,
+		},
+		{
+			name: "zero decimal currency",
+			transfer: apimodel.TransferRequest{
+				SourceAccountID:      1,
+				DestinationAccountID: 2,
+				Amount:               "100.00",
+				Currency:             "JPY",
+			},
+			expectedError:  nil,
+			expectedAmount: decimal.NewFromInt(100),
+		},
+		{
+			name: "idempotency key too long",
+			transfer: apimodel.TransferRequest{
+				SourceAccountID:      1,
+				DestinationAccountID: 2,
+				Amount:               "100.50",
+				Currency:             "SGD",
+				IdempotencyKey:       strings.Repeat("k", 256),
+			},
+			expectedError:  svrerror.New("idempotency key must be at most 255 characters", fiber.StatusBadRequest),
+			expectedAmount: decimal.Zero,
+		},
+		{
+			name: "reference too long",
+			transfer: apimodel.TransferRequest{
+				SourceAccountID:      1,
+				DestinationAccountID: 2,
+				Amount:               "100.50",
+				Currency:             "SGD",
+				Reference:            strings.Repeat("r", 141),
+			},
+			expectedError:  svrerror.New("reference must be at most 140 characters", fiber.StatusBadRequest),
+			expectedAmount: decimal.Zero,
+		},
+		{
+			name: "description too long",
+			transfer: apimodel.TransferRequest{
+				SourceAccountID:      1,
+				DestinationAccountID: 2,
+				Amount:               "100.50",
+				Currency:             "SGD",
+				Description:          strings.Repeat("d", 501),
+			},
+			expectedError:  svrerror.New("description must be at most 500 characters", fiber.StatusBadRequest),
+			expectedAmount: decimal.Zero,
+		},
+		{
+			name: "external id too long",
+			transfer: apimodel.TransferRequest{
+				SourceAccountID:      1,
+				DestinationAccountID: 2,
+				Amount:               "100.50",
+				Currency:             "SGD",
+				ExternalID:           strings.Repeat("e", 256),
+			},
+			expectedError:  svrerror.New("external id must be at most 255 characters", fiber.StatusBadRequest),
+			expectedAmount: decimal.Zero,
+		},
+		{
+			name: "metadata that is not an object",
+			transfer: apimodel.TransferRequest{
+				SourceAccountID:      1,
+				DestinationAccountID: 2,
+				Amount:               "100.50",
+				Currency:             "SGD",
+				Metadata:             []byte(`["invoice", 42]`),
+			},
+			expectedError:  svrerror.New("metadata must be a JSON object", fiber.StatusBadRequest),
+			expectedAmount: decimal.Zero,
+		},
+		{
+			name: "metadata too large",
+			transfer: apimodel.TransferRequest{
+				SourceAccountID:      1,
+				DestinationAccountID: 2,
+				Amount:               "100.50",
+				Currency:             "SGD",
+				Metadata:             []byte(`{"notes": "` + strings.Repeat("n", 4096) + `"}`),
+			},
+			expectedError:  svrerror.New("metadata must be at most 4096 bytes", fiber.StatusBadRequest),
+			expectedAmount: decimal.Zero,
+		},
+		{
+			name: "metadata with a null character",
+			transfer: apimodel.TransferRequest{
+				SourceAccountID:      1,
+				DestinationAccountID: 2,
+				Amount:               "100.50",
+				Currency:             "SGD",
+				Metadata:             []byte(`{"notes": "a\u0000b"}`),
+			},
+			expectedError:  svrerror.New("metadata must not contain null characters", fiber.StatusBadRequest),
+			expectedAmount: decimal.Zero,
+		},
 	}
 
 	for _, tt := range tests {
@@ -80,6 +203,24 @@ func TestValidateTransfer(t *testing.T) {
 	}
 }
 
+func TestValidateTransferMetadata(t *testing.T) {
+	transfer := apimodel.TransferRequest{
+		SourceAccountID:      1,
+		DestinationAccountID: 2,
+		Amount:               "1",
+		Currency:             "SGD",
+		Metadata:             []byte(`{ "invoice": "INV-1",  "lines": [1, 2] }`),
+	}
+	_, err := ValidateTransfer(&transfer)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"invoice":"INV-1","lines":[1,2]}`, string(transfer.Metadata))
+
+	transfer.Metadata = []byte(`null`)
+	_, err = ValidateTransfer(&transfer)
+	assert.NoError(t, err)
+	assert.Nil(t, transfer.Metadata)
+}
+
 func TestValidateCreateAccount(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -92,6 +233,7 @@ func TestValidateCreateAccount(t *testing.T) {
 			account: &apimodel.CreateAccountRequest{
 				AccountID:      1,
 				InitialBalance: "100",
+				Currency:       "SGD",
 			},
 			expectedValue: decimal.NewFromFloat(100.00),
 			expectedError: nil,
@@ -101,6 +243,7 @@ func TestValidateCreateAccount(t *testing.T) {
 			account: &apimodel.CreateAccountRequest{
 				AccountID:      0,
 				InitialBalance: "100",
+				Currency:       "SGD",
 			},
 			expectedValue: decimal.Zero,
 			expectedError: svrerror.New("account id must be greater than 0", fiber.StatusBadRequest),
@@ -110,6 +253,7 @@ func TestValidateCreateAccount(t *testing.T) {
 			account: &apimodel.CreateAccountRequest{
 				AccountID:      2,
 				InitialBalance: "invalid",
+				Currency:       "SGD",
 			},
 			expectedValue: decimal.Zero,
 			expectedError: svrerror.New("invalid initial balance", fiber.StatusBadRequest),
@@ -119,10 +263,30 @@ func TestValidateCreateAccount(t *testing.T) {
 			account: &apimodel.CreateAccountRequest{
 				AccountID:      3,
 				InitialBalance: "-100",
+				Currency:       "SGD",
 			},
 			expectedValue: decimal.Zero,
 			expectedError: svrerror.New("initial balance must be non-negative", fiber.StatusBadRequest),
 		},
+		{
+			name: "Missing currency",
+			account: &apimodel.CreateAccountRequest{
+				AccountID:      4,
+				InitialBalance: "100",
+			},
+			expectedValue: decimal.Zero,
+			expectedError: svrerror.New("currency must be a supported ISO 4217 code", fiber.StatusBadRequest),
+		},
+		{
+			name: "Initial balance more precise than the currency",
+			account: &apimodel.CreateAccountRequest{
+				AccountID:      5,
+				InitialBalance: "100.5",
+				Currency:       "JPY",
+			},
+			expectedValue: decimal.Zero,
+			expectedError: svrerror.New("initial balance must have at most 0 decimal places for JPY", fiber.StatusBadRequest),
+		},
 	}
 
 	for _, tt := range tests {
@@ -139,3 +303,935 @@ func TestValidateCreateAccount(t *testing.T) {
 		})
 	}
 }
+
+func TestParseID(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         string
+		expectedID    uint64
+		expectedError error
+	}{
+		{
+			name:          "valid id",
+			value:         "42",
+			expectedID:    42,
+			expectedError: nil,
+		},
+		{
+			name:          "zero id",
+			value:         "0",
+			expectedID:    0,
+			expectedError: svrerror.New("invalid transfer id", fiber.StatusBadRequest),
+		},
+		{
+			name:          "non-numeric id",
+			value:         "abc",
+			expectedID:    0,
+			expectedError: svrerror.New("invalid transfer id", fiber.StatusBadRequest),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := ParseID(tt.value, "transfer")
+
+			if tt.expectedError != nil {
+				assert.Equal(t, tt.expectedError, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedID, id)
+		})
+	}
+}
+
+func TestValidateListTransfers(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         apimodel.ListTransfersQuery
+		expectedError error
+		check         func(t *testing.T, filter apimodel.TransferFilter)
+	}{
+		{
+			name:          "defaults",
+			query:         apimodel.ListTransfersQuery{},
+			expectedError: nil,
+			check: func(t *testing.T, filter apimodel.TransferFilter) {
+				assert.Equal(t, uint64(1), filter.AccountID)
+				assert.Equal(t, "", filter.Direction)
+				assert.Equal(t, 50, filter.Limit)
+				assert.Nil(t, filter.MinAmount)
+				assert.Nil(t, filter.CreatedFrom)
+			},
+		},
+		{
+			name: "all filters",
+			query: apimodel.ListTransfersQuery{
+				Direction:   "out",
+				MinAmount:   "10",
+				MaxAmount:   "20.5",
+				CreatedFrom: "2024-03-01T00:00:00Z",
+				CreatedTo:   "2024-04-01T00:00:00+08:00",
+				Reference:   "INV-1",
+				ExternalID:  "ext-1",
+				Description: "rent",
+				Metadata:    `{"invoice": "INV-1"}`,
+				Cursor:      "100",
+				Limit:       10,
+			},
+			expectedError: nil,
+			check: func(t *testing.T, filter apimodel.TransferFilter) {
+				assert.Equal(t, apimodel.DirectionOut, filter.Direction)
+				assert.True(t, decimal.NewFromInt(10).Equal(*filter.MinAmount))
+				assert.True(t, decimal.NewFromFloat(20.5).Equal(*filter.MaxAmount))
+				assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), filter.CreatedFrom.UTC())
+				assert.Equal(t, time.Date(2024, 3, 31, 16, 0, 0, 0, time.UTC), filter.CreatedTo.UTC())
+				assert.Equal(t, "INV-1", filter.Reference)
+				assert.Equal(t, "ext-1", filter.ExternalID)
+				assert.Equal(t, "rent", filter.Description)
+				assert.Equal(t, `{"invoice": "INV-1"}`, filter.Metadata)
+				assert.Equal(t, uint64(100), filter.Cursor)
+				assert.Equal(t, 10, filter.Limit)
+			},
+		},
+		{
+			name:          "invalid direction",
+			query:         apimodel.ListTransfersQuery{Direction: "sideways"},
+			expectedError: svrerror.New("direction must be either in or out", fiber.StatusBadRequest),
+		},
+		{
+			name:          "invalid amount",
+			query:         apimodel.ListTransfersQuery{MinAmount: "ten"},
+			expectedError: svrerror.New("invalid min_amount format", fiber.StatusBadRequest),
+		},
+		{
+			name:          "inverted amount range",
+			query:         apimodel.ListTransfersQuery{MinAmount: "20", MaxAmount: "10"},
+			expectedError: svrerror.New("min_amount must not be greater than max_amount", fiber.StatusBadRequest),
+		},
+		{
+			name:          "invalid timestamp",
+			query:         apimodel.ListTransfersQuery{CreatedFrom: "2024-03-01"},
+			expectedError: svrerror.New("created_from must be an RFC 3339 timestamp", fiber.StatusBadRequest),
+		},
+		{
+			name:          "metadata that is not an object",
+			query:         apimodel.ListTransfersQuery{Metadata: `"INV-1"`},
+			expectedError: svrerror.New("metadata must be a JSON object", fiber.StatusBadRequest),
+		},
+		{
+			name:          "invalid cursor",
+			query:         apimodel.ListTransfersQuery{Cursor: "abc"},
+			expectedError: svrerror.New("invalid cursor", fiber.StatusBadRequest),
+		},
+		{
+			name:          "limit too large",
+			query:         apimodel.ListTransfersQuery{Limit: 1000},
+			expectedError: svrerror.New("limit must be between 1 and 200", fiber.StatusBadRequest),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ValidateListTransfers(1, &tt.query)
+
+			if tt.expectedError != nil {
+				assert.Equal(t, tt.expectedError, err)
+				return
+			}
+			assert.NoError(t, err)
+			tt.check(t, filter)
+		})
+	}
+}
+
+func TestValidateCreateHold(t *testing.T) {
+	tests := []struct {
+		name           string
+		hold           apimodel.CreateHoldRequest
+		expectedAmount decimal.Decimal
+		expectedTTL    time.Duration
+		expectedError  error
+	}{
+		{
+			name:           "default expiry",
+			hold:           apimodel.CreateHoldRequest{AccountID: 1, DestinationAccountID: 2, Amount: "10", Currency: "SGD"},
+			expectedAmount: decimal.NewFromInt(10),
+			expectedTTL:    7 * 24 * time.Hour,
+		},
+		{
+			name:           "custom expiry",
+			hold:           apimodel.CreateHoldRequest{AccountID: 1, DestinationAccountID: 2, Amount: "10", Currency: "SGD", ExpiresInSeconds: 60},
+			expectedAmount: decimal.NewFromInt(10),
+			expectedTTL:    time.Minute,
+		},
+		{
+			name:           "expiry too long",
+			hold:           apimodel.CreateHoldRequest{AccountID: 1, DestinationAccountID: 2, Amount: "10", Currency: "SGD", ExpiresInSeconds: 2592001},
+			expectedAmount: decimal.Zero,
+			expectedError:  svrerror.New("expires_in_seconds must be between 1 and 2592000", fiber.StatusBadRequest),
+		},
+		{
+			name:           "zero amount",
+			hold:           apimodel.CreateHoldRequest{AccountID: 1, DestinationAccountID: 2, Amount: "0", Currency: "SGD"},
+			expectedAmount: decimal.Zero,
+			expectedError:  svrerror.New("amount must be greater than zero", fiber.StatusBadRequest),
+		},
+		{
+			name:           "hold to the same account",
+			hold:           apimodel.CreateHoldRequest{AccountID: 1, DestinationAccountID: 1, Amount: "10", Currency: "SGD"},
+			expectedAmount: decimal.Zero,
+			expectedError:  svrerror.New("source and destination accounts must be different", fiber.StatusBadRequest),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, ttl, err := ValidateCreateHold(&tt.hold)
+
+			if tt.expectedError != nil {
+				assert.Equal(t, tt.expectedError, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.True(t, tt.expectedAmount.Equal(amount), "expected %v but got %v", tt.expectedAmount, amount)
+			assert.Equal(t, tt.expectedTTL, ttl)
+		})
+	}
+}
+
+func TestValidateCaptureHold(t *testing.T) {
+	amount, err := ValidateCaptureHold(&apimodel.CaptureHoldRequest{})
+	assert.NoError(t, err)
+	assert.False(t, amount.Valid)
+
+	amount, err = ValidateCaptureHold(&apimodel.CaptureHoldRequest{Amount: "12.5"})
+	assert.NoError(t, err)
+	assert.True(t, amount.Valid)
+	assert.True(t, decimal.NewFromFloat(12.5).Equal(amount.Decimal))
+
+	_, err = ValidateCaptureHold(&apimodel.CaptureHoldRequest{Amount: "-1"})
+	assert.Equal(t, svrerror.New("amount must be greater than zero", fiber.StatusBadRequest), err)
+}
+
+func TestValidateReverseTransfer(t *testing.T) {
+	amount, err := ValidateReverseTransfer(&apimodel.ReverseTransferRequest{})
+	assert.NoError(t, err)
+	assert.False(t, amount.Valid)
+
+	amount, err = ValidateReverseTransfer(&apimodel.ReverseTransferRequest{Amount: "5"})
+	assert.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(5).Equal(amount.Decimal))
+
+	_, err = ValidateReverseTransfer(&apimodel.ReverseTransferRequest{Amount: "five"})
+	assert.Equal(t, svrerror.New("invalid amount format", fiber.StatusBadRequest), err)
+}
+
+func TestValidateSetFXRates(t *testing.T) {
+	rates, err := ValidateSetFXRates(&apimodel.SetFXRatesRequest{Rates: []apimodel.FXRateRequest{
+		{BaseCurrency: "USD", QuoteCurrency: "SGD", Rate: "1.35"},
+	}})
+	assert.NoError(t, err)
+	if assert.Len(t, rates, 1) {
+		assert.Equal(t, "USD", rates[0].BaseCurrency)
+		assert.True(t, decimal.RequireFromString("1.35").Equal(rates[0].Rate))
+	}
+
+	tests := []struct {
+		name          string
+		rate          apimodel.FXRateRequest
+		expectedError error
+	}{
+		{
+			name:          "unsupported currency",
+			rate:          apimodel.FXRateRequest{BaseCurrency: "USD", QuoteCurrency: "XYZ", Rate: "1"},
+			expectedError: svrerror.New("currency must be a supported ISO 4217 code", fiber.StatusBadRequest),
+		},
+		{
+			name:          "same currency",
+			rate:          apimodel.FXRateRequest{BaseCurrency: "USD", QuoteCurrency: "USD", Rate: "1"},
+			expectedError: svrerror.New("base and quote currencies must be different", fiber.StatusBadRequest),
+		},
+		{
+			name:          "zero rate",
+			rate:          apimodel.FXRateRequest{BaseCurrency: "USD", QuoteCurrency: "SGD", Rate: "0"},
+			expectedError: svrerror.New("rate must be greater than zero", fiber.StatusBadRequest),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateSetFXRates(&apimodel.SetFXRatesRequest{Rates: []apimodel.FXRateRequest{tt.rate}})
+			assert.Equal(t, tt.expectedError, err)
+		})
+	}
+
+	_, err = ValidateSetFXRates(&apimodel.SetFXRatesRequest{})
+	assert.Equal(t, svrerror.New("at least one rate is required", fiber.StatusBadRequest), err)
+}
+
+func TestValidateCreateFXQuote(t *testing.T) {
+	tests := []struct {
+		name           string
+		quote          apimodel.CreateFXQuoteRequest
+		expectedAmount decimal.Decimal
+		expectedTTL    time.Duration
+		expectedError  error
+	}{
+		{
+			name:           "default expiry",
+			quote:          apimodel.CreateFXQuoteRequest{SourceCurrency: "USD", DestinationCurrency: "SGD", SourceAmount: "10"},
+			expectedAmount: decimal.NewFromInt(10),
+			expectedTTL:    30 * time.Second,
+		},
+		{
+			name:           "expiry too long",
+			quote:          apimodel.CreateFXQuoteRequest{SourceCurrency: "USD", DestinationCurrency: "SGD", SourceAmount: "10", ExpiresInSeconds: 601},
+			expectedAmount: decimal.Zero,
+			expectedError:  svrerror.New("expires_in_seconds must be between 1 and 600", fiber.StatusBadRequest),
+		},
+		{
+			name:           "more decimal places than the source currency",
+			quote:          apimodel.CreateFXQuoteRequest{SourceCurrency: "JPY", DestinationCurrency: "SGD", SourceAmount: "10.5"},
+			expectedAmount: decimal.Zero,
+			expectedError:  svrerror.New("source amount must have at most 0 decimal places for JPY", fiber.StatusBadRequest),
+		},
+		{
+			name:           "same currency",
+			quote:          apimodel.CreateFXQuoteRequest{SourceCurrency: "SGD", DestinationCurrency: "SGD", SourceAmount: "10"},
+			expectedAmount: decimal.Zero,
+			expectedError:  svrerror.New("source and destination currencies must be different", fiber.StatusBadRequest),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, ttl, err := ValidateCreateFXQuote(&tt.quote)
+
+			if tt.expectedError != nil {
+				assert.Equal(t, tt.expectedError, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.True(t, tt.expectedAmount.Equal(amount), "expected %v but got %v", tt.expectedAmount, amount)
+			assert.Equal(t, tt.expectedTTL, ttl)
+		})
+	}
+}
+
+func TestValidateSetFeeSchedules(t *testing.T) {
+	schedules, err := ValidateSetFeeSchedules(&apimodel.SetFeeSchedulesRequest{Schedules: []apimodel.FeeScheduleRequest{
+		{TransferType: "standard", Currency: "SGD", Type: "percentage", RevenueAccountID: 9, Percentage: "1.5", MinAmount: "0.50"},
+		{TransferType: "cross_currency", Currency: "SGD", Type: "tiered", RevenueAccountID: 9, Tiers: []apimodel.FeeTierRequest{
+			{UpTo: "100", Amount: "1"}, {Amount: "5"},
+		}},
+	}})
+	assert.NoError(t, err)
+	if assert.Len(t, schedules, 2) {
+		assert.True(t, decimal.RequireFromString("1.5").Equal(schedules[0].Percentage.Decimal))
+		assert.True(t, schedules[0].MinAmount.Valid)
+		assert.False(t, schedules[0].MaxAmount.Valid)
+		if assert.Len(t, schedules[1].Tiers, 2) {
+			assert.True(t, decimal.NewFromInt(100).Equal(schedules[1].Tiers[0].UpTo.Decimal))
+			assert.False(t, schedules[1].Tiers[1].UpTo.Valid)
+		}
+	}
+
+	flat := func(amount string) apimodel.FeeScheduleRequest {
+		return apimodel.FeeScheduleRequest{TransferType: "standard", Currency: "SGD", Type: "flat", RevenueAccountID: 9, FlatAmount: amount}
+	}
+	tiered := func(tiers ...apimodel.FeeTierRequest) apimodel.FeeScheduleRequest {
+		return apimodel.FeeScheduleRequest{TransferType: "standard", Currency: "SGD", Type: "tiered", RevenueAccountID: 9, Tiers: tiers}
+	}
+
+	tests := []struct {
+		name          string
+		schedule      apimodel.FeeScheduleRequest
+		expectedError error
+	}{
+		{
+			name:          "unknown transfer type",
+			schedule:      apimodel.FeeScheduleRequest{TransferType: "instant", Currency: "SGD", Type: "flat", RevenueAccountID: 9, FlatAmount: "1"},
+			expectedError: svrerror.New("schedules[0]: transfer type must be either standard or cross_currency", fiber.StatusBadRequest),
+		},
+		{
+			name:          "unknown fee type",
+			schedule:      apimodel.FeeScheduleRequest{TransferType: "standard", Currency: "SGD", Type: "free", RevenueAccountID: 9},
+			expectedError: svrerror.New("schedules[0]: type must be one of flat, percentage or tiered", fiber.StatusBadRequest),
+		},
+		{
+			name:          "missing revenue account",
+			schedule:      apimodel.FeeScheduleRequest{TransferType: "standard", Currency: "SGD", Type: "flat", FlatAmount: "1"},
+			expectedError: svrerror.New("schedules[0]: revenue account id must be greater than 0", fiber.StatusBadRequest),
+		},
+		{
+			name:          "zero flat fee",
+			schedule:      flat("0"),
+			expectedError: svrerror.New("schedules[0]: flat_amount must be greater than zero", fiber.StatusBadRequest),
+		},
+		{
+			name:          "flat fee with more decimal places than the currency",
+			schedule:      flat("0.001"),
+			expectedError: svrerror.New("schedules[0]: flat_amount must have at most 2 decimal places for SGD", fiber.StatusBadRequest),
+		},
+		{
+			name:          "flat fee with a percentage",
+			schedule:      apimodel.FeeScheduleRequest{TransferType: "standard", Currency: "SGD", Type: "flat", RevenueAccountID: 9, FlatAmount: "1", Percentage: "1"},
+			expectedError: svrerror.New("schedules[0]: flat fees only take a flat_amount", fiber.StatusBadRequest),
+		},
+		{
+			name:          "percentage over 100",
+			schedule:      apimodel.FeeScheduleRequest{TransferType: "standard", Currency: "SGD", Type: "percentage", RevenueAccountID: 9, Percentage: "101"},
+			expectedError: svrerror.New("schedules[0]: percentage must be greater than 0 and at most 100", fiber.StatusBadRequest),
+		},
+		{
+			name:          "minimum above the maximum",
+			schedule:      apimodel.FeeScheduleRequest{TransferType: "standard", Currency: "SGD", Type: "percentage", RevenueAccountID: 9, Percentage: "1", MinAmount: "5", MaxAmount: "1"},
+			expectedError: svrerror.New("schedules[0]: min_amount must not be greater than max_amount", fiber.StatusBadRequest),
+		},
+		{
+			name:          "no tiers",
+			schedule:      tiered(),
+			expectedError: svrerror.New("schedules[0]: tiered fees must have between 1 and 20 tiers", fiber.StatusBadRequest),
+		},
+		{
+			name:          "bounded last tier",
+			schedule:      tiered(apimodel.FeeTierRequest{UpTo: "100", Amount: "1"}),
+			expectedError: svrerror.New("schedules[0]: the last tier must not have an up_to amount", fiber.StatusBadRequest),
+		},
+		{
+			name:          "unbounded middle tier",
+			schedule:      tiered(apimodel.FeeTierRequest{Amount: "1"}, apimodel.FeeTierRequest{Amount: "2"}),
+			expectedError: svrerror.New("schedules[0]: tiers[0]: up_to is required on every tier but the last", fiber.StatusBadRequest),
+		},
+		{
+			name: "tiers out of order",
+			schedule: tiered(
+				apimodel.FeeTierRequest{UpTo: "100", Amount: "1"},
+				apimodel.FeeTierRequest{UpTo: "100", Amount: "2"},
+				apimodel.FeeTierRequest{Amount: "3"},
+			),
+			expectedError: svrerror.New("schedules[0]: tiers[1]: up_to must be greater than the up_to of the tier before", fiber.StatusBadRequest),
+		},
+		{
+			name:          "negative tier amount",
+			schedule:      tiered(apimodel.FeeTierRequest{Amount: "-1"}),
+			expectedError: svrerror.New("schedules[0]: tiers[0] amount must not be negative", fiber.StatusBadRequest),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateSetFeeSchedules(&apimodel.SetFeeSchedulesRequest{Schedules: []apimodel.FeeScheduleRequest{tt.schedule}})
+			assert.Equal(t, tt.expectedError, err)
+		})
+	}
+
+	_, err = ValidateSetFeeSchedules(&apimodel.SetFeeSchedulesRequest{Schedules: []apimodel.FeeScheduleRequest{flat("1"), flat("2")}})
+	assert.Equal(t, svrerror.New("schedules[1]: SGD standard fees are set more than once", fiber.StatusBadRequest), err)
+
+	_, err = ValidateSetFeeSchedules(&apimodel.SetFeeSchedulesRequest{})
+	assert.Equal(t, svrerror.New("at least one schedule is required", fiber.StatusBadRequest), err)
+}
+
+func TestValidateFeeQuote(t *testing.T) {
+	query := apimodel.FeeQuoteQuery{Currency: "SGD", Amount: "10.50"}
+	amount, err := ValidateFeeQuote(&query)
+	assert.NoError(t, err)
+	assert.True(t, decimal.RequireFromString("10.5").Equal(amount))
+	assert.Equal(t, "standard", query.TransferType)
+
+	_, err = ValidateFeeQuote(&apimodel.FeeQuoteQuery{TransferType: "instant", Currency: "SGD", Amount: "1"})
+	assert.Equal(t, svrerror.New("transfer type must be either standard or cross_currency", fiber.StatusBadRequest), err)
+
+	_, err = ValidateFeeQuote(&apimodel.FeeQuoteQuery{Currency: "JPY", Amount: "1.5"})
+	assert.Equal(t, svrerror.New("amount must have at most 0 decimal places for JPY", fiber.StatusBadRequest), err)
+}
+
+func TestValidateChangeAccountStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		request       apimodel.ChangeAccountStatusRequest
+		expectedError error
+	}{
+		{
+			name:    "freeze",
+			request: apimodel.ChangeAccountStatusRequest{Status: "frozen", Reason: "court order"},
+		},
+		{
+			name:          "unknown status",
+			request:       apimodel.ChangeAccountStatusRequest{Status: "dormant", Reason: "no activity"},
+			expectedError: svrerror.New("status must be one of active, frozen or closed", fiber.StatusBadRequest),
+		},
+		{
+			name:          "blank reason",
+			request:       apimodel.ChangeAccountStatusRequest{Status: "closed", Reason: "  "},
+			expectedError: svrerror.New("reason is required", fiber.StatusBadRequest),
+		},
+		{
+			name:          "reason too long",
+			request:       apimodel.ChangeAccountStatusRequest{Status: "closed", Reason: strings.Repeat("a", 501)},
+			expectedError: svrerror.New("reason must be at most 500 characters", fiber.StatusBadRequest),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateChangeAccountStatus(&tt.request)
+			if tt.expectedError != nil {
+				assert.Equal(t, tt.expectedError, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateSetOverdraftLimit(t *testing.T) {
+	limit, err := ValidateSetOverdraftLimit(&apimodel.SetOverdraftLimitRequest{OverdraftLimit: "250.50"})
+	assert.NoError(t, err)
+	assert.True(t, decimal.RequireFromString("250.5").Equal(limit))
+
+	_, err = ValidateSetOverdraftLimit(&apimodel.SetOverdraftLimitRequest{OverdraftLimit: "-1"})
+	assert.Equal(t, svrerror.New("overdraft limit must be non-negative", fiber.StatusBadRequest), err)
+
+	_, err = ValidateSetOverdraftLimit(&apimodel.SetOverdraftLimitRequest{})
+	assert.Equal(t, svrerror.New("invalid overdraft limit format", fiber.StatusBadRequest), err)
+}
+
+func TestValidateSetAccountLimits(t *testing.T) {
+	hourly := int64(5)
+	limits, err := ValidateSetAccountLimits(1, &apimodel.AccountLimitsRequest{DailyAmount: "1000", HourlyCount: &hourly})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), limits.AccountID)
+	assert.False(t, limits.MaxTransferAmount.Valid)
+	assert.True(t, limits.DailyAmount.Valid)
+	assert.True(t, decimal.NewFromInt(1000).Equal(limits.DailyAmount.Decimal))
+	assert.Equal(t, &hourly, limits.HourlyCount)
+
+	_, err = ValidateSetAccountLimits(1, &apimodel.AccountLimitsRequest{MaxTransferAmount: "abc"})
+	assert.Equal(t, svrerror.New("invalid max_transfer_amount format", fiber.StatusBadRequest), err)
+
+	_, err = ValidateSetAccountLimits(1, &apimodel.AccountLimitsRequest{Rolling30DayAmount: "0"})
+	assert.Equal(t, svrerror.New("rolling_30_day_amount must be greater than zero", fiber.StatusBadRequest), err)
+
+	zero := int64(0)
+	_, err = ValidateSetAccountLimits(1, &apimodel.AccountLimitsRequest{HourlyCount: &zero})
+	assert.Equal(t, svrerror.New("hourly_count must be greater than zero", fiber.StatusBadRequest), err)
+}
+
+func TestValidateCreateScheduledTransfer(t *testing.T) {
+	tomorrow := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	tests := []struct {
+		name              string
+		request           apimodel.CreateScheduledTransferRequest
+		expectedAmount    decimal.Decimal
+		expectedExecuteAt time.Time
+		expectedError     error
+	}{
+		{
+			name:              "valid scheduled transfer",
+			request:           apimodel.CreateScheduledTransferRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "10.50", Currency: "SGD", ExecuteAt: tomorrow.Format(time.RFC3339)},
+			expectedAmount:    decimal.NewFromFloat(10.50),
+			expectedExecuteAt: tomorrow,
+		},
+		{
+			name:          "invalid transfer",
+			request:       apimodel.CreateScheduledTransferRequest{SourceAccountID: 1, DestinationAccountID: 1, Amount: "10", Currency: "SGD", ExecuteAt: tomorrow.Format(time.RFC3339)},
+			expectedError: svrerror.New("source and destination accounts must be different", fiber.StatusBadRequest),
+		},
+		{
+			name:          "missing execution time",
+			request:       apimodel.CreateScheduledTransferRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "10", Currency: "SGD"},
+			expectedError: svrerror.New("execute_at must be an RFC 3339 timestamp", fiber.StatusBadRequest),
+		},
+		{
+			name:          "execution time in the past",
+			request:       apimodel.CreateScheduledTransferRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "10", Currency: "SGD", ExecuteAt: "2024-03-01T00:00:00Z"},
+			expectedError: svrerror.New("execute_at must be in the future", fiber.StatusBadRequest),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, executeAt, err := ValidateCreateScheduledTransfer(&tt.request)
+
+			if tt.expectedError != nil {
+				assert.Equal(t, tt.expectedError, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, tt.expectedAmount.Equal(amount))
+			assert.True(t, tt.expectedExecuteAt.Equal(executeAt))
+		})
+	}
+}
+
+func TestValidateListScheduledTransfers(t *testing.T) {
+	filter, err := ValidateListScheduledTransfers(&apimodel.ListScheduledTransfersQuery{AccountID: 1, Status: "pending", Cursor: "10"})
+	assert.NoError(t, err)
+	assert.Equal(t, apimodel.ScheduledTransferFilter{AccountID: 1, Status: "pending", Cursor: 10, Limit: 50}, filter)
+
+	_, err = ValidateListScheduledTransfers(&apimodel.ListScheduledTransfersQuery{Status: "done"})
+	assert.Equal(t, svrerror.New("status must be one of pending, completed, failed or cancelled", fiber.StatusBadRequest), err)
+
+	_, err = ValidateListScheduledTransfers(&apimodel.ListScheduledTransfersQuery{Limit: -1})
+	assert.Equal(t, svrerror.New("limit must be between 1 and 200", fiber.StatusBadRequest), err)
+}
+
+func TestValidateCreateStandingOrder(t *testing.T) {
+	start := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	valid := func() apimodel.CreateStandingOrderRequest {
+		return apimodel.CreateStandingOrderRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "10", Currency: "SGD",
+			Frequency: "weekly", StartAt: start.Format(time.RFC3339)}
+	}
+	maxOccurrences := 0
+
+	tests := []struct {
+		name          string
+		modify        func(request *apimodel.CreateStandingOrderRequest)
+		expectedError error
+	}{
+		{
+			name:   "valid weekly order",
+			modify: func(request *apimodel.CreateStandingOrderRequest) {},
+		},
+		{
+			name: "valid cron order with retries",
+			modify: func(request *apimodel.CreateStandingOrderRequest) {
+				request.Frequency, request.CronExpression = "cron", "0 9 * * 1-5"
+				request.OnInsufficientFunds, request.RetryCount = "retry", 3
+			},
+		},
+		{
+			name:   "valid order that catches up",
+			modify: func(request *apimodel.CreateStandingOrderRequest) { request.MissedOccurrences = "catch_up" },
+		},
+		{
+			name:          "unknown frequency",
+			modify:        func(request *apimodel.CreateStandingOrderRequest) { request.Frequency = "daily" },
+			expectedError: svrerror.New("frequency must be one of weekly, monthly or cron", fiber.StatusBadRequest),
+		},
+		{
+			name:          "cron expression without the cron frequency",
+			modify:        func(request *apimodel.CreateStandingOrderRequest) { request.CronExpression = "0 9 * * *" },
+			expectedError: svrerror.New("cron_expression is only allowed with the cron frequency", fiber.StatusBadRequest),
+		},
+		{
+			name:          "cron frequency without an expression",
+			modify:        func(request *apimodel.CreateStandingOrderRequest) { request.Frequency = "cron" },
+			expectedError: svrerror.New("cron_expression is required with the cron frequency", fiber.StatusBadRequest),
+		},
+		{
+			name:          "start in the past",
+			modify:        func(request *apimodel.CreateStandingOrderRequest) { request.StartAt = "2024-03-01T00:00:00Z" },
+			expectedError: svrerror.New("start_at must be in the future", fiber.StatusBadRequest),
+		},
+		{
+			name: "end before the start",
+			modify: func(request *apimodel.CreateStandingOrderRequest) {
+				request.EndAt = start.Add(-time.Minute).Format(time.RFC3339)
+			},
+			expectedError: svrerror.New("end_at must be after start_at", fiber.StatusBadRequest),
+		},
+		{
+			name:          "no occurrences",
+			modify:        func(request *apimodel.CreateStandingOrderRequest) { request.MaxOccurrences = &maxOccurrences },
+			expectedError: svrerror.New("max_occurrences must be greater than zero", fiber.StatusBadRequest),
+		},
+		{
+			name:          "unknown insufficient funds behaviour",
+			modify:        func(request *apimodel.CreateStandingOrderRequest) { request.OnInsufficientFunds = "ignore" },
+			expectedError: svrerror.New("on_insufficient_funds must be one of skip, retry or suspend", fiber.StatusBadRequest),
+		},
+		{
+			name:          "retry count without retries",
+			modify:        func(request *apimodel.CreateStandingOrderRequest) { request.RetryCount = 2 },
+			expectedError: svrerror.New("retry_count is only allowed when on_insufficient_funds is retry", fiber.StatusBadRequest),
+		},
+		{
+			name: "too many retries",
+			modify: func(request *apimodel.CreateStandingOrderRequest) {
+				request.OnInsufficientFunds, request.RetryCount = "retry", 11
+			},
+			expectedError: svrerror.New("retry_count must be between 1 and 10", fiber.StatusBadRequest),
+		},
+		{
+			name:          "unknown missed occurrences behaviour",
+			modify:        func(request *apimodel.CreateStandingOrderRequest) { request.MissedOccurrences = "replay" },
+			expectedError: svrerror.New("missed_occurrences must be one of skip or catch_up", fiber.StatusBadRequest),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := valid()
+			tt.modify(&request)
+			order, err := ValidateCreateStandingOrder(&request)
+
+			if tt.expectedError != nil {
+				assert.Equal(t, tt.expectedError, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, start.Equal(order.StartAt))
+			assert.Equal(t, request.Frequency, order.Frequency)
+			if request.OnInsufficientFunds == "" {
+				assert.Equal(t, "skip", order.OnInsufficientFunds)
+			}
+			if request.MissedOccurrences == "" {
+				assert.Equal(t, "skip", order.MissedOccurrences)
+			}
+		})
+	}
+}
+
+func TestValidateBatchTransfer(t *testing.T) {
+	valid := apimodel.TransferRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "10.50", Currency: "SGD"}
+	invalid := apimodel.TransferRequest{SourceAccountID: 1, DestinationAccountID: 1, Amount: "10", Currency: "SGD"}
+
+	items, err := ValidateBatchTransfer(&apimodel.BatchTransferRequest{Mode: "best_effort", Transfers: []apimodel.TransferRequest{valid, invalid}}, 100)
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.NoError(t, items[0].Err)
+	assert.True(t, decimal.NewFromFloat(10.50).Equal(items[0].Amount))
+	assert.Equal(t, svrerror.New("source and destination accounts must be different", fiber.StatusBadRequest), items[1].Err)
+
+	_, err = ValidateBatchTransfer(&apimodel.BatchTransferRequest{Mode: "eventual", Transfers: []apimodel.TransferRequest{valid}}, 100)
+	assert.Equal(t, svrerror.New("mode must be either atomic or best_effort", fiber.StatusBadRequest), err)
+
+	_, err = ValidateBatchTransfer(&apimodel.BatchTransferRequest{Mode: "atomic"}, 100)
+	assert.Equal(t, svrerror.New("a batch must have between 1 and 100 transfers", fiber.StatusBadRequest), err)
+
+	_, err = ValidateBatchTransfer(&apimodel.BatchTransferRequest{Mode: "atomic", Transfers: make([]apimodel.TransferRequest, 101)}, 100)
+	assert.Equal(t, svrerror.New("a batch must have between 1 and 100 transfers", fiber.StatusBadRequest), err)
+
+	payroll := make([]apimodel.TransferRequest, 5000)
+	for i := range payroll {
+		payroll[i] = valid
+	}
+	items, err = ValidateBatchTransfer(&apimodel.BatchTransferRequest{Mode: "atomic", Transfers: payroll}, 5000)
+	assert.NoError(t, err)
+	assert.Len(t, items, 5000)
+}
+
+func TestValidateMultiLegTransfer(t *testing.T) {
+	legs := func(legs ...apimodel.TransferLegRequest) []apimodel.TransferLegRequest { return legs }
+	tests := []struct {
+		name          string
+		request       apimodel.MultiLegTransferRequest
+		expectedError error
+	}{
+		{
+			name: "valid split",
+			request: apimodel.MultiLegTransferRequest{Currency: "SGD",
+				Sources:      legs(apimodel.TransferLegRequest{AccountID: 1, Amount: "10.00"}),
+				Destinations: legs(apimodel.TransferLegRequest{AccountID: 2, Amount: "2.5"}, apimodel.TransferLegRequest{AccountID: 3, Amount: "7.50"})},
+		},
+		{
+			name:          "no destinations",
+			request:       apimodel.MultiLegTransferRequest{Currency: "SGD", Sources: legs(apimodel.TransferLegRequest{AccountID: 1, Amount: "10"})},
+			expectedError: svrerror.New("a multi-leg transfer needs at least one source and one destination", fiber.StatusBadRequest),
+		},
+		{
+			name: "unbalanced",
+			request: apimodel.MultiLegTransferRequest{Currency: "SGD",
+				Sources:      legs(apimodel.TransferLegRequest{AccountID: 1, Amount: "10"}),
+				Destinations: legs(apimodel.TransferLegRequest{AccountID: 2, Amount: "9"})},
+			expectedError: svrerror.New("legs do not balance: sources add up to 10 and destinations to 9", fiber.StatusBadRequest),
+		},
+		{
+			name: "account on both sides",
+			request: apimodel.MultiLegTransferRequest{Currency: "SGD",
+				Sources:      legs(apimodel.TransferLegRequest{AccountID: 1, Amount: "10"}),
+				Destinations: legs(apimodel.TransferLegRequest{AccountID: 1, Amount: "10"})},
+			expectedError: svrerror.New("destinations[0]: account 1 is in more than one leg", fiber.StatusBadRequest),
+		},
+		{
+			name: "negative leg",
+			request: apimodel.MultiLegTransferRequest{Currency: "SGD",
+				Sources:      legs(apimodel.TransferLegRequest{AccountID: 1, Amount: "-10"}),
+				Destinations: legs(apimodel.TransferLegRequest{AccountID: 2, Amount: "-10"})},
+			expectedError: svrerror.New("sources[0]: amount must be greater than zero", fiber.StatusBadRequest),
+		},
+		{
+			name: "too many decimal places",
+			request: apimodel.MultiLegTransferRequest{Currency: "JPY",
+				Sources:      legs(apimodel.TransferLegRequest{AccountID: 1, Amount: "10.5"}),
+				Destinations: legs(apimodel.TransferLegRequest{AccountID: 2, Amount: "10.5"})},
+			expectedError: svrerror.New("sources[0] amount must have at most 0 decimal places for JPY", fiber.StatusBadRequest),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transfer, err := ValidateMultiLegTransfer(&tt.request)
+			if tt.expectedError != nil {
+				assert.Equal(t, tt.expectedError, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, transfer.Sources, len(tt.request.Sources))
+			assert.Len(t, transfer.Destinations, len(tt.request.Destinations))
+		})
+	}
+}
+
+func TestValidateBalanceAsOf(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         string
+		expected      time.Time
+		expectedError error
+	}{
+		{name: "valid", value: "2024-03-31T23:59:59+08:00", expected: time.Date(2024, 3, 31, 15, 59, 59, 0, time.UTC)},
+		{name: "fractional seconds", value: "2024-03-31T15:59:59.5Z", expected: time.Date(2024, 3, 31, 15, 59, 59, 500000000, time.UTC)},
+		{name: "date only", value: "2024-03-31", expectedError: svrerror.New("as_of must be an RFC 3339 timestamp", fiber.StatusBadRequest)},
+		{name: "future", value: time.Now().Add(time.Hour).Format(time.RFC3339), expectedError: svrerror.New("as_of must not be in the future", fiber.StatusBadRequest)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asOf, err := ValidateBalanceAsOf(tt.value)
+			if tt.expectedError != nil {
+				assert.Equal(t, tt.expectedError, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, tt.expected.Equal(asOf))
+		})
+	}
+
+	t.Run("empty is now", func(t *testing.T) {
+		before := time.Now()
+		asOf, err := ValidateBalanceAsOf("")
+		assert.NoError(t, err)
+		assert.False(t, asOf.Before(before))
+		assert.False(t, asOf.After(time.Now()))
+	})
+}
+
+func TestValidateStatement(t *testing.T) {
+	march := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	april := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		query         apimodel.StatementQuery
+		from, to      time.Time
+		format        string
+		expectedError error
+	}{
+		{name: "dates", query: apimodel.StatementQuery{From: "2024-03-01", To: "2024-04-01"}, from: march, to: april, format: "json"},
+		{name: "timestamps", query: apimodel.StatementQuery{From: "2024-03-01T08:00:00+08:00", To: "2024-04-01T00:00:00Z", Format: "pdf"}, from: march, to: april, format: "pdf"},
+		{name: "missing from", query: apimodel.StatementQuery{To: "2024-04-01"}, expectedError: svrerror.New("from is required", fiber.StatusBadRequest)},
+		{name: "invalid to", query: apimodel.StatementQuery{From: "2024-03-01", To: "01/04/2024"}, expectedError: svrerror.New("to must be a date or an RFC 3339 timestamp", fiber.StatusBadRequest)},
+		{name: "empty period", query: apimodel.StatementQuery{From: "2024-03-01", To: "2024-03-01"}, expectedError: svrerror.New("from must be before to", fiber.StatusBadRequest)},
+		{name: "too long", query: apimodel.StatementQuery{From: "2024-01-01", To: "2025-01-02"}, expectedError: svrerror.New("a statement can cover at most 366 days", fiber.StatusBadRequest)},
+		{name: "unknown format", query: apimodel.StatementQuery{From: "2024-03-01", To: "2024-04-01", Format: "xlsx"}, expectedError: svrerror.New("format must be one of json, csv, pdf or camt053", fiber.StatusBadRequest)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, format, err := ValidateStatement(&tt.query)
+			if tt.expectedError != nil {
+				assert.Equal(t, tt.expectedError, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, tt.from.Equal(from))
+			assert.True(t, tt.to.Equal(to))
+			assert.Equal(t, tt.format, format)
+		})
+	}
+}
+
+func TestValidateCreateWebhookSubscription(t *testing.T) {
+	tests := []struct {
+		name          string
+		request       apimodel.CreateWebhookSubscriptionRequest
+		expectedError error
+	}{
+		{name: "every event", request: apimodel.CreateWebhookSubscriptionRequest{URL: "https://example.com/hooks"}},
+		{name: "event types and secret", request: apimodel.CreateWebhookSubscriptionRequest{URL: "http://localhost:8080/hooks", EventTypes: []string{"transfer.created"}, Secret: "0123456789abcdef"}},
+		{name: "missing url", request: apimodel.CreateWebhookSubscriptionRequest{}, expectedError: svrerror.New("url must be an absolute http or https URL", fiber.StatusBadRequest)},
+		{name: "relative url", request: apimodel.CreateWebhookSubscriptionRequest{URL: "/hooks"}, expectedError: svrerror.New("url must be an absolute http or https URL", fiber.StatusBadRequest)},
+		{name: "other scheme", request: apimodel.CreateWebhookSubscriptionRequest{URL: "mailto:ops@example.com"}, expectedError: svrerror.New("url must be an absolute http or https URL", fiber.StatusBadRequest)},
+		{name: "long url", request: apimodel.CreateWebhookSubscriptionRequest{URL: "https://example.com/" + strings.Repeat("a", 2048)}, expectedError: svrerror.New("url must be at most 2048 characters", fiber.StatusBadRequest)},
+		{name: "unknown event type", request: apimodel.CreateWebhookSubscriptionRequest{URL: "https://example.com/hooks", EventTypes: []string{"account.closed"}}, expectedError: svrerror.New(`unknown event type "account.closed", must be one of account.created, transfer.created, balance.changed`, fiber.StatusBadRequest)},
+		{name: "duplicate event type", request: apimodel.CreateWebhookSubscriptionRequest{URL: "https://example.com/hooks", EventTypes: []string{"account.created", "account.created"}}, expectedError: svrerror.New(`event type "account.created" is listed more than once`, fiber.StatusBadRequest)},
+		{name: "short secret", request: apimodel.CreateWebhookSubscriptionRequest{URL: "https://example.com/hooks", Secret: "secret"}, expectedError: svrerror.New("secret must be at least 16 characters", fiber.StatusBadRequest)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedError, ValidateCreateWebhookSubscription(&tt.request))
+		})
+	}
+}
+
+func TestValidateListWebhookDeliveries(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         apimodel.ListWebhookDeliveriesQuery
+		expected      apimodel.WebhookDeliveryFilter
+		expectedError error
+	}{
+		{name: "no filter", expected: apimodel.WebhookDeliveryFilter{Limit: defaultPageLimit}},
+		{name: "dead deliveries of a subscription", query: apimodel.ListWebhookDeliveriesQuery{Status: "dead", SubscriptionID: 3, Cursor: "10", Limit: 5}, expected: apimodel.WebhookDeliveryFilter{Status: "dead", SubscriptionID: 3, Cursor: 10, Limit: 5}},
+		{name: "unknown status", query: apimodel.ListWebhookDeliveriesQuery{Status: "failed"}, expectedError: svrerror.New("status must be one of pending, delivered or dead", fiber.StatusBadRequest)},
+		{name: "invalid cursor", query: apimodel.ListWebhookDeliveriesQuery{Cursor: "abc"}, expectedError: svrerror.New("invalid cursor", fiber.StatusBadRequest)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ValidateListWebhookDeliveries(&tt.query)
+			if tt.expectedError != nil {
+				assert.Equal(t, tt.expectedError, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, filter)
+		})
+	}
+}
+
+func TestValidateEventStream(t *testing.T) {
+	filter, err := ValidateEventStreamAccount("")
+	assert.NoError(t, err)
+	assert.Equal(t, apimodel.EventStreamFilter{}, filter)
+
+	filter, err = ValidateEventStreamAccount("7")
+	assert.NoError(t, err)
+	assert.Equal(t, apimodel.EventStreamFilter{AccountID: 7}, filter)
+
+	_, err = ValidateEventStreamAccount("abc")
+	assert.Equal(t, svrerror.New("invalid account id", fiber.StatusBadRequest), err)
+
+	tests := []struct {
+		name          string
+		lastEventID   string
+		after         uint64
+		resume        bool
+		expectedError error
+	}{
+		{name: "new events only", lastEventID: ""},
+		{name: "from the start", lastEventID: "0", resume: true},
+		{name: "after an event", lastEventID: "42", after: 42, resume: true},
+		{name: "invalid", lastEventID: "42a", expectedError: svrerror.New("Last-Event-ID must be the id of an event", fiber.StatusBadRequest)},
+		{name: "negative", lastEventID: "-1", expectedError: svrerror.New("Last-Event-ID must be the id of an event", fiber.StatusBadRequest)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after, resume, err := ValidateLastEventID(tt.lastEventID)
+			if tt.expectedError != nil {
+				assert.Equal(t, tt.expectedError, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.after, after)
+			assert.Equal(t, tt.resume, resume)
+		})
+	}
+}
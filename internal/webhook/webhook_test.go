@@ -0,0 +1,36 @@
+package webhook
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	sent := time.Unix(1711929600, 0)
+	body := []byte(`{"id":1,"type":"transfer.created"}`)
+	header := Sign("secret", sent, body)
+
+	assert.Equal(t, "t=1711929600,v1=", header[:len("t=1711929600,v1=")])
+	assert.NoError(t, Verify("secret", header, body, 5*time.Minute, sent.Add(time.Minute)))
+
+	assert.Equal(t, ErrInvalidSignature, Verify("other secret", header, body, 5*time.Minute, sent))
+	assert.Equal(t, ErrInvalidSignature, Verify("secret", header, []byte(`{"id":2,"type":"transfer.created"}`), 5*time.Minute, sent))
+	assert.Equal(t, ErrInvalidSignature, Verify("secret", strings.Replace(header, "t=1711929600", "t=1711929601", 1), body, 5*time.Minute, sent))
+	assert.Equal(t, ErrInvalidSignature, Verify("secret", "v1=abc", body, 5*time.Minute, sent))
+	assert.Equal(t, ErrInvalidSignature, Verify("secret", "", body, 5*time.Minute, sent))
+	assert.Equal(t, ErrExpiredSignature, Verify("secret", header, body, 5*time.Minute, sent.Add(6*time.Minute)))
+}
+
+func TestNewSecret(t *testing.T) {
+	first, err := NewSecret()
+	require.NoError(t, err)
+	second, err := NewSecret()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(first, "whsec_"))
+	assert.Len(t, first, len("whsec_")+64)
+	assert.NotEqual(t, first, second)
+}
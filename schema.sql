@@ -1,22 +1,762 @@
 CREATE TABLE IF NOT EXISTS accounts
 (
-    id         BIGINT PRIMARY KEY,
-    created_at TIMESTAMPTZ     NOT NULL DEFAULT NOW(),
-    updated_at TIMESTAMPTZ     NOT NULL DEFAULT NOW(),
-    balance    NUMERIC(78, 18) NOT NULL DEFAULT 0
+    id              BIGINT PRIMARY KEY,
+    created_at      TIMESTAMPTZ     NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ     NOT NULL DEFAULT NOW(),
+    balance         NUMERIC(78, 18) NOT NULL DEFAULT 0,
+    currency        CHAR(3)         NOT NULL,
+    status          TEXT            NOT NULL DEFAULT 'active',
+    overdraft_limit NUMERIC(78, 18) NOT NULL DEFAULT 0,
+    CONSTRAINT chk_account_currency CHECK (currency ~ '^[A-Z]{3}$'),
+    CONSTRAINT chk_account_status CHECK (status IN ('active', 'frozen', 'closed')),
+    CONSTRAINT chk_account_closed_balance CHECK (status <> 'closed' OR balance = 0),
+    -- The balance may only go below zero by up to the account's overdraft limit
+    CONSTRAINT chk_account_overdraft CHECK (overdraft_limit >= 0 AND balance >= -overdraft_limit)
+);
+
+-- Upgrade an accounts table created before currencies, statuses and overdrafts. The accounts of that time were all
+-- in the one currency the deployment ran in, which the upgrade cannot know: it must be given as the app.legacy_currency
+-- setting, e.g. LEGACY_CURRENCY=SGD make migrate-db, and the upgrade fails if it is needed and not set.
+ALTER TABLE accounts
+    ADD COLUMN IF NOT EXISTS currency        CHAR(3),
+    ADD COLUMN IF NOT EXISTS status          TEXT            NOT NULL DEFAULT 'active',
+    ADD COLUMN IF NOT EXISTS overdraft_limit NUMERIC(78, 18) NOT NULL DEFAULT 0;
+DO
+$$
+BEGIN
+    IF EXISTS (SELECT 1 FROM accounts WHERE currency IS NULL)
+        AND COALESCE(current_setting('app.legacy_currency', true), '') !~ '^[A-Z]{3}$' THEN
+        RAISE EXCEPTION 'accounts without a currency need app.legacy_currency to be set to their ISO 4217 currency code, got "%"',
+            COALESCE(current_setting('app.legacy_currency', true), '');
+    END IF;
+END;
+$$;
+UPDATE accounts
+SET currency = current_setting('app.legacy_currency', true)
+WHERE currency IS NULL;
+ALTER TABLE accounts
+    ALTER COLUMN currency SET NOT NULL,
+    DROP CONSTRAINT IF EXISTS chk_account_currency,
+    ADD CONSTRAINT chk_account_currency CHECK (currency ~ '^[A-Z]{3}$'),
+    DROP CONSTRAINT IF EXISTS chk_account_status,
+    ADD CONSTRAINT chk_account_status CHECK (status IN ('active', 'frozen', 'closed')),
+    DROP CONSTRAINT IF EXISTS chk_account_closed_balance,
+    ADD CONSTRAINT chk_account_closed_balance CHECK (status <> 'closed' OR balance = 0),
+    DROP CONSTRAINT IF EXISTS chk_account_overdraft,
+    ADD CONSTRAINT chk_account_overdraft CHECK (overdraft_limit >= 0 AND balance >= -overdraft_limit);
+
+CREATE TABLE IF NOT EXISTS account_status_changes
+(
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    account_id  BIGINT      NOT NULL,
+    from_status TEXT        NOT NULL,
+    to_status   TEXT        NOT NULL,
+    reason      TEXT        NOT NULL,
+    CONSTRAINT fk_account
+        FOREIGN KEY (account_id)
+            REFERENCES accounts (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_status_changes_account_id ON account_status_changes (account_id, id);
+
+-- Per-account overrides of the default limits. NULL falls back to the default.
+CREATE TABLE IF NOT EXISTS account_limits
+(
+    account_id            BIGINT PRIMARY KEY,
+    updated_at            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    max_transfer_amount   NUMERIC(78, 18),
+    daily_amount          NUMERIC(78, 18),
+    rolling_30_day_amount NUMERIC(78, 18),
+    hourly_count          BIGINT,
+    CONSTRAINT fk_account
+        FOREIGN KEY (account_id)
+            REFERENCES accounts (id),
+    CONSTRAINT chk_account_limits_positive CHECK (
+        max_transfer_amount > 0 AND daily_amount > 0 AND rolling_30_day_amount > 0 AND hourly_count > 0
+        )
+);
+
+-- An account's currency is set when it is opened and can never change
+CREATE OR REPLACE FUNCTION prevent_account_currency_change() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF NEW.currency <> OLD.currency THEN
+        RAISE EXCEPTION 'currency of account % cannot be changed', OLD.id;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS accounts_currency_immutable ON accounts;
+CREATE TRIGGER accounts_currency_immutable
+    BEFORE UPDATE OF currency
+    ON accounts
+    FOR EACH ROW
+EXECUTE FUNCTION prevent_account_currency_change();
+
+CREATE TABLE IF NOT EXISTS fx_rates
+(
+    base_currency  CHAR(3)         NOT NULL,
+    quote_currency CHAR(3)         NOT NULL,
+    rate           NUMERIC(78, 18) NOT NULL,
+    updated_at     TIMESTAMPTZ     NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (base_currency, quote_currency),
+    CONSTRAINT chk_fx_rate_positive CHECK (rate > 0)
+);
+
+CREATE TABLE IF NOT EXISTS fx_quotes
+(
+    id                   BIGSERIAL PRIMARY KEY,
+    created_at           TIMESTAMPTZ     NOT NULL DEFAULT NOW(),
+    source_currency      CHAR(3)         NOT NULL,
+    destination_currency CHAR(3)         NOT NULL,
+    source_amount        NUMERIC(78, 18) NOT NULL,
+    destination_amount   NUMERIC(78, 18) NOT NULL,
+    rate                 NUMERIC(78, 18) NOT NULL,
+    rounding_adjustment  NUMERIC(78, 18) NOT NULL,
+    expires_at           TIMESTAMPTZ     NOT NULL
+);
+
+-- The fee charged on transfers of a type in a currency. Only the columns of the fee's type are set.
+CREATE TABLE IF NOT EXISTS fee_schedules
+(
+    transfer_type      TEXT        NOT NULL,
+    currency           CHAR(3)     NOT NULL,
+    type               TEXT        NOT NULL,
+    revenue_account_id BIGINT      NOT NULL,
+    flat_amount        NUMERIC(78, 18),
+    percentage         NUMERIC(78, 18),
+    min_amount         NUMERIC(78, 18),
+    max_amount         NUMERIC(78, 18),
+    tiers              JSONB,
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (transfer_type, currency),
+    CONSTRAINT fk_revenue_account
+        FOREIGN KEY (revenue_account_id)
+            REFERENCES accounts (id),
+    CONSTRAINT chk_fee_schedule_transfer_type CHECK (transfer_type IN ('standard', 'cross_currency')),
+    CONSTRAINT chk_fee_schedule_type CHECK (
+        type = 'flat' AND flat_amount > 0
+            OR type = 'percentage' AND percentage > 0 AND percentage <= 100
+            OR type = 'tiered' AND jsonb_typeof(tiers) = 'array')
+);
+
+CREATE TABLE IF NOT EXISTS transfer_batches
+(
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    mode       TEXT        NOT NULL,
+    item_count INTEGER     NOT NULL,
+    CONSTRAINT chk_transfer_batch_mode CHECK (mode IN ('atomic', 'best_effort'))
 );
 
 CREATE TABLE IF NOT EXISTS transfers
 (
     id                     BIGSERIAL PRIMARY KEY,
     created_at             TIMESTAMPTZ     NOT NULL DEFAULT NOW(),
+    source_account_id      BIGINT,
+    destination_account_id BIGINT,
+    amount                 NUMERIC(78, 18) NOT NULL,
+    currency               CHAR(3)         NOT NULL,
+    source_balance_after   NUMERIC(78, 18),
+    destination_amount     NUMERIC(78, 18) NOT NULL,
+    destination_currency   CHAR(3)         NOT NULL,
+    fx_rate                NUMERIC(78, 18),
+    fx_rounding_adjustment NUMERIC(78, 18),
+    fx_quote_id            BIGINT UNIQUE,
+    reversal_of_id         BIGINT,
+    batch_id               BIGINT,
+    fee_amount             NUMERIC(78, 18),
+    fee_account_id         BIGINT,
+    reference              TEXT            NOT NULL DEFAULT '',
+    description            TEXT            NOT NULL DEFAULT '',
+    metadata               JSONB,
+    external_id            TEXT,
+    -- The position in the hash chain of transfers and the transfer's hash, given out when the transfer is booked
+    chain_sequence         BIGINT UNIQUE,
+    hash                   CHAR(64),
+    CONSTRAINT fk_source_account
+        FOREIGN KEY (source_account_id)
+            REFERENCES accounts (id),
+    CONSTRAINT fk_destination_account
+        FOREIGN KEY (destination_account_id)
+            REFERENCES accounts (id),
+    CONSTRAINT fk_reversal_of
+        FOREIGN KEY (reversal_of_id)
+            REFERENCES transfers (id),
+    CONSTRAINT fk_fx_quote
+        FOREIGN KEY (fx_quote_id)
+            REFERENCES fx_quotes (id),
+    CONSTRAINT fk_transfer_batch
+        FOREIGN KEY (batch_id)
+            REFERENCES transfer_batches (id),
+    CONSTRAINT fk_fee_account
+        FOREIGN KEY (fee_account_id)
+            REFERENCES accounts (id),
+    CONSTRAINT chk_transfer_fee CHECK ((fee_amount IS NULL) = (fee_account_id IS NULL) AND fee_amount > 0),
+    CONSTRAINT chk_transfer_metadata CHECK (jsonb_typeof(metadata) = 'object'),
+    -- Only cross-currency transfers carry a rate
+    CONSTRAINT chk_transfer_fx CHECK ((fx_rate IS NOT NULL) = (currency <> destination_currency)),
+    -- Multi-leg transfers have neither a source nor a destination account, their accounts are in transfer_legs
+    CONSTRAINT chk_transfer_accounts CHECK (
+        source_account_id IS NOT NULL AND destination_account_id IS NOT NULL AND source_balance_after IS NOT NULL
+            OR source_account_id IS NULL AND destination_account_id IS NULL AND source_balance_after IS NULL),
+    CONSTRAINT chk_transfer_chain CHECK ((chain_sequence IS NULL) = (hash IS NULL))
+);
+
+-- Upgrade a transfers table created by an earlier version of this file. Transfers of that time were between two
+-- accounts in the legacy currency and balances only ever changed by transfers, so the source balance after each transfer can be worked back
+-- from the account's current balance.
+ALTER TABLE transfers
+    ALTER COLUMN source_account_id DROP NOT NULL,
+    ALTER COLUMN destination_account_id DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS currency               CHAR(3),
+    ADD COLUMN IF NOT EXISTS source_balance_after   NUMERIC(78, 18),
+    ADD COLUMN IF NOT EXISTS destination_amount     NUMERIC(78, 18),
+    ADD COLUMN IF NOT EXISTS destination_currency   CHAR(3),
+    ADD COLUMN IF NOT EXISTS fx_rate                NUMERIC(78, 18),
+    ADD COLUMN IF NOT EXISTS fx_rounding_adjustment NUMERIC(78, 18),
+    ADD COLUMN IF NOT EXISTS fx_quote_id            BIGINT UNIQUE,
+    ADD COLUMN IF NOT EXISTS reversal_of_id         BIGINT,
+    ADD COLUMN IF NOT EXISTS batch_id               BIGINT,
+    ADD COLUMN IF NOT EXISTS fee_amount             NUMERIC(78, 18),
+    ADD COLUMN IF NOT EXISTS fee_account_id         BIGINT,
+    ADD COLUMN IF NOT EXISTS reference              TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS description            TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS metadata               JSONB,
+    ADD COLUMN IF NOT EXISTS external_id            TEXT,
+    ADD COLUMN IF NOT EXISTS chain_sequence         BIGINT UNIQUE,
+    ADD COLUMN IF NOT EXISTS hash                   CHAR(64);
+UPDATE transfers t
+SET currency = a.currency
+FROM accounts a
+WHERE a.id = t.source_account_id
+  AND t.currency IS NULL;
+UPDATE transfers
+SET destination_amount   = amount,
+    destination_currency = currency
+WHERE destination_amount IS NULL;
+UPDATE transfers t
+SET source_balance_after = a.balance - COALESCE((SELECT SUM(CASE
+                                                                WHEN later.source_account_id = t.source_account_id
+                                                                    THEN -later.amount
+                                                                ELSE later.amount END)
+                                                 FROM transfers later
+                                                 WHERE later.id > t.id
+                                                   AND t.source_account_id IN
+                                                       (later.source_account_id, later.destination_account_id)), 0)
+FROM accounts a
+WHERE a.id = t.source_account_id
+  AND t.source_balance_after IS NULL;
+ALTER TABLE transfers
+    ALTER COLUMN currency SET NOT NULL,
+    ALTER COLUMN destination_amount SET NOT NULL,
+    ALTER COLUMN destination_currency SET NOT NULL,
+    DROP CONSTRAINT IF EXISTS fk_reversal_of,
+    ADD CONSTRAINT fk_reversal_of FOREIGN KEY (reversal_of_id) REFERENCES transfers (id),
+    DROP CONSTRAINT IF EXISTS fk_fx_quote,
+    ADD CONSTRAINT fk_fx_quote FOREIGN KEY (fx_quote_id) REFERENCES fx_quotes (id),
+    DROP CONSTRAINT IF EXISTS fk_transfer_batch,
+    ADD CONSTRAINT fk_transfer_batch FOREIGN KEY (batch_id) REFERENCES transfer_batches (id),
+    DROP CONSTRAINT IF EXISTS fk_fee_account,
+    ADD CONSTRAINT fk_fee_account FOREIGN KEY (fee_account_id) REFERENCES accounts (id),
+    DROP CONSTRAINT IF EXISTS chk_transfer_fee,
+    ADD CONSTRAINT chk_transfer_fee CHECK ((fee_amount IS NULL) = (fee_account_id IS NULL) AND fee_amount > 0),
+    DROP CONSTRAINT IF EXISTS chk_transfer_metadata,
+    ADD CONSTRAINT chk_transfer_metadata CHECK (jsonb_typeof(metadata) = 'object'),
+    DROP CONSTRAINT IF EXISTS chk_transfer_fx,
+    ADD CONSTRAINT chk_transfer_fx CHECK ((fx_rate IS NOT NULL) = (currency <> destination_currency)),
+    DROP CONSTRAINT IF EXISTS chk_transfer_accounts,
+    ADD CONSTRAINT chk_transfer_accounts CHECK (
+        source_account_id IS NOT NULL AND destination_account_id IS NOT NULL AND source_balance_after IS NOT NULL
+            OR source_account_id IS NULL AND destination_account_id IS NULL AND source_balance_after IS NULL),
+    DROP CONSTRAINT IF EXISTS chk_transfer_chain,
+    ADD CONSTRAINT chk_transfer_chain CHECK ((chain_sequence IS NULL) = (hash IS NULL));
+
+-- Support listing an account's transfers newest first with keyset pagination over id
+CREATE INDEX IF NOT EXISTS idx_transfers_source_account_id ON transfers (source_account_id, id);
+CREATE INDEX IF NOT EXISTS idx_transfers_destination_account_id ON transfers (destination_account_id, id);
+-- External IDs are unique per source account. NULLs are distinct, so transfers without one are not affected.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transfers_source_account_id_external_id ON transfers (source_account_id, external_id);
+CREATE INDEX IF NOT EXISTS idx_transfers_reversal_of_id ON transfers (reversal_of_id);
+CREATE INDEX IF NOT EXISTS idx_transfers_batch_id ON transfers (batch_id);
+-- Support summing an account's recent outgoing transfers for its limits
+CREATE INDEX IF NOT EXISTS idx_transfers_source_account_id_created_at ON transfers (source_account_id, created_at);
+-- Transfers booked before transfers were chained are backfilled in order of their ID
+CREATE INDEX IF NOT EXISTS idx_transfers_unchained ON transfers (id) WHERE chain_sequence IS NULL;
+
+CREATE TABLE IF NOT EXISTS transfer_legs
+(
+    id            BIGSERIAL PRIMARY KEY,
+    created_at    TIMESTAMPTZ     NOT NULL DEFAULT NOW(),
+    transfer_id   BIGINT          NOT NULL,
+    account_id    BIGINT          NOT NULL,
+    amount        NUMERIC(78, 18) NOT NULL,
+    balance_after NUMERIC(78, 18) NOT NULL,
+    CONSTRAINT fk_transfer
+        FOREIGN KEY (transfer_id)
+            REFERENCES transfers (id),
+    CONSTRAINT fk_account
+        FOREIGN KEY (account_id)
+            REFERENCES accounts (id),
+    CONSTRAINT chk_transfer_leg_amount CHECK (amount <> 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_transfer_legs_transfer_id ON transfer_legs (transfer_id);
+-- Support listing an account's transfers and summing its outgoing legs for its limits
+CREATE INDEX IF NOT EXISTS idx_transfer_legs_account_id_created_at ON transfer_legs (account_id, created_at);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    key          TEXT PRIMARY KEY,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    request_hash TEXT        NOT NULL,
+    transfer_id  BIGINT      NOT NULL,
+    CONSTRAINT fk_transfer
+        FOREIGN KEY (transfer_id)
+            REFERENCES transfers (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys (created_at);
+
+CREATE TABLE IF NOT EXISTS journal_entries
+(
+    id            BIGSERIAL PRIMARY KEY,
+    created_at    TIMESTAMPTZ     NOT NULL DEFAULT NOW(),
+    transfer_id   BIGINT,
+    account_id    BIGINT,
+    currency      CHAR(3)         NOT NULL,
+    amount        NUMERIC(78, 18) NOT NULL,
+    balance_after NUMERIC(78, 18),
+    CONSTRAINT fk_transfer
+        FOREIGN KEY (transfer_id)
+            REFERENCES transfers (id),
+    CONSTRAINT fk_account
+        FOREIGN KEY (account_id)
+            REFERENCES accounts (id),
+    -- Postings without an account are FX positions, which belong to a transfer and have no running balance
+    CONSTRAINT chk_journal_entry_fx_position CHECK (
+        account_id IS NOT NULL AND balance_after IS NOT NULL
+            OR account_id IS NULL AND balance_after IS NULL AND transfer_id IS NOT NULL)
+);
+
+-- Upgrade a journal_entries table created before FX positions, when every posting was to an account
+ALTER TABLE journal_entries
+    ALTER COLUMN account_id DROP NOT NULL,
+    ALTER COLUMN balance_after DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS currency CHAR(3);
+UPDATE journal_entries j
+SET currency = a.currency
+FROM accounts a
+WHERE a.id = j.account_id
+  AND j.currency IS NULL;
+ALTER TABLE journal_entries
+    ALTER COLUMN currency SET NOT NULL,
+    DROP CONSTRAINT IF EXISTS chk_journal_entry_fx_position,
+    ADD CONSTRAINT chk_journal_entry_fx_position CHECK (
+        account_id IS NOT NULL AND balance_after IS NOT NULL
+            OR account_id IS NULL AND balance_after IS NULL AND transfer_id IS NOT NULL);
+
+-- Post the balance of accounts opened before the journal as their opening balance, like the opening balance of a new
+-- account: without a transfer, so it has no offsetting posting. Accounts with a balance always have postings once the
+-- journal exists, so this only matches the first time schema.sql is applied to such a database. The postings are
+-- dated when they are made; the journal has no history from before it existed.
+INSERT INTO journal_entries (account_id, currency, amount, balance_after)
+SELECT a.id, a.currency, a.balance, a.balance
+FROM accounts a
+WHERE a.balance <> 0
+  AND NOT EXISTS (SELECT 1 FROM journal_entries j WHERE j.account_id = a.id)
+ORDER BY a.id;
+
+CREATE INDEX IF NOT EXISTS idx_journal_entries_transfer_id ON journal_entries (transfer_id);
+CREATE INDEX IF NOT EXISTS idx_journal_entries_account_id ON journal_entries (account_id, id);
+-- Support point-in-time balances and snapshotting the postings since the previous snapshot
+CREATE INDEX IF NOT EXISTS idx_journal_entries_account_id_created_at ON journal_entries (account_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_journal_entries_created_at ON journal_entries (created_at);
+
+-- The balance of an account as of a point in time: the sum of its postings created up to and including as_of
+CREATE TABLE IF NOT EXISTS balance_snapshots
+(
+    account_id BIGINT          NOT NULL,
+    as_of      TIMESTAMPTZ     NOT NULL,
+    balance    NUMERIC(78, 18) NOT NULL,
+    created_at TIMESTAMPTZ     NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (account_id, as_of),
+    CONSTRAINT fk_account
+        FOREIGN KEY (account_id)
+            REFERENCES accounts (id)
+);
+
+-- The postings of a transfer must sum to zero in each currency. Checked at commit time so that all postings can be
+-- inserted first.
+CREATE OR REPLACE FUNCTION check_journal_entries_balanced() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF EXISTS (SELECT 1
+               FROM journal_entries
+               WHERE transfer_id = NEW.transfer_id
+               GROUP BY currency
+               HAVING SUM(amount) <> 0) THEN
+        RAISE EXCEPTION 'journal entries for transfer % do not sum to zero', NEW.transfer_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS journal_entries_balanced ON journal_entries;
+CREATE CONSTRAINT TRIGGER journal_entries_balanced
+    AFTER INSERT OR UPDATE
+    ON journal_entries
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW
+    WHEN (NEW.transfer_id IS NOT NULL)
+EXECUTE FUNCTION check_journal_entries_balanced();
+
+CREATE TABLE IF NOT EXISTS holds
+(
+    id                     BIGSERIAL PRIMARY KEY,
+    created_at             TIMESTAMPTZ     NOT NULL DEFAULT NOW(),
+    updated_at             TIMESTAMPTZ     NOT NULL DEFAULT NOW(),
+    account_id             BIGINT          NOT NULL,
+    destination_account_id BIGINT          NOT NULL,
+    amount                 NUMERIC(78, 18) NOT NULL,
+    currency               CHAR(3)         NOT NULL,
+    status                 TEXT            NOT NULL DEFAULT 'active',
+    expires_at             TIMESTAMPTZ     NOT NULL,
+    captured_amount        NUMERIC(78, 18),
+    transfer_id            BIGINT,
+    CONSTRAINT fk_account
+        FOREIGN KEY (account_id)
+            REFERENCES accounts (id),
+    CONSTRAINT fk_destination_account
+        FOREIGN KEY (destination_account_id)
+            REFERENCES accounts (id),
+    CONSTRAINT fk_transfer
+        FOREIGN KEY (transfer_id)
+            REFERENCES transfers (id),
+    CONSTRAINT chk_hold_status CHECK (status IN ('active', 'captured', 'voided', 'expired'))
+);
+
+-- Upgrade a holds table created before currencies
+ALTER TABLE holds
+    ADD COLUMN IF NOT EXISTS currency CHAR(3);
+UPDATE holds h
+SET currency = a.currency
+FROM accounts a
+WHERE a.id = h.account_id
+  AND h.currency IS NULL;
+ALTER TABLE holds
+    ALTER COLUMN currency SET NOT NULL;
+
+-- Sum of active holds per account for the available balance, and the expiry sweep
+CREATE INDEX IF NOT EXISTS idx_holds_active ON holds (account_id, expires_at) WHERE status = 'active';
+
+CREATE TABLE IF NOT EXISTS scheduled_transfers
+(
+    id                     BIGSERIAL PRIMARY KEY,
+    created_at             TIMESTAMPTZ     NOT NULL DEFAULT NOW(),
+    updated_at             TIMESTAMPTZ     NOT NULL DEFAULT NOW(),
     source_account_id      BIGINT          NOT NULL,
     destination_account_id BIGINT          NOT NULL,
     amount                 NUMERIC(78, 18) NOT NULL,
+    currency               CHAR(3)         NOT NULL,
+    status                 TEXT            NOT NULL DEFAULT 'pending',
+    execute_at             TIMESTAMPTZ     NOT NULL,
+    next_attempt_at        TIMESTAMPTZ     NOT NULL,
+    attempt_count          INTEGER         NOT NULL DEFAULT 0,
+    transfer_id            BIGINT,
     CONSTRAINT fk_source_account
         FOREIGN KEY (source_account_id)
             REFERENCES accounts (id),
     CONSTRAINT fk_destination_account
         FOREIGN KEY (destination_account_id)
-            REFERENCES accounts (id)
+            REFERENCES accounts (id),
+    CONSTRAINT fk_transfer
+        FOREIGN KEY (transfer_id)
+            REFERENCES transfers (id),
+    CONSTRAINT chk_scheduled_transfer_status CHECK (status IN ('pending', 'completed', 'failed', 'cancelled')),
+    CONSTRAINT chk_scheduled_transfer_completed CHECK ((status = 'completed') = (transfer_id IS NOT NULL))
+);
+
+-- The scheduler picks pending scheduled transfers in the order they are due
+CREATE INDEX IF NOT EXISTS idx_scheduled_transfers_due ON scheduled_transfers (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_scheduled_transfers_source_account_id ON scheduled_transfers (source_account_id, id);
+CREATE INDEX IF NOT EXISTS idx_scheduled_transfers_destination_account_id ON scheduled_transfers (destination_account_id, id);
+
+CREATE TABLE IF NOT EXISTS scheduled_transfer_attempts
+(
+    id                    BIGSERIAL PRIMARY KEY,
+    created_at            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    scheduled_transfer_id BIGINT      NOT NULL,
+    status                TEXT        NOT NULL,
+    transfer_id           BIGINT,
+    error                 TEXT        NOT NULL DEFAULT '',
+    CONSTRAINT fk_scheduled_transfer
+        FOREIGN KEY (scheduled_transfer_id)
+            REFERENCES scheduled_transfers (id),
+    CONSTRAINT fk_transfer
+        FOREIGN KEY (transfer_id)
+            REFERENCES transfers (id),
+    CONSTRAINT chk_scheduled_transfer_attempt_status CHECK (status IN ('succeeded', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_transfer_attempts_scheduled_transfer_id ON scheduled_transfer_attempts (scheduled_transfer_id, id);
+
+CREATE TABLE IF NOT EXISTS standing_orders
+(
+    id                     BIGSERIAL PRIMARY KEY,
+    created_at             TIMESTAMPTZ     NOT NULL DEFAULT NOW(),
+    updated_at             TIMESTAMPTZ     NOT NULL DEFAULT NOW(),
+    source_account_id      BIGINT          NOT NULL,
+    destination_account_id BIGINT          NOT NULL,
+    amount                 NUMERIC(78, 18) NOT NULL,
+    currency               CHAR(3)         NOT NULL,
+    frequency              TEXT            NOT NULL,
+    cron_expression        TEXT            NOT NULL DEFAULT '',
+    start_at               TIMESTAMPTZ     NOT NULL,
+    end_at                 TIMESTAMPTZ,
+    max_occurrences        INTEGER,
+    on_insufficient_funds  TEXT            NOT NULL,
+    retry_count            INTEGER         NOT NULL DEFAULT 0,
+    missed_occurrences     TEXT            NOT NULL DEFAULT 'skip',
+    status                 TEXT            NOT NULL DEFAULT 'active',
+    next_run_at            TIMESTAMPTZ     NOT NULL,
+    next_attempt_at        TIMESTAMPTZ     NOT NULL,
+    occurrence_count       INTEGER         NOT NULL DEFAULT 0,
+    attempt_count          INTEGER         NOT NULL DEFAULT 0,
+    CONSTRAINT fk_source_account
+        FOREIGN KEY (source_account_id)
+            REFERENCES accounts (id),
+    CONSTRAINT fk_destination_account
+        FOREIGN KEY (destination_account_id)
+            REFERENCES accounts (id),
+    CONSTRAINT chk_standing_order_frequency CHECK (
+        frequency IN ('weekly', 'monthly') AND cron_expression = ''
+            OR frequency = 'cron' AND cron_expression <> ''),
+    CONSTRAINT chk_standing_order_on_insufficient_funds CHECK (on_insufficient_funds IN ('skip', 'retry', 'suspend')),
+    CONSTRAINT chk_standing_order_missed_occurrences CHECK (missed_occurrences IN ('skip', 'catch_up')),
+    CONSTRAINT chk_standing_order_status CHECK (status IN ('active', 'suspended', 'completed', 'cancelled')),
+    CONSTRAINT chk_standing_order_max_occurrences CHECK (max_occurrences > 0)
+);
+
+-- Upgrade a standing_orders table created before missed occurrences could be skipped. Orders that exist keep
+-- catching up, as they did when they were created.
+ALTER TABLE standing_orders
+    ADD COLUMN IF NOT EXISTS missed_occurrences TEXT NOT NULL DEFAULT 'catch_up';
+ALTER TABLE standing_orders
+    ALTER COLUMN missed_occurrences SET DEFAULT 'skip',
+    DROP CONSTRAINT IF EXISTS chk_standing_order_missed_occurrences,
+    ADD CONSTRAINT chk_standing_order_missed_occurrences CHECK (missed_occurrences IN ('skip', 'catch_up'));
+
+-- The worker picks active standing orders in the order they are due
+CREATE INDEX IF NOT EXISTS idx_standing_orders_due ON standing_orders (next_attempt_at) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS idx_standing_orders_source_account_id ON standing_orders (source_account_id, id);
+CREATE INDEX IF NOT EXISTS idx_standing_orders_destination_account_id ON standing_orders (destination_account_id, id);
+
+-- Every attempt at an occurrence of a standing order, linking it to the transfers it generated
+CREATE TABLE IF NOT EXISTS standing_order_executions
+(
+    id                BIGSERIAL PRIMARY KEY,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    standing_order_id BIGINT      NOT NULL,
+    occurrence_at     TIMESTAMPTZ NOT NULL,
+    status            TEXT        NOT NULL,
+    transfer_id       BIGINT UNIQUE,
+    error             TEXT        NOT NULL DEFAULT '',
+    CONSTRAINT fk_standing_order
+        FOREIGN KEY (standing_order_id)
+            REFERENCES standing_orders (id),
+    CONSTRAINT fk_transfer
+        FOREIGN KEY (transfer_id)
+            REFERENCES transfers (id),
+    CONSTRAINT chk_standing_order_execution_status CHECK (status IN ('succeeded', 'failed', 'skipped')),
+    CONSTRAINT chk_standing_order_execution_transfer CHECK ((status = 'succeeded') = (transfer_id IS NOT NULL))
 );
+
+CREATE INDEX IF NOT EXISTS idx_standing_order_executions_standing_order_id ON standing_order_executions (standing_order_id, id);
+
+-- Events written in the same transaction as the change they describe, waiting to be fanned out to webhooks
+CREATE TABLE IF NOT EXISTS outbox_events
+(
+    id            BIGSERIAL PRIMARY KEY,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    type          TEXT        NOT NULL,
+    payload       JSONB       NOT NULL,
+    dispatched_at TIMESTAMPTZ,
+    -- The position in the event stream, given out after commit
+    sequence      BIGINT UNIQUE
+);
+
+-- Upgrade an outbox_events table created before the event stream. Events without a sequence are given one by the
+-- sequencer.
+ALTER TABLE outbox_events
+    ADD COLUMN IF NOT EXISTS sequence BIGINT UNIQUE;
+
+-- The dispatcher picks events that have not been fanned out yet in the order they were written
+CREATE INDEX IF NOT EXISTS idx_outbox_events_undispatched ON outbox_events (id) WHERE dispatched_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_events_unsequenced ON outbox_events (id) WHERE sequence IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions
+(
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    url         TEXT        NOT NULL,
+    secret      TEXT        NOT NULL,
+    event_types JSONB       NOT NULL DEFAULT '[]'
+);
+
+-- One delivery of an event to a subscription. Dead deliveries stay until they are replayed.
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id               BIGSERIAL PRIMARY KEY,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    event_id         BIGINT      NOT NULL,
+    subscription_id  BIGINT      NOT NULL,
+    status           TEXT        NOT NULL DEFAULT 'pending',
+    attempt_count    INT         NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMPTZ NOT NULL,
+    last_attempt_at  TIMESTAMPTZ,
+    last_status_code INT,
+    last_error       TEXT        NOT NULL DEFAULT '',
+    delivered_at     TIMESTAMPTZ,
+    CONSTRAINT fk_event
+        FOREIGN KEY (event_id)
+            REFERENCES outbox_events (id),
+    CONSTRAINT fk_subscription
+        FOREIGN KEY (subscription_id)
+            REFERENCES webhook_subscriptions (id)
+            ON DELETE CASCADE,
+    CONSTRAINT chk_webhook_delivery_status CHECK (status IN ('pending', 'delivered', 'dead'))
+);
+
+-- The dispatcher only claims the oldest pending delivery of each subscription
+DROP INDEX IF EXISTS idx_webhook_deliveries_due;
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending ON webhook_deliveries (subscription_id, id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_event_id ON webhook_deliveries (event_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription_id ON webhook_deliveries (subscription_id, id);
+
+-- The append-only log of everything that changed the accounts table, from which accounts can be rebuilt
+CREATE TABLE IF NOT EXISTS ledger_events
+(
+    sequence   BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    type       TEXT        NOT NULL,
+    payload    JSONB       NOT NULL,
+    CONSTRAINT chk_ledger_event_type CHECK (type IN
+                                            ('AccountOpened', 'FundsTransferred', 'AccountStatusChanged',
+                                             'OverdraftLimitChanged'))
+);
+
+CREATE OR REPLACE FUNCTION prevent_ledger_event_change() RETURNS TRIGGER AS
+$$
+BEGIN
+    RAISE EXCEPTION 'ledger events are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ledger_events_append_only ON ledger_events;
+CREATE TRIGGER ledger_events_append_only
+    BEFORE UPDATE OR DELETE
+    ON ledger_events
+    FOR EACH ROW
+EXECUTE FUNCTION prevent_ledger_event_change();
+
+-- Open accounts from before the ledger in the ledger, with the balance, status and overdraft limit they have now, so
+-- that replaying the ledger rebuilds them. Accounts opened since all have an AccountOpened event, so this only matches
+-- the first time schema.sql is applied to such a database.
+WITH legacy AS (SELECT *
+                FROM accounts a
+                WHERE NOT EXISTS (SELECT 1
+                                  FROM ledger_events e
+                                  WHERE e.type = 'AccountOpened'
+                                    AND (e.payload ->> 'account_id')::BIGINT = a.id))
+INSERT
+INTO ledger_events (type, payload)
+SELECT type, payload
+FROM (SELECT id,
+             1                 AS step,
+             'AccountOpened'   AS type,
+             jsonb_build_object('account_id', id, 'currency', currency, 'initial_balance', balance::TEXT,
+                                'opened_at', created_at) AS payload
+      FROM legacy
+      UNION ALL
+      SELECT id,
+             2,
+             'AccountStatusChanged',
+             jsonb_build_object('account_id', id, 'from_status', 'active', 'to_status', status, 'reason',
+                                'status when the ledger was started')
+      FROM legacy
+      WHERE status <> 'active'
+      UNION ALL
+      SELECT id,
+             3,
+             'OverdraftLimitChanged',
+             jsonb_build_object('account_id', id, 'overdraft_limit', overdraft_limit::TEXT)
+      FROM legacy
+      WHERE overdraft_limit <> 0) AS events
+ORDER BY id, step;
+
+-- A transfer's signed receipt, issued once and then returned as it was signed
+CREATE TABLE IF NOT EXISTS transfer_receipts
+(
+    transfer_id BIGINT PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    key_id      TEXT        NOT NULL,
+    payload     TEXT        NOT NULL,
+    signature   TEXT        NOT NULL,
+    CONSTRAINT fk_transfer
+        FOREIGN KEY (transfer_id)
+            REFERENCES transfers (id)
+);
+
+-- The last transfer of the hash chain, in a single row. It moves on in the same transaction as every transfer is
+-- chained and can only move forward, so removing transfers from the end of the chain is noticed by comparing the
+-- chain with its head.
+CREATE TABLE IF NOT EXISTS transfer_chain_heads
+(
+    id             SMALLINT PRIMARY KEY,
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    chain_sequence BIGINT      NOT NULL,
+    hash           TEXT        NOT NULL,
+    CONSTRAINT chk_transfer_chain_head_single_row CHECK (id = 1)
+);
+
+-- Start from the end of a chain built by an earlier version of the service, or from an empty chain
+INSERT INTO transfer_chain_heads (id, chain_sequence, hash)
+SELECT 1, COALESCE(last.chain_sequence, 0), COALESCE(last.hash, '')
+FROM (SELECT 1) AS one
+         LEFT JOIN (SELECT chain_sequence, hash
+                    FROM transfers
+                    WHERE chain_sequence IS NOT NULL
+                    ORDER BY chain_sequence DESC
+                    LIMIT 1) AS last ON TRUE
+ON CONFLICT (id) DO NOTHING;
+
+CREATE OR REPLACE FUNCTION prevent_transfer_chain_head_rewind() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF TG_OP IN ('DELETE', 'TRUNCATE') THEN
+        RAISE EXCEPTION 'the transfer chain head cannot be deleted';
+    END IF;
+    IF NEW.chain_sequence <= OLD.chain_sequence THEN
+        RAISE EXCEPTION 'the transfer chain head can only move forward';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS transfer_chain_heads_forward_only ON transfer_chain_heads;
+CREATE TRIGGER transfer_chain_heads_forward_only
+    BEFORE UPDATE OR DELETE
+    ON transfer_chain_heads
+    FOR EACH ROW
+EXECUTE FUNCTION prevent_transfer_chain_head_rewind();
+
+DROP TRIGGER IF EXISTS transfer_chain_heads_no_truncate ON transfer_chain_heads;
+CREATE TRIGGER transfer_chain_heads_no_truncate
+    BEFORE TRUNCATE
+    ON transfer_chain_heads
+    FOR EACH STATEMENT
+EXECUTE FUNCTION prevent_transfer_chain_head_rewind();
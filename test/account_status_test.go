@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func changeTestAccountStatus(t *testing.T, app *fiber.App, accountID uint64, payload string) int {
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/admin/accounts/%d/status", accountID), strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp.StatusCode
+}
+
+func TestAccountStatusTransitions(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	tests := []struct {
+		name       string
+		accountID  uint64
+		payload    string
+		statusCode int
+		status     string
+	}{
+		{
+			name:       "Freeze an active account",
+			accountID:  1,
+			payload:    `{"status": "frozen", "reason": "sanctions screening hit"}`,
+			statusCode: fiber.StatusOK,
+			status:     model.AccountStatusFrozen,
+		},
+		{
+			name:       "Close a frozen account",
+			accountID:  1,
+			payload:    `{"status": "closed", "reason": "customer request"}`,
+			statusCode: fiber.StatusUnprocessableEntity,
+			status:     model.AccountStatusFrozen,
+		},
+		{
+			name:       "Unfreeze",
+			accountID:  1,
+			payload:    `{"status": "active", "reason": "screening cleared"}`,
+			statusCode: fiber.StatusOK,
+			status:     model.AccountStatusActive,
+		},
+		{
+			name:       "Close an account with a balance",
+			accountID:  1,
+			payload:    `{"status": "closed", "reason": "customer request"}`,
+			statusCode: fiber.StatusUnprocessableEntity,
+			status:     model.AccountStatusActive,
+		},
+		{
+			name:       "Missing reason",
+			accountID:  2,
+			payload:    `{"status": "closed"}`,
+			statusCode: fiber.StatusBadRequest,
+			status:     model.AccountStatusActive,
+		},
+		{
+			name:       "Close an account with a zero balance",
+			accountID:  2,
+			payload:    `{"status": "closed", "reason": "customer request"}`,
+			statusCode: fiber.StatusOK,
+			status:     model.AccountStatusClosed,
+		},
+		{
+			name:       "Reopen a closed account",
+			accountID:  2,
+			payload:    `{"status": "active", "reason": "customer request"}`,
+			statusCode: fiber.StatusUnprocessableEntity,
+			status:     model.AccountStatusClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.statusCode, changeTestAccountStatus(t, svr.FiberApp, tt.accountID, tt.payload))
+			assert.Equal(t, tt.status, getTestAccount(t, svr.FiberApp, tt.accountID).Status)
+		})
+	}
+
+	t.Run("Closing an account with a balance is rejected by the schema", func(t *testing.T) {
+		err := svr.DB.Exec("UPDATE accounts SET status = ? WHERE id = 1", model.AccountStatusClosed).Error
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "chk_account_closed_balance")
+		assert.Equal(t, model.AccountStatusActive, getTestAccount(t, svr.FiberApp, 1).Status)
+	})
+
+	t.Run("Status changes are recorded with their reason", func(t *testing.T) {
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", "/admin/accounts/1/status-changes", nil))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		var body apimodel.AccountStatusChangeListResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		require.Len(t, body.Changes, 2)
+		assert.Equal(t, model.AccountStatusFrozen, body.Changes[0].ToStatus)
+		assert.Equal(t, "sanctions screening hit", body.Changes[0].Reason)
+		assert.Equal(t, model.AccountStatusActive, body.Changes[1].ToStatus)
+	})
+}
+
+func TestTransfersOnFrozenAndClosedAccounts(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(100.00), Currency: "SGD", Status: model.AccountStatusFrozen})
+	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.NewFromFloat(0), Currency: "SGD", Status: model.AccountStatusClosed})
+
+	tests := []struct {
+		name       string
+		url        string
+		payload    string
+		statusCode int
+		code       string
+	}{
+		{
+			name:       "Debit from a frozen account",
+			url:        "/transactions",
+			payload:    `{"source_account_id": 2, "destination_account_id": 1, "amount": "10", "currency": "SGD"}`,
+			statusCode: fiber.StatusForbidden,
+			code:       "account_frozen",
+		},
+		{
+			name:       "Hold on a frozen account",
+			url:        "/holds",
+			payload:    `{"account_id": 2, "destination_account_id": 1, "amount": "10", "currency": "SGD"}`,
+			statusCode: fiber.StatusForbidden,
+			code:       "account_frozen",
+		},
+		{
+			name:       "Credit to a frozen account",
+			url:        "/transactions",
+			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "10", "currency": "SGD"}`,
+			statusCode: fiber.StatusCreated,
+		},
+		{
+			name:       "Credit to a closed account",
+			url:        "/transactions",
+			payload:    `{"source_account_id": 1, "destination_account_id": 3, "amount": "10", "currency": "SGD"}`,
+			statusCode: fiber.StatusUnprocessableEntity,
+			code:       "account_closed",
+		},
+		{
+			name:       "Debit from a closed account",
+			url:        "/transactions",
+			payload:    `{"source_account_id": 3, "destination_account_id": 1, "amount": "10", "currency": "SGD"}`,
+			statusCode: fiber.StatusUnprocessableEntity,
+			code:       "account_closed",
+		},
+		{
+			name: "Scheduled transfer to a closed account",
+			url:  "/scheduled-transfers",
+			payload: fmt.Sprintf(`{"source_account_id": 1, "destination_account_id": 3, "amount": "10", "currency": "SGD", "execute_at": "%s"}`,
+				time.Now().Add(time.Hour).Format(time.RFC3339)),
+			statusCode: fiber.StatusUnprocessableEntity,
+			code:       "account_closed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.url, strings.NewReader(tt.payload))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := svr.FiberApp.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+
+			if tt.code != "" {
+				var body map[string]string
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+				assert.Equal(t, tt.code, body["code"])
+			}
+		})
+	}
+
+	assert.Equal(t, "90", getTestAccount(t, svr.FiberApp, 1).Balance)
+	assert.Equal(t, "110", getTestAccount(t, svr.FiberApp, 2).Balance)
+	assert.Equal(t, "0", getTestAccount(t, svr.FiberApp, 3).Balance)
+}
+
+func TestCloseAccountWithOpenItems(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+
+	hold := createTestHold(t, svr.FiberApp, `{"account_id": 2, "destination_account_id": 1, "amount": "10", "currency": "SGD"}`)
+	scheduled := createTestScheduledTransfer(t, svr.FiberApp, scheduledTransferPayload(2, 1, "10", time.Now().Add(time.Hour)))
+	order := createTestStandingOrder(t, svr.FiberApp, standingOrderPayload("10", ""))
+
+	closeAccount := func(t *testing.T) *http.Response {
+		req := httptest.NewRequest("PUT", "/admin/accounts/1/status", strings.NewReader(`{"status": "closed", "reason": "customer request"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := svr.FiberApp.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	for _, end := range []struct {
+		name    string
+		url     string
+		details map[string]string
+	}{
+		{
+			name:    "Active hold towards the account",
+			url:     fmt.Sprintf("/holds/%d/void", hold.ID),
+			details: map[string]string{"active_holds": "1", "pending_scheduled_transfers": "1", "standing_orders": "1"},
+		},
+		{
+			name:    "Pending scheduled transfer",
+			url:     fmt.Sprintf("/scheduled-transfers/%d/cancel", scheduled.ID),
+			details: map[string]string{"active_holds": "0", "pending_scheduled_transfers": "1", "standing_orders": "1"},
+		},
+		{
+			name:    "Active standing order",
+			url:     fmt.Sprintf("/standing-orders/%d/cancel", order.ID),
+			details: map[string]string{"active_holds": "0", "pending_scheduled_transfers": "0", "standing_orders": "1"},
+		},
+	} {
+		t.Run(end.name, func(t *testing.T) {
+			resp := closeAccount(t)
+			require.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+			var body apimodel.ErrorResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			assert.Equal(t, "account_has_open_items", body.Code)
+			assert.Equal(t, end.details, body.Details)
+			assert.Equal(t, model.AccountStatusActive, getTestAccount(t, svr.FiberApp, 1).Status)
+
+			resp, err := svr.FiberApp.Test(httptest.NewRequest("POST", end.url, nil))
+			require.NoError(t, err)
+			require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		})
+	}
+
+	require.Equal(t, fiber.StatusOK, closeAccount(t).StatusCode)
+	assert.Equal(t, model.AccountStatusClosed, getTestAccount(t, svr.FiberApp, 1).Status)
+}
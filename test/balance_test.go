@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/service"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getTestBalance(t *testing.T, app *fiber.App, query string) apimodel.AccountBalanceResponse {
+	resp, err := app.Test(httptest.NewRequest("GET", "/accounts/1/balance"+query, nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var balance apimodel.AccountBalanceResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&balance))
+	return balance
+}
+
+func asOfQuery(asOf time.Time) string {
+	return "?as_of=" + url.QueryEscape(asOf.Format(time.RFC3339Nano))
+}
+
+// markTime returns a point in time that falls strictly between the postings made before and after it.
+func markTime() time.Time {
+	time.Sleep(10 * time.Millisecond)
+	mark := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	return mark
+}
+
+func TestBalanceAsOf(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	beforeOpening := markTime()
+	// The opening balances are posted to the journal when the accounts are created through the API
+	for _, payload := range []string{
+		`{"account_id": 1, "initial_balance": "100", "currency": "SGD"}`,
+		`{"account_id": 2, "initial_balance": "0", "currency": "SGD"}`,
+	} {
+		req := httptest.NewRequest("POST", "/accounts", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := svr.FiberApp.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	}
+
+	afterOpening := markTime()
+	createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "10", "currency": "SGD"}`)
+	afterFirstTransfer := markTime()
+	createTestTransfer(t, svr.FiberApp, `{"source_account_id": 2, "destination_account_id": 1, "amount": "2.5", "currency": "SGD"}`)
+	afterSecondTransfer := markTime()
+
+	expected := []struct {
+		name    string
+		asOf    time.Time
+		balance string
+	}{
+		{"Before the account was opened", beforeOpening, "0"},
+		{"After the opening balance", afterOpening, "100"},
+		{"After the first transfer", afterFirstTransfer, "90"},
+		{"After the second transfer", afterSecondTransfer, "92.5"},
+	}
+	check := func(t *testing.T) {
+		for _, tt := range expected {
+			t.Run(tt.name, func(t *testing.T) {
+				balance := getTestBalance(t, svr.FiberApp, asOfQuery(tt.asOf))
+				assert.Equal(t, tt.balance, balance.Balance)
+				assert.Equal(t, "SGD", balance.Currency)
+			})
+		}
+	}
+
+	t.Run("From the journal alone", check)
+
+	t.Run("Without as_of the balance matches the current balance", func(t *testing.T) {
+		assert.Equal(t, getTestAccount(t, svr.FiberApp, 1).Balance, getTestBalance(t, svr.FiberApp, "").Balance)
+	})
+
+	// Snapshot the balances after the first transfer; the second transfer is still summed from the journal
+	taken, err := service.TakeBalanceSnapshots(context.Background(), svr.DB, afterFirstTransfer)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), taken)
+
+	var snapshot model.BalanceSnapshot
+	require.NoError(t, svr.DB.Take(&snapshot, "account_id = ?", 1).Error)
+	assert.Equal(t, "90", snapshot.Balance.String())
+
+	t.Run("With a snapshot", check)
+
+	t.Run("Snapshots only move forward", func(t *testing.T) {
+		taken, err := service.TakeBalanceSnapshots(context.Background(), svr.DB, afterOpening)
+		require.NoError(t, err)
+		assert.Zero(t, taken)
+	})
+
+	t.Run("Only accounts with new postings are snapshotted", func(t *testing.T) {
+		createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "1", "currency": "SGD"}`)
+		svr.DB.Create(&model.Account{ID: 3, Balance: decimal.Zero, Currency: "SGD"})
+
+		taken, err := service.TakeBalanceSnapshots(context.Background(), svr.DB, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), taken)
+
+		taken, err = service.TakeBalanceSnapshots(context.Background(), svr.DB, time.Now())
+		require.NoError(t, err)
+		assert.Zero(t, taken)
+		assert.Equal(t, "91.5", getTestBalance(t, svr.FiberApp, "").Balance)
+	})
+
+	t.Run("The latest snapshot before as_of is used", func(t *testing.T) {
+		// Tamper with the snapshot to show that the postings before it are not summed again
+		require.NoError(t, svr.DB.Model(&model.BalanceSnapshot{}).
+			Where("account_id = ? AND as_of = ?", 1, snapshot.AsOf).
+			Update("balance", decimal.NewFromInt(1000)).Error)
+
+		assert.Equal(t, "100", getTestBalance(t, svr.FiberApp, asOfQuery(afterOpening)).Balance)
+		assert.Equal(t, "1002.5", getTestBalance(t, svr.FiberApp, asOfQuery(afterSecondTransfer)).Balance)
+	})
+
+	tests := []struct {
+		name       string
+		url        string
+		statusCode int
+	}{
+		{"As of the future", "/accounts/1/balance" + asOfQuery(time.Now().Add(time.Hour)), fiber.StatusBadRequest},
+		{"Invalid as_of", "/accounts/1/balance?as_of=2024-03-31", fiber.StatusBadRequest},
+		{"Unknown account", "/accounts/99/balance", fiber.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", tt.url, nil))
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func postTestBatch(t *testing.T, app *fiber.App, payload string) *http.Response {
+	req := httptest.NewRequest("POST", "/transactions/batch", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, 10000)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestAtomicBatchTransfer(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	// The second transfer is funded by the first
+	resp := postTestBatch(t, svr.FiberApp, `{"mode": "atomic", "transfers": [
+		{"source_account_id": 1, "destination_account_id": 2, "amount": "60.00", "currency": "SGD"},
+		{"source_account_id": 2, "destination_account_id": 3, "amount": "50.00", "currency": "SGD"}
+	]}`)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var batch apimodel.BatchTransferResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&batch))
+	assert.NotZero(t, batch.BatchID)
+	assert.Equal(t, model.TransferBatchModeAtomic, batch.Mode)
+	require.Len(t, batch.Results, 2)
+	for i, result := range batch.Results {
+		assert.Equal(t, i, result.Index)
+		assert.Equal(t, apimodel.BatchTransferSucceeded, result.Status)
+		require.NotNil(t, result.Transfer)
+		require.NotNil(t, result.Transfer.BatchID)
+		assert.Equal(t, batch.BatchID, *result.Transfer.BatchID)
+	}
+
+	assert.Equal(t, "40", getTestAccount(t, svr.FiberApp, 1).Balance)
+	assert.Equal(t, "10", getTestAccount(t, svr.FiberApp, 2).Balance)
+	assert.Equal(t, "50", getTestAccount(t, svr.FiberApp, 3).Balance)
+
+	var stored model.TransferBatch
+	require.NoError(t, svr.DB.Preload("Transfers").Take(&stored, "id = ?", batch.BatchID).Error)
+	assert.Equal(t, 2, stored.ItemCount)
+	assert.Len(t, stored.Transfers, 2)
+
+	t.Run("A failed transfer rolls back the batch", func(t *testing.T) {
+		resp := postTestBatch(t, svr.FiberApp, `{"mode": "atomic", "transfers": [
+			{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00", "currency": "SGD"},
+			{"source_account_id": 3, "destination_account_id": 1, "amount": "500.00", "currency": "SGD"}
+		]}`)
+		require.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+		var body apimodel.ErrorResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "transfers[1]: insufficient funds", body.Error)
+		assert.Equal(t, "insufficient_funds", body.Code)
+		assert.Equal(t, "1", body.Details["index"])
+
+		assert.Equal(t, "40", getTestAccount(t, svr.FiberApp, 1).Balance)
+		assert.Equal(t, "10", getTestAccount(t, svr.FiberApp, 2).Balance)
+
+		var batches, transfers int64
+		svr.DB.Model(&model.TransferBatch{}).Count(&batches)
+		svr.DB.Model(&model.Transfer{}).Count(&transfers)
+		assert.Equal(t, int64(1), batches)
+		assert.Equal(t, int64(2), transfers)
+	})
+
+	t.Run("An invalid transfer rejects the batch", func(t *testing.T) {
+		resp := postTestBatch(t, svr.FiberApp, `{"mode": "atomic", "transfers": [
+			{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00", "currency": "SGD"},
+			{"source_account_id": 1, "destination_account_id": 1, "amount": "10.00", "currency": "SGD"}
+		]}`)
+		require.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+		var body apimodel.ErrorResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "1", body.Details["index"])
+		assert.Equal(t, "40", getTestAccount(t, svr.FiberApp, 1).Balance)
+	})
+
+	t.Run("Idempotency keys are checked within the batch", func(t *testing.T) {
+		original := createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "5.00", "currency": "SGD", "idempotency_key": "batch-key"}`)
+
+		// The first transfer replays the one booked with its key and the second is booked as usual
+		resp := postTestBatch(t, svr.FiberApp, `{"mode": "atomic", "transfers": [
+			{"source_account_id": 1, "destination_account_id": 2, "amount": "5.00", "currency": "SGD", "idempotency_key": "batch-key"},
+			{"source_account_id": 1, "destination_account_id": 2, "amount": "5.00", "currency": "SGD", "idempotency_key": "new-batch-key"}
+		]}`)
+		require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+		var batch apimodel.BatchTransferResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&batch))
+		require.Len(t, batch.Results, 2)
+		require.NotNil(t, batch.Results[0].Transfer)
+		assert.Equal(t, original.ID, batch.Results[0].Transfer.ID)
+		require.NotNil(t, batch.Results[1].Transfer)
+		assert.NotEqual(t, original.ID, batch.Results[1].Transfer.ID)
+		assert.Equal(t, "30", getTestAccount(t, svr.FiberApp, 1).Balance)
+
+		// Reusing a key for a different transfer fails the batch
+		resp = postTestBatch(t, svr.FiberApp, `{"mode": "atomic", "transfers": [
+			{"source_account_id": 1, "destination_account_id": 2, "amount": "1.00", "currency": "SGD"},
+			{"source_account_id": 1, "destination_account_id": 2, "amount": "6.00", "currency": "SGD", "idempotency_key": "batch-key"}
+		]}`)
+		require.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+		assert.Equal(t, "30", getTestAccount(t, svr.FiberApp, 1).Balance)
+	})
+
+	t.Run("A missing account rolls back the batch", func(t *testing.T) {
+		resp := postTestBatch(t, svr.FiberApp, `{"mode": "atomic", "transfers": [
+			{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00", "currency": "SGD"},
+			{"source_account_id": 1, "destination_account_id": 99, "amount": "10.00", "currency": "SGD"}
+		]}`)
+		require.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, "30", getTestAccount(t, svr.FiberApp, 1).Balance)
+	})
+}
+
+func TestBestEffortBatchTransfer(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	resp := postTestBatch(t, svr.FiberApp, `{"mode": "best_effort", "transfers": [
+		{"source_account_id": 1, "destination_account_id": 2, "amount": "30.00", "currency": "SGD"},
+		{"source_account_id": 1, "destination_account_id": 2, "amount": "500.00", "currency": "SGD"},
+		{"source_account_id": 1, "destination_account_id": 2, "amount": "abc", "currency": "SGD"},
+		{"source_account_id": 1, "destination_account_id": 99, "amount": "10.00", "currency": "SGD"},
+		{"source_account_id": 1, "destination_account_id": 2, "amount": "20.00", "currency": "SGD"}
+	]}`)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var batch apimodel.BatchTransferResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&batch))
+	assert.Equal(t, model.TransferBatchModeBestEffort, batch.Mode)
+	require.Len(t, batch.Results, 5)
+
+	expected := []struct {
+		status string
+		error  string
+	}{
+		{apimodel.BatchTransferSucceeded, ""},
+		{apimodel.BatchTransferFailed, "insufficient funds"},
+		{apimodel.BatchTransferFailed, "invalid amount format"},
+		{apimodel.BatchTransferFailed, "destination account not found"},
+		{apimodel.BatchTransferSucceeded, ""},
+	}
+	for i, result := range batch.Results {
+		assert.Equal(t, i, result.Index)
+		assert.Equal(t, expected[i].status, result.Status, "transfer %d", i)
+		if expected[i].error == "" {
+			require.NotNil(t, result.Transfer)
+			assert.Equal(t, batch.BatchID, *result.Transfer.BatchID)
+			assert.Nil(t, result.Error)
+		} else {
+			require.NotNil(t, result.Error)
+			assert.Equal(t, expected[i].error, result.Error.Error)
+			assert.Nil(t, result.Transfer)
+		}
+	}
+	assert.Equal(t, "insufficient_funds", batch.Results[1].Error.Code)
+
+	assert.Equal(t, "50", getTestAccount(t, svr.FiberApp, 1).Balance)
+	assert.Equal(t, "50", getTestAccount(t, svr.FiberApp, 2).Balance)
+
+	// The batch ID is returned with the transfer later on
+	getResp, err := svr.FiberApp.Test(httptest.NewRequest("GET", fmt.Sprintf("/transactions/%d", batch.Results[0].Transfer.ID), nil))
+	require.NoError(t, err)
+	var transfer apimodel.TransferResponse
+	require.NoError(t, json.NewDecoder(getResp.Body).Decode(&transfer))
+	require.NotNil(t, transfer.BatchID)
+	assert.Equal(t, batch.BatchID, *transfer.BatchID)
+}
+
+func TestBatchTransferValidation(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{"Missing mode", `{"transfers": [{"source_account_id": 1, "destination_account_id": 2, "amount": "1", "currency": "SGD"}]}`},
+		{"Unknown mode", `{"mode": "eventual", "transfers": [{"source_account_id": 1, "destination_account_id": 2, "amount": "1", "currency": "SGD"}]}`},
+		{"No transfers", `{"mode": "atomic", "transfers": []}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := postTestBatch(t, svr.FiberApp, tt.payload)
+			assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
+// TestConcurrentOppositeAtomicBatches runs batches that lock the same accounts in opposite orders of their transfers,
+// which would deadlock if the accounts were not locked in a fixed order.
+func TestConcurrentOppositeAtomicBatches(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+
+	forward := `{"mode": "atomic", "transfers": [
+		{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00", "currency": "SGD"},
+		{"source_account_id": 2, "destination_account_id": 3, "amount": "10.00", "currency": "SGD"}
+	]}`
+	backward := `{"mode": "atomic", "transfers": [
+		{"source_account_id": 3, "destination_account_id": 2, "amount": "10.00", "currency": "SGD"},
+		{"source_account_id": 2, "destination_account_id": 1, "amount": "10.00", "currency": "SGD"}
+	]}`
+
+	const numBatches = 5
+	var wg sync.WaitGroup
+	for i := 0; i < numBatches; i++ {
+		for _, payload := range []string{forward, backward} {
+			wg.Add(1)
+			go func(payload string) {
+				defer wg.Done()
+				resp := postTestBatch(t, svr.FiberApp, payload)
+				assert.Equal(t, fiber.StatusCreated, resp.StatusCode)
+			}(payload)
+		}
+	}
+	wg.Wait()
+
+	for id := uint64(1); id <= 3; id++ {
+		assert.Equal(t, "1000", getTestAccount(t, svr.FiberApp, id).Balance, "account %d", id)
+	}
+
+	var transfers int64
+	svr.DB.Model(&model.Transfer{}).Where("batch_id IS NOT NULL").Count(&transfers)
+	assert.Equal(t, int64(numBatches*2*2), transfers)
+}
+
+func TestAtomicBatchLocksFeeRevenueAccountsUpFront(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	setTestFeeSchedules(t, svr.FiberApp, `{"schedules": [
+		{"transfer_type": "standard", "currency": "SGD", "type": "flat", "revenue_account_id": 1, "flat_amount": "1"}
+	]}`)
+
+	// The revenue account has the lowest ID, so the batch waits for it before locking the accounts of its transfers
+	other := svr.DB.Begin()
+	require.NoError(t, other.Exec("SELECT id FROM accounts WHERE id = 1 FOR UPDATE").Error)
+	done := make(chan int)
+	go func() {
+		resp := postTestBatch(t, svr.FiberApp, `{"mode": "atomic", "transfers": [
+			{"source_account_id": 2, "destination_account_id": 3, "amount": "10.00", "currency": "SGD"},
+			{"source_account_id": 3, "destination_account_id": 2, "amount": "5.00", "currency": "SGD"}
+		]}`)
+		done <- resp.StatusCode
+	}()
+	time.Sleep(200 * time.Millisecond)
+	assert.NoError(t, svr.DB.Exec("SELECT id FROM accounts WHERE id IN (2, 3) FOR UPDATE NOWAIT").Error)
+	require.NoError(t, other.Rollback().Error)
+
+	assert.Equal(t, fiber.StatusCreated, <-done)
+	assert.Equal(t, "2", getTestAccount(t, svr.FiberApp, 1).Balance)
+	assert.Equal(t, "94", getTestAccount(t, svr.FiberApp, 2).Balance)
+	assert.Equal(t, "4", getTestAccount(t, svr.FiberApp, 3).Balance)
+}
+
+func TestLargeAtomicBatch(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	// A payroll run pays many accounts out of one
+	const employees = 250
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100000.00), Currency: "SGD"})
+	transfers := make([]string, employees)
+	for i := range transfers {
+		id := uint64(i + 2)
+		svr.DB.Create(&model.Account{ID: id, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+		transfers[i] = fmt.Sprintf(`{"source_account_id": 1, "destination_account_id": %d, "amount": "100.00", "currency": "SGD"}`, id)
+	}
+
+	resp := postTestBatch(t, svr.FiberApp, fmt.Sprintf(`{"mode": "atomic", "transfers": [%s]}`, strings.Join(transfers, ",")))
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "75000", getTestAccount(t, svr.FiberApp, 1).Balance)
+	assert.Equal(t, "100", getTestAccount(t, svr.FiberApp, employees+1).Balance)
+}
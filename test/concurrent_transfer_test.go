@@ -14,13 +14,13 @@ import (
 
 func TestConcurrentTransfers(t *testing.T) {
 	svr := setupTestServer()
-	defer svr.DB.Migrator().DropTable(&model.Account{}, &model.Transfer{})
+	defer teardownTestServer(svr)
 
 	// Create initial accounts
-	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(1000.00)})
-	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(1000.00)})
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
 
-	payload := `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00"}`
+	payload := `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00", "currency": "SGD"}`
 
 	transferFunc := func() {
 		req := httptest.NewRequest("POST", "/transactions", strings.NewReader(payload))
@@ -57,16 +57,16 @@ func TestConcurrentTransfers(t *testing.T) {
 
 func TestConcurrentTransfersDifferentAccounts(t *testing.T) {
 	svr := setupTestServer()
-	defer svr.DB.Migrator().DropTable(&model.Account{}, &model.Transfer{})
+	defer teardownTestServer(svr)
 
 	// Create initial accounts
-	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(1000.00)})
-	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(1000.00)})
-	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.NewFromFloat(1000.00)})
-	svr.DB.Create(&model.Account{ID: 4, Balance: decimal.NewFromFloat(1000.00)})
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 4, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
 
-	payload1 := `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00"}`
-	payload2 := `{"source_account_id": 3, "destination_account_id": 4, "amount": "20.00"}`
+	payload1 := `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00", "currency": "SGD"}`
+	payload2 := `{"source_account_id": 3, "destination_account_id": 4, "amount": "20.00", "currency": "SGD"}`
 
 	transferFunc := func(payload string) {
 		req := httptest.NewRequest("POST", "/transactions", strings.NewReader(payload))
@@ -115,14 +115,14 @@ func TestConcurrentTransfersDifferentAccounts(t *testing.T) {
 
 func TestConcurrentOppositeTransfers(t *testing.T) {
 	svr := setupTestServer()
-	defer svr.DB.Migrator().DropTable(&model.Account{}, &model.Transfer{})
+	defer teardownTestServer(svr)
 
 	// Create initial accounts
-	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(1000.00)})
-	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(1000.00)})
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
 
-	payload1 := `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00"}`
-	payload2 := `{"source_account_id": 2, "destination_account_id": 1, "amount": "10.00"}`
+	payload1 := `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00", "currency": "SGD"}`
+	payload2 := `{"source_account_id": 2, "destination_account_id": 1, "amount": "10.00", "currency": "SGD"}`
 
 	transferFunc := func(payload string) {
 		req := httptest.NewRequest("POST", "/transactions", strings.NewReader(payload))
@@ -162,13 +162,13 @@ func TestConcurrentOppositeTransfers(t *testing.T) {
 
 func TestConcurrentReadAndWrite(t *testing.T) {
 	svr := setupTestServer()
-	defer svr.DB.Migrator().DropTable(&model.Account{}, &model.Transfer{})
+	defer teardownTestServer(svr)
 
 	// Create initial accounts
-	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(1000.00)})
-	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(1000.00)})
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
 
-	payload := `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00"}`
+	payload := `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00", "currency": "SGD"}`
 
 	transferFunc := func() {
 		req := httptest.NewRequest("POST", "/transactions", strings.NewReader(payload))
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/apiserver"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/service"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseEvent is an event read off GET /events/stream.
+type sseEvent struct {
+	ID    uint64
+	Type  string
+	Event apimodel.WebhookEvent
+}
+
+// startTestEventStream serves the app on a local port and feeds its event stream, and returns the server's URL and
+// a function that stops both.
+func startTestEventStream(t *testing.T, svr *apiserver.Server) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = svr.FiberApp.Listener(listener)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go service.RunEventStream(ctx, svr.DB, svr.Events, time.Second)
+
+	return "http://" + listener.Addr().String(), func() {
+		cancel()
+		_ = svr.FiberApp.ShutdownWithTimeout(time.Second)
+	}
+}
+
+// openTestEventStream connects to the event stream and returns the events read off it. The stream is closed when
+// the test ends.
+func openTestEventStream(t *testing.T, url string, lastEventID string) <-chan sseEvent {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	// The stream is subscribed to new events once it has said so
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, ": connected\n", line)
+
+	events := make(chan sseEvent, 100)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+
+		var event sseEvent
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "":
+				if event.Type != "" {
+					events <- event
+				}
+				event = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				event.ID, _ = strconv.ParseUint(strings.TrimPrefix(line, "id: "), 10, 64)
+			case strings.HasPrefix(line, "event: "):
+				event.Type = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.Event)
+			}
+		}
+	}()
+	return events
+}
+
+// nextTestEvents waits for the next count events of a stream.
+func nextTestEvents(t *testing.T, events <-chan sseEvent, count int) []sseEvent {
+	var received []sseEvent
+	timeout := time.After(5 * time.Second)
+	for len(received) < count {
+		select {
+		case event, ok := <-events:
+			require.True(t, ok, "the stream was closed")
+			received = append(received, event)
+		case <-timeout:
+			require.FailNow(t, "timed out waiting for events", "received %d of %d", len(received), count)
+		}
+	}
+	return received
+}
+
+// assertNoTestEvents checks that nothing else arrives on a stream for a little while.
+func assertNoTestEvents(t *testing.T, events <-chan sseEvent) {
+	select {
+	case event := <-events:
+		assert.Fail(t, "unexpected event", "%+v", event)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func eventTypes(events []sseEvent) []string {
+	types := make([]string, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestEventStream(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+	url, stop := startTestEventStream(t, svr)
+	defer stop()
+
+	stream := openTestEventStream(t, url+"/events/stream", "")
+
+	resp := postTestJSON(t, svr.FiberApp, "/accounts", `{"account_id": 1, "initial_balance": "100.00", "currency": "SGD"}`)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	resp = postTestJSON(t, svr.FiberApp, "/accounts", `{"account_id": 2, "initial_balance": "0", "currency": "SGD"}`)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	transfer := createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "30.00", "currency": "SGD"}`)
+
+	events := nextTestEvents(t, stream, 5)
+	assert.Equal(t, []string{model.EventTypeAccountCreated, model.EventTypeAccountCreated, model.EventTypeTransferCreated,
+		model.EventTypeBalanceChanged, model.EventTypeBalanceChanged}, eventTypes(events))
+	for i, event := range events {
+		assert.Equal(t, uint64(i+1), event.ID)
+		assert.Equal(t, event.Type, event.Event.Type)
+	}
+
+	var transferred apimodel.TransferResponse
+	require.NoError(t, json.Unmarshal(events[2].Event.Data, &transferred))
+	assert.Equal(t, transfer.ID, transferred.ID)
+
+	var credited apimodel.BalanceChangedEvent
+	require.NoError(t, json.Unmarshal(events[4].Event.Data, &credited))
+	assert.Equal(t, uint64(2), credited.AccountID)
+	assert.Equal(t, transfer.ID, credited.TransferID)
+	assert.True(t, decimal.RequireFromString("30").Equal(decimal.RequireFromString(credited.Balance)))
+
+	// A second stream only gets what happens after it connected
+	late := openTestEventStream(t, url+"/events/stream", "")
+	createTestTransfer(t, svr.FiberApp, `{"source_account_id": 2, "destination_account_id": 1, "amount": "5.00", "currency": "SGD"}`)
+	for _, stream := range []<-chan sseEvent{stream, late} {
+		events = nextTestEvents(t, stream, 3)
+		assert.Equal(t, []uint64{6, 7, 8}, []uint64{events[0].ID, events[1].ID, events[2].ID})
+	}
+	assertNoTestEvents(t, late)
+}
+
+func TestEventStreamAccountFilter(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+	url, stop := startTestEventStream(t, svr)
+	defer stop()
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	stream := openTestEventStream(t, url+"/events/stream?account_id=3", "")
+
+	resp := postTestJSON(t, svr.FiberApp, "/accounts", `{"account_id": 3, "initial_balance": "0", "currency": "SGD"}`)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00", "currency": "SGD"}`)
+	resp = postTestMultiLegTransfer(t, svr.FiberApp, `{"currency": "SGD", "sources": [{"account_id": 1, "amount": "20.00"}],
+		"destinations": [{"account_id": 2, "amount": "5.00"}, {"account_id": 3, "amount": "15.00"}]}`, "")
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	events := nextTestEvents(t, stream, 3)
+	assert.Equal(t, []string{model.EventTypeAccountCreated, model.EventTypeTransferCreated, model.EventTypeBalanceChanged}, eventTypes(events))
+
+	var changed apimodel.BalanceChangedEvent
+	require.NoError(t, json.Unmarshal(events[2].Event.Data, &changed))
+	assert.Equal(t, uint64(3), changed.AccountID)
+	assert.True(t, decimal.RequireFromString("15").Equal(decimal.RequireFromString(changed.Balance)))
+	assertNoTestEvents(t, stream)
+}
+
+func TestEventStreamResume(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+	url, stop := startTestEventStream(t, svr)
+	defer stop()
+
+	for id := 1; id <= 3; id++ {
+		resp := postTestJSON(t, svr.FiberApp, "/accounts", fmt.Sprintf(`{"account_id": %d, "initial_balance": "10.00", "currency": "SGD"}`, id))
+		require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	}
+	// Wait for the events to be numbered
+	require.Eventually(t, func() bool {
+		last, err := service.LastEventSequence(context.Background(), svr.DB)
+		return err == nil && last == 3
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// The events after Last-Event-ID are replayed, followed by new events
+	stream := openTestEventStream(t, url+"/events/stream", "1")
+	createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 3, "amount": "1.00", "currency": "SGD"}`)
+	events := nextTestEvents(t, stream, 5)
+	assert.Equal(t, []uint64{2, 3, 4, 5, 6}, []uint64{events[0].ID, events[1].ID, events[2].ID, events[3].ID, events[4].ID})
+	assert.Equal(t, []string{model.EventTypeAccountCreated, model.EventTypeAccountCreated, model.EventTypeTransferCreated,
+		model.EventTypeBalanceChanged, model.EventTypeBalanceChanged}, eventTypes(events))
+	assertNoTestEvents(t, stream)
+
+	// Resuming honours the account filter
+	stream = openTestEventStream(t, url+"/events/stream?account_id=2", "0")
+	events = nextTestEvents(t, stream, 1)
+	assert.Equal(t, uint64(2), events[0].ID)
+	assertNoTestEvents(t, stream)
+
+	// Nothing was missed
+	stream = openTestEventStream(t, url+"/events/stream", "6")
+	assertNoTestEvents(t, stream)
+}
+
+func TestEventSequenceFollowsCommitOrder(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	// The first event is written by a transaction that commits last
+	tx := svr.DB.Begin()
+	first := model.OutboxEvent{Type: model.EventTypeAccountCreated, Payload: model.JSON(`{"account_id": 1}`)}
+	require.NoError(t, tx.Create(&first).Error)
+
+	second := model.OutboxEvent{Type: model.EventTypeAccountCreated, Payload: model.JSON(`{"account_id": 2}`)}
+	require.NoError(t, svr.DB.Create(&second).Error)
+	require.Less(t, first.ID, second.ID)
+
+	numbered, err := service.SequenceEvents(context.Background(), svr.DB)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), numbered)
+
+	require.NoError(t, tx.Commit().Error)
+	numbered, err = service.SequenceEvents(context.Background(), svr.DB)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), numbered)
+
+	// A reader that saw the second event still gets the first one
+	events, err := service.ListStreamEvents(context.Background(), svr.DB, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, first.ID, events[0].ID)
+	assert.Equal(t, uint64(2), *events[0].Sequence)
+}
+
+func TestEventStreamErrors(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	tests := []struct {
+		name        string
+		url         string
+		lastEventID string
+		statusCode  int
+	}{
+		{name: "invalid account", url: "/events/stream?account_id=abc", statusCode: fiber.StatusBadRequest},
+		{name: "unknown account", url: "/events/stream?account_id=99", statusCode: fiber.StatusNotFound},
+		{name: "invalid Last-Event-ID", url: "/events/stream", lastEventID: "abc", statusCode: fiber.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			resp, err := svr.FiberApp.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func setTestFeeSchedules(t *testing.T, app *fiber.App, payload string) apimodel.FeeScheduleListResponse {
+	req := httptest.NewRequest("PUT", "/admin/fees/schedules", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var schedules apimodel.FeeScheduleListResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&schedules))
+	return schedules
+}
+
+func getTestFeeQuote(t *testing.T, app *fiber.App, query string) apimodel.FeeQuoteResponse {
+	resp, err := app.Test(httptest.NewRequest("GET", "/fees/quote?"+query, nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var quote apimodel.FeeQuoteResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&quote))
+	return quote
+}
+
+func TestFeeSchedulesAndQuotes(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 91, Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 92, Currency: "USD"})
+	svr.DB.Create(&model.Account{ID: 93, Currency: "EUR"})
+	svr.DB.Create(&model.Account{ID: 94, Currency: "SGD", Status: model.AccountStatusFrozen})
+
+	schedules := setTestFeeSchedules(t, svr.FiberApp, `{"schedules": [
+		{"transfer_type": "standard", "currency": "SGD", "type": "flat", "revenue_account_id": 91, "flat_amount": "1.50"},
+		{"transfer_type": "standard", "currency": "USD", "type": "percentage", "revenue_account_id": 92,
+			"percentage": "1.5", "min_amount": "0.50", "max_amount": "10"},
+		{"transfer_type": "cross_currency", "currency": "EUR", "type": "tiered", "revenue_account_id": 93,
+			"tiers": [{"up_to": "100", "amount": "1"}, {"up_to": "1000", "amount": "5"}, {"amount": "20"}]}
+	]}`)
+	require.Len(t, schedules.Schedules, 3)
+	assert.Equal(t, "cross_currency", schedules.Schedules[0].TransferType)
+	assert.Equal(t, []apimodel.FeeTierResponse{{UpTo: "100", Amount: "1"}, {UpTo: "1000", Amount: "5"}, {Amount: "20"}}, schedules.Schedules[0].Tiers)
+
+	// Replacing a schedule updates it in place
+	setTestFeeSchedules(t, svr.FiberApp, `{"schedules": [
+		{"transfer_type": "standard", "currency": "SGD", "type": "flat", "revenue_account_id": 91, "flat_amount": "2"}
+	]}`)
+
+	resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", "/fees/schedules", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&schedules))
+	require.Len(t, schedules.Schedules, 3)
+	assert.Equal(t, "2", schedules.Schedules[1].FlatAmount)
+
+	quotes := []struct {
+		name  string
+		query string
+		fee   string
+		total string
+	}{
+		{"Flat", "currency=SGD&amount=10", "2", "12"},
+		{"Percentage", "currency=USD&amount=100", "1.5", "101.5"},
+		{"Percentage is rounded half up", "currency=USD&amount=100.10", "1.5", "101.6"},
+		{"Percentage below the minimum", "currency=USD&amount=1", "0.5", "1.5"},
+		{"Percentage above the maximum", "currency=USD&amount=5000", "10", "5010"},
+		{"Lowest tier includes its bound", "transfer_type=cross_currency&currency=EUR&amount=100", "1", "101"},
+		{"Middle tier", "transfer_type=cross_currency&currency=EUR&amount=100.01", "5", "105.01"},
+		{"Unbounded tier", "transfer_type=cross_currency&currency=EUR&amount=5000", "20", "5020"},
+		{"No schedule", "transfer_type=cross_currency&currency=SGD&amount=10", "0", "10"},
+	}
+	for _, tt := range quotes {
+		t.Run(tt.name, func(t *testing.T) {
+			quote := getTestFeeQuote(t, svr.FiberApp, tt.query)
+			assert.Equal(t, tt.fee, quote.Fee)
+			assert.Equal(t, tt.total, quote.Total)
+		})
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		payload    string
+		statusCode int
+	}{
+		{
+			name:       "Missing revenue account",
+			method:     "PUT",
+			url:        "/admin/fees/schedules",
+			payload:    `{"schedules": [{"transfer_type": "standard", "currency": "SGD", "type": "flat", "revenue_account_id": 99, "flat_amount": "1"}]}`,
+			statusCode: fiber.StatusNotFound,
+		},
+		{
+			name:       "Revenue account in another currency",
+			method:     "PUT",
+			url:        "/admin/fees/schedules",
+			payload:    `{"schedules": [{"transfer_type": "standard", "currency": "SGD", "type": "flat", "revenue_account_id": 92, "flat_amount": "1"}]}`,
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Revenue account that is not active",
+			method:     "PUT",
+			url:        "/admin/fees/schedules",
+			payload:    `{"schedules": [{"transfer_type": "standard", "currency": "SGD", "type": "flat", "revenue_account_id": 94, "flat_amount": "1"}]}`,
+			statusCode: fiber.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Incomplete schedule",
+			method:     "PUT",
+			url:        "/admin/fees/schedules",
+			payload:    `{"schedules": [{"transfer_type": "standard", "currency": "SGD", "type": "percentage", "revenue_account_id": 91}]}`,
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Quote without an amount",
+			method:     "GET",
+			url:        "/fees/quote?currency=SGD",
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Quote for an unknown transfer type",
+			method:     "GET",
+			url:        "/fees/quote?transfer_type=instant&currency=SGD&amount=1",
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Delete a schedule",
+			method:     "DELETE",
+			url:        "/admin/fees/schedules/standard/SGD",
+			statusCode: fiber.StatusNoContent,
+		},
+		{
+			name:       "Delete a missing schedule",
+			method:     "DELETE",
+			url:        "/admin/fees/schedules/standard/SGD",
+			statusCode: fiber.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.payload))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := svr.FiberApp.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestTransferWithFee(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 9, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	setTestFeeSchedules(t, svr.FiberApp, `{"schedules": [
+		{"transfer_type": "standard", "currency": "SGD", "type": "flat", "revenue_account_id": 9, "flat_amount": "1.50"}
+	]}`)
+
+	transfer := createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "10", "currency": "SGD"}`)
+	assert.Equal(t, "10", transfer.Amount)
+	assert.Equal(t, "1.5", transfer.Fee)
+	require.NotNil(t, transfer.FeeAccountID)
+	assert.Equal(t, uint64(9), *transfer.FeeAccountID)
+	assert.Equal(t, "88.5", transfer.SourceBalance)
+
+	assert.Equal(t, "88.5", getTestAccount(t, svr.FiberApp, 1).Balance)
+	assert.Equal(t, "10", getTestAccount(t, svr.FiberApp, 2).Balance)
+	assert.Equal(t, "1.5", getTestAccount(t, svr.FiberApp, 9).Balance)
+
+	t.Run("The fee is booked as separate postings", func(t *testing.T) {
+		var entries []model.JournalEntry
+		require.NoError(t, svr.DB.Where("transfer_id = ?", transfer.ID).Order("id").Find(&entries).Error)
+		require.Len(t, entries, 4)
+		assert.Equal(t, "-10", entries[0].Amount.String())
+		assert.Equal(t, "90", entries[0].BalanceAfter.Decimal.String())
+		assert.Equal(t, "-1.5", entries[2].Amount.String())
+		assert.Equal(t, "88.5", entries[2].BalanceAfter.Decimal.String())
+		assert.Equal(t, uint64(9), *entries[3].AccountID)
+		assert.Equal(t, "1.5", entries[3].Amount.String())
+
+		for _, id := range []uint64{1, 9} {
+			resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", fmt.Sprintf("/accounts/%d?verify=true", id), nil))
+			require.NoError(t, err)
+			var account apimodel.AccountResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&account))
+			require.NotNil(t, account.LedgerConsistent)
+			assert.True(t, *account.LedgerConsistent, "account %d", id)
+		}
+	})
+
+	t.Run("The fee counts towards the funds needed", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/transactions", strings.NewReader(`{"source_account_id": 1, "destination_account_id": 2, "amount": "88", "currency": "SGD"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := svr.FiberApp.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "88.5", getTestAccount(t, svr.FiberApp, 1).Balance)
+		assert.Equal(t, "1.5", getTestAccount(t, svr.FiberApp, 9).Balance)
+	})
+
+	t.Run("Transfers out of the revenue account are not charged", func(t *testing.T) {
+		transfer := createTestTransfer(t, svr.FiberApp, `{"source_account_id": 9, "destination_account_id": 2, "amount": "1.5", "currency": "SGD"}`)
+		assert.Empty(t, transfer.Fee)
+		assert.Nil(t, transfer.FeeAccountID)
+		assert.Equal(t, "0", getTestAccount(t, svr.FiberApp, 9).Balance)
+	})
+
+	t.Run("Reversals do not refund the fee", func(t *testing.T) {
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("POST", fmt.Sprintf("/transactions/%d/reverse", transfer.ID), nil))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+		var reversal apimodel.TransferResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&reversal))
+		assert.Empty(t, reversal.Fee)
+		assert.Equal(t, "98.5", getTestAccount(t, svr.FiberApp, 1).Balance)
+	})
+
+	t.Run("A closed revenue account fails the transfer", func(t *testing.T) {
+		require.Equal(t, fiber.StatusOK, changeTestAccountStatus(t, svr.FiberApp, 9, `{"status": "closed", "reason": "fees moved"}`))
+
+		req := httptest.NewRequest("POST", "/transactions", strings.NewReader(`{"source_account_id": 1, "destination_account_id": 2, "amount": "10", "currency": "SGD"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := svr.FiberApp.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+
+		var body apimodel.ErrorResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "fee_account_unavailable", body.Code)
+		assert.Equal(t, "98.5", getTestAccount(t, svr.FiberApp, 1).Balance)
+	})
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setTestFXRates(t *testing.T, app *fiber.App, payload string) {
+	req := httptest.NewRequest("PUT", "/admin/fx/rates", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func createTestFXQuote(t *testing.T, app *fiber.App, payload string) apimodel.FXQuoteResponse {
+	req := httptest.NewRequest("POST", "/fx/quotes", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var quote apimodel.FXQuoteResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&quote))
+	return quote
+}
+
+func TestFXRatesAndQuotes(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	setTestFXRates(t, svr.FiberApp, `{"rates": [{"base_currency": "USD", "quote_currency": "SGD", "rate": "1.35"}]}`)
+	// Replacing a rate updates it in place
+	setTestFXRates(t, svr.FiberApp, `{"rates": [{"base_currency": "USD", "quote_currency": "SGD", "rate": "1.3333"}]}`)
+
+	resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", "/fx/rates", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var rates apimodel.FXRateListResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&rates))
+	require.Len(t, rates.Rates, 1)
+	assert.Equal(t, "1.3333", rates.Rates[0].Rate)
+
+	t.Run("Quote rounds down to the destination currency", func(t *testing.T) {
+		quote := createTestFXQuote(t, svr.FiberApp, `{"source_currency": "USD", "destination_currency": "SGD", "source_amount": "10.01"}`)
+		assert.Equal(t, "13.34", quote.DestinationAmount)
+		assert.Equal(t, "0.006333", quote.RoundingAdjustment)
+		assert.True(t, quote.ExpiresAt.After(time.Now()))
+	})
+
+	t.Run("Quote with the inverse rate", func(t *testing.T) {
+		quote := createTestFXQuote(t, svr.FiberApp, `{"source_currency": "SGD", "destination_currency": "USD", "source_amount": "100"}`)
+		assert.Equal(t, "75", quote.DestinationAmount)
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		payload    string
+		statusCode int
+	}{
+		{
+			name:       "Quote for a pair without a rate",
+			method:     "POST",
+			url:        "/fx/quotes",
+			payload:    `{"source_currency": "USD", "destination_currency": "EUR", "source_amount": "10"}`,
+			statusCode: fiber.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Quote in the same currency",
+			method:     "POST",
+			url:        "/fx/quotes",
+			payload:    `{"source_currency": "USD", "destination_currency": "USD", "source_amount": "10"}`,
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Negative rate",
+			method:     "PUT",
+			url:        "/admin/fx/rates",
+			payload:    `{"rates": [{"base_currency": "USD", "quote_currency": "EUR", "rate": "-1"}]}`,
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Missing quote",
+			method:     "GET",
+			url:        "/fx/quotes/999",
+			statusCode: fiber.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.payload))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := svr.FiberApp.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestCrossCurrencyTransfer(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "USD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	setTestFXRates(t, svr.FiberApp, `{"rates": [{"base_currency": "USD", "quote_currency": "SGD", "rate": "1.3333"}]}`)
+
+	quote := createTestFXQuote(t, svr.FiberApp, `{"source_currency": "USD", "destination_currency": "SGD", "source_amount": "10.01"}`)
+	payload := fmt.Sprintf(`{"source_account_id": 1, "destination_account_id": 2, "amount": "10.01", "currency": "USD", "quote_id": %d}`, quote.ID)
+
+	transfer := createTestTransfer(t, svr.FiberApp, payload)
+	assert.Equal(t, "10.01", transfer.Amount)
+	assert.Equal(t, "USD", transfer.Currency)
+	assert.Equal(t, "13.34", transfer.DestinationAmount)
+	assert.Equal(t, "SGD", transfer.DestinationCurrency)
+	assert.Equal(t, "1.3333", transfer.FXRate)
+	assert.Equal(t, "0.006333", transfer.FXRoundingAdjustment)
+	require.NotNil(t, transfer.QuoteID)
+	assert.Equal(t, quote.ID, *transfer.QuoteID)
+
+	assert.Equal(t, "89.99", getTestAccount(t, svr.FiberApp, 1).Balance)
+	assert.Equal(t, "13.34", getTestAccount(t, svr.FiberApp, 2).Balance)
+
+	t.Run("Postings balance in each currency", func(t *testing.T) {
+		var entries []model.JournalEntry
+		require.NoError(t, svr.DB.Where("transfer_id = ?", transfer.ID).Find(&entries).Error)
+		require.Len(t, entries, 4)
+
+		sums := map[string]decimal.Decimal{}
+		for _, entry := range entries {
+			sums[entry.Currency] = sums[entry.Currency].Add(entry.Amount)
+		}
+		assert.True(t, sums["USD"].IsZero())
+		assert.True(t, sums["SGD"].IsZero())
+	})
+
+	expiredQuote := createTestFXQuote(t, svr.FiberApp, `{"source_currency": "USD", "destination_currency": "SGD", "source_amount": "1"}`)
+	svr.DB.Model(&model.FXQuote{}).Where("id = ?", expiredQuote.ID).Update("expires_at", time.Now().Add(-time.Second))
+	otherQuote := createTestFXQuote(t, svr.FiberApp, `{"source_currency": "USD", "destination_currency": "SGD", "source_amount": "5"}`)
+
+	tests := []struct {
+		name       string
+		payload    string
+		statusCode int
+	}{
+		{
+			name:       "Reusing a quote",
+			payload:    payload,
+			statusCode: fiber.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Expired quote",
+			payload:    fmt.Sprintf(`{"source_account_id": 1, "destination_account_id": 2, "amount": "1", "currency": "USD", "quote_id": %d}`, expiredQuote.ID),
+			statusCode: fiber.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Amount differs from the quote",
+			payload:    fmt.Sprintf(`{"source_account_id": 1, "destination_account_id": 2, "amount": "6", "currency": "USD", "quote_id": %d}`, otherQuote.ID),
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Cross-currency transfer without a quote",
+			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "5", "currency": "USD"}`,
+			statusCode: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/transactions", strings.NewReader(tt.payload))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := svr.FiberApp.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+
+	reverseURL := fmt.Sprintf("/transactions/%d/reverse", transfer.ID)
+
+	t.Run("Partial reversal is rejected", func(t *testing.T) {
+		req := httptest.NewRequest("POST", reverseURL, strings.NewReader(`{"amount": "5"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := svr.FiberApp.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	})
+
+	t.Run("Full reversal restores both balances", func(t *testing.T) {
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("POST", reverseURL, nil))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+		var reversal apimodel.TransferResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&reversal))
+		assert.Equal(t, "13.34", reversal.Amount)
+		assert.Equal(t, "SGD", reversal.Currency)
+		assert.Equal(t, "10.01", reversal.DestinationAmount)
+		assert.Equal(t, "USD", reversal.DestinationCurrency)
+
+		assert.Equal(t, "100", getTestAccount(t, svr.FiberApp, 1).Balance)
+		assert.Equal(t, "0", getTestAccount(t, svr.FiberApp, 2).Balance)
+	})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/service"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createTestHold(t *testing.T, app *fiber.App, payload string) apimodel.HoldResponse {
+	req := httptest.NewRequest("POST", "/holds", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var hold apimodel.HoldResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&hold))
+	return hold
+}
+
+func TestHoldReducesAvailableBalance(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	createTestHold(t, svr.FiberApp, `{"account_id": 1, "destination_account_id": 2, "amount": "60", "currency": "SGD"}`)
+
+	account := getTestAccount(t, svr.FiberApp, 1)
+	assert.Equal(t, "100", account.Balance)
+	assert.Equal(t, "40", account.AvailableBalance)
+
+	tests := []struct {
+		name       string
+		url        string
+		payload    string
+		statusCode int
+	}{
+		{
+			name:       "Transfer above the available balance",
+			url:        "/transactions",
+			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "50", "currency": "SGD"}`,
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Hold above the available balance",
+			url:        "/holds",
+			payload:    `{"account_id": 1, "destination_account_id": 2, "amount": "50", "currency": "SGD"}`,
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Transfer within the available balance",
+			url:        "/transactions",
+			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "40", "currency": "SGD"}`,
+			statusCode: fiber.StatusCreated,
+		},
+		{
+			name:       "Hold on a missing account",
+			url:        "/holds",
+			payload:    `{"account_id": 3, "destination_account_id": 2, "amount": "1", "currency": "SGD"}`,
+			statusCode: fiber.StatusNotFound,
+		},
+		{
+			name:       "Hold in another currency",
+			url:        "/holds",
+			payload:    `{"account_id": 1, "destination_account_id": 2, "amount": "1", "currency": "USD"}`,
+			statusCode: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.url, strings.NewReader(tt.payload))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := svr.FiberApp.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestCaptureAndVoidHold(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	t.Run("Partial capture releases the remainder", func(t *testing.T) {
+		hold := createTestHold(t, svr.FiberApp, `{"account_id": 1, "destination_account_id": 2, "amount": "30", "currency": "SGD"}`)
+
+		req := httptest.NewRequest("POST", fmt.Sprintf("/holds/%d/capture", hold.ID), strings.NewReader(`{"amount": "25"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := svr.FiberApp.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		var captured apimodel.HoldResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&captured))
+		assert.Equal(t, model.HoldStatusCaptured, captured.Status)
+		assert.Equal(t, "25", captured.CapturedAmount)
+		require.NotNil(t, captured.TransferID)
+
+		var transfer model.Transfer
+		require.NoError(t, svr.DB.First(&transfer, *captured.TransferID).Error)
+		assert.True(t, decimal.NewFromInt(25).Equal(transfer.Amount))
+
+		source := getTestAccount(t, svr.FiberApp, 1)
+		assert.Equal(t, "75", source.Balance)
+		assert.Equal(t, "75", source.AvailableBalance)
+		assert.Equal(t, "25", getTestAccount(t, svr.FiberApp, 2).Balance)
+
+		// A hold can only be captured once
+		req = httptest.NewRequest("POST", fmt.Sprintf("/holds/%d/capture", hold.ID), nil)
+		resp, err = svr.FiberApp.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	})
+
+	t.Run("Capture more than held", func(t *testing.T) {
+		hold := createTestHold(t, svr.FiberApp, `{"account_id": 1, "destination_account_id": 2, "amount": "10", "currency": "SGD"}`)
+
+		req := httptest.NewRequest("POST", fmt.Sprintf("/holds/%d/capture", hold.ID), strings.NewReader(`{"amount": "11"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := svr.FiberApp.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Void releases the hold", func(t *testing.T) {
+		before := getTestAccount(t, svr.FiberApp, 1)
+		hold := createTestHold(t, svr.FiberApp, `{"account_id": 1, "destination_account_id": 2, "amount": "5", "currency": "SGD"}`)
+
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("POST", fmt.Sprintf("/holds/%d/void", hold.ID), nil))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		var voided apimodel.HoldResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&voided))
+		assert.Equal(t, model.HoldStatusVoided, voided.Status)
+
+		after := getTestAccount(t, svr.FiberApp, 1)
+		assert.Equal(t, before.AvailableBalance, after.AvailableBalance)
+		assert.Equal(t, before.Balance, after.Balance)
+	})
+
+	t.Run("Expired holds no longer reserve funds", func(t *testing.T) {
+		before := getTestAccount(t, svr.FiberApp, 1)
+		hold := createTestHold(t, svr.FiberApp, `{"account_id": 1, "destination_account_id": 2, "amount": "5", "currency": "SGD"}`)
+		svr.DB.Model(&model.Hold{}).Where("id = ?", hold.ID).Update("expires_at", time.Now().Add(-time.Minute))
+
+		assert.Equal(t, before.AvailableBalance, getTestAccount(t, svr.FiberApp, 1).AvailableBalance)
+
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("POST", fmt.Sprintf("/holds/%d/capture", hold.ID), nil))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+
+		expired, err := service.ExpireHolds(context.Background(), svr.DB)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), expired)
+
+		resp, err = svr.FiberApp.Test(httptest.NewRequest("GET", fmt.Sprintf("/holds/%d", hold.ID), nil))
+		require.NoError(t, err)
+		var body apimodel.HoldResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, model.HoldStatusExpired, body.Status)
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestIdempotentTransfer(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	tests := []struct {
+		name       string
+		key        string
+		payload    string
+		statusCode int
+	}{
+		{
+			name:       "First request",
+			key:        "key-1",
+			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00", "currency": "SGD"}`,
+			statusCode: fiber.StatusCreated,
+		},
+		{
+			name:       "Retry of the same request",
+			key:        "key-1",
+			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "10", "currency": "SGD"}`,
+			statusCode: fiber.StatusCreated,
+		},
+		{
+			name:       "Same key with a different amount",
+			key:        "key-1",
+			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "20.00", "currency": "SGD"}`,
+			statusCode: fiber.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Key supplied in the body",
+			key:        "",
+			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00", "currency": "SGD", "idempotency_key": "key-1"}`,
+			statusCode: fiber.StatusCreated,
+		},
+		{
+			name:       "Different key",
+			key:        "key-2",
+			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00", "currency": "SGD"}`,
+			statusCode: fiber.StatusCreated,
+		},
+	}
+
+	transferIDs := map[string]uint64{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/transactions", strings.NewReader(tt.payload))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.key != "" {
+				req.Header.Set("Idempotency-Key", tt.key)
+			}
+
+			resp, err := svr.FiberApp.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+
+			if resp.StatusCode == fiber.StatusCreated {
+				var body apimodel.TransferResponse
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+				if tt.key == "" {
+					return
+				}
+				// replays must return the transfer booked by the first request
+				if id, ok := transferIDs[tt.key]; ok {
+					assert.Equal(t, id, body.ID)
+					assert.Equal(t, "90", body.SourceBalance)
+				}
+				transferIDs[tt.key] = body.ID
+			}
+		})
+	}
+
+	var transferCount int64
+	svr.DB.Model(&model.Transfer{}).Count(&transferCount)
+	assert.Equal(t, int64(2), transferCount)
+
+	var sourceAccount model.Account
+	svr.DB.First(&sourceAccount, 1)
+	assert.True(t, decimal.NewFromFloat(80.00).Equal(sourceAccount.Balance), "expected 80 but got %v", sourceAccount.Balance)
+}
+
+func TestConcurrentIdempotentTransfers(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	payload := `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00", "currency": "SGD"}`
+
+	const numRequests = 10
+	var wg sync.WaitGroup
+	for i := 0; i < numRequests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("POST", "/transactions", strings.NewReader(payload))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Idempotency-Key", "same-key")
+
+			resp, err := svr.FiberApp.Test(req, 5000)
+			require.NoError(t, err)
+			assert.Equal(t, fiber.StatusCreated, resp.StatusCode)
+		}()
+	}
+	wg.Wait()
+
+	var transferCount int64
+	svr.DB.Model(&model.Transfer{}).Count(&transferCount)
+	assert.Equal(t, int64(1), transferCount)
+
+	var sourceAccount model.Account
+	svr.DB.First(&sourceAccount, 1)
+	assert.True(t, decimal.NewFromFloat(90.00).Equal(sourceAccount.Balance), "expected 90 but got %v", sourceAccount.Balance)
+}
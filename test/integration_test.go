@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/shopspring/decimal"
 	"gorm.io/driver/postgres"
@@ -9,6 +10,7 @@ import (
 	"io"
 	"log"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 
@@ -17,16 +19,47 @@ import (
 	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
 
+	"internal-transfers-system/internal/apimodel"
 	"internal-transfers-system/internal/apiserver"
 	"internal-transfers-system/internal/model"
 )
 
-func setupTestDB() *gorm.DB {
+// testModels lists every table of schema.sql, which the integration tests drop after each test.
+var testModels = []interface{}{
+	&model.Account{},
+	&model.AccountStatusChange{},
+	&model.AccountLimits{},
+	&model.FXRate{},
+	&model.FXQuote{},
+	&model.FeeSchedule{},
+	&model.TransferBatch{},
+	&model.Transfer{},
+	&model.TransferLeg{},
+	&model.IdempotencyKey{},
+	&model.JournalEntry{},
+	&model.BalanceSnapshot{},
+	&model.Hold{},
+	&model.ScheduledTransfer{},
+	&model.ScheduledTransferAttempt{},
+	&model.StandingOrder{},
+	&model.StandingOrderExecution{},
+	&model.OutboxEvent{},
+	&model.WebhookSubscription{},
+	&model.WebhookDelivery{},
+	&model.LedgerEvent{},
+	&model.TransferReceipt{},
+	&model.TransferChainHead{},
+}
+
+func loadTestConfig() config.Config {
 	conf, err := config.LoadConfig("test")
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	return conf
+}
 
+func setupTestDB(conf config.Config) *gorm.DB {
 	dsn := fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
 		conf.DBHost,
@@ -43,46 +76,161 @@ func setupTestDB() *gorm.DB {
 		log.Fatalf("failed to connect to test database: %v", err)
 	}
 
-	if err := db.AutoMigrate(&model.Account{}, &model.Transfer{}); err != nil {
+	// The tables are created from schema.sql rather than the models, so that the tests run against its constraints
+	// and triggers
+	if err := applyTestSchema(db); err != nil {
 		panic(err)
 	}
 	return db
 }
+
+// applyTestSchema applies schema.sql to the test database, which is also how a database is upgraded.
+func applyTestSchema(db *gorm.DB) error {
+	return applyTestSchemaWithLegacyCurrency(db, "")
+}
+
+// applyTestSchemaWithLegacyCurrency applies schema.sql with app.legacy_currency set to code, like
+// LEGACY_CURRENCY=<code> make migrate-db. The setting is left unset if code is empty.
+func applyTestSchemaWithLegacyCurrency(db *gorm.DB, code string) error {
+	schema, err := os.ReadFile("../schema.sql")
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	tx, err := sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if code != "" {
+		if _, err := tx.Exec("SELECT set_config('app.legacy_currency', $1, true)", code); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(string(schema)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 func setupTestServer() *apiserver.Server {
+	return setupTestServerWithConfig(loadTestConfig())
+}
+
+// setupTestServerWithConfig is for tests that need to change the configuration loaded from test.env.
+func setupTestServerWithConfig(conf config.Config) *apiserver.Server {
 	app := fiber.New()
-	db := setupTestDB()
-	svr := apiserver.New(db, app)
+	db := setupTestDB(conf)
+	svr, err := apiserver.New(db, app, conf)
+	if err != nil {
+		log.Fatalf("failed to create server: %v", err)
+	}
 	svr.SetupRoutes()
 	return svr
 }
 
+func teardownTestServer(svr *apiserver.Server) {
+	_ = svr.DB.Migrator().DropTable(testModels...)
+}
+
+// TestSchemaMatchesModels checks that schema.sql creates a column for every field of the models, and that testModels
+// covers every table it creates.
+func TestSchemaMatchesModels(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	modelTables := make([]string, 0, len(testModels))
+	for _, m := range testModels {
+		stmt := &gorm.Statement{DB: svr.DB}
+		require.NoError(t, stmt.Parse(m))
+		modelTables = append(modelTables, stmt.Schema.Table)
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			assert.True(t, svr.DB.Migrator().HasColumn(m, field.DBName), "%s has no column %s", stmt.Schema.Table, field.DBName)
+		}
+	}
+
+	var tables []string
+	require.NoError(t, svr.DB.Raw("SELECT table_name FROM information_schema.tables WHERE table_schema = CURRENT_SCHEMA() AND table_type = 'BASE TABLE'").
+		Scan(&tables).Error)
+	assert.ElementsMatch(t, modelTables, tables)
+}
+
+func getTestAccount(t *testing.T, app *fiber.App, accountID uint64) apimodel.AccountResponse {
+	resp, err := app.Test(httptest.NewRequest("GET", fmt.Sprintf("/accounts/%d", accountID), nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var account apimodel.AccountResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&account))
+	return account
+}
+
+func TestLegacyAccountCurrencyUpgrade(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	// An account from before accounts had a currency
+	require.NoError(t, svr.DB.Exec("ALTER TABLE accounts ALTER COLUMN currency DROP NOT NULL").Error)
+	require.NoError(t, svr.DB.Exec("INSERT INTO accounts (id, balance) VALUES (1, 100)").Error)
+
+	// The upgrade does not guess the currency, and fails without changing anything
+	for _, code := range []string{"", "usd"} {
+		err := applyTestSchemaWithLegacyCurrency(svr.DB, code)
+		require.Error(t, err, "legacy currency %q", code)
+		assert.Contains(t, err.Error(), "app.legacy_currency")
+		var currency *string
+		require.NoError(t, svr.DB.Raw("SELECT currency FROM accounts WHERE id = 1").Scan(&currency).Error)
+		assert.Nil(t, currency)
+	}
+
+	require.NoError(t, applyTestSchemaWithLegacyCurrency(svr.DB, "USD"))
+	account := getTestAccount(t, svr.FiberApp, 1)
+	assert.Equal(t, "USD", account.Currency)
+	assert.Equal(t, "100", account.Balance)
+
+	// Once every account has a currency, the setting is no longer needed
+	require.NoError(t, applyTestSchema(svr.DB))
+}
+
 func TestCreateAccount(t *testing.T) {
 	svr := setupTestServer()
-	defer svr.DB.Migrator().DropTable(&model.Account{}, &model.Transfer{})
+	defer teardownTestServer(svr)
 
 	tests := []struct {
 		name       string
 		payload    string
 		statusCode int
+		response   string
 	}{
 		{
 			name:       "Valid account creation",
-			payload:    `{"account_id": 1, "initial_balance": "100.00"}`,
+			payload:    `{"account_id": 1, "initial_balance": "100.00", "currency": "SGD"}`,
 			statusCode: fiber.StatusCreated,
+			response:   `{"account_id":1,"balance":"100","available_balance":"100","currency":"SGD","status":"active","overdraft_limit":"0"}`,
 		},
 		{
 			name:       "Invalid initial balance format",
-			payload:    `{"account_id": 2, "initial_balance": "invalid"}`,
+			payload:    `{"account_id": 2, "initial_balance": "invalid", "currency": "SGD"}`,
 			statusCode: fiber.StatusBadRequest,
 		},
 		{
 			name:       "Negative initial balance",
-			payload:    `{"account_id": 3, "initial_balance": "-100.00"}`,
+			payload:    `{"account_id": 3, "initial_balance": "-100.00", "currency": "SGD"}`,
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Missing currency",
+			payload:    `{"account_id": 4, "initial_balance": "100.00"}`,
 			statusCode: fiber.StatusBadRequest,
 		},
 		{
 			name:       "Duplicate account ID",
-			payload:    `{"account_id": 1, "initial_balance": "100.00"}`,
+			payload:    `{"account_id": 1, "initial_balance": "100.00", "currency": "SGD"}`,
 			statusCode: fiber.StatusBadRequest,
 		},
 	}
@@ -95,17 +243,38 @@ func TestCreateAccount(t *testing.T) {
 			resp, err := svr.FiberApp.Test(req)
 			require.NoError(t, err)
 			assert.Equal(t, tt.statusCode, resp.StatusCode)
+
+			if tt.response != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tt.response, string(body))
+			}
 		})
 	}
 }
 
+func TestAccountCurrencyImmutable(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+
+	err := svr.DB.Exec("UPDATE accounts SET currency = 'USD' WHERE id = 1").Error
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "currency of account 1 cannot be changed")
+	assert.Equal(t, "SGD", getTestAccount(t, svr.FiberApp, 1).Currency)
+
+	// Updates that leave the currency alone still go through
+	require.NoError(t, svr.DB.Exec("UPDATE accounts SET currency = 'SGD', balance = 90 WHERE id = 1").Error)
+}
+
 func TestCreateTransfer(t *testing.T) {
 	svr := setupTestServer()
-	defer svr.DB.Migrator().DropTable(&model.Account{}, &model.Transfer{})
+	defer teardownTestServer(svr)
 
 	// Create initial accounts
-	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00)})
-	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(50.00)})
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(50.00), Currency: "SGD"})
 
 	tests := []struct {
 		name       string
@@ -114,37 +283,37 @@ func TestCreateTransfer(t *testing.T) {
 	}{
 		{
 			name:       "Valid transfer",
-			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "50.00"}`,
+			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "50.00", "currency": "SGD"}`,
 			statusCode: fiber.StatusCreated,
 		},
 		{
 			name:       "Insufficient funds",
-			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "200.00"}`,
+			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "200.00", "currency": "SGD"}`,
 			statusCode: fiber.StatusBadRequest,
 		},
 		{
 			name:       "Invalid amount format",
-			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "invalid"}`,
+			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "invalid", "currency": "SGD"}`,
 			statusCode: fiber.StatusBadRequest,
 		},
 		{
 			name:       "Negative amount",
-			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "-1"}`,
+			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "-1", "currency": "SGD"}`,
 			statusCode: fiber.StatusBadRequest,
 		},
 		{
 			name:       "Self transfer",
-			payload:    `{"source_account_id": 1, "destination_account_id": 1, "amount": "10.00"}`,
+			payload:    `{"source_account_id": 1, "destination_account_id": 1, "amount": "10.00", "currency": "SGD"}`,
 			statusCode: fiber.StatusBadRequest,
 		},
 		{
 			name:       "Missing source account",
-			payload:    `{"source_account_id": 3, "destination_account_id": 1, "amount": "10.00"}`,
+			payload:    `{"source_account_id": 3, "destination_account_id": 1, "amount": "10.00", "currency": "SGD"}`,
 			statusCode: fiber.StatusNotFound,
 		},
 		{
 			name:       "Missing destination account",
-			payload:    `{"source_account_id": 1, "destination_account_id": 3, "amount": "10.00"}`,
+			payload:    `{"source_account_id": 1, "destination_account_id": 3, "amount": "10.00", "currency": "SGD"}`,
 			statusCode: fiber.StatusNotFound,
 		},
 	}
@@ -161,12 +330,39 @@ func TestCreateTransfer(t *testing.T) {
 	}
 }
 
+func TestCreateTransferResponse(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(50.00), Currency: "SGD"})
+
+	payload := `{"source_account_id": 1, "destination_account_id": 2, "amount": "30.50", "currency": "SGD"}`
+	req := httptest.NewRequest("POST", "/transactions", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := svr.FiberApp.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var body apimodel.TransferResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	assert.NotZero(t, body.ID)
+	assert.Equal(t, fmt.Sprintf("/transactions/%d", body.ID), resp.Header.Get("Location"))
+	assert.Equal(t, uint64(1), body.SourceAccountID)
+	assert.Equal(t, uint64(2), body.DestinationAccountID)
+	assert.Equal(t, "30.5", body.Amount)
+	assert.Equal(t, "69.5", body.SourceBalance)
+	assert.False(t, body.CreatedAt.IsZero())
+}
+
 func TestGetAccount(t *testing.T) {
 	svr := setupTestServer()
-	defer svr.DB.Migrator().DropTable(&model.Account{}, &model.Transfer{})
+	defer teardownTestServer(svr)
 
 	// Create an account
-	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00)})
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
 
 	tests := []struct {
 		name       string
@@ -178,7 +374,7 @@ func TestGetAccount(t *testing.T) {
 			name:       "Existing account",
 			accountID:  "1",
 			statusCode: fiber.StatusOK,
-			response:   `{"account_id":1,"balance":"100"}`,
+			response:   `{"account_id":1,"balance":"100","available_balance":"100","currency":"SGD","status":"active","overdraft_limit":"0"}`,
 		},
 		{
 			name:       "Non-existent account",
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransferJournalEntries(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	for _, payload := range []string{
+		`{"account_id": 1, "initial_balance": "100.00", "currency": "SGD"}`,
+		`{"account_id": 2, "initial_balance": "0", "currency": "SGD"}`,
+	} {
+		req := httptest.NewRequest("POST", "/accounts", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := svr.FiberApp.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	}
+
+	for _, payload := range []string{
+		`{"source_account_id": 1, "destination_account_id": 2, "amount": "30", "currency": "SGD"}`,
+		`{"source_account_id": 2, "destination_account_id": 1, "amount": "5.5", "currency": "SGD"}`,
+	} {
+		req := httptest.NewRequest("POST", "/transactions", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := svr.FiberApp.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	}
+
+	t.Run("Postings of each transfer sum to zero", func(t *testing.T) {
+		var transfers []model.Transfer
+		require.NoError(t, svr.DB.Find(&transfers).Error)
+		require.Len(t, transfers, 2)
+
+		for _, transfer := range transfers {
+			var entries []model.JournalEntry
+			require.NoError(t, svr.DB.Where("transfer_id = ?", transfer.ID).Find(&entries).Error)
+			require.Len(t, entries, 2)
+			assert.True(t, entries[0].Amount.Add(entries[1].Amount).IsZero())
+		}
+	})
+
+	t.Run("Running balance after each posting", func(t *testing.T) {
+		var entries []model.JournalEntry
+		require.NoError(t, svr.DB.Where("account_id = ?", 1).Order("id").Find(&entries).Error)
+
+		expected := []string{"100", "70", "75.5"}
+		require.Len(t, entries, len(expected))
+		for i, entry := range entries {
+			assert.Equal(t, expected[i], entry.BalanceAfter.Decimal.String())
+		}
+	})
+
+	t.Run("Unbalanced postings are rejected", func(t *testing.T) {
+		var transfer model.Transfer
+		require.NoError(t, svr.DB.Order("id").First(&transfer).Error)
+
+		accountID := uint64(1)
+		err := svr.DB.Transaction(func(tx *gorm.DB) error {
+			return tx.Create(&model.JournalEntry{
+				TransferID:   &transfer.ID,
+				AccountID:    &accountID,
+				Currency:     "SGD",
+				Amount:       decimal.NewFromInt(1),
+				BalanceAfter: decimal.NewNullDecimal(decimal.NewFromInt(76)),
+			}).Error
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "do not sum to zero")
+
+		var entries int64
+		svr.DB.Model(&model.JournalEntry{}).Where("transfer_id = ?", transfer.ID).Count(&entries)
+		assert.Equal(t, int64(2), entries)
+	})
+
+	t.Run("Balance verified against the journal", func(t *testing.T) {
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", "/accounts/2?verify=true", nil))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		var body apimodel.AccountResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "24.5", body.Balance)
+		require.NotNil(t, body.LedgerBalance)
+		assert.Equal(t, "24.5", *body.LedgerBalance)
+		require.NotNil(t, body.LedgerConsistent)
+		assert.True(t, *body.LedgerConsistent)
+	})
+
+	t.Run("Balance changed outside of the journal", func(t *testing.T) {
+		svr.DB.Model(&model.Account{}).Where("id = ?", 2).Update("balance", decimal.NewFromInt(1000))
+
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", "/accounts/2?verify=true", nil))
+		require.NoError(t, err)
+
+		var body apimodel.AccountResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		require.NotNil(t, body.LedgerConsistent)
+		assert.False(t, *body.LedgerConsistent)
+	})
+}
+
+func TestJournalUpgrade(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	// Accounts written without postings stand in for accounts opened before the journal existed
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.Zero, Currency: "SGD"})
+	req := httptest.NewRequest("POST", "/accounts", strings.NewReader(`{"account_id": 3, "initial_balance": "50", "currency": "SGD"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := svr.FiberApp.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	// Applying the schema again posts the opening balances that are missing, and only once
+	require.NoError(t, applyTestSchema(svr.DB))
+	require.NoError(t, applyTestSchema(svr.DB))
+
+	for _, tt := range []struct {
+		accountID uint64
+		balance   string
+		postings  int64
+	}{
+		{accountID: 1, balance: "100", postings: 1},
+		{accountID: 2, balance: "0", postings: 0},
+		{accountID: 3, balance: "50", postings: 1},
+	} {
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", fmt.Sprintf("/accounts/%d?verify=true", tt.accountID), nil))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		var body apimodel.AccountResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		require.NotNil(t, body.LedgerBalance)
+		assert.Equal(t, tt.balance, *body.LedgerBalance, "account %d", tt.accountID)
+		require.NotNil(t, body.LedgerConsistent)
+		assert.True(t, *body.LedgerConsistent, "account %d", tt.accountID)
+
+		var postings int64
+		require.NoError(t, svr.DB.Model(&model.JournalEntry{}).Where("account_id = ?", tt.accountID).Count(&postings).Error)
+		assert.Equal(t, tt.postings, postings, "account %d", tt.accountID)
+	}
+}
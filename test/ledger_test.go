@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apiserver"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/service"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// replayTestLedger replays the ledger into schema, which is dropped when the test ends.
+func replayTestLedger(t *testing.T, svr *apiserver.Server, schema string) *service.LedgerReplay {
+	t.Cleanup(func() {
+		svr.DB.Exec(fmt.Sprintf(`DROP SCHEMA IF EXISTS "%s" CASCADE`, schema))
+	})
+	replay, err := service.ReplayLedger(context.Background(), svr.DB, schema)
+	require.NoError(t, err)
+	return replay
+}
+
+func putTestJSON(t *testing.T, app *fiber.App, url string, payload string) int {
+	req := httptest.NewRequest("PUT", url, strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp.StatusCode
+}
+
+func TestReplayLedger(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	for _, payload := range []string{
+		`{"account_id": 1, "initial_balance": "100.00", "currency": "SGD"}`,
+		`{"account_id": 2, "initial_balance": "0", "currency": "SGD"}`,
+		`{"account_id": 3, "initial_balance": "50.00", "currency": "SGD"}`,
+		`{"account_id": 9, "initial_balance": "0", "currency": "SGD"}`,
+	} {
+		resp := postTestJSON(t, svr.FiberApp, "/accounts", payload)
+		require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	}
+	setTestFeeSchedules(t, svr.FiberApp, `{"schedules": [
+		{"transfer_type": "standard", "currency": "SGD", "type": "flat", "revenue_account_id": 9, "flat_amount": "1"}
+	]}`)
+
+	// Every kind of change to the accounts table
+	transfer := createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "30.00", "currency": "SGD"}`)
+	resp := postTestJSON(t, svr.FiberApp, fmt.Sprintf("/transactions/%d/reverse", transfer.ID), `{"amount": "10"}`)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	resp = postTestMultiLegTransfer(t, svr.FiberApp, `{"currency": "SGD", "sources": [{"account_id": 1, "amount": "20.00"}],
+		"destinations": [{"account_id": 2, "amount": "5.00"}, {"account_id": 3, "amount": "15.00"}]}`, "")
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	require.Equal(t, fiber.StatusOK, putTestJSON(t, svr.FiberApp, "/admin/accounts/3/overdraft-limit", `{"overdraft_limit": "25"}`))
+	createTestTransfer(t, svr.FiberApp, `{"source_account_id": 3, "destination_account_id": 1, "amount": "80.00", "currency": "SGD"}`)
+	require.Equal(t, fiber.StatusOK, changeTestAccountStatus(t, svr.FiberApp, 2, `{"status": "frozen", "reason": "review"}`))
+
+	// Rejected changes leave no event
+	resp = postTestJSON(t, svr.FiberApp, "/transactions", `{"source_account_id": 1, "destination_account_id": 2, "amount": "500.00", "currency": "SGD"}`)
+	require.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	require.Equal(t, fiber.StatusUnprocessableEntity, changeTestAccountStatus(t, svr.FiberApp, 1, `{"status": "closed", "reason": "not empty"}`))
+
+	var types []string
+	require.NoError(t, svr.DB.Model(&model.LedgerEvent{}).Order("sequence").Pluck("type", &types).Error)
+	assert.Equal(t, []string{
+		model.LedgerEventAccountOpened, model.LedgerEventAccountOpened, model.LedgerEventAccountOpened, model.LedgerEventAccountOpened,
+		model.LedgerEventFundsTransferred, model.LedgerEventFundsTransferred, model.LedgerEventFundsTransferred,
+		model.LedgerEventOverdraftLimitChanged, model.LedgerEventFundsTransferred, model.LedgerEventAccountStatusChanged,
+	}, types)
+
+	replay := replayTestLedger(t, svr, "ledger_replay_test")
+	assert.Equal(t, 10, replay.Events)
+	assert.Equal(t, 4, replay.Accounts)
+	assert.Empty(t, replay.Diffs)
+
+	var replayed []model.Account
+	require.NoError(t, svr.DB.Table("ledger_replay_test.accounts").Order("id").Find(&replayed).Error)
+	require.Len(t, replayed, 4)
+	for _, account := range replayed {
+		live := getTestAccount(t, svr.FiberApp, account.ID)
+		assert.True(t, decimal.RequireFromString(live.Balance).Equal(account.Balance), "account %d", account.ID)
+		assert.Equal(t, live.Status, account.Status)
+	}
+	assert.Equal(t, model.AccountStatusFrozen, replayed[1].Status)
+	assert.True(t, decimal.NewFromInt(25).Equal(replayed[2].OverdraftLimit))
+	assert.True(t, replayed[2].Balance.IsNegative())
+
+	// Changes made behind the ledger's back show up as differences
+	svr.DB.Exec("UPDATE accounts SET balance = balance + 1 WHERE id = 2")
+	svr.DB.Create(&model.Account{ID: 50, Balance: decimal.NewFromFloat(10), Currency: "SGD"})
+
+	replay = replayTestLedger(t, svr, "ledger_replay_tampered")
+	require.Len(t, replay.Diffs, 2)
+	assert.Equal(t, uint64(2), replay.Diffs[0].AccountID)
+	assert.Equal(t, "balance", replay.Diffs[0].Field)
+	assert.True(t, decimal.RequireFromString(replay.Diffs[0].Live).Sub(decimal.RequireFromString(replay.Diffs[0].Replayed)).Equal(decimal.NewFromInt(1)))
+	assert.Equal(t, service.AccountDiff{AccountID: 50, Field: "account", Live: "present"}, replay.Diffs[1])
+}
+
+func TestLedgerEventsAppendOnly(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	resp := postTestJSON(t, svr.FiberApp, "/accounts", `{"account_id": 1, "initial_balance": "100.00", "currency": "SGD"}`)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var event model.LedgerEvent
+	require.NoError(t, svr.DB.Order("sequence").First(&event).Error)
+
+	for _, statement := range []string{
+		"UPDATE ledger_events SET type = 'AccountStatusChanged' WHERE sequence = ?",
+		"DELETE FROM ledger_events WHERE sequence = ?",
+	} {
+		err := svr.DB.Exec(statement, event.Sequence).Error
+		require.Error(t, err, statement)
+		assert.Contains(t, err.Error(), "ledger events are append-only")
+	}
+
+	var count int64
+	svr.DB.Model(&model.LedgerEvent{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestReplayLedgerSchema(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	replay := replayTestLedger(t, svr, "ledger_replay_empty")
+	assert.Equal(t, 0, replay.Events)
+	assert.Empty(t, replay.Diffs)
+
+	// The schema must be fresh
+	_, err := service.ReplayLedger(context.Background(), svr.DB, "ledger_replay_empty")
+	assert.Error(t, err)
+
+	_, err = service.ReplayLedger(context.Background(), svr.DB, `public"; DROP TABLE accounts; --`)
+	assert.Error(t, err)
+	assert.True(t, svr.DB.Migrator().HasTable(&model.Account{}))
+}
+
+func TestLedgerUpgrade(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	// Accounts written without events stand in for accounts opened before the ledger existed
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.RequireFromString("100.25"), Currency: "SGD", OverdraftLimit: decimal.NewFromInt(50)})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromInt(20), Currency: "USD", Status: model.AccountStatusFrozen})
+	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.Zero, Currency: "SGD", Status: model.AccountStatusClosed})
+	assert.Len(t, replayTestLedger(t, svr, "ledger_replay_before_upgrade").Diffs, 3)
+
+	// Applying the schema again opens them in the ledger, and only once
+	require.NoError(t, applyTestSchema(svr.DB))
+	require.NoError(t, applyTestSchema(svr.DB))
+	var opened int64
+	require.NoError(t, svr.DB.Model(&model.LedgerEvent{}).Where("type = ?", model.LedgerEventAccountOpened).Count(&opened).Error)
+	assert.Equal(t, int64(3), opened)
+
+	replay := replayTestLedger(t, svr, "ledger_replay_after_upgrade")
+	assert.Equal(t, 3, replay.Accounts)
+	assert.Empty(t, replay.Diffs)
+
+	// Transfers from then on are replayed on top of the balances at the upgrade
+	req := httptest.NewRequest("POST", "/accounts", strings.NewReader(`{"account_id": 4, "initial_balance": "0", "currency": "SGD"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := svr.FiberApp.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 4, "amount": "0.25", "currency": "SGD"}`)
+	assert.Empty(t, replayTestLedger(t, svr, "ledger_replay_after_transfer").Diffs)
+}
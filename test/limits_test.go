@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type limitExceededResponse struct {
+	Error   string            `json:"error"`
+	Code    string            `json:"code"`
+	Details map[string]string `json:"details"`
+}
+
+func TestTransferLimits(t *testing.T) {
+	conf := loadTestConfig()
+	conf.DefaultMaxTransferAmount = "SGD:100,JPY:10000"
+	conf.DefaultDailyAmount = "SGD:150"
+	conf.DefaultHourlyTransferCount = 3
+	svr := setupTestServerWithConfig(conf)
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 4, Balance: decimal.NewFromFloat(1000.00), Currency: "USD"})
+	svr.DB.Create(&model.Account{ID: 5, Balance: decimal.NewFromFloat(0), Currency: "USD"})
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		payload    string
+		statusCode int
+		limit      string
+	}{
+		{
+			name:       "Above the default per transfer limit",
+			method:     "POST",
+			url:        "/transactions",
+			payload:    `{"source_account_id": 1, "destination_account_id": 3, "amount": "100.01", "currency": "SGD"}`,
+			statusCode: fiber.StatusUnprocessableEntity,
+			limit:      "max_transfer_amount",
+		},
+		{
+			name:       "Within the default limits",
+			method:     "POST",
+			url:        "/transactions",
+			payload:    `{"source_account_id": 1, "destination_account_id": 3, "amount": "100", "currency": "SGD"}`,
+			statusCode: fiber.StatusCreated,
+		},
+		{
+			name:       "Above the default daily limit",
+			method:     "POST",
+			url:        "/transactions",
+			payload:    `{"source_account_id": 1, "destination_account_id": 3, "amount": "50.01", "currency": "SGD"}`,
+			statusCode: fiber.StatusUnprocessableEntity,
+			limit:      "daily_amount",
+		},
+		{
+			name:       "Up to the default daily limit",
+			method:     "POST",
+			url:        "/transactions",
+			payload:    `{"source_account_id": 1, "destination_account_id": 3, "amount": "50", "currency": "SGD"}`,
+			statusCode: fiber.StatusCreated,
+		},
+		{
+			name:       "Raise the account's daily limit",
+			method:     "PUT",
+			url:        "/admin/accounts/1/limits",
+			payload:    `{"daily_amount": "1000"}`,
+			statusCode: fiber.StatusOK,
+		},
+		{
+			name:       "Within the account's own daily limit",
+			method:     "POST",
+			url:        "/transactions",
+			payload:    `{"source_account_id": 1, "destination_account_id": 3, "amount": "10", "currency": "SGD"}`,
+			statusCode: fiber.StatusCreated,
+		},
+		{
+			name:       "Above the default hourly count",
+			method:     "POST",
+			url:        "/transactions",
+			payload:    `{"source_account_id": 1, "destination_account_id": 3, "amount": "10", "currency": "SGD"}`,
+			statusCode: fiber.StatusUnprocessableEntity,
+			limit:      "hourly_count",
+		},
+		{
+			name:       "Limits are per account",
+			method:     "POST",
+			url:        "/transactions",
+			payload:    `{"source_account_id": 2, "destination_account_id": 3, "amount": "100", "currency": "SGD"}`,
+			statusCode: fiber.StatusCreated,
+		},
+		{
+			name:       "Default amounts are per currency",
+			method:     "POST",
+			url:        "/transactions",
+			payload:    `{"source_account_id": 4, "destination_account_id": 5, "amount": "500", "currency": "USD"}`,
+			statusCode: fiber.StatusCreated,
+		},
+		{
+			name:       "Rolling 30 day limit below what was sent",
+			method:     "PUT",
+			url:        "/admin/accounts/2/limits",
+			payload:    `{"rolling_30_day_amount": "120"}`,
+			statusCode: fiber.StatusOK,
+		},
+		{
+			name:       "Above the account's rolling 30 day limit",
+			method:     "POST",
+			url:        "/transactions",
+			payload:    `{"source_account_id": 2, "destination_account_id": 3, "amount": "20.01", "currency": "SGD"}`,
+			statusCode: fiber.StatusUnprocessableEntity,
+			limit:      "rolling_30_day_amount",
+		},
+		{
+			name:       "Invalid limit",
+			method:     "PUT",
+			url:        "/admin/accounts/2/limits",
+			payload:    `{"hourly_count": 0}`,
+			statusCode: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.payload))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := svr.FiberApp.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+
+			if tt.limit != "" {
+				var body limitExceededResponse
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+				assert.Equal(t, "limit_exceeded", body.Code)
+				assert.Equal(t, tt.limit, body.Details["limit"])
+			}
+		})
+	}
+
+	t.Run("Effective limits combine the defaults and the account's own", func(t *testing.T) {
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", "/admin/accounts/1/limits", nil))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		var body apimodel.AccountLimitsResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "100", body.Effective.MaxTransferAmount)
+		assert.Equal(t, "1000", body.Effective.DailyAmount)
+		require.NotNil(t, body.Effective.HourlyCount)
+		assert.Equal(t, int64(3), *body.Effective.HourlyCount)
+		require.NotNil(t, body.Overrides)
+		assert.Equal(t, "1000", body.Overrides.DailyAmount)
+		assert.Empty(t, body.Overrides.MaxTransferAmount)
+	})
+}
+
+func TestConcurrentTransfersRespectDailyLimit(t *testing.T) {
+	conf := loadTestConfig()
+	conf.DefaultDailyAmount = "SGD:50"
+	svr := setupTestServerWithConfig(conf)
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	payload := `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00", "currency": "SGD"}`
+
+	const numTransfers = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < numTransfers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("POST", "/transactions", strings.NewReader(payload))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := svr.FiberApp.Test(req, 5000)
+			require.NoError(t, err)
+			if resp.StatusCode == fiber.StatusCreated {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			} else {
+				assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 5, succeeded)
+	assert.Equal(t, "950", getTestAccount(t, svr.FiberApp, 1).Balance)
+}
+
+func TestReversalsDoNotCountTowardsLimits(t *testing.T) {
+	conf := loadTestConfig()
+	conf.DefaultDailyAmount = "SGD:100"
+	svr := setupTestServerWithConfig(conf)
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+
+	original := createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "100", "currency": "SGD"}`)
+	resp, err := svr.FiberApp.Test(httptest.NewRequest("POST", fmt.Sprintf("/transactions/%d/reverse", original.ID), nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	// The reversal was paid from account 2, which still has its whole daily limit
+	createTestTransfer(t, svr.FiberApp, `{"source_account_id": 2, "destination_account_id": 1, "amount": "100", "currency": "SGD"}`)
+	assert.Equal(t, "800", getTestAccount(t, svr.FiberApp, 2).Balance)
+}
+
+func TestHoldCapturesRespectLimits(t *testing.T) {
+	conf := loadTestConfig()
+	conf.DefaultDailyAmount = "SGD:100"
+	svr := setupTestServerWithConfig(conf)
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+
+	// Creating a hold is not checked, but capturing it is, and the capture counts towards the daily total
+	first := createTestHold(t, svr.FiberApp, `{"account_id": 1, "destination_account_id": 2, "amount": "60", "currency": "SGD"}`)
+	second := createTestHold(t, svr.FiberApp, `{"account_id": 1, "destination_account_id": 2, "amount": "60", "currency": "SGD"}`)
+	resp, err := svr.FiberApp.Test(httptest.NewRequest("POST", fmt.Sprintf("/holds/%d/capture", first.ID), nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp, err = svr.FiberApp.Test(httptest.NewRequest("POST", fmt.Sprintf("/holds/%d/capture", second.ID), nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	var body limitExceededResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, limitExceededResponse{
+		Error: "daily_amount limit exceeded",
+		Code:  "limit_exceeded",
+		Details: map[string]string{
+			"limit":     "daily_amount",
+			"value":     "100",
+			"used":      "60",
+			"requested": "60",
+		},
+	}, body)
+
+	// The hold is still active, and only the first capture was sent
+	var hold model.Hold
+	require.NoError(t, svr.DB.Take(&hold, second.ID).Error)
+	assert.Equal(t, model.HoldStatusActive, hold.Status)
+	assert.Equal(t, "940", getTestAccount(t, svr.FiberApp, 1).Balance)
+
+	// Transfers count the capture too
+	req := httptest.NewRequest("POST", "/transactions",
+		strings.NewReader(`{"source_account_id": 1, "destination_account_id": 2, "amount": "50", "currency": "SGD"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = svr.FiberApp.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+}
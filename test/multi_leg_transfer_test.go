@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func postTestMultiLegTransfer(t *testing.T, app *fiber.App, payload string, key string) *http.Response {
+	req := httptest.NewRequest("POST", "/transactions/multi-leg", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	resp, err := app.Test(req, 5000)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestMultiLegTransfer(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(50.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 4, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	resp := postTestMultiLegTransfer(t, svr.FiberApp, `{"currency": "SGD",
+		"sources": [{"account_id": 1, "amount": "60.00"}],
+		"destinations": [{"account_id": 3, "amount": "45.50"}, {"account_id": 4, "amount": "14.50"}]}`, "")
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var transfer apimodel.TransferResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&transfer))
+	assert.Equal(t, fmt.Sprintf("/transactions/%d", transfer.ID), resp.Header.Get("Location"))
+	assert.Zero(t, transfer.SourceAccountID)
+	assert.Zero(t, transfer.DestinationAccountID)
+	assert.Empty(t, transfer.SourceBalance)
+	assert.Equal(t, "60", transfer.Amount)
+	assert.Equal(t, []apimodel.TransferLegResponse{
+		{AccountID: 1, Direction: "debit", Amount: "60", BalanceAfter: "40"},
+		{AccountID: 3, Direction: "credit", Amount: "45.5", BalanceAfter: "45.5"},
+		{AccountID: 4, Direction: "credit", Amount: "14.5", BalanceAfter: "14.5"},
+	}, transfer.Legs)
+
+	assert.Equal(t, "40", getTestAccount(t, svr.FiberApp, 1).Balance)
+	assert.Equal(t, "45.5", getTestAccount(t, svr.FiberApp, 3).Balance)
+	assert.Equal(t, "14.5", getTestAccount(t, svr.FiberApp, 4).Balance)
+
+	// Every leg is posted to the journal, and the postings balance
+	var postings []model.JournalEntry
+	svr.DB.Where("transfer_id = ?", transfer.ID).Find(&postings)
+	require.Len(t, postings, 3)
+	sum := decimal.Zero
+	for _, posting := range postings {
+		sum = sum.Add(posting.Amount)
+	}
+	assert.True(t, sum.IsZero())
+
+	t.Run("Read back with its legs", func(t *testing.T) {
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", fmt.Sprintf("/transactions/%d", transfer.ID), nil))
+		require.NoError(t, err)
+		var read apimodel.TransferResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&read))
+		assert.Equal(t, transfer.Legs, read.Legs)
+	})
+
+	t.Run("Listed for every account it touches", func(t *testing.T) {
+		for _, tt := range []struct {
+			accountID uint64
+			direction string
+			found     bool
+		}{
+			{1, "out", true},
+			{1, "in", false},
+			{4, "in", true},
+			{4, "out", false},
+			{3, "", true},
+			{2, "", false},
+		} {
+			resp, err := svr.FiberApp.Test(httptest.NewRequest("GET",
+				fmt.Sprintf("/accounts/%d/transactions?direction=%s", tt.accountID, tt.direction), nil))
+			require.NoError(t, err)
+			var list apimodel.TransferListResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+			if tt.found {
+				require.Len(t, list.Transfers, 1, "account %d %s", tt.accountID, tt.direction)
+				assert.Len(t, list.Transfers[0].Legs, 3)
+			} else {
+				assert.Empty(t, list.Transfers, "account %d %s", tt.accountID, tt.direction)
+			}
+		}
+	})
+
+	t.Run("Several sources", func(t *testing.T) {
+		resp := postTestMultiLegTransfer(t, svr.FiberApp, `{"currency": "SGD",
+			"sources": [{"account_id": 1, "amount": "10"}, {"account_id": 2, "amount": "20"}],
+			"destinations": [{"account_id": 3, "amount": "30"}]}`, "")
+		require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+		assert.Equal(t, "30", getTestAccount(t, svr.FiberApp, 1).Balance)
+		assert.Equal(t, "30", getTestAccount(t, svr.FiberApp, 2).Balance)
+		assert.Equal(t, "75.5", getTestAccount(t, svr.FiberApp, 3).Balance)
+	})
+
+	t.Run("Multi-leg transfers cannot be reversed", func(t *testing.T) {
+		req := httptest.NewRequest("POST", fmt.Sprintf("/transactions/%d/reverse", transfer.ID), strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := svr.FiberApp.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	})
+}
+
+func TestMultiLegTransferIsAtomic(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(10.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 4, Balance: decimal.NewFromFloat(0), Currency: "SGD", Status: model.AccountStatusClosed})
+	svr.DB.Create(&model.Account{ID: 5, Balance: decimal.NewFromFloat(0), Currency: "USD"})
+
+	tests := []struct {
+		name       string
+		payload    string
+		statusCode int
+		error      string
+	}{
+		{
+			name: "Legs do not balance",
+			payload: `{"currency": "SGD", "sources": [{"account_id": 1, "amount": "10"}],
+				"destinations": [{"account_id": 3, "amount": "5"}, {"account_id": 2, "amount": "4.99"}]}`,
+			statusCode: fiber.StatusBadRequest,
+			error:      "legs do not balance: sources add up to 10 and destinations to 9.99",
+		},
+		{
+			name: "Second source is short of funds",
+			payload: `{"currency": "SGD", "sources": [{"account_id": 1, "amount": "10"}, {"account_id": 2, "amount": "20"}],
+				"destinations": [{"account_id": 3, "amount": "30"}]}`,
+			statusCode: fiber.StatusBadRequest,
+			error:      "insufficient funds in account 2",
+		},
+		{
+			name: "Closed destination",
+			payload: `{"currency": "SGD", "sources": [{"account_id": 1, "amount": "10"}],
+				"destinations": [{"account_id": 3, "amount": "5"}, {"account_id": 4, "amount": "5"}]}`,
+			statusCode: fiber.StatusUnprocessableEntity,
+			error:      "account 4 is closed",
+		},
+		{
+			name: "Destination in another currency",
+			payload: `{"currency": "SGD", "sources": [{"account_id": 1, "amount": "10"}],
+				"destinations": [{"account_id": 3, "amount": "5"}, {"account_id": 5, "amount": "5"}]}`,
+			statusCode: fiber.StatusBadRequest,
+			error:      "currency SGD does not match destination account currency USD",
+		},
+		{
+			name: "Missing destination",
+			payload: `{"currency": "SGD", "sources": [{"account_id": 1, "amount": "10"}],
+				"destinations": [{"account_id": 3, "amount": "5"}, {"account_id": 99, "amount": "5"}]}`,
+			statusCode: fiber.StatusNotFound,
+			error:      "account 99 not found",
+		},
+		{
+			name: "Account in two legs",
+			payload: `{"currency": "SGD", "sources": [{"account_id": 1, "amount": "10"}],
+				"destinations": [{"account_id": 3, "amount": "5"}, {"account_id": 3, "amount": "5"}]}`,
+			statusCode: fiber.StatusBadRequest,
+			error:      "destinations[1]: account 3 is in more than one leg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := postTestMultiLegTransfer(t, svr.FiberApp, tt.payload, "")
+			require.Equal(t, tt.statusCode, resp.StatusCode)
+			var body apimodel.ErrorResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			assert.Equal(t, tt.error, body.Error)
+		})
+	}
+
+	// None of the legs of a failed transfer were booked
+	assert.Equal(t, "100", getTestAccount(t, svr.FiberApp, 1).Balance)
+	assert.Equal(t, "10", getTestAccount(t, svr.FiberApp, 2).Balance)
+	assert.Equal(t, "0", getTestAccount(t, svr.FiberApp, 3).Balance)
+	var transfers, legs int64
+	svr.DB.Model(&model.Transfer{}).Count(&transfers)
+	svr.DB.Model(&model.TransferLeg{}).Count(&legs)
+	assert.Zero(t, transfers)
+	assert.Zero(t, legs)
+}
+
+func TestIdempotentMultiLegTransfer(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	payload := `{"currency": "SGD", "sources": [{"account_id": 1, "amount": "30"}],
+		"destinations": [{"account_id": 2, "amount": "10"}, {"account_id": 3, "amount": "20"}]}`
+
+	first := postTestMultiLegTransfer(t, svr.FiberApp, payload, "split-1")
+	require.Equal(t, fiber.StatusCreated, first.StatusCode)
+	var booked apimodel.TransferResponse
+	require.NoError(t, json.NewDecoder(first.Body).Decode(&booked))
+
+	retry := postTestMultiLegTransfer(t, svr.FiberApp, strings.Replace(payload, `"30"`, `"30.00"`, 1), "split-1")
+	require.Equal(t, fiber.StatusCreated, retry.StatusCode)
+	var replayed apimodel.TransferResponse
+	require.NoError(t, json.NewDecoder(retry.Body).Decode(&replayed))
+	assert.Equal(t, booked.ID, replayed.ID)
+	assert.Equal(t, booked.Legs, replayed.Legs)
+
+	different := strings.NewReplacer(`"10"`, `"15"`, `"20"`, `"15"`).Replace(payload)
+	assert.Equal(t, fiber.StatusUnprocessableEntity, postTestMultiLegTransfer(t, svr.FiberApp, different, "split-1").StatusCode)
+
+	assert.Equal(t, "70", getTestAccount(t, svr.FiberApp, 1).Balance)
+}
+
+func TestMultiLegTransferCountsTowardsLimits(t *testing.T) {
+	conf := loadTestConfig()
+	conf.DefaultDailyAmount = "100"
+	svr := setupTestServerWithConfig(conf)
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	resp := postTestMultiLegTransfer(t, svr.FiberApp, `{"currency": "SGD", "sources": [{"account_id": 1, "amount": "80"}],
+		"destinations": [{"account_id": 2, "amount": "40"}, {"account_id": 3, "amount": "40"}]}`, "")
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	req := httptest.NewRequest("POST", "/transactions",
+		strings.NewReader(`{"source_account_id": 1, "destination_account_id": 2, "amount": "20.01", "currency": "SGD"}`))
+	req.Header.Set("Content-Type", "application/json")
+	single, err := svr.FiberApp.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusUnprocessableEntity, single.StatusCode)
+	var body limitExceededResponse
+	require.NoError(t, json.NewDecoder(single.Body).Decode(&body))
+	assert.Equal(t, "daily_amount", body.Details["limit"])
+	assert.Equal(t, "80", body.Details["used"])
+
+	resp = postTestMultiLegTransfer(t, svr.FiberApp, `{"currency": "SGD", "sources": [{"account_id": 1, "amount": "20.01"}],
+		"destinations": [{"account_id": 2, "amount": "20.01"}]}`, "")
+	assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+}
+
+// TestConcurrentMultiLegTransfers moves money around the same accounts in opposite directions. The balances must add
+// up afterwards and no transfer may fail on a deadlock.
+func TestConcurrentMultiLegTransfers(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	for id := uint64(1); id <= 3; id++ {
+		svr.DB.Create(&model.Account{ID: id, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	}
+
+	payloads := []string{
+		`{"currency": "SGD", "sources": [{"account_id": 1, "amount": "10"}],
+			"destinations": [{"account_id": 2, "amount": "5"}, {"account_id": 3, "amount": "5"}]}`,
+		`{"currency": "SGD", "sources": [{"account_id": 3, "amount": "5"}, {"account_id": 2, "amount": "5"}],
+			"destinations": [{"account_id": 1, "amount": "10"}]}`,
+	}
+
+	const numTransfers = 5
+	var wg sync.WaitGroup
+	for i := 0; i < numTransfers; i++ {
+		for _, payload := range payloads {
+			wg.Add(1)
+			go func(payload string) {
+				defer wg.Done()
+				resp := postTestMultiLegTransfer(t, svr.FiberApp, payload, "")
+				assert.Equal(t, fiber.StatusCreated, resp.StatusCode)
+			}(payload)
+		}
+	}
+	wg.Wait()
+
+	for id := uint64(1); id <= 3; id++ {
+		assert.Equal(t, "1000", getTestAccount(t, svr.FiberApp, id).Balance, "account %d", id)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/model"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestOverdraftLimit(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	tests := []struct {
+		name            string
+		method          string
+		url             string
+		payload         string
+		statusCode      int
+		expectedBalance string
+	}{
+		{
+			name:            "Overdraw without a limit",
+			method:          "POST",
+			url:             "/transactions",
+			payload:         `{"source_account_id": 1, "destination_account_id": 2, "amount": "100.01", "currency": "SGD"}`,
+			statusCode:      fiber.StatusBadRequest,
+			expectedBalance: "100",
+		},
+		{
+			name:            "Set a limit",
+			method:          "PUT",
+			url:             "/admin/accounts/1/overdraft-limit",
+			payload:         `{"overdraft_limit": "50"}`,
+			statusCode:      fiber.StatusOK,
+			expectedBalance: "100",
+		},
+		{
+			name:            "Overdraw within the limit",
+			method:          "POST",
+			url:             "/transactions",
+			payload:         `{"source_account_id": 1, "destination_account_id": 2, "amount": "130", "currency": "SGD"}`,
+			statusCode:      fiber.StatusCreated,
+			expectedBalance: "-30",
+		},
+		{
+			name:            "Overdraw beyond the limit",
+			method:          "POST",
+			url:             "/transactions",
+			payload:         `{"source_account_id": 1, "destination_account_id": 2, "amount": "20.01", "currency": "SGD"}`,
+			statusCode:      fiber.StatusBadRequest,
+			expectedBalance: "-30",
+		},
+		{
+			name:            "Lower the limit below the overdrawn amount",
+			method:          "PUT",
+			url:             "/admin/accounts/1/overdraft-limit",
+			payload:         `{"overdraft_limit": "29.99"}`,
+			statusCode:      fiber.StatusUnprocessableEntity,
+			expectedBalance: "-30",
+		},
+		{
+			name:            "Negative limit",
+			method:          "PUT",
+			url:             "/admin/accounts/1/overdraft-limit",
+			payload:         `{"overdraft_limit": "-1"}`,
+			statusCode:      fiber.StatusBadRequest,
+			expectedBalance: "-30",
+		},
+		{
+			name:            "Hold within the limit",
+			method:          "POST",
+			url:             "/holds",
+			payload:         `{"account_id": 1, "destination_account_id": 2, "amount": "20", "currency": "SGD"}`,
+			statusCode:      fiber.StatusCreated,
+			expectedBalance: "-30",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.payload))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := svr.FiberApp.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			assert.Equal(t, tt.expectedBalance, getTestAccount(t, svr.FiberApp, 1).Balance)
+		})
+	}
+
+	account := getTestAccount(t, svr.FiberApp, 1)
+	assert.Equal(t, "50", account.OverdraftLimit)
+	assert.Equal(t, "-50", account.AvailableBalance)
+}
+
+func TestConcurrentTransfersRespectOverdraftLimit(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(0), Currency: "SGD", OverdraftLimit: decimal.NewFromInt(55)})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	payload := `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.00", "currency": "SGD"}`
+
+	const numTransfers = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < numTransfers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("POST", "/transactions", strings.NewReader(payload))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := svr.FiberApp.Test(req, 5000)
+			require.NoError(t, err)
+			if resp.StatusCode == fiber.StatusCreated {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			} else {
+				assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 5, succeeded)
+	assert.Equal(t, "-50", getTestAccount(t, svr.FiberApp, 1).Balance)
+}
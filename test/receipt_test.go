@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/apiserver"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/receipt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testRotatedReceiptKey is added to the key in test.env to test key rotation
+const testRotatedReceiptKey = "test-2025:JV0p/EFcyf6q2enBChWg+IvplFSsnr8KXIjVj7JpiEw="
+
+func createTestTransferWithReceipt(t *testing.T, app *fiber.App, payload string, key string) apimodel.CreateTransferResponse {
+	req := httptest.NewRequest("POST", "/transactions", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var transfer apimodel.CreateTransferResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&transfer))
+	return transfer
+}
+
+func getTestReceipt(t *testing.T, app *fiber.App, transferID uint64) apimodel.SignedReceiptResponse {
+	resp, err := app.Test(httptest.NewRequest("GET", fmt.Sprintf("/transactions/%d/receipt", transferID), nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var signed apimodel.SignedReceiptResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&signed))
+	return signed
+}
+
+func getTestReceiptKeys(t *testing.T, app *fiber.App) apimodel.ReceiptKeyListResponse {
+	resp, err := app.Test(httptest.NewRequest("GET", "/receipts/keys", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var keys apimodel.ReceiptKeyListResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&keys))
+	return keys
+}
+
+// verifyTestReceipt verifies a receipt the way a counterparty would, against the keys the API publishes.
+func verifyTestReceipt(t *testing.T, app *fiber.App, signed *apimodel.SignedReceiptResponse) error {
+	response := getTestReceiptKeys(t, app)
+	keys, err := receipt.PublicKeysFromResponse(&response)
+	require.NoError(t, err)
+	return receipt.Verify(keys, signed)
+}
+
+func TestTransferReceipts(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(50), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.NewFromFloat(50), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 9, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	setTestFeeSchedules(t, svr.FiberApp, `{"schedules": [
+		{"transfer_type": "standard", "currency": "SGD", "type": "flat", "revenue_account_id": 9, "flat_amount": "1"}
+	]}`)
+
+	transfer := createTestTransferWithReceipt(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "30.50",
+		"currency": "SGD", "reference": "<INV-1>", "metadata": {"order": 42}}`, "receipt-1")
+	require.NotNil(t, transfer.Receipt)
+	signed := *transfer.Receipt
+	assert.Equal(t, "test-2024", signed.Receipt.KeyID)
+	assert.Equal(t, transfer.ID, signed.Receipt.Transfer.ID)
+	assert.Equal(t, "30.5", signed.Receipt.Transfer.Amount)
+	assert.Equal(t, "<INV-1>", signed.Receipt.Transfer.Reference)
+	assert.Equal(t, "1", signed.Receipt.Transfer.Fee)
+	// The fee revenue account is left out
+	assert.Equal(t, []apimodel.ReceiptBalance{
+		{AccountID: 1, Currency: "SGD", Balance: "68.5"},
+		{AccountID: 2, Currency: "SGD", Balance: "80.5"},
+	}, signed.Receipt.Balances)
+	assert.NoError(t, verifyTestReceipt(t, svr.FiberApp, &signed))
+
+	// The receipt is stored: it is the same when fetched later, after the balances have moved on, and for retries
+	createTestTransfer(t, svr.FiberApp, `{"source_account_id": 2, "destination_account_id": 1, "amount": "10", "currency": "SGD"}`)
+	assert.Equal(t, signed, getTestReceipt(t, svr.FiberApp, transfer.ID))
+	retried := createTestTransferWithReceipt(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "30.50",
+		"currency": "SGD", "reference": "<INV-1>", "metadata": {"order": 42}}`, "receipt-1")
+	assert.Equal(t, transfer.ID, retried.ID)
+	assert.Equal(t, &signed, retried.Receipt)
+
+	// A receipt that was changed does not verify
+	tampered := signed
+	tampered.Receipt.Balances = []apimodel.ReceiptBalance{
+		{AccountID: 1, Currency: "SGD", Balance: "68.5"},
+		{AccountID: 2, Currency: "SGD", Balance: "90.5"},
+	}
+	assert.ErrorIs(t, verifyTestReceipt(t, svr.FiberApp, &tampered), receipt.ErrInvalidSignature)
+
+	// Transfers booked by other endpoints get their receipt when it is first asked for
+	resp := postTestMultiLegTransfer(t, svr.FiberApp, `{"currency": "SGD", "sources": [{"account_id": 3, "amount": "15"}],
+		"destinations": [{"account_id": 1, "amount": "5"}, {"account_id": 2, "amount": "10"}]}`, "")
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	var multiLeg apimodel.TransferResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&multiLeg))
+
+	multiLegReceipt := getTestReceipt(t, svr.FiberApp, multiLeg.ID)
+	assert.Len(t, multiLegReceipt.Receipt.Transfer.Legs, 3)
+	assert.Equal(t, []apimodel.ReceiptBalance{
+		{AccountID: 3, Currency: "SGD", Balance: "35"},
+		{AccountID: 1, Currency: "SGD", Balance: "83.5"},
+		{AccountID: 2, Currency: "SGD", Balance: "79.5"},
+	}, multiLegReceipt.Receipt.Balances)
+	assert.NoError(t, verifyTestReceipt(t, svr.FiberApp, &multiLegReceipt))
+	assert.Equal(t, multiLegReceipt, getTestReceipt(t, svr.FiberApp, multiLeg.ID))
+
+	for _, tt := range []struct {
+		url        string
+		statusCode int
+	}{
+		{url: "/transactions/999/receipt", statusCode: fiber.StatusNotFound},
+		{url: "/transactions/abc/receipt", statusCode: fiber.StatusBadRequest},
+	} {
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", tt.url, nil))
+		require.NoError(t, err)
+		assert.Equal(t, tt.statusCode, resp.StatusCode, tt.url)
+	}
+}
+
+func TestReceiptKeyRotation(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(50), Currency: "SGD"})
+
+	before := createTestTransferWithReceipt(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "10", "currency": "SGD"}`, "")
+	require.NotNil(t, before.Receipt)
+	assert.Equal(t, "test-2024", before.Receipt.Receipt.KeyID)
+
+	// Rotate to a new key, keeping the old one
+	conf := loadTestConfig()
+	conf.ReceiptSigningKeyID = "test-2025"
+	conf.ReceiptSigningKeys += "," + testRotatedReceiptKey
+	rotated, err := apiserver.New(svr.DB, fiber.New(), conf)
+	require.NoError(t, err)
+	rotated.SetupRoutes()
+
+	keys := getTestReceiptKeys(t, rotated.FiberApp)
+	require.Len(t, keys.Keys, 2)
+	assert.Equal(t, "test-2024", keys.Keys[0].KeyID)
+	assert.False(t, keys.Keys[0].Current)
+	assert.Equal(t, "test-2025", keys.Keys[1].KeyID)
+	assert.True(t, keys.Keys[1].Current)
+
+	after := createTestTransferWithReceipt(t, rotated.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "10", "currency": "SGD"}`, "")
+	require.NotNil(t, after.Receipt)
+	assert.Equal(t, "test-2025", after.Receipt.Receipt.KeyID)
+	assert.NoError(t, verifyTestReceipt(t, rotated.FiberApp, after.Receipt))
+
+	// Receipts signed before the rotation are unchanged and still verify
+	old := getTestReceipt(t, rotated.FiberApp, before.ID)
+	assert.Equal(t, *before.Receipt, old)
+	assert.NoError(t, verifyTestReceipt(t, rotated.FiberApp, &old))
+
+	// But not once the old key is dropped
+	conf.ReceiptSigningKeys = testRotatedReceiptKey
+	dropped, err := apiserver.New(svr.DB, fiber.New(), conf)
+	require.NoError(t, err)
+	dropped.SetupRoutes()
+	assert.ErrorIs(t, verifyTestReceipt(t, dropped.FiberApp, &old), receipt.ErrUnknownKey)
+
+	// The current key must be one of the keys
+	conf.ReceiptSigningKeyID = "test-2026"
+	_, err = apiserver.New(svr.DB, fiber.New(), conf)
+	assert.Error(t, err)
+}
+
+func TestReceiptsDisabled(t *testing.T) {
+	conf := loadTestConfig()
+	conf.ReceiptSigningKeyID = ""
+	conf.ReceiptSigningKeys = ""
+	svr := setupTestServerWithConfig(conf)
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(50), Currency: "SGD"})
+
+	transfer := createTestTransferWithReceipt(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "10", "currency": "SGD"}`, "")
+	assert.NotZero(t, transfer.ID)
+	assert.Nil(t, transfer.Receipt)
+
+	resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", fmt.Sprintf("/transactions/%d/receipt", transfer.ID), nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Empty(t, getTestReceiptKeys(t, svr.FiberApp).Keys)
+}
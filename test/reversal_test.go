@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func createTestTransfer(t *testing.T, app *fiber.App, payload string) apimodel.TransferResponse {
+	req := httptest.NewRequest("POST", "/transactions", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var transfer apimodel.TransferResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&transfer))
+	return transfer
+}
+
+func TestReverseTransfer(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	original := createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "50", "currency": "SGD"}`)
+	reverseURL := fmt.Sprintf("/transactions/%d/reverse", original.ID)
+
+	var firstReversal apimodel.TransferResponse
+	tests := []struct {
+		name       string
+		url        string
+		payload    string
+		statusCode int
+	}{
+		{
+			name:       "Partial reversal",
+			url:        reverseURL,
+			payload:    `{"amount": "20"}`,
+			statusCode: fiber.StatusCreated,
+		},
+		{
+			name:       "Reversing more than what is left",
+			url:        reverseURL,
+			payload:    `{"amount": "31"}`,
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Reverse the remainder",
+			url:        reverseURL,
+			payload:    ``,
+			statusCode: fiber.StatusCreated,
+		},
+		{
+			name:       "Already fully reversed",
+			url:        reverseURL,
+			payload:    `{"amount": "1"}`,
+			statusCode: fiber.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Unknown transfer",
+			url:        fmt.Sprintf("/transactions/%d/reverse", original.ID+100),
+			payload:    ``,
+			statusCode: fiber.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.url, strings.NewReader(tt.payload))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := svr.FiberApp.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+
+			if resp.StatusCode == fiber.StatusCreated && firstReversal.ID == 0 {
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&firstReversal))
+				assert.Equal(t, uint64(2), firstReversal.SourceAccountID)
+				assert.Equal(t, uint64(1), firstReversal.DestinationAccountID)
+				require.NotNil(t, firstReversal.ReversalOf)
+				assert.Equal(t, original.ID, *firstReversal.ReversalOf)
+			}
+		})
+	}
+
+	t.Run("Reversal chain on the original", func(t *testing.T) {
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", fmt.Sprintf("/transactions/%d", original.ID), nil))
+		require.NoError(t, err)
+
+		var body apimodel.TransferResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "50", body.ReversedAmount)
+		require.Len(t, body.Reversals, 2)
+		assert.Equal(t, "20", body.Reversals[0].Amount)
+		assert.Equal(t, "30", body.Reversals[1].Amount)
+	})
+
+	t.Run("Reversing a reversal", func(t *testing.T) {
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("POST", fmt.Sprintf("/transactions/%d/reverse", firstReversal.ID), nil))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	})
+
+	var source, destination model.Account
+	svr.DB.First(&source, 1)
+	svr.DB.First(&destination, 2)
+	assert.True(t, decimal.NewFromInt(100).Equal(source.Balance), "expected 100 but got %v", source.Balance)
+	assert.True(t, decimal.Zero.Equal(destination.Balance), "expected 0 but got %v", destination.Balance)
+}
+
+func TestConcurrentReversals(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+
+	original := createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "10", "currency": "SGD"}`)
+
+	const numReversals = 5
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < numReversals; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("POST", fmt.Sprintf("/transactions/%d/reverse", original.ID), strings.NewReader(`{"amount": "4"}`))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := svr.FiberApp.Test(req, 5000)
+			require.NoError(t, err)
+			if resp.StatusCode == fiber.StatusCreated {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Only two reversals of 4 fit into the original 10
+	assert.Equal(t, 2, created)
+
+	var source model.Account
+	svr.DB.First(&source, 1)
+	assert.True(t, decimal.NewFromInt(98).Equal(source.Balance), "expected 98 but got %v", source.Balance)
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/apiserver"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/service"
+	"internal-transfers-system/internal/svrerror"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testScheduledTransferRetry = service.ScheduledTransferRetry{MaxAttempts: 2}
+
+func createTestScheduledTransfer(t *testing.T, app *fiber.App, payload string) apimodel.ScheduledTransferResponse {
+	req := httptest.NewRequest("POST", "/scheduled-transfers", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var scheduled apimodel.ScheduledTransferResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&scheduled))
+	return scheduled
+}
+
+func getTestScheduledTransfer(t *testing.T, app *fiber.App, id uint64) apimodel.ScheduledTransferResponse {
+	resp, err := app.Test(httptest.NewRequest("GET", fmt.Sprintf("/scheduled-transfers/%d", id), nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var scheduled apimodel.ScheduledTransferResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&scheduled))
+	return scheduled
+}
+
+// makeDue moves a scheduled transfer into the past so that the scheduler picks it up.
+func makeDue(svr *apiserver.Server, id uint64) {
+	past := time.Now().Add(-time.Minute)
+	svr.DB.Model(&model.ScheduledTransfer{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"execute_at": past, "next_attempt_at": past})
+}
+
+func scheduledTransferPayload(source, destination uint64, amount string, executeAt time.Time) string {
+	return fmt.Sprintf(`{"source_account_id": %d, "destination_account_id": %d, "amount": "%s", "currency": "SGD", "execute_at": "%s"}`,
+		source, destination, amount, executeAt.Format(time.RFC3339))
+}
+
+func TestCreateScheduledTransfer(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.NewFromFloat(0), Currency: "USD"})
+
+	tomorrow := time.Now().Add(24 * time.Hour)
+	tests := []struct {
+		name       string
+		payload    string
+		statusCode int
+	}{
+		{
+			name:       "Valid scheduled transfer",
+			payload:    scheduledTransferPayload(1, 2, "10", tomorrow),
+			statusCode: fiber.StatusCreated,
+		},
+		{
+			name:       "Execution time in the past",
+			payload:    scheduledTransferPayload(1, 2, "10", time.Now().Add(-time.Hour)),
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Invalid execution time",
+			payload:    `{"source_account_id": 1, "destination_account_id": 2, "amount": "10", "currency": "SGD", "execute_at": "tomorrow"}`,
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Self transfer",
+			payload:    scheduledTransferPayload(1, 1, "10", tomorrow),
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Missing destination account",
+			payload:    scheduledTransferPayload(1, 4, "10", tomorrow),
+			statusCode: fiber.StatusNotFound,
+		},
+		{
+			name:       "Destination account in another currency",
+			payload:    scheduledTransferPayload(1, 3, "10", tomorrow),
+			statusCode: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/scheduled-transfers", strings.NewReader(tt.payload))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := svr.FiberApp.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+
+	// Nothing is booked until the transfer is due
+	attempted, err := service.ExecuteDueScheduledTransfers(context.Background(), svr.DB, svr.TransferPolicy, testScheduledTransferRetry)
+	require.NoError(t, err)
+	assert.Equal(t, 0, attempted)
+	assert.Equal(t, "100", getTestAccount(t, svr.FiberApp, 1).Balance)
+}
+
+func TestExecuteScheduledTransfers(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	tomorrow := time.Now().Add(24 * time.Hour)
+	succeeding := createTestScheduledTransfer(t, svr.FiberApp, scheduledTransferPayload(1, 2, "60", tomorrow))
+	failing := createTestScheduledTransfer(t, svr.FiberApp, scheduledTransferPayload(1, 2, "50", tomorrow))
+	later := createTestScheduledTransfer(t, svr.FiberApp, scheduledTransferPayload(1, 2, "1", tomorrow))
+	makeDue(svr, succeeding.ID)
+	svr.DB.Model(&model.ScheduledTransfer{}).Where("id = ?", failing.ID).
+		Updates(map[string]interface{}{"execute_at": time.Now(), "next_attempt_at": time.Now()})
+
+	attempted, err := service.ExecuteDueScheduledTransfers(context.Background(), svr.DB, svr.TransferPolicy, testScheduledTransferRetry)
+	require.NoError(t, err)
+	// The failing transfer is retried straight away, since the test retry has no delay
+	assert.Equal(t, 3, attempted)
+
+	t.Run("Due transfer is booked", func(t *testing.T) {
+		scheduled := getTestScheduledTransfer(t, svr.FiberApp, succeeding.ID)
+		assert.Equal(t, model.ScheduledTransferStatusCompleted, scheduled.Status)
+		require.NotNil(t, scheduled.TransferID)
+		require.Len(t, scheduled.Attempts, 1)
+		assert.Equal(t, model.ScheduledTransferAttemptSucceeded, scheduled.Attempts[0].Status)
+		assert.Equal(t, scheduled.TransferID, scheduled.Attempts[0].TransferID)
+		assert.Equal(t, "40", getTestAccount(t, svr.FiberApp, 1).Balance)
+	})
+
+	t.Run("Failed attempts are recorded until the transfer fails", func(t *testing.T) {
+		scheduled := getTestScheduledTransfer(t, svr.FiberApp, failing.ID)
+		assert.Equal(t, model.ScheduledTransferStatusFailed, scheduled.Status)
+		assert.Nil(t, scheduled.TransferID)
+		assert.Equal(t, 2, scheduled.AttemptCount)
+		require.Len(t, scheduled.Attempts, 2)
+		for _, attempt := range scheduled.Attempts {
+			assert.Equal(t, model.ScheduledTransferAttemptFailed, attempt.Status)
+			assert.Equal(t, "insufficient funds", attempt.Error)
+		}
+	})
+
+	t.Run("Transfers that are not due are left alone", func(t *testing.T) {
+		scheduled := getTestScheduledTransfer(t, svr.FiberApp, later.ID)
+		assert.Equal(t, model.ScheduledTransferStatusPending, scheduled.Status)
+		assert.Empty(t, scheduled.Attempts)
+	})
+}
+
+func TestCancelAndListScheduledTransfers(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	tomorrow := time.Now().Add(24 * time.Hour)
+	cancelled := createTestScheduledTransfer(t, svr.FiberApp, scheduledTransferPayload(1, 2, "10", tomorrow))
+	pending := createTestScheduledTransfer(t, svr.FiberApp, scheduledTransferPayload(1, 3, "10", tomorrow))
+
+	cancelURL := fmt.Sprintf("/scheduled-transfers/%d/cancel", cancelled.ID)
+	resp, err := svr.FiberApp.Test(httptest.NewRequest("POST", cancelURL, nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var body apimodel.ScheduledTransferResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, model.ScheduledTransferStatusCancelled, body.Status)
+
+	t.Run("Cancelling twice", func(t *testing.T) {
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("POST", cancelURL, nil))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	})
+
+	t.Run("Cancelled transfers are not executed", func(t *testing.T) {
+		makeDue(svr, cancelled.ID)
+		attempted, err := service.ExecuteDueScheduledTransfers(context.Background(), svr.DB, svr.TransferPolicy, testScheduledTransferRetry)
+		require.NoError(t, err)
+		assert.Equal(t, 0, attempted)
+		assert.Equal(t, "100", getTestAccount(t, svr.FiberApp, 1).Balance)
+	})
+
+	t.Run("Unknown scheduled transfer", func(t *testing.T) {
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("POST", fmt.Sprintf("/scheduled-transfers/%d/cancel", pending.ID+100), nil))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	tests := []struct {
+		name string
+		url  string
+		ids  []uint64
+	}{
+		{name: "All", url: "/scheduled-transfers", ids: []uint64{pending.ID, cancelled.ID}},
+		{name: "By status", url: "/scheduled-transfers?status=pending", ids: []uint64{pending.ID}},
+		{name: "By account", url: "/scheduled-transfers?account_id=2", ids: []uint64{cancelled.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", tt.url, nil))
+			require.NoError(t, err)
+			require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+			var list apimodel.ScheduledTransferListResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+			ids := make([]uint64, 0, len(list.ScheduledTransfers))
+			for _, scheduled := range list.ScheduledTransfers {
+				ids = append(ids, scheduled.ID)
+			}
+			assert.Equal(t, tt.ids, ids)
+		})
+	}
+}
+
+func TestConcurrentSchedulers(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	const numScheduled = 10
+	for i := 0; i < numScheduled; i++ {
+		scheduled := createTestScheduledTransfer(t, svr.FiberApp, scheduledTransferPayload(1, 2, "1", time.Now().Add(time.Hour)))
+		makeDue(svr, scheduled.ID)
+	}
+
+	// Each scheduled transfer is claimed by exactly one of the schedulers. A scheduler that loses an optimistic
+	// concurrency race on the source account stops with the conflict and leaves the transfer for its next run, so each
+	// one runs until nothing is due.
+	const numSchedulers = 4
+	var wg sync.WaitGroup
+	for i := 0; i < numSchedulers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				attempted, err := service.ExecuteDueScheduledTransfers(context.Background(), svr.DB, svr.TransferPolicy, testScheduledTransferRetry)
+				if err != nil {
+					var conflict *svrerror.Error
+					if !assert.ErrorAs(t, err, &conflict) || !assert.Equal(t, fiber.StatusConflict, conflict.StatusCode) {
+						return
+					}
+					continue
+				}
+				if attempted == 0 {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var completed, transfers int64
+	svr.DB.Model(&model.ScheduledTransfer{}).Where("status = ?", model.ScheduledTransferStatusCompleted).Count(&completed)
+	svr.DB.Model(&model.Transfer{}).Count(&transfers)
+	assert.Equal(t, int64(numScheduled), completed)
+	assert.Equal(t, int64(numScheduled), transfers)
+	assert.Equal(t, "90", getTestAccount(t, svr.FiberApp, 1).Balance)
+
+	// Conflicts are not recorded as attempts
+	var failedAttempts int64
+	svr.DB.Model(&model.ScheduledTransferAttempt{}).Where("status = ?", model.ScheduledTransferAttemptFailed).Count(&failedAttempts)
+	assert.Zero(t, failedAttempts)
+}
+
+func TestScheduledTransferConflict(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	scheduled := createTestScheduledTransfer(t, svr.FiberApp, scheduledTransferPayload(1, 2, "10", time.Now().Add(time.Hour)))
+	makeDue(svr, scheduled.ID)
+
+	// Another transaction changes the source account after the scheduler has read it, so its booking conflicts
+	other := svr.DB.Begin()
+	require.NoError(t, other.Exec("SELECT id FROM accounts WHERE id = 1 FOR UPDATE").Error)
+	done := make(chan error)
+	go func() {
+		_, err := service.ExecuteDueScheduledTransfers(context.Background(), svr.DB, svr.TransferPolicy, testScheduledTransferRetry)
+		done <- err
+	}()
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, other.Exec("UPDATE accounts SET updated_at = NOW() WHERE id = 1").Error)
+	require.NoError(t, other.Commit().Error)
+
+	// The scheduler gives up the claimed transfer instead of waiting for a retry while holding it, and records nothing
+	err := <-done
+	var conflict *svrerror.Error
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, fiber.StatusConflict, conflict.StatusCode)
+	pending := getTestScheduledTransfer(t, svr.FiberApp, scheduled.ID)
+	assert.Equal(t, model.ScheduledTransferStatusPending, pending.Status)
+	assert.Zero(t, pending.AttemptCount)
+	assert.Empty(t, pending.Attempts)
+
+	// The next run books it
+	attempted, err := service.ExecuteDueScheduledTransfers(context.Background(), svr.DB, svr.TransferPolicy, testScheduledTransferRetry)
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+	assert.Equal(t, model.ScheduledTransferStatusCompleted, getTestScheduledTransfer(t, svr.FiberApp, scheduled.ID).Status)
+}
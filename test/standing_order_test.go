@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/apiserver"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/service"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createTestStandingOrder(t *testing.T, app *fiber.App, payload string) apimodel.StandingOrderResponse {
+	req := httptest.NewRequest("POST", "/standing-orders", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var order apimodel.StandingOrderResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+	return order
+}
+
+func getTestStandingOrder(t *testing.T, app *fiber.App, id uint64) apimodel.StandingOrderResponse {
+	resp, err := app.Test(httptest.NewRequest("GET", fmt.Sprintf("/standing-orders/%d", id), nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var order apimodel.StandingOrderResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+	return order
+}
+
+func listTestStandingOrderExecutions(t *testing.T, app *fiber.App, id uint64) []apimodel.StandingOrderExecutionResponse {
+	resp, err := app.Test(httptest.NewRequest("GET", fmt.Sprintf("/standing-orders/%d/executions", id), nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var list apimodel.StandingOrderExecutionListResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	return list.Executions
+}
+
+// startStandingOrderAt moves the start of a standing order, and so its first occurrence, to start.
+func startStandingOrderAt(svr *apiserver.Server, id uint64, start time.Time) {
+	svr.DB.Model(&model.StandingOrder{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"start_at": start, "next_run_at": start, "next_attempt_at": start})
+}
+
+func executeTestStandingOrders(t *testing.T, svr *apiserver.Server) int {
+	attempted, err := service.ExecuteDueStandingOrders(context.Background(), svr.DB, svr.TransferPolicy, 0)
+	require.NoError(t, err)
+	return attempted
+}
+
+func standingOrderPayload(amount string, extra string) string {
+	return fmt.Sprintf(`{"source_account_id": 1, "destination_account_id": 2, "amount": "%s", "currency": "SGD", "start_at": "%s"%s}`,
+		amount, time.Now().Add(time.Hour).Format(time.RFC3339), extra)
+}
+
+func TestCreateStandingOrder(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	tests := []struct {
+		name       string
+		payload    string
+		statusCode int
+	}{
+		{
+			name:       "Weekly",
+			payload:    standingOrderPayload("10", `, "frequency": "weekly"`),
+			statusCode: fiber.StatusCreated,
+		},
+		{
+			name:       "Cron with retries",
+			payload:    standingOrderPayload("10", `, "frequency": "cron", "cron_expression": "0 9 1 * *", "on_insufficient_funds": "retry", "retry_count": 3`),
+			statusCode: fiber.StatusCreated,
+		},
+		{
+			name:       "Invalid cron expression",
+			payload:    standingOrderPayload("10", `, "frequency": "cron", "cron_expression": "0 9 * *"`),
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Unknown frequency",
+			payload:    standingOrderPayload("10", `, "frequency": "daily"`),
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Retry without a retry count",
+			payload:    standingOrderPayload("10", `, "frequency": "weekly", "on_insufficient_funds": "retry"`),
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "No occurrence before the end",
+			payload:    standingOrderPayload("10", fmt.Sprintf(`, "frequency": "cron", "cron_expression": "0 0 1 1 *", "end_at": "%s"`, time.Now().Add(2*time.Hour).Format(time.RFC3339))),
+			statusCode: fiber.StatusBadRequest,
+		},
+		{
+			name:       "Missing destination account",
+			payload:    strings.Replace(standingOrderPayload("10", `, "frequency": "weekly"`), `"destination_account_id": 2`, `"destination_account_id": 3`, 1),
+			statusCode: fiber.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/standing-orders", strings.NewReader(tt.payload))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := svr.FiberApp.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+
+	// Nothing is booked before the start
+	assert.Equal(t, 0, executeTestStandingOrders(t, svr))
+}
+
+func TestStandingOrderOccurrences(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	order := createTestStandingOrder(t, svr.FiberApp, standingOrderPayload("10", `, "frequency": "weekly", "max_occurrences": 3, "missed_occurrences": "catch_up"`))
+	// Two occurrences are overdue and the third is still to come
+	start := time.Now().Add(-8 * 24 * time.Hour).UTC().Truncate(time.Second)
+	startStandingOrderAt(svr, order.ID, start)
+
+	assert.Equal(t, 2, executeTestStandingOrders(t, svr))
+	assert.Equal(t, "80", getTestAccount(t, svr.FiberApp, 1).Balance)
+
+	order = getTestStandingOrder(t, svr.FiberApp, order.ID)
+	assert.Equal(t, model.StandingOrderStatusActive, order.Status)
+	assert.Equal(t, 2, order.OccurrenceCount)
+	require.NotNil(t, order.NextRunAt)
+	assert.True(t, start.AddDate(0, 0, 14).Equal(*order.NextRunAt))
+
+	executions := listTestStandingOrderExecutions(t, svr.FiberApp, order.ID)
+	require.Len(t, executions, 2)
+	for i, execution := range executions {
+		// Newest first
+		assert.True(t, start.AddDate(0, 0, 7*(1-i)).Equal(execution.OccurrenceAt))
+		assert.Equal(t, model.StandingOrderExecutionSucceeded, execution.Status)
+		require.NotNil(t, execution.TransferID)
+
+		var transfer model.Transfer
+		require.NoError(t, svr.DB.First(&transfer, *execution.TransferID).Error)
+		assert.True(t, decimal.NewFromInt(10).Equal(transfer.Amount))
+	}
+
+	// The last occurrence completes the order
+	svr.DB.Model(&model.StandingOrder{}).Where("id = ?", order.ID).
+		Updates(map[string]interface{}{"next_run_at": time.Now(), "next_attempt_at": time.Now()})
+	assert.Equal(t, 1, executeTestStandingOrders(t, svr))
+	order = getTestStandingOrder(t, svr.FiberApp, order.ID)
+	assert.Equal(t, model.StandingOrderStatusCompleted, order.Status)
+	assert.Equal(t, 3, order.OccurrenceCount)
+	assert.Equal(t, "70", getTestAccount(t, svr.FiberApp, 1).Balance)
+}
+
+func TestStandingOrderSkipsMissedOccurrences(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	order := createTestStandingOrder(t, svr.FiberApp, standingOrderPayload("10", `, "frequency": "weekly"`))
+	assert.Equal(t, model.MissedOccurrencesSkip, order.MissedOccurrences)
+	// Three occurrences are overdue, of which only the latest is booked
+	start := time.Now().Add(-15 * 24 * time.Hour).UTC().Truncate(time.Second)
+	startStandingOrderAt(svr, order.ID, start)
+
+	assert.Equal(t, 1, executeTestStandingOrders(t, svr))
+	assert.Equal(t, "90", getTestAccount(t, svr.FiberApp, 1).Balance)
+
+	order = getTestStandingOrder(t, svr.FiberApp, order.ID)
+	assert.Equal(t, model.StandingOrderStatusActive, order.Status)
+	assert.Equal(t, 3, order.OccurrenceCount)
+	require.NotNil(t, order.NextRunAt)
+	assert.True(t, start.AddDate(0, 0, 21).Equal(*order.NextRunAt))
+
+	executions := listTestStandingOrderExecutions(t, svr.FiberApp, order.ID)
+	require.Len(t, executions, 3)
+	for i, execution := range executions {
+		// Newest first
+		assert.True(t, start.AddDate(0, 0, 7*(2-i)).Equal(execution.OccurrenceAt))
+	}
+	assert.Equal(t, model.StandingOrderExecutionSucceeded, executions[0].Status)
+	for _, execution := range executions[1:] {
+		assert.Equal(t, model.StandingOrderExecutionSkipped, execution.Status)
+		assert.Equal(t, "occurrence was missed", execution.Error)
+		assert.Nil(t, execution.TransferID)
+	}
+}
+
+func TestStandingOrderInsufficientFunds(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	t.Run("Skip", func(t *testing.T) {
+		order := createTestStandingOrder(t, svr.FiberApp, standingOrderPayload("500", `, "frequency": "monthly", "max_occurrences": 2`))
+		startStandingOrderAt(svr, order.ID, time.Now().Add(-time.Minute))
+
+		assert.Equal(t, 1, executeTestStandingOrders(t, svr))
+		order = getTestStandingOrder(t, svr.FiberApp, order.ID)
+		assert.Equal(t, model.StandingOrderStatusActive, order.Status)
+		assert.Equal(t, 1, order.OccurrenceCount)
+
+		executions := listTestStandingOrderExecutions(t, svr.FiberApp, order.ID)
+		require.Len(t, executions, 1)
+		assert.Equal(t, model.StandingOrderExecutionSkipped, executions[0].Status)
+		assert.Equal(t, "insufficient funds", executions[0].Error)
+		assert.Nil(t, executions[0].TransferID)
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		order := createTestStandingOrder(t, svr.FiberApp, standingOrderPayload("500", `, "frequency": "monthly", "on_insufficient_funds": "retry", "retry_count": 2`))
+		startStandingOrderAt(svr, order.ID, time.Now().Add(-time.Minute))
+
+		// The first attempt and two retries, which happen straight away without a retry delay
+		assert.Equal(t, 3, executeTestStandingOrders(t, svr))
+		order = getTestStandingOrder(t, svr.FiberApp, order.ID)
+		assert.Equal(t, model.StandingOrderStatusActive, order.Status)
+		assert.Equal(t, 1, order.OccurrenceCount)
+
+		executions := listTestStandingOrderExecutions(t, svr.FiberApp, order.ID)
+		require.Len(t, executions, 3)
+		for _, execution := range executions {
+			assert.Equal(t, model.StandingOrderExecutionFailed, execution.Status)
+			assert.True(t, executions[0].OccurrenceAt.Equal(execution.OccurrenceAt))
+		}
+	})
+
+	t.Run("Suspend and resume", func(t *testing.T) {
+		order := createTestStandingOrder(t, svr.FiberApp, standingOrderPayload("150", `, "frequency": "monthly", "on_insufficient_funds": "suspend"`))
+		startStandingOrderAt(svr, order.ID, time.Now().Add(-time.Minute))
+
+		assert.Equal(t, 1, executeTestStandingOrders(t, svr))
+		order = getTestStandingOrder(t, svr.FiberApp, order.ID)
+		assert.Equal(t, model.StandingOrderStatusSuspended, order.Status)
+		assert.Equal(t, 0, executeTestStandingOrders(t, svr))
+
+		svr.DB.Model(&model.Account{}).Where("id = 1").Update("balance", decimal.NewFromInt(200))
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("POST", fmt.Sprintf("/standing-orders/%d/resume", order.ID), nil))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		assert.Equal(t, 1, executeTestStandingOrders(t, svr))
+		order = getTestStandingOrder(t, svr.FiberApp, order.ID)
+		assert.Equal(t, model.StandingOrderStatusActive, order.Status)
+		assert.Equal(t, 1, order.OccurrenceCount)
+		assert.Equal(t, "50", getTestAccount(t, svr.FiberApp, 1).Balance)
+
+		executions := listTestStandingOrderExecutions(t, svr.FiberApp, order.ID)
+		require.Len(t, executions, 2)
+		assert.Equal(t, model.StandingOrderExecutionSucceeded, executions[0].Status)
+		assert.Equal(t, model.StandingOrderExecutionFailed, executions[1].Status)
+	})
+}
+
+func TestStandingOrderSuspendedOnOtherFailures(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	order := createTestStandingOrder(t, svr.FiberApp, standingOrderPayload("10", `, "frequency": "weekly"`))
+	startStandingOrderAt(svr, order.ID, time.Now().Add(-time.Minute))
+	changeTestAccountStatus(t, svr.FiberApp, 1, `{"status": "frozen", "reason": "investigation"}`)
+
+	assert.Equal(t, 1, executeTestStandingOrders(t, svr))
+	order = getTestStandingOrder(t, svr.FiberApp, order.ID)
+	assert.Equal(t, model.StandingOrderStatusSuspended, order.Status)
+
+	t.Run("Cancel", func(t *testing.T) {
+		cancelURL := fmt.Sprintf("/standing-orders/%d/cancel", order.ID)
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("POST", cancelURL, nil))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, model.StandingOrderStatusCancelled, getTestStandingOrder(t, svr.FiberApp, order.ID).Status)
+
+		resp, err = svr.FiberApp.Test(httptest.NewRequest("POST", cancelURL, nil))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+
+		resp, err = svr.FiberApp.Test(httptest.NewRequest("POST", fmt.Sprintf("/standing-orders/%d/resume", order.ID), nil))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", "/standing-orders?account_id=1&status=cancelled", nil))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		var list apimodel.StandingOrderListResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+		require.Len(t, list.StandingOrders, 1)
+		assert.Equal(t, order.ID, list.StandingOrders[0].ID)
+	})
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getTestStatement(t *testing.T, app *fiber.App, accountID uint64, from, to time.Time, format string) *http.Response {
+	query := url.Values{
+		"from":   {from.UTC().Format(time.RFC3339Nano)},
+		"to":     {to.UTC().Format(time.RFC3339Nano)},
+		"format": {format},
+	}
+	resp, err := app.Test(httptest.NewRequest("GET", fmt.Sprintf("/accounts/%d/statement?%s", accountID, query.Encode()), nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	return resp
+}
+
+func getTestJSONStatement(t *testing.T, app *fiber.App, accountID uint64, from, to time.Time) apimodel.StatementResponse {
+	var statement apimodel.StatementResponse
+	require.NoError(t, json.NewDecoder(getTestStatement(t, app, accountID, from, to, "json").Body).Decode(&statement))
+	return statement
+}
+
+// statementAmounts lists the type, amount and running balance of every line of a statement.
+func statementAmounts(statement apimodel.StatementResponse) []string {
+	amounts := make([]string, 0, len(statement.Lines))
+	for _, line := range statement.Lines {
+		amounts = append(amounts, fmt.Sprintf("%s %s %s", line.Type, line.Amount, line.Balance))
+	}
+	return amounts
+}
+
+func TestAccountStatement(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	opened := time.Now().Add(-48 * time.Hour)
+	svr.DB.Create(&model.Account{ID: 1, CreatedAt: opened, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, CreatedAt: opened, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 9, CreatedAt: opened, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	setTestFeeSchedules(t, svr.FiberApp, `{"schedules": [
+		{"transfer_type": "standard", "currency": "SGD", "type": "flat", "revenue_account_id": 9, "flat_amount": "1.50"}
+	]}`)
+
+	from, to := time.Now().Add(-24*time.Hour), time.Now().Add(time.Hour)
+	first := createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "10", "currency": "SGD",
+		"reference": "INV-1", "description": "First invoice"}`)
+	mark := markTime()
+	createTestTransfer(t, svr.FiberApp, `{"source_account_id": 2, "destination_account_id": 1, "amount": "5", "currency": "SGD"}`)
+	resp := postTestMultiLegTransfer(t, svr.FiberApp, `{"currency": "SGD",
+		"sources": [{"account_id": 1, "amount": "4"}],
+		"destinations": [{"account_id": 2, "amount": "4"}]}`, "")
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	t.Run("Whole period", func(t *testing.T) {
+		statement := getTestJSONStatement(t, svr.FiberApp, 1, from, to)
+		assert.Equal(t, "SGD", statement.Currency)
+		assert.Equal(t, "100", statement.OpeningBalance)
+		assert.Equal(t, "89.5", statement.ClosingBalance)
+		assert.Equal(t, getTestAccount(t, svr.FiberApp, 1).Balance, statement.ClosingBalance)
+		assert.Equal(t, []string{"transfer -10 90", "fee -1.5 88.5", "transfer 5 93.5", "transfer -4 89.5"}, statementAmounts(statement))
+
+		line := statement.Lines[0]
+		assert.Equal(t, first.ID, line.TransferID)
+		assert.Equal(t, uint64(2), line.CounterpartyAccountID)
+		assert.Equal(t, "INV-1", line.Reference)
+		assert.Equal(t, "First invoice", line.Description)
+		assert.Equal(t, uint64(9), statement.Lines[1].CounterpartyAccountID)
+		assert.Zero(t, statement.Lines[3].CounterpartyAccountID)
+	})
+
+	t.Run("Consecutive periods", func(t *testing.T) {
+		before := getTestJSONStatement(t, svr.FiberApp, 1, from, mark)
+		assert.Equal(t, "100", before.OpeningBalance)
+		assert.Equal(t, "88.5", before.ClosingBalance)
+		assert.Len(t, before.Lines, 2)
+
+		after := getTestJSONStatement(t, svr.FiberApp, 1, mark, to)
+		assert.Equal(t, before.ClosingBalance, after.OpeningBalance)
+		assert.Equal(t, "89.5", after.ClosingBalance)
+		assert.Equal(t, []string{"transfer 5 93.5", "transfer -4 89.5"}, statementAmounts(after))
+	})
+
+	t.Run("Period without transfers", func(t *testing.T) {
+		statement := getTestJSONStatement(t, svr.FiberApp, 1, opened.Add(time.Hour), from)
+		assert.Equal(t, "100", statement.OpeningBalance)
+		assert.Equal(t, "100", statement.ClosingBalance)
+		assert.Empty(t, statement.Lines)
+
+		// Before the transfers, what the account was opened with is all that is left
+		statement = getTestJSONStatement(t, svr.FiberApp, 1, opened.Add(-time.Hour), from)
+		assert.Equal(t, "0", statement.OpeningBalance)
+		assert.Equal(t, []string{"account_opened 100 100"}, statementAmounts(statement))
+	})
+
+	t.Run("Revenue account", func(t *testing.T) {
+		statement := getTestJSONStatement(t, svr.FiberApp, 9, from, to)
+		assert.Equal(t, "0", statement.OpeningBalance)
+		assert.Equal(t, []string{"fee 1.5 1.5", "fee 1.5 3"}, statementAmounts(statement))
+		assert.Equal(t, uint64(1), statement.Lines[0].CounterpartyAccountID)
+	})
+
+	t.Run("Account opened during the period", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/accounts", strings.NewReader(`{"account_id": 3, "initial_balance": "50", "currency": "SGD"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := svr.FiberApp.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+		createTestTransfer(t, svr.FiberApp, `{"source_account_id": 3, "destination_account_id": 2, "amount": "20", "currency": "SGD"}`)
+
+		statement := getTestJSONStatement(t, svr.FiberApp, 3, from, to)
+		assert.Equal(t, "0", statement.OpeningBalance)
+		assert.Equal(t, "28.5", statement.ClosingBalance)
+		assert.Equal(t, []string{"account_opened 50 50", "transfer -20 30", "fee -1.5 28.5"}, statementAmounts(statement))
+
+		statement = getTestJSONStatement(t, svr.FiberApp, 3, opened, from)
+		assert.Equal(t, "0", statement.OpeningBalance)
+		assert.Equal(t, "0", statement.ClosingBalance)
+		assert.Empty(t, statement.Lines)
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		resp := getTestStatement(t, svr.FiberApp, 1, from, to, "csv")
+		assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+		assert.Contains(t, resp.Header.Get("Content-Disposition"), "attachment")
+		assert.Contains(t, resp.Header.Get("Content-Disposition"), ".csv")
+
+		rows, err := csv.NewReader(resp.Body).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, rows, 7)
+		assert.Equal(t, "date", rows[0][0])
+		assert.Equal(t, []string{"opening_balance", "100"}, []string{rows[1][1], rows[1][7]})
+		assert.Equal(t, []string{"transfer", "INV-1", "First invoice", "-10", "90"}, []string{rows[2][1], rows[2][4], rows[2][5], rows[2][6], rows[2][7]})
+		assert.Equal(t, []string{"closing_balance", "89.5"}, []string{rows[6][1], rows[6][7]})
+	})
+
+	t.Run("PDF", func(t *testing.T) {
+		resp := getTestStatement(t, svr.FiberApp, 1, from, to, "pdf")
+		assert.Equal(t, "application/pdf", resp.Header.Get("Content-Type"))
+		assert.Contains(t, resp.Header.Get("Content-Disposition"), ".pdf")
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(body, []byte("%PDF-")))
+	})
+
+	t.Run("camt.053", func(t *testing.T) {
+		resp := getTestStatement(t, svr.FiberApp, 1, from, to, "camt053")
+		assert.Equal(t, "application/xml", resp.Header.Get("Content-Type"))
+		assert.Contains(t, resp.Header.Get("Content-Disposition"), ".xml")
+
+		var document struct {
+			Balances []string `xml:"BkToCstmrStmt>Stmt>Bal>Amt"`
+			Entries  []struct {
+				Reference   string `xml:"NtryRef"`
+				Amount      string `xml:"Amt"`
+				CreditDebit string `xml:"CdtDbtInd"`
+			} `xml:"BkToCstmrStmt>Stmt>Ntry"`
+		}
+		require.NoError(t, xml.NewDecoder(resp.Body).Decode(&document))
+		assert.Equal(t, []string{"100", "89.5"}, document.Balances)
+		require.Len(t, document.Entries, 4)
+		assert.Equal(t, fmt.Sprint(first.ID), document.Entries[0].Reference)
+		assert.Equal(t, []string{"10", "DBIT"}, []string{document.Entries[0].Amount, document.Entries[0].CreditDebit})
+		assert.Equal(t, []string{"5", "CRDT"}, []string{document.Entries[2].Amount, document.Entries[2].CreditDebit})
+	})
+
+	tests := []struct {
+		name       string
+		url        string
+		statusCode int
+	}{
+		{"Missing period", "/accounts/1/statement", fiber.StatusBadRequest},
+		{"Period ends before it starts", "/accounts/1/statement?from=2024-04-01&to=2024-03-01", fiber.StatusBadRequest},
+		{"Period longer than a year", "/accounts/1/statement?from=2023-01-01&to=2024-03-01", fiber.StatusBadRequest},
+		{"Unknown format", "/accounts/1/statement?from=2024-03-01&to=2024-04-01&format=xlsx", fiber.StatusBadRequest},
+		{"Unknown account", "/accounts/99/statement?from=2024-03-01&to=2024-04-01", fiber.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", tt.url, nil))
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+}
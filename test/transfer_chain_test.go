@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/apiserver"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/service"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func verifyTestTransferChain(t *testing.T, app *fiber.App) apimodel.TransferChainResponse {
+	resp, err := app.Test(httptest.NewRequest("GET", "/admin/transfers/chain/verify", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var verification apimodel.TransferChainResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&verification))
+	return verification
+}
+
+func testTransferChainHead(t *testing.T, svr *apiserver.Server) model.TransferChainHead {
+	var head model.TransferChainHead
+	require.NoError(t, svr.DB.Take(&head, model.TransferChainHeadID).Error)
+	return head
+}
+
+func TestTransferChain(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	assert.Equal(t, apimodel.TransferChainResponse{Valid: true}, verifyTestTransferChain(t, svr.FiberApp))
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(100), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.NewFromFloat(100), Currency: "SGD"})
+
+	first := createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "10.50", "currency": "SGD",
+		"reference": "INV-1", "metadata": {"invoice": {"number": 1001}, "tags": ["rent"]}}`)
+	second := createTestTransfer(t, svr.FiberApp, `{"source_account_id": 2, "destination_account_id": 3, "amount": "20", "currency": "SGD"}`)
+	resp := postTestMultiLegTransfer(t, svr.FiberApp, `{"currency": "SGD", "sources": [{"account_id": 3, "amount": "15"}],
+		"destinations": [{"account_id": 1, "amount": "5"}, {"account_id": 2, "amount": "10"}]}`, "")
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	var multiLeg apimodel.TransferResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&multiLeg))
+
+	// Transfers are chained as they are booked
+	verification := verifyTestTransferChain(t, svr.FiberApp)
+	assert.True(t, verification.Valid)
+	assert.Equal(t, uint64(3), verification.Length)
+	assert.Zero(t, verification.Unchained)
+	assert.Nil(t, verification.Break)
+	var last model.Transfer
+	require.NoError(t, svr.DB.Take(&last, multiLeg.ID).Error)
+	assert.Equal(t, uint64(3), *last.ChainSequence)
+	assert.Equal(t, *last.Hash, verification.HeadHash)
+	head := testTransferChainHead(t, svr)
+	assert.Equal(t, uint64(3), head.ChainSequence)
+	assert.Equal(t, *last.Hash, head.Hash)
+
+	// New transfers extend the chain
+	fourth := createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 3, "amount": "1", "currency": "SGD"}`)
+	verification = verifyTestTransferChain(t, svr.FiberApp)
+	assert.True(t, verification.Valid)
+	assert.Equal(t, uint64(4), verification.Length)
+	headHash := verification.HeadHash
+	assert.Equal(t, headHash, testTransferChainHead(t, svr).Hash)
+
+	// The head only moves forward
+	assert.Error(t, svr.DB.Exec("UPDATE transfer_chain_heads SET chain_sequence = 3, hash = ?", *last.Hash).Error)
+	assert.Error(t, svr.DB.Exec("DELETE FROM transfer_chain_heads").Error)
+	assert.Error(t, svr.DB.Exec("TRUNCATE transfer_chain_heads").Error)
+
+	tests := []struct {
+		name        string
+		tamper      string
+		restore     string
+		breakAt     uint64
+		transferID  uint64
+		reason      string
+		verifiedLen uint64
+	}{
+		{
+			name:        "Edited amount",
+			tamper:      "UPDATE transfers SET amount = amount + 1 WHERE id = ?",
+			restore:     "UPDATE transfers SET amount = amount - 1 WHERE id = ?",
+			breakAt:     2,
+			transferID:  second.ID,
+			reason:      "hash does not match",
+			verifiedLen: 1,
+		},
+		{
+			name:        "Edited metadata",
+			tamper:      `UPDATE transfers SET metadata = '{"invoice": {"number": 1002}, "tags": ["rent"]}' WHERE id = ?`,
+			restore:     `UPDATE transfers SET metadata = '{"invoice": {"number": 1001}, "tags": ["rent"]}' WHERE id = ?`,
+			breakAt:     1,
+			transferID:  first.ID,
+			reason:      "hash does not match",
+			verifiedLen: 0,
+		},
+		{
+			name:        "Edited leg",
+			tamper:      "UPDATE transfer_legs SET account_id = 2 WHERE transfer_id = ? AND account_id = 1",
+			restore:     "UPDATE transfer_legs SET account_id = 1 WHERE transfer_id = ? AND amount = 5",
+			breakAt:     3,
+			transferID:  multiLeg.ID,
+			reason:      "hash does not match",
+			verifiedLen: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, svr.DB.Exec(tt.tamper, tt.transferID).Error)
+
+			verification := verifyTestTransferChain(t, svr.FiberApp)
+			assert.False(t, verification.Valid)
+			assert.Equal(t, tt.verifiedLen, verification.Length)
+			require.NotNil(t, verification.Break)
+			assert.Equal(t, tt.breakAt, verification.Break.ChainSequence)
+			require.NotNil(t, verification.Break.TransferID)
+			assert.Equal(t, tt.transferID, *verification.Break.TransferID)
+			assert.Equal(t, tt.reason, verification.Break.Reason)
+
+			if tt.restore != "" {
+				require.NoError(t, svr.DB.Exec(tt.restore, tt.transferID).Error)
+				verification = verifyTestTransferChain(t, svr.FiberApp)
+				assert.True(t, verification.Valid)
+				assert.Equal(t, headHash, verification.HeadHash)
+			}
+		})
+	}
+
+	// Removing transfers from the end of the chain leaves it short of its head
+	for _, id := range []uint64{fourth.ID, second.ID} {
+		require.NoError(t, svr.DB.Exec("DELETE FROM journal_entries WHERE transfer_id = ?", id).Error)
+		require.NoError(t, svr.DB.Exec("DELETE FROM transfer_receipts WHERE transfer_id = ?", id).Error)
+	}
+	require.NoError(t, svr.DB.Exec("DELETE FROM transfers WHERE id = ?", fourth.ID).Error)
+	verification = verifyTestTransferChain(t, svr.FiberApp)
+	assert.False(t, verification.Valid)
+	assert.Equal(t, uint64(3), verification.Length)
+	assert.Equal(t, &apimodel.TransferChainBreakResponse{ChainSequence: 4, Reason: "transfer is missing"}, verification.Break)
+
+	// Removing any other transfer leaves a gap
+	require.NoError(t, svr.DB.Exec("DELETE FROM transfers WHERE id = ?", second.ID).Error)
+	verification = verifyTestTransferChain(t, svr.FiberApp)
+	assert.False(t, verification.Valid)
+	assert.Equal(t, uint64(1), verification.Length)
+	assert.Equal(t, &apimodel.TransferChainBreakResponse{ChainSequence: 2, Reason: "transfer is missing"}, verification.Break)
+}
+
+func TestUnchainedTransfers(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(100), Currency: "SGD"})
+
+	t.Run("A chained transfer whose chain fields were cleared", func(t *testing.T) {
+		transfer := createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "1", "currency": "SGD"}`)
+		require.NoError(t, svr.DB.Exec("UPDATE transfers SET chain_sequence = NULL, hash = NULL WHERE id = ?", transfer.ID).Error)
+
+		verification := verifyTestTransferChain(t, svr.FiberApp)
+		assert.False(t, verification.Valid)
+		assert.Equal(t, int64(1), verification.Unchained)
+		assert.Equal(t, &apimodel.TransferChainBreakResponse{ChainSequence: 1, Reason: "transfer is missing"}, verification.Break)
+		require.NoError(t, svr.DB.Exec("DELETE FROM journal_entries WHERE transfer_id = ?", transfer.ID).Error)
+		require.NoError(t, svr.DB.Exec("DELETE FROM transfer_receipts WHERE transfer_id = ?", transfer.ID).Error)
+		require.NoError(t, svr.DB.Exec("DELETE FROM transfers WHERE id = ?", transfer.ID).Error)
+	})
+
+	// Start over from transfers that were booked before transfers were chained, with an empty chain
+	var legacy []uint64
+	for i := 0; i < 3; i++ {
+		legacy = append(legacy, createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "1", "currency": "SGD"}`).ID)
+	}
+	require.NoError(t, svr.DB.Exec("UPDATE transfers SET chain_sequence = NULL, hash = NULL").Error)
+	require.NoError(t, svr.DB.Exec("ALTER TABLE transfer_chain_heads DISABLE TRIGGER transfer_chain_heads_forward_only").Error)
+	require.NoError(t, svr.DB.Exec("UPDATE transfer_chain_heads SET chain_sequence = 0, hash = ''").Error)
+	require.NoError(t, svr.DB.Exec("ALTER TABLE transfer_chain_heads ENABLE TRIGGER transfer_chain_heads_forward_only").Error)
+
+	verification := verifyTestTransferChain(t, svr.FiberApp)
+	assert.False(t, verification.Valid)
+	assert.Equal(t, int64(3), verification.Unchained)
+	assert.Equal(t, &apimodel.TransferChainBreakResponse{ChainSequence: 1, TransferID: &legacy[0], Reason: "transfer is not chained"}, verification.Break)
+
+	// New transfers are chained while the old ones wait for the backfill, which adds them after the new ones
+	booked := createTestTransfer(t, svr.FiberApp, `{"source_account_id": 2, "destination_account_id": 1, "amount": "1", "currency": "SGD"}`)
+	verification = verifyTestTransferChain(t, svr.FiberApp)
+	assert.False(t, verification.Valid)
+	assert.Equal(t, uint64(1), verification.Length)
+	assert.Equal(t, "transfer is not chained", verification.Break.Reason)
+
+	chained, err := service.BackfillTransferChain(context.Background(), svr.DB)
+	require.NoError(t, err)
+	assert.Equal(t, 3, chained)
+	chained, err = service.BackfillTransferChain(context.Background(), svr.DB)
+	require.NoError(t, err)
+	assert.Zero(t, chained)
+
+	verification = verifyTestTransferChain(t, svr.FiberApp)
+	assert.True(t, verification.Valid)
+	assert.Equal(t, uint64(4), verification.Length)
+	assert.Zero(t, verification.Unchained)
+	assert.Equal(t, testTransferChainHead(t, svr).Hash, verification.HeadHash)
+
+	var order []uint64
+	require.NoError(t, svr.DB.Model(&model.Transfer{}).Order("chain_sequence").Pluck("id", &order).Error)
+	assert.Equal(t, append([]uint64{booked.ID}, legacy...), order)
+}
+
+func TestConcurrentTransferChaining(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(100), Currency: "SGD"})
+
+	const transfers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < transfers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("POST", "/transactions",
+				strings.NewReader(`{"source_account_id": 1, "destination_account_id": 2, "amount": "1", "currency": "SGD"}`))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := svr.FiberApp.Test(req, 5000)
+			if assert.NoError(t, err) {
+				assert.Equal(t, fiber.StatusCreated, resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	verification := verifyTestTransferChain(t, svr.FiberApp)
+	assert.True(t, verification.Valid)
+	assert.Equal(t, uint64(transfers), verification.Length)
+	assert.Zero(t, verification.Unchained)
+	assert.Equal(t, uint64(transfers), testTransferChainHead(t, svr).ChainSequence)
+}
+
+func TestConcurrentTransferChainingWithFeesAndBatches(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	for id := uint64(1); id <= 3; id++ {
+		svr.DB.Create(&model.Account{ID: id, Balance: decimal.NewFromFloat(1000), Currency: "SGD"})
+	}
+	svr.DB.Create(&model.Account{ID: 9, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	setTestFeeSchedules(t, svr.FiberApp, `{"schedules": [
+		{"transfer_type": "standard", "currency": "SGD", "type": "flat", "revenue_account_id": 9, "flat_amount": "1"}
+	]}`)
+
+	// Single transfers lock their accounts and then the fee revenue account, while atomic batches charge the same
+	// revenue account for several items; neither may be holding the end of the chain while it waits for the other
+	batch := `{"mode": "atomic", "transfers": [
+		{"source_account_id": 1, "destination_account_id": 2, "amount": "10", "currency": "SGD"},
+		{"source_account_id": 2, "destination_account_id": 3, "amount": "10", "currency": "SGD"},
+		{"source_account_id": 3, "destination_account_id": 1, "amount": "10", "currency": "SGD"}
+	]}`
+	const rounds = 5
+	var wg sync.WaitGroup
+	for i := 0; i < rounds; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			resp := postTestBatch(t, svr.FiberApp, batch)
+			assert.Equal(t, fiber.StatusCreated, resp.StatusCode)
+		}()
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("POST", "/transactions",
+				strings.NewReader(`{"source_account_id": 3, "destination_account_id": 2, "amount": "5", "currency": "SGD"}`))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := svr.FiberApp.Test(req, 10000)
+			if assert.NoError(t, err) {
+				assert.Equal(t, fiber.StatusCreated, resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	verification := verifyTestTransferChain(t, svr.FiberApp)
+	assert.True(t, verification.Valid)
+	assert.Equal(t, uint64(rounds*4), verification.Length)
+	assert.Zero(t, verification.Unchained)
+	assert.Equal(t, fmt.Sprint(rounds*4), getTestAccount(t, svr.FiberApp, 9).Balance)
+}
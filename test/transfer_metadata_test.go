@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestTransferMetadata(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+
+	transfer := createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "100", "currency": "SGD",
+		"reference": "INV-1001", "description": "March rent", "external_id": "pay-1",
+		"metadata": {"invoice": {"number": 1001, "lines": 3}, "tags": ["rent"]}}`)
+	assert.Equal(t, "INV-1001", transfer.Reference)
+	assert.Equal(t, "March rent", transfer.Description)
+	require.NotNil(t, transfer.ExternalID)
+	assert.Equal(t, "pay-1", *transfer.ExternalID)
+	assert.JSONEq(t, `{"invoice": {"number": 1001, "lines": 3}, "tags": ["rent"]}`, string(transfer.Metadata))
+
+	resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", fmt.Sprintf("/transactions/%d", transfer.ID), nil))
+	require.NoError(t, err)
+	var stored apimodel.TransferResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stored))
+	assert.Equal(t, "INV-1001", stored.Reference)
+	assert.JSONEq(t, `{"invoice": {"number": 1001, "lines": 3}, "tags": ["rent"]}`, string(stored.Metadata))
+
+	createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "20", "currency": "SGD",
+		"reference": "INV-1002", "description": "50% deposit_2", "metadata": {"invoice": {"number": 1002}}}`)
+	createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "30", "currency": "SGD"}`)
+
+	t.Run("External IDs are unique per source account", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/transactions", strings.NewReader(
+			`{"source_account_id": 1, "destination_account_id": 2, "amount": "5", "currency": "SGD", "external_id": "pay-1"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := svr.FiberApp.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+
+		var body apimodel.ErrorResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "duplicate_external_id", body.Code)
+		assert.Equal(t, fmt.Sprint(transfer.ID), body.Details["transfer_id"])
+		assert.Equal(t, "850", getTestAccount(t, svr.FiberApp, 1).Balance)
+
+		// Another account can use the same external ID
+		other := createTestTransfer(t, svr.FiberApp, `{"source_account_id": 2, "destination_account_id": 1, "amount": "5", "currency": "SGD", "external_id": "pay-1"}`)
+		assert.Equal(t, "pay-1", *other.ExternalID)
+	})
+
+	t.Run("Invalid metadata", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/transactions", strings.NewReader(
+			`{"source_account_id": 1, "destination_account_id": 2, "amount": "5", "currency": "SGD", "metadata": "INV-1"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := svr.FiberApp.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+
+	tests := []struct {
+		name            string
+		query           string
+		statusCode      int
+		expectedAmounts []string
+	}{
+		{
+			name:            "By reference",
+			query:           "?reference=INV-1002",
+			statusCode:      fiber.StatusOK,
+			expectedAmounts: []string{"20"},
+		},
+		{
+			name:            "By external ID",
+			query:           "?direction=out&external_id=pay-1",
+			statusCode:      fiber.StatusOK,
+			expectedAmounts: []string{"100"},
+		},
+		{
+			name:            "By description, ignoring case",
+			query:           "?description=RENT",
+			statusCode:      fiber.StatusOK,
+			expectedAmounts: []string{"100"},
+		},
+		{
+			name:            "Wildcards in the description match literally",
+			query:           "?description=" + url.QueryEscape("0% deposit_"),
+			statusCode:      fiber.StatusOK,
+			expectedAmounts: []string{"20"},
+		},
+		{
+			name:            "By nested metadata",
+			query:           "?metadata=" + url.QueryEscape(`{"invoice": {"number": 1001}}`),
+			statusCode:      fiber.StatusOK,
+			expectedAmounts: []string{"100"},
+		},
+		{
+			name:            "By a metadata key that no transfer has",
+			query:           "?metadata=" + url.QueryEscape(`{"customer": "acme"}`),
+			statusCode:      fiber.StatusOK,
+			expectedAmounts: []string{},
+		},
+		{
+			name:       "Metadata filter that is not an object",
+			query:      "?metadata=1001",
+			statusCode: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", "/accounts/1/transactions"+tt.query, nil))
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+
+			if tt.statusCode != fiber.StatusOK {
+				return
+			}
+
+			var body apimodel.TransferListResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+			amounts := make([]string, 0, len(body.Transfers))
+			for _, transfer := range body.Transfers {
+				amounts = append(amounts, transfer.Amount)
+			}
+			assert.Equal(t, tt.expectedAmounts, amounts)
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/model"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetTransfer(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(100.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	payload := `{"source_account_id": 1, "destination_account_id": 2, "amount": "12.34", "currency": "SGD"}`
+	req := httptest.NewRequest("POST", "/transactions", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := svr.FiberApp.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var created apimodel.TransferResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+
+	tests := []struct {
+		name       string
+		url        string
+		statusCode int
+	}{
+		{
+			name:       "Existing transfer",
+			url:        fmt.Sprintf("/transactions/%d", created.ID),
+			statusCode: fiber.StatusOK,
+		},
+		{
+			name:       "Non-existent transfer",
+			url:        fmt.Sprintf("/transactions/%d", created.ID+1),
+			statusCode: fiber.StatusNotFound,
+		},
+		{
+			name:       "Invalid transfer id",
+			url:        "/transactions/abc",
+			statusCode: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", tt.url, nil))
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+
+			if tt.statusCode == fiber.StatusOK {
+				var body apimodel.TransferResponse
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+				assert.Equal(t, created.ID, body.ID)
+				assert.Equal(t, "12.34", body.Amount)
+				assert.Equal(t, "87.66", body.SourceBalance)
+			}
+		})
+	}
+}
+
+func TestListAccountTransfers(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 3, Balance: decimal.NewFromFloat(1000.00), Currency: "SGD"})
+
+	// 1 -> 2 for 1..5, then 2 -> 1 for 10, and an unrelated 2 -> 3
+	payloads := []string{
+		`{"source_account_id": 1, "destination_account_id": 2, "amount": "1", "currency": "SGD"}`,
+		`{"source_account_id": 1, "destination_account_id": 2, "amount": "2", "currency": "SGD"}`,
+		`{"source_account_id": 1, "destination_account_id": 2, "amount": "3", "currency": "SGD"}`,
+		`{"source_account_id": 1, "destination_account_id": 2, "amount": "4", "currency": "SGD"}`,
+		`{"source_account_id": 1, "destination_account_id": 2, "amount": "5", "currency": "SGD"}`,
+		`{"source_account_id": 2, "destination_account_id": 1, "amount": "10", "currency": "SGD"}`,
+		`{"source_account_id": 2, "destination_account_id": 3, "amount": "7", "currency": "SGD"}`,
+	}
+	for _, payload := range payloads {
+		req := httptest.NewRequest("POST", "/transactions", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := svr.FiberApp.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	}
+
+	tests := []struct {
+		name            string
+		query           string
+		statusCode      int
+		expectedAmounts []string
+		hasNextPage     bool
+	}{
+		{
+			name:            "All transfers newest first",
+			query:           "",
+			statusCode:      fiber.StatusOK,
+			expectedAmounts: []string{"10", "5", "4", "3", "2", "1"},
+		},
+		{
+			name:            "Incoming only",
+			query:           "?direction=in",
+			statusCode:      fiber.StatusOK,
+			expectedAmounts: []string{"10"},
+		},
+		{
+			name:            "Outgoing within an amount range",
+			query:           "?direction=out&min_amount=2&max_amount=4",
+			statusCode:      fiber.StatusOK,
+			expectedAmounts: []string{"4", "3", "2"},
+		},
+		{
+			name:            "First page",
+			query:           "?limit=4",
+			statusCode:      fiber.StatusOK,
+			expectedAmounts: []string{"10", "5", "4", "3"},
+			hasNextPage:     true,
+		},
+		{
+			name:            "Created in the future",
+			query:           "?created_from=2999-01-01T00:00:00Z",
+			statusCode:      fiber.StatusOK,
+			expectedAmounts: []string{},
+		},
+		{
+			name:       "Invalid direction",
+			query:      "?direction=up",
+			statusCode: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", "/accounts/1/transactions"+tt.query, nil))
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+
+			if tt.statusCode != fiber.StatusOK {
+				return
+			}
+
+			var body apimodel.TransferListResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+			amounts := make([]string, 0, len(body.Transfers))
+			for _, transfer := range body.Transfers {
+				amounts = append(amounts, transfer.Amount)
+			}
+			assert.Equal(t, tt.expectedAmounts, amounts)
+			assert.Equal(t, tt.hasNextPage, body.NextCursor != "")
+		})
+	}
+
+	t.Run("Follow cursor to the last page", func(t *testing.T) {
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", "/accounts/1/transactions?limit=4", nil))
+		require.NoError(t, err)
+		var firstPage apimodel.TransferListResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&firstPage))
+
+		resp, err = svr.FiberApp.Test(httptest.NewRequest("GET", "/accounts/1/transactions?limit=4&cursor="+firstPage.NextCursor, nil))
+		require.NoError(t, err)
+		var secondPage apimodel.TransferListResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&secondPage))
+
+		require.Len(t, secondPage.Transfers, 2)
+		assert.Equal(t, "2", secondPage.Transfers[0].Amount)
+		assert.Equal(t, "1", secondPage.Transfers[1].Amount)
+		assert.Empty(t, secondPage.NextCursor)
+	})
+
+	t.Run("Unknown account", func(t *testing.T) {
+		resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", "/accounts/99/transactions", nil))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+}
@@ -13,12 +13,14 @@ import (
 
 func TestCreateTransferEdgeCases(t *testing.T) {
 	svr := setupTestServer()
-	defer svr.DB.Migrator().DropTable(&model.Account{}, &model.Transfer{})
+	defer teardownTestServer(svr)
 
 	tests := []struct {
 		name               string
 		srcAccountID       uint64
 		dstAccountID       uint64
+		srcCurrency        string
+		dstCurrency        string
 		initialSrcBalance  string
 		initialDstBalance  string
 		payload            string
@@ -30,9 +32,11 @@ func TestCreateTransferEdgeCases(t *testing.T) {
 			name:               "Very large transfer amount",
 			srcAccountID:       1,
 			dstAccountID:       2,
+			srcCurrency:        "SGD",
+			dstCurrency:        "SGD",
 			initialSrcBalance:  "1000000000000000000.00",
 			initialDstBalance:  "0.00",
-			payload:            `{"source_account_id": 1, "destination_account_id": 2, "amount": "999999999999999999.99"}`,
+			payload:            `{"source_account_id": 1, "destination_account_id": 2, "amount": "999999999999999999.99", "currency": "SGD"}`,
 			expectedSrcBalance: "0.01",
 			expectedDstBalance: "999999999999999999.99",
 			statusCode:         fiber.StatusCreated,
@@ -41,42 +45,74 @@ func TestCreateTransferEdgeCases(t *testing.T) {
 			name:               "Very small transfer amount",
 			srcAccountID:       3,
 			dstAccountID:       4,
-			initialSrcBalance:  "1000000000000000000.00",
-			initialDstBalance:  "0.00",
-			payload:            `{"source_account_id": 3, "destination_account_id": 4, "amount": "0.000000000000000001"}`,
-			expectedSrcBalance: "999999999999999999.999999999999999999",
-			expectedDstBalance: "0.000000000000000001",
+			srcCurrency:        "KWD",
+			dstCurrency:        "KWD",
+			initialSrcBalance:  "1000000000000000000.000",
+			initialDstBalance:  "0.000",
+			payload:            `{"source_account_id": 3, "destination_account_id": 4, "amount": "0.001", "currency": "KWD"}`,
+			expectedSrcBalance: "999999999999999999.999",
+			expectedDstBalance: "0.001",
 			statusCode:         fiber.StatusCreated,
 		},
 		{
 			name:               "Zero transfer amount",
 			srcAccountID:       5,
 			dstAccountID:       6,
+			srcCurrency:        "SGD",
+			dstCurrency:        "SGD",
 			initialSrcBalance:  "1000000000000000000.00",
 			initialDstBalance:  "0.00",
-			payload:            `{"source_account_id": 5, "destination_account_id": 6, "amount": "0.00"}`,
+			payload:            `{"source_account_id": 5, "destination_account_id": 6, "amount": "0.00", "currency": "SGD"}`,
 			expectedSrcBalance: "1000000000000000000.00",
 			expectedDstBalance: "0.00",
 			statusCode:         fiber.StatusBadRequest,
 		},
 		{
-			name:               "High precision transfer amount",
+			name:               "More decimal places than the currency allows",
 			srcAccountID:       7,
 			dstAccountID:       8,
+			srcCurrency:        "SGD",
+			dstCurrency:        "SGD",
 			initialSrcBalance:  "1000000000000000000.00",
 			initialDstBalance:  "0.00",
-			payload:            `{"source_account_id": 7, "destination_account_id": 8, "amount": "0.123456789123456789"}`,
-			expectedSrcBalance: "999999999999999999.876543210876543211",
-			expectedDstBalance: "0.123456789123456789",
-			statusCode:         fiber.StatusCreated,
+			payload:            `{"source_account_id": 7, "destination_account_id": 8, "amount": "0.123456789123456789", "currency": "SGD"}`,
+			expectedSrcBalance: "1000000000000000000.00",
+			expectedDstBalance: "0.00",
+			statusCode:         fiber.StatusBadRequest,
+		},
+		{
+			name:               "Destination account in another currency",
+			srcAccountID:       9,
+			dstAccountID:       10,
+			srcCurrency:        "SGD",
+			dstCurrency:        "USD",
+			initialSrcBalance:  "100.00",
+			initialDstBalance:  "0.00",
+			payload:            `{"source_account_id": 9, "destination_account_id": 10, "amount": "10.00", "currency": "SGD"}`,
+			expectedSrcBalance: "100.00",
+			expectedDstBalance: "0.00",
+			statusCode:         fiber.StatusBadRequest,
+		},
+		{
+			name:               "Transfer currency differs from both accounts",
+			srcAccountID:       11,
+			dstAccountID:       12,
+			srcCurrency:        "SGD",
+			dstCurrency:        "SGD",
+			initialSrcBalance:  "100.00",
+			initialDstBalance:  "0.00",
+			payload:            `{"source_account_id": 11, "destination_account_id": 12, "amount": "10.00", "currency": "EUR"}`,
+			expectedSrcBalance: "100.00",
+			expectedDstBalance: "0.00",
+			statusCode:         fiber.StatusBadRequest,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create initial accounts for this test
-			svr.DB.Create(&model.Account{ID: tt.srcAccountID, Balance: decimal.RequireFromString(tt.initialSrcBalance)})
-			svr.DB.Create(&model.Account{ID: tt.dstAccountID, Balance: decimal.RequireFromString(tt.initialDstBalance)})
+			svr.DB.Create(&model.Account{ID: tt.srcAccountID, Balance: decimal.RequireFromString(tt.initialSrcBalance), Currency: tt.srcCurrency})
+			svr.DB.Create(&model.Account{ID: tt.dstAccountID, Balance: decimal.RequireFromString(tt.initialDstBalance), Currency: tt.dstCurrency})
 
 			req := httptest.NewRequest("POST", "/transactions", strings.NewReader(tt.payload))
 			req.Header.Set("Content-Type", "application/json")
@@ -85,17 +121,15 @@ func TestCreateTransferEdgeCases(t *testing.T) {
 			require.NoError(t, err)
 			assert.Equal(t, tt.statusCode, resp.StatusCode)
 
-			if tt.statusCode == fiber.StatusCreated {
-				var srcAccount, dstAccount model.Account
-				svr.DB.First(&srcAccount, tt.srcAccountID)
-				svr.DB.First(&dstAccount, tt.dstAccountID)
+			var srcAccount, dstAccount model.Account
+			svr.DB.First(&srcAccount, tt.srcAccountID)
+			svr.DB.First(&dstAccount, tt.dstAccountID)
 
-				expectedSrcBalance, _ := decimal.NewFromString(tt.expectedSrcBalance)
-				expectedDstBalance, _ := decimal.NewFromString(tt.expectedDstBalance)
+			expectedSrcBalance, _ := decimal.NewFromString(tt.expectedSrcBalance)
+			expectedDstBalance, _ := decimal.NewFromString(tt.expectedDstBalance)
 
-				assert.True(t, expectedSrcBalance.Equal(srcAccount.Balance), "expected %v but got %v", expectedSrcBalance, srcAccount.Balance)
-				assert.True(t, expectedDstBalance.Equal(dstAccount.Balance), "expected %v but got %v", expectedDstBalance, dstAccount.Balance)
-			}
+			assert.True(t, expectedSrcBalance.Equal(srcAccount.Balance), "expected %v but got %v", expectedSrcBalance, srcAccount.Balance)
+			assert.True(t, expectedDstBalance.Equal(dstAccount.Balance), "expected %v but got %v", expectedDstBalance, dstAccount.Balance)
 		})
 	}
 }
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"internal-transfers-system/internal/apimodel"
+	"internal-transfers-system/internal/apiserver"
+	"internal-transfers-system/internal/model"
+	"internal-transfers-system/internal/service"
+	"internal-transfers-system/internal/webhook"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "test-webhook-secret"
+
+// webhookReceiver is an endpoint that records the webhooks it receives and answers with status.
+type webhookReceiver struct {
+	server *httptest.Server
+	status atomic.Int32
+
+	mu     sync.Mutex
+	events []apimodel.WebhookEvent
+	errors []error
+}
+
+func newWebhookReceiver(t *testing.T) *webhookReceiver {
+	receiver := &webhookReceiver{}
+	receiver.status.Store(http.StatusOK)
+	receiver.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		if err := webhook.Verify(testWebhookSecret, r.Header.Get(webhook.SignatureHeader), body, time.Minute, time.Now()); err != nil {
+			receiver.errors = append(receiver.errors, err)
+		}
+		var event apimodel.WebhookEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			receiver.errors = append(receiver.errors, err)
+		}
+		if r.Header.Get(webhook.EventIDHeader) != fmt.Sprint(event.ID) || r.Header.Get(webhook.EventTypeHeader) != event.Type {
+			receiver.errors = append(receiver.errors, fmt.Errorf("headers do not match event %d", event.ID))
+		}
+		receiver.events = append(receiver.events, event)
+
+		status := int(receiver.status.Load())
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(http.StatusText(status)))
+	}))
+	t.Cleanup(receiver.server.Close)
+	return receiver
+}
+
+func (r *webhookReceiver) received(t *testing.T) []apimodel.WebhookEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	require.Empty(t, r.errors)
+	return append([]apimodel.WebhookEvent(nil), r.events...)
+}
+
+func createTestWebhookSubscription(t *testing.T, app *fiber.App, payload string) apimodel.WebhookSubscriptionResponse {
+	req := httptest.NewRequest("POST", "/admin/webhooks/subscriptions", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var subscription apimodel.WebhookSubscriptionResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&subscription))
+	return subscription
+}
+
+func listTestWebhookDeliveries(t *testing.T, app *fiber.App, query string) []apimodel.WebhookDeliveryResponse {
+	resp, err := app.Test(httptest.NewRequest("GET", "/admin/webhooks/deliveries"+query, nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var list apimodel.WebhookDeliveryListResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	return list.Deliveries
+}
+
+func postTestJSON(t *testing.T, app *fiber.App, url string, payload string) *http.Response {
+	req := httptest.NewRequest("POST", url, strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func dispatchTestWebhooks(t *testing.T, svr *apiserver.Server, policy service.WebhookPolicy) int {
+	attempted, err := service.DispatchWebhooks(context.Background(), svr.DB, http.DefaultClient, policy)
+	require.NoError(t, err)
+	return attempted
+}
+
+// makeWebhooksDue makes every pending delivery due, skipping its backoff.
+func makeWebhooksDue(svr *apiserver.Server) {
+	svr.DB.Model(&model.WebhookDelivery{}).Where("status = ?", model.WebhookDeliveryStatusPending).
+		Update("next_attempt_at", time.Now().Add(-time.Second))
+}
+
+var testWebhookPolicy = service.WebhookPolicy{MaxAttempts: 3, BackoffBase: time.Minute, BackoffMax: time.Hour}
+
+func TestWebhookDelivery(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	receiver := newWebhookReceiver(t)
+	subscription := createTestWebhookSubscription(t, svr.FiberApp,
+		fmt.Sprintf(`{"url": "%s", "secret": "%s"}`, receiver.server.URL, testWebhookSecret))
+	assert.Equal(t, testWebhookSecret, subscription.Secret)
+	assert.Empty(t, subscription.EventTypes)
+
+	resp := postTestJSON(t, svr.FiberApp, "/accounts", `{"account_id": 1, "initial_balance": "100.00", "currency": "SGD"}`)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	resp = postTestJSON(t, svr.FiberApp, "/accounts", `{"account_id": 2, "initial_balance": "0", "currency": "SGD"}`)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	transfer := createTestTransfer(t, svr.FiberApp,
+		`{"source_account_id": 1, "destination_account_id": 2, "amount": "40.00", "currency": "SGD", "reference": "INV-1"}`)
+
+	// Nothing is sent until the dispatcher runs
+	assert.Empty(t, receiver.received(t))
+	assert.Equal(t, 5, dispatchTestWebhooks(t, svr, testWebhookPolicy))
+
+	events := receiver.received(t)
+	require.Len(t, events, 5)
+	assert.Equal(t, model.EventTypeAccountCreated, events[0].Type)
+	assert.Equal(t, model.EventTypeAccountCreated, events[1].Type)
+	assert.Equal(t, model.EventTypeTransferCreated, events[2].Type)
+	assert.Equal(t, model.EventTypeBalanceChanged, events[3].Type)
+	assert.Equal(t, model.EventTypeBalanceChanged, events[4].Type)
+
+	var account apimodel.AccountResponse
+	require.NoError(t, json.Unmarshal(events[0].Data, &account))
+	assert.Equal(t, uint64(1), account.AccountID)
+	assert.True(t, decimal.RequireFromString("100").Equal(decimal.RequireFromString(account.Balance)))
+
+	var transferred apimodel.TransferResponse
+	require.NoError(t, json.Unmarshal(events[2].Data, &transferred))
+	assert.Equal(t, transfer.ID, transferred.ID)
+	assert.Equal(t, "INV-1", transferred.Reference)
+	assert.True(t, decimal.RequireFromString("40").Equal(decimal.RequireFromString(transferred.Amount)))
+
+	var debited, credited apimodel.BalanceChangedEvent
+	require.NoError(t, json.Unmarshal(events[3].Data, &debited))
+	require.NoError(t, json.Unmarshal(events[4].Data, &credited))
+	assert.Equal(t, apimodel.BalanceChangedEvent{AccountID: 1, TransferID: transfer.ID, Currency: "SGD", Amount: "-40", Balance: "60"}, debited)
+	assert.Equal(t, apimodel.BalanceChangedEvent{AccountID: 2, TransferID: transfer.ID, Currency: "SGD", Amount: "40", Balance: "40"}, credited)
+
+	deliveries := listTestWebhookDeliveries(t, svr.FiberApp, "")
+	require.Len(t, deliveries, 5)
+	for _, delivery := range deliveries {
+		assert.Equal(t, model.WebhookDeliveryStatusDelivered, delivery.Status)
+		assert.Equal(t, 1, delivery.AttemptCount)
+		assert.NotNil(t, delivery.DeliveredAt)
+		assert.Nil(t, delivery.NextAttemptAt)
+		require.NotNil(t, delivery.LastStatusCode)
+		assert.Equal(t, http.StatusOK, *delivery.LastStatusCode)
+	}
+
+	// Delivered events are not sent again
+	assert.Equal(t, 0, dispatchTestWebhooks(t, svr, testWebhookPolicy))
+	assert.Len(t, receiver.received(t), 5)
+}
+
+func TestWebhookOutboxIsTransactional(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	svr.DB.Create(&model.Account{ID: 1, Balance: decimal.NewFromFloat(10.00), Currency: "SGD"})
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+
+	// Rejected transfers and accounts leave no event behind
+	resp := postTestJSON(t, svr.FiberApp, "/transfers", `{"source_account_id": 1, "destination_account_id": 2, "amount": "50.00", "currency": "SGD"}`)
+	require.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	resp = postTestJSON(t, svr.FiberApp, "/accounts", `{"account_id": 1, "initial_balance": "100.00", "currency": "SGD"}`)
+	require.NotEqual(t, fiber.StatusCreated, resp.StatusCode)
+
+	var count int64
+	svr.DB.Model(&model.OutboxEvent{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "5.00", "currency": "SGD"}`)
+	svr.DB.Model(&model.OutboxEvent{}).Where("type = ?", model.EventTypeTransferCreated).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestWebhookEventTypes(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	receiver := newWebhookReceiver(t)
+	transfers := createTestWebhookSubscription(t, svr.FiberApp,
+		fmt.Sprintf(`{"url": "%s", "secret": "%s", "event_types": ["transfer.created"]}`, receiver.server.URL, testWebhookSecret))
+	assert.Equal(t, []string{model.EventTypeTransferCreated}, transfers.EventTypes)
+
+	resp := postTestJSON(t, svr.FiberApp, "/accounts", `{"account_id": 1, "initial_balance": "100.00", "currency": "SGD"}`)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	svr.DB.Create(&model.Account{ID: 2, Balance: decimal.NewFromFloat(0), Currency: "SGD"})
+	createTestTransfer(t, svr.FiberApp, `{"source_account_id": 1, "destination_account_id": 2, "amount": "5.00", "currency": "SGD"}`)
+
+	assert.Equal(t, 1, dispatchTestWebhooks(t, svr, testWebhookPolicy))
+	events := receiver.received(t)
+	require.Len(t, events, 1)
+	assert.Equal(t, model.EventTypeTransferCreated, events[0].Type)
+
+	// A subscription only receives events written after it was created
+	createTestWebhookSubscription(t, svr.FiberApp, fmt.Sprintf(`{"url": "%s", "secret": "%s"}`, receiver.server.URL, testWebhookSecret))
+	assert.Equal(t, 0, dispatchTestWebhooks(t, svr, testWebhookPolicy))
+}
+
+func TestWebhookRetries(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	receiver := newWebhookReceiver(t)
+	receiver.status.Store(http.StatusServiceUnavailable)
+	subscription := createTestWebhookSubscription(t, svr.FiberApp,
+		fmt.Sprintf(`{"url": "%s", "secret": "%s"}`, receiver.server.URL, testWebhookSecret))
+
+	resp := postTestJSON(t, svr.FiberApp, "/accounts", `{"account_id": 1, "initial_balance": "100.00", "currency": "SGD"}`)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	// The first failure backs off by BackoffBase
+	before := time.Now()
+	assert.Equal(t, 1, dispatchTestWebhooks(t, svr, testWebhookPolicy))
+	deliveries := listTestWebhookDeliveries(t, svr.FiberApp, "")
+	require.Len(t, deliveries, 1)
+	delivery := deliveries[0]
+	assert.Equal(t, model.WebhookDeliveryStatusPending, delivery.Status)
+	assert.Equal(t, 1, delivery.AttemptCount)
+	require.NotNil(t, delivery.LastStatusCode)
+	assert.Equal(t, http.StatusServiceUnavailable, *delivery.LastStatusCode)
+	assert.Contains(t, delivery.LastError, "503")
+	require.NotNil(t, delivery.NextAttemptAt)
+	assert.WithinRange(t, *delivery.NextAttemptAt, before.Add(time.Minute), time.Now().Add(time.Minute))
+
+	// Not due yet
+	assert.Equal(t, 0, dispatchTestWebhooks(t, svr, testWebhookPolicy))
+
+	// The second failure waits twice as long
+	makeWebhooksDue(svr)
+	before = time.Now()
+	assert.Equal(t, 1, dispatchTestWebhooks(t, svr, testWebhookPolicy))
+	delivery = listTestWebhookDeliveries(t, svr.FiberApp, "")[0]
+	assert.Equal(t, 2, delivery.AttemptCount)
+	assert.WithinRange(t, *delivery.NextAttemptAt, before.Add(2*time.Minute), time.Now().Add(2*time.Minute))
+
+	// The last attempt dead-letters the delivery
+	makeWebhooksDue(svr)
+	assert.Equal(t, 1, dispatchTestWebhooks(t, svr, testWebhookPolicy))
+	delivery = listTestWebhookDeliveries(t, svr.FiberApp, "?status=dead")[0]
+	assert.Equal(t, 3, delivery.AttemptCount)
+	assert.Nil(t, delivery.NextAttemptAt)
+	assert.Empty(t, listTestWebhookDeliveries(t, svr.FiberApp, "?status=pending"))
+
+	makeWebhooksDue(svr)
+	assert.Equal(t, 0, dispatchTestWebhooks(t, svr, testWebhookPolicy))
+	assert.Len(t, receiver.received(t), 3)
+
+	// Once the endpoint is fixed, the dead delivery is replayed with a fresh set of attempts
+	receiver.status.Store(http.StatusNoContent)
+	resp = postTestJSON(t, svr.FiberApp, fmt.Sprintf("/admin/webhooks/deliveries/%d/replay", delivery.ID), "")
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var replayed apimodel.WebhookDeliveryResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&replayed))
+	assert.Equal(t, model.WebhookDeliveryStatusPending, replayed.Status)
+	assert.Equal(t, 0, replayed.AttemptCount)
+
+	assert.Equal(t, 1, dispatchTestWebhooks(t, svr, testWebhookPolicy))
+	delivery = listTestWebhookDeliveries(t, svr.FiberApp, fmt.Sprintf("?subscription_id=%d", subscription.ID))[0]
+	assert.Equal(t, model.WebhookDeliveryStatusDelivered, delivery.Status)
+	assert.Equal(t, 1, delivery.AttemptCount)
+	assert.Len(t, receiver.received(t), 4)
+}
+
+func TestWebhookUnreachableEndpoint(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	receiver := newWebhookReceiver(t)
+	url := receiver.server.URL
+	receiver.server.Close()
+	createTestWebhookSubscription(t, svr.FiberApp, fmt.Sprintf(`{"url": "%s"}`, url))
+
+	resp := postTestJSON(t, svr.FiberApp, "/accounts", `{"account_id": 1, "initial_balance": "100.00", "currency": "SGD"}`)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	// Without a backoff, every attempt is made in the same run
+	policy := service.WebhookPolicy{MaxAttempts: 2}
+	assert.Equal(t, 2, dispatchTestWebhooks(t, svr, policy))
+	delivery := listTestWebhookDeliveries(t, svr.FiberApp, "")[0]
+	assert.Equal(t, model.WebhookDeliveryStatusDead, delivery.Status)
+	assert.Nil(t, delivery.LastStatusCode)
+	assert.NotEmpty(t, delivery.LastError)
+}
+
+func TestWebhookSlowEndpoint(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	// The slow endpoint answers once it is released, and checks that its delivery is not locked while it is sent
+	started, release := make(chan struct{}), make(chan struct{})
+	var locked atomic.Bool
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := svr.DB.Exec("SELECT id FROM webhook_deliveries WHERE status = 'pending' FOR UPDATE NOWAIT").Error
+		locked.Store(err != nil)
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slow.Close()
+	fast := newWebhookReceiver(t)
+
+	slowSubscription := createTestWebhookSubscription(t, svr.FiberApp, fmt.Sprintf(`{"url": "%s"}`, slow.URL))
+	fastSubscription := createTestWebhookSubscription(t, svr.FiberApp,
+		fmt.Sprintf(`{"url": "%s", "secret": "%s"}`, fast.server.URL, testWebhookSecret))
+	resp := postTestJSON(t, svr.FiberApp, "/accounts", `{"account_id": 1, "initial_balance": "100.00", "currency": "SGD"}`)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	attempted := make(chan int)
+	go func() {
+		count, _ := service.DispatchWebhooks(context.Background(), svr.DB, http.DefaultClient, testWebhookPolicy)
+		attempted <- count
+	}()
+
+	<-started
+	assert.False(t, locked.Load())
+	// The fast endpoint gets its webhook, and the outcome is recorded, while the slow one is still being sent
+	assert.Eventually(t, func() bool {
+		deliveries := listTestWebhookDeliveries(t, svr.FiberApp, fmt.Sprintf("?subscription_id=%d", fastSubscription.ID))
+		return len(deliveries) == 1 && deliveries[0].Status == model.WebhookDeliveryStatusDelivered
+	}, 5*time.Second, 10*time.Millisecond)
+	slowDelivery := listTestWebhookDeliveries(t, svr.FiberApp, fmt.Sprintf("?subscription_id=%d", slowSubscription.ID))[0]
+	assert.Equal(t, model.WebhookDeliveryStatusPending, slowDelivery.Status)
+	assert.Equal(t, 0, slowDelivery.AttemptCount)
+
+	close(release)
+	assert.Equal(t, 2, <-attempted)
+	slowDelivery = listTestWebhookDeliveries(t, svr.FiberApp, fmt.Sprintf("?subscription_id=%d", slowSubscription.ID))[0]
+	assert.Equal(t, model.WebhookDeliveryStatusDelivered, slowDelivery.Status)
+	assert.Len(t, fast.received(t), 1)
+}
+
+func TestReplayWebhookEvent(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	receiver := newWebhookReceiver(t)
+	accounts := createTestWebhookSubscription(t, svr.FiberApp,
+		fmt.Sprintf(`{"url": "%s", "secret": "%s", "event_types": ["account.created"]}`, receiver.server.URL, testWebhookSecret))
+	transfers := createTestWebhookSubscription(t, svr.FiberApp,
+		fmt.Sprintf(`{"url": "%s", "secret": "%s", "event_types": ["transfer.created"]}`, receiver.server.URL, testWebhookSecret))
+
+	resp := postTestJSON(t, svr.FiberApp, "/accounts", `{"account_id": 1, "initial_balance": "100.00", "currency": "SGD"}`)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+
+	var event model.OutboxEvent
+	require.NoError(t, svr.DB.Take(&event).Error)
+	replayURL := fmt.Sprintf("/admin/webhooks/events/%d/replay", event.ID)
+
+	// Not picked up by the dispatcher yet
+	resp = postTestJSON(t, svr.FiberApp, replayURL, "")
+	assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+
+	assert.Equal(t, 1, dispatchTestWebhooks(t, svr, testWebhookPolicy))
+
+	// Without a subscription, the event goes to every subscription to its type
+	resp = postTestJSON(t, svr.FiberApp, replayURL, "")
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	var list apimodel.WebhookDeliveryListResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	require.Len(t, list.Deliveries, 1)
+	assert.Equal(t, accounts.ID, list.Deliveries[0].SubscriptionID)
+
+	// A named subscription gets the event even if it is not subscribed to its type
+	resp = postTestJSON(t, svr.FiberApp, replayURL, fmt.Sprintf(`{"subscription_id": %d}`, transfers.ID))
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	require.Len(t, list.Deliveries, 1)
+	assert.Equal(t, transfers.ID, list.Deliveries[0].SubscriptionID)
+
+	assert.Equal(t, 2, dispatchTestWebhooks(t, svr, testWebhookPolicy))
+	events := receiver.received(t)
+	require.Len(t, events, 3)
+	for _, received := range events {
+		assert.Equal(t, event.ID, received.ID)
+	}
+	assert.Len(t, listTestWebhookDeliveries(t, svr.FiberApp, fmt.Sprintf("?event_id=%d", event.ID)), 3)
+
+	resp = postTestJSON(t, svr.FiberApp, replayURL, `{"subscription_id": 99}`)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	resp = postTestJSON(t, svr.FiberApp, "/admin/webhooks/events/99/replay", "")
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	resp = postTestJSON(t, svr.FiberApp, "/admin/webhooks/deliveries/99/replay", "")
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+}
+
+func TestWebhookSubscriptions(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	// A secret is generated when none is given
+	subscription := createTestWebhookSubscription(t, svr.FiberApp, `{"url": "https://example.com/hooks"}`)
+	assert.True(t, strings.HasPrefix(subscription.Secret, "whsec_"))
+
+	resp, err := svr.FiberApp.Test(httptest.NewRequest("GET", "/admin/webhooks/subscriptions", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var list apimodel.WebhookSubscriptionListResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	require.Len(t, list.Subscriptions, 1)
+	assert.Equal(t, subscription.ID, list.Subscriptions[0].ID)
+	assert.Empty(t, list.Subscriptions[0].Secret)
+
+	tests := []struct {
+		name       string
+		payload    string
+		statusCode int
+	}{
+		{"Missing URL", `{}`, fiber.StatusBadRequest},
+		{"Relative URL", `{"url": "/hooks"}`, fiber.StatusBadRequest},
+		{"Unsupported scheme", `{"url": "ftp://example.com/hooks"}`, fiber.StatusBadRequest},
+		{"Unknown event type", `{"url": "https://example.com/hooks", "event_types": ["account.deleted"]}`, fiber.StatusBadRequest},
+		{"Short secret", `{"url": "https://example.com/hooks", "secret": "short"}`, fiber.StatusBadRequest},
+		{"Malformed body", `{"url": `, fiber.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := postTestJSON(t, svr.FiberApp, "/admin/webhooks/subscriptions", tt.payload)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+
+	resp, err = svr.FiberApp.Test(httptest.NewRequest("GET", "/admin/webhooks/deliveries?status=failed", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+	resp, err = svr.FiberApp.Test(httptest.NewRequest("DELETE", fmt.Sprintf("/admin/webhooks/subscriptions/%d", subscription.ID), nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNoContent, resp.StatusCode)
+	resp, err = svr.FiberApp.Test(httptest.NewRequest("DELETE", fmt.Sprintf("/admin/webhooks/subscriptions/%d", subscription.ID), nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+}
+
+func TestWebhookDeliveriesInOrder(t *testing.T) {
+	svr := setupTestServer()
+	defer teardownTestServer(svr)
+
+	receiver := newWebhookReceiver(t)
+	receiver.status.Store(http.StatusServiceUnavailable)
+	createTestWebhookSubscription(t, svr.FiberApp,
+		fmt.Sprintf(`{"url": "%s", "secret": "%s"}`, receiver.server.URL, testWebhookSecret))
+
+	resp := postTestJSON(t, svr.FiberApp, "/accounts", `{"account_id": 1, "initial_balance": "100.00", "currency": "SGD"}`)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	assert.Equal(t, 1, dispatchTestWebhooks(t, svr, testWebhookPolicy))
+
+	// The next event is due straight away, but waits for the failed delivery before it to back off and be delivered
+	receiver.status.Store(http.StatusOK)
+	resp = postTestJSON(t, svr.FiberApp, "/accounts", `{"account_id": 2, "initial_balance": "0", "currency": "SGD"}`)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	assert.Equal(t, 0, dispatchTestWebhooks(t, svr, testWebhookPolicy))
+	assert.Len(t, listTestWebhookDeliveries(t, svr.FiberApp, "?status=pending"), 2)
+
+	makeWebhooksDue(svr)
+	assert.Equal(t, 2, dispatchTestWebhooks(t, svr, testWebhookPolicy))
+	events := receiver.received(t)
+	require.Len(t, events, 3)
+	assert.Equal(t, events[0].ID, events[1].ID)
+	assert.Less(t, events[1].ID, events[2].ID)
+	assert.Empty(t, listTestWebhookDeliveries(t, svr.FiberApp, "?status=pending"))
+}